@@ -0,0 +1,212 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+
+	dbExportCmd.Flags().StringP("file", "f", "", "Path to write the export to, standard output if not set")
+	dbCmd.AddCommand(dbExportCmd)
+
+	dbImportCmd.Flags().StringP("file", "f", "", "Path of the export to import")
+	if err := dbImportCmd.MarkFlagRequired("file"); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	dbCmd.AddCommand(dbImportCmd)
+
+	dbBackupCmd.Flags().StringP("file", "f", "", "Path to write the backup to")
+	if err := dbBackupCmd.MarkFlagRequired("file"); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	dbCmd.AddCommand(dbBackupCmd)
+
+	dbMigrateCmd.Flags().String("from", "", "Path of the configuration of the database to copy")
+	if err := dbMigrateCmd.MarkFlagRequired("from"); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	dbMigrateCmd.Flags().String("to", "", "Path of the configuration of the empty database to copy to")
+	if err := dbMigrateCmd.MarkFlagRequired("to"); err != nil {
+		log.Fatal().Err(err).Msg("")
+	}
+	dbCmd.AddCommand(dbMigrateCmd)
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Back up, export, import and migrate the database",
+}
+
+var dbExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the database to a portable file",
+	Long: `
+	Exports the users, nodes, pre auth keys, API key hashes, policies and the tailnet lock state
+	as newline delimited JSON, which can be imported into a sqlite or postgres database with "db import".
+	The export is made in a single transaction, headscale does not have to be stopped.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		path, _ := cmd.Flags().GetString("file")
+
+		hsdb, err := openDatabaseWithConfig()
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error opening the database: %s", err), output)
+		}
+
+		var w io.Writer = os.Stdout
+		if path != "" {
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+			if err != nil {
+				ErrorOutput(err, fmt.Sprintf("Error creating the export file: %s", err), output)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		counts, err := hsdb.Export(w)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error exporting the database: %s", err), output)
+		}
+
+		// The export itself is written to standard output without a path.
+		if path == "" {
+			return
+		}
+
+		SuccessOutput(counts, "Exported "+formatTableCounts(counts), output)
+	},
+}
+
+var dbImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import an export into an empty database",
+	Long: `
+	Imports a file written by "db export" into the configured database, which must be empty.
+	The database is migrated to the schema of this version of headscale before the import.
+	Headscale must not be running.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		path, _ := cmd.Flags().GetString("file")
+
+		f, err := os.Open(path)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error opening the export file: %s", err), output)
+		}
+		defer f.Close()
+
+		hsdb, err := openDatabaseWithConfig()
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error opening the database: %s", err), output)
+		}
+
+		counts, err := hsdb.Import(f)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error importing the database: %s", err), output)
+		}
+
+		SuccessOutput(counts, "Imported "+formatTableCounts(counts), output)
+	},
+}
+
+var dbBackupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up the sqlite database while headscale is running",
+	Long: `
+	Writes a consistent copy of the sqlite database to the given path, which must not exist.
+	Headscale does not have to be stopped. For postgres, use pg_dump.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		path, _ := cmd.Flags().GetString("file")
+
+		cfg, err := types.LoadServerConfig()
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error loading the configuration: %s", err), output)
+		}
+
+		if err := db.Backup(cfg.Database, path); err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error backing up the database: %s", err), output)
+		}
+
+		SuccessOutput(map[string]string{"path": path}, "Database backed up to "+path, output)
+	},
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Copy the database to another database, for example from sqlite to postgres",
+	Long: `
+	Copies all rows of the database configured in --from to the database configured in --to,
+	which must be empty. Only the database section of the configuration files is used.
+	Both databases are migrated to the schema of this version of headscale before the copy,
+	and the number of rows and the checksums of all tables are compared afterwards.
+	Headscale must not be running.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+
+		src, err := openDatabaseFromConfigFile(from)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error opening the source database: %s", err), output)
+		}
+
+		dst, err := openDatabaseFromConfigFile(to)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error opening the destination database: %s", err), output)
+		}
+
+		tables, err := db.MigrateDatabase(src, dst)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error migrating the database: %s", err), output)
+		}
+
+		counts := make(map[string]int, len(tables))
+		for _, table := range tables {
+			counts[table.Table] = int(table.Rows)
+		}
+
+		SuccessOutput(tables, "Migrated and verified "+formatTableCounts(counts), output)
+	},
+}
+
+// openDatabaseFromConfigFile opens the database of the configuration file
+// at path, and runs the migrations.
+func openDatabaseFromConfigFile(path string) (*db.HSDatabase, error) {
+	cfg, err := types.LoadDatabaseConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading configuration %q: %w", path, err)
+	}
+
+	return db.NewHeadscaleDatabase(cfg, "", nil)
+}
+
+// openDatabaseWithConfig opens the database of the configuration, and runs
+// the migrations.
+func openDatabaseWithConfig() (*db.HSDatabase, error) {
+	cfg, err := types.LoadServerConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading configuration: %w", err)
+	}
+
+	return db.NewHeadscaleDatabase(cfg.Database, cfg.BaseDomain, nil)
+}
+
+func formatTableCounts(counts map[string]int) string {
+	rows := make([]string, 0, len(counts))
+	for _, table := range slices.Sorted(maps.Keys(counts)) {
+		rows = append(rows, fmt.Sprintf("%s: %d", table, counts[table]))
+	}
+
+	return strings.Join(rows, ", ")
+}
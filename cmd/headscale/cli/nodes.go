@@ -1,16 +1,23 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/netip"
+	"os"
+	"os/signal"
 	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	survey "github.com/AlecAivazis/survey/v2"
 	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
@@ -22,6 +29,10 @@ func init() {
 	rootCmd.AddCommand(nodeCmd)
 	listNodesCmd.Flags().StringP("user", "u", "", "Filter by user")
 	listNodesCmd.Flags().BoolP("tags", "t", false, "Show tags")
+	listNodesCmd.Flags().Bool("health", false, "Show health warnings, preferred DERP region and NAT type")
+	listNodesCmd.Flags().Bool("unhealthy", false, "Only list nodes with health warnings")
+	listNodesCmd.Flags().String("health-warning", "", "Only list nodes with a health warning of a subsystem containing this text, e.g. dns")
+	listNodesCmd.Flags().String("nat", "", "Only list nodes behind this type of NAT: easy, hard, no-udp or unknown")
 
 	listNodesCmd.Flags().StringP("namespace", "n", "", "User")
 	listNodesNamespaceFlag := listNodesCmd.Flags().Lookup("namespace")
@@ -29,6 +40,9 @@ func init() {
 	listNodesNamespaceFlag.Hidden = true
 	nodeCmd.AddCommand(listNodesCmd)
 
+	watchNodesCmd.Flags().StringP("user", "u", "", "Filter by user")
+	nodeCmd.AddCommand(watchNodesCmd)
+
 	listNodeRoutesCmd.Flags().Uint64P("identifier", "i", 0, "Node identifier (ID)")
 	nodeCmd.AddCommand(listNodeRoutesCmd)
 
@@ -102,6 +116,10 @@ func init() {
 	nodeCmd.AddCommand(approveRoutesCmd)
 
 	nodeCmd.AddCommand(backfillNodeIPsCmd)
+
+	pingNodeCmd.Flags().String("target", "", "IP the node pings instead of answering the ping itself")
+	pingNodeCmd.Flags().String("type", "disco", "Type of ping of the target: disco, TSMP or peerapi, or c2n without a target")
+	nodeCmd.AddCommand(pingNodeCmd)
 }
 
 var nodeCmd = &cobra.Command{
@@ -170,6 +188,16 @@ var listNodesCmd = &cobra.Command{
 		if err != nil {
 			ErrorOutput(err, fmt.Sprintf("Error getting tags flag: %s", err), output)
 		}
+		showHealth, _ := cmd.Flags().GetBool("health")
+
+		var filter nodeFilter
+		filter.unhealthy, _ = cmd.Flags().GetBool("unhealthy")
+		filter.healthWarning, _ = cmd.Flags().GetString("health-warning")
+		filter.nat, _ = cmd.Flags().GetString("nat")
+		if filter.nat != "" && !slices.Contains(natTypes, filter.nat) {
+			err := fmt.Errorf("invalid NAT type %q", filter.nat)
+			ErrorOutput(err, fmt.Sprintf("%s, must be one of: %s", err, strings.Join(natTypes, ", ")), output)
+		}
 
 		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
 		defer cancel()
@@ -188,11 +216,13 @@ var listNodesCmd = &cobra.Command{
 			)
 		}
 
+		nodes := filter.apply(response.GetNodes())
+
 		if output != "" {
-			SuccessOutput(response.GetNodes(), "", output)
+			SuccessOutput(nodes, "", output)
 		}
 
-		tableData, err := nodesToPtables(user, showTags, response.GetNodes())
+		tableData, err := nodesToPtables(user, showTags, showHealth, nodes)
 		if err != nil {
 			ErrorOutput(err, fmt.Sprintf("Error converting to table: %s", err), output)
 		}
@@ -208,6 +238,126 @@ var listNodesCmd = &cobra.Command{
 	},
 }
 
+var watchNodesCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Watch nodes being added, removed, changed and going online or offline",
+	Long: `Watch nodes being added, removed, changed and going online or offline.
+
+The nodes known when starting to watch are printed as added first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		user, err := cmd.Flags().GetString("user")
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Error getting user: %s", err), output)
+		}
+
+		_, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		// The CLI timeout only applies to connecting, the nodes are
+		// watched until interrupted.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		stream, err := client.WatchNodes(ctx, &v1.WatchNodesRequest{User: user})
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Cannot watch nodes: %s", status.Convert(err).Message()),
+				output,
+			)
+		}
+
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				if ctx.Err() != nil || errors.Is(err, io.EOF) {
+					return
+				}
+
+				ErrorOutput(
+					err,
+					fmt.Sprintf("Stopped watching nodes: %s", status.Convert(err).Message()),
+					output,
+				)
+			}
+
+			fmt.Println(watchNodesOutput(event, output))
+		}
+	},
+}
+
+func watchNodesOutput(event *v1.WatchNodesResponse, outputFormat string) string {
+	typ := strings.ToLower(strings.TrimPrefix(event.GetType().String(), "NODE_EVENT_TYPE_"))
+
+	line := fmt.Sprintf("%s\t%s\t%d", time.Now().Format(HeadscaleDateTimeFormat), typ, event.GetNodeId())
+	if node := event.GetNode(); node != nil {
+		line += fmt.Sprintf("\t%s\t%s", node.GetGivenName(), node.GetUser().GetName())
+	}
+
+	return output(event, line, outputFormat)
+}
+
+var pingNodeCmd = &cobra.Command{
+	Use:   "ping ID",
+	Short: "Check that a node is reachable through its map session",
+	Long: `Check that a node is reachable through its map session.
+
+Without a target, the node answers the ping itself, which tells that it
+is connected and responsive. With --type c2n, the node answers through
+its c2n (control to node) handler instead. With a target, the node pings
+the target and reports how it reached it: direct, derp or peerapi.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		target, _ := cmd.Flags().GetString("target")
+		pingType, _ := cmd.Flags().GetString("type")
+
+		identifier, err := strconv.ParseUint(args[0], util.Base10, 64)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Invalid node ID %q: %s", args[0], err), output)
+		}
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		request := &v1.PingNodeRequest{
+			NodeId: identifier,
+			Target: target,
+		}
+		if target != "" || cmd.Flags().Changed("type") {
+			request.Type = pingType
+		}
+
+		response, err := client.PingNode(ctx, request)
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Cannot ping node: %s", status.Convert(err).Message()),
+				output,
+			)
+		}
+
+		SuccessOutput(response, pingNodeOutput(identifier, response), output)
+	},
+}
+
+func pingNodeOutput(identifier uint64, response *v1.PingNodeResponse) string {
+	latency := time.Duration(response.GetLatencySeconds() * float64(time.Second))
+
+	via := response.GetPath()
+	switch {
+	case response.GetEndpoint() != "":
+		via += " " + response.GetEndpoint()
+	case response.GetDerpRegionCode() != "":
+		via += fmt.Sprintf(" %s (%d)", response.GetDerpRegionCode(), response.GetDerpRegionId())
+	}
+
+	return fmt.Sprintf("pong from node %d via %s in %s", identifier, via, latency.Round(time.Microsecond))
+}
+
 var listNodeRoutesCmd = &cobra.Command{
 	Use:     "list-routes",
 	Short:   "List routes available on nodes",
@@ -577,9 +727,48 @@ be assigned to nodes.`,
 	},
 }
 
+// natTypes are the NAT types nodes can be filtered by, unknown matches
+// the nodes which have not reported their NAT type.
+var natTypes = []string{types.NATTypeEasy, types.NATTypeHard, types.NATTypeNoUDP, "unknown"}
+
+// nodeFilter selects the nodes to list by their health.
+type nodeFilter struct {
+	unhealthy     bool
+	healthWarning string
+	nat           string
+}
+
+func (f nodeFilter) apply(nodes []*v1.Node) []*v1.Node {
+	return slices.DeleteFunc(nodes, func(node *v1.Node) bool {
+		return !f.match(node)
+	})
+}
+
+func (f nodeFilter) match(node *v1.Node) bool {
+	if f.unhealthy && len(node.GetHealthWarnings()) == 0 {
+		return false
+	}
+
+	if f.healthWarning != "" && !slices.ContainsFunc(node.GetHealthWarnings(), func(warning *v1.HealthWarning) bool {
+		return strings.Contains(warning.GetSubsystem(), f.healthWarning)
+	}) {
+		return false
+	}
+
+	switch f.nat {
+	case "":
+		return true
+	case "unknown":
+		return node.GetNatType() == ""
+	default:
+		return node.GetNatType() == f.nat
+	}
+}
+
 func nodesToPtables(
 	currentUser string,
 	showTags bool,
+	showHealth bool,
 	nodes []*v1.Node,
 ) (pterm.TableData, error) {
 	tableHeader := []string{
@@ -603,6 +792,13 @@ func nodesToPtables(
 			"ValidTags",
 		}...)
 	}
+	if showHealth {
+		tableHeader = append(tableHeader, []string{
+			"Health",
+			"DERP",
+			"NAT",
+		}...)
+	}
 	tableData := pterm.TableData{tableHeader}
 
 	for _, node := range nodes {
@@ -712,6 +908,9 @@ func nodesToPtables(
 		if showTags {
 			nodeData = append(nodeData, []string{forcedTags, invalidTags, validTags}...)
 		}
+		if showHealth {
+			nodeData = append(nodeData, nodeHealthColumns(node)...)
+		}
 		tableData = append(
 			tableData,
 			nodeData,
@@ -721,6 +920,32 @@ func nodesToPtables(
 	return tableData, nil
 }
 
+func nodeHealthColumns(node *v1.Node) []string {
+	var warnings []string
+	for _, warning := range node.GetHealthWarnings() {
+		warnings = append(warnings, pterm.LightRed(warning.GetSubsystem()))
+	}
+	health := strings.Join(warnings, ",")
+	if health == "" {
+		health = pterm.LightGreen("ok")
+	}
+
+	var derp string
+	if node.GetPreferredDerp() != 0 {
+		derp = strconv.Itoa(int(node.GetPreferredDerp()))
+	}
+
+	nat := node.GetNatType()
+	switch nat {
+	case types.NATTypeEasy:
+		nat = pterm.LightGreen(nat)
+	case types.NATTypeHard, types.NATTypeNoUDP:
+		nat = pterm.LightRed(nat)
+	}
+
+	return []string{health, derp, nat}
+}
+
 func nodeRoutesToPtables(
 	nodes []*v1.Node,
 ) (pterm.TableData, error) {
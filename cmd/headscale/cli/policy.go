@@ -1,24 +1,59 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
 
 	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/pterm/pterm"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
+// policyRevisionHeader is prepended to the policy by "policy get
+// --with-revision" so that "policy set" can detect if the policy was
+// changed in the meantime.
+const policyRevisionHeader = "// headscale policy revision: "
+
 func init() {
 	rootCmd.AddCommand(policyCmd)
+	getPolicy.Flags().Bool("with-revision", false, "Start the policy with a comment holding its revision, used by \"policy set\"")
 	policyCmd.AddCommand(getPolicy)
 
 	setPolicy.Flags().StringP("file", "f", "", "Path to a policy file in HuJSON format")
+	setPolicy.Flags().Bool("dry-run", false, "Show how the policy would affect the nodes without applying it")
+	setPolicy.Flags().StringP("message", "m", "", "Message describing the change, kept in the policy history")
+	setPolicy.Flags().Uint64("revision", 0, "Revision the policy is based on, 0 if there is no policy yet, read from the file if not set")
+	setPolicy.Flags().Bool("force", false, "Overwrite the policy even if it was changed since it was fetched")
 	if err := setPolicy.MarkFlagRequired("file"); err != nil {
 		log.Fatal().Err(err).Msg("")
 	}
 	policyCmd.AddCommand(setPolicy)
+
+	checkPolicy.Flags().String("src", "", "Source IP address or node name")
+	checkPolicy.Flags().String("dst", "", "Destination IP address or node name")
+	checkPolicy.Flags().Uint32("port", 0, "Destination port")
+	checkPolicy.Flags().String("proto", "tcp", "Protocol name or number, e.g. tcp, udp or icmp")
+	for _, flag := range []string{"src", "dst", "port"} {
+		if err := checkPolicy.MarkFlagRequired(flag); err != nil {
+			log.Fatal().Err(err).Msg("")
+		}
+	}
+	policyCmd.AddCommand(checkPolicy)
+
+	policyCmd.AddCommand(policyHistory)
+
+	rollbackPolicy.Flags().StringP("message", "m", "", "Message describing the rollback, kept in the policy history")
+	policyCmd.AddCommand(rollbackPolicy)
+
+	migratePolicy.Flags().StringP("file", "f", "", "Path to a v1 policy file, the current policy is used if not set")
+	policyCmd.AddCommand(migratePolicy)
 }
 
 var policyCmd = &cobra.Command{
@@ -46,6 +81,10 @@ var getPolicy = &cobra.Command{
 		// TODO(pallabpain): Maybe print this better?
 		// This does not pass output as we dont support yaml, json or json-line
 		// output for this command. It is HuJSON already.
+		if withRevision, _ := cmd.Flags().GetBool("with-revision"); withRevision && response.GetRevision() != 0 {
+			SuccessOutput("", fmt.Sprintf("%s%d\n%s", policyRevisionHeader, response.GetRevision(), response.GetPolicy()), "")
+		}
+
 		SuccessOutput("", response.GetPolicy(), "")
 	},
 }
@@ -55,7 +94,9 @@ var setPolicy = &cobra.Command{
 	Short: "Updates the ACL Policy",
 	Long: `
 	Updates the existing ACL Policy with the provided policy. The policy must be a valid HuJSON object.
-	This command only works when the acl.policy_mode is set to "db", and the policy will be stored in the database.`,
+	This command only works when the acl.policy_mode is set to "db", and the policy will be stored in the database.
+	With --dry-run, the policy is not applied, instead the changes it would cause for each node are shown.
+	If the file was written by "policy get --with-revision", the update is rejected when the policy was changed since.`,
 	Aliases: []string{"put", "update"},
 	Run: func(cmd *cobra.Command, args []string) {
 		output, _ := cmd.Flags().GetString("output")
@@ -72,12 +113,35 @@ var setPolicy = &cobra.Command{
 			ErrorOutput(err, fmt.Sprintf("Error reading the policy file: %s", err), output)
 		}
 
-		request := &v1.SetPolicyRequest{Policy: string(policyBytes)}
+		policy, baseRevision := splitPolicyRevision(string(policyBytes))
+		if cmd.Flags().Changed("revision") {
+			revision, _ := cmd.Flags().GetUint64("revision")
+			baseRevision = &revision
+		}
+		if force, _ := cmd.Flags().GetBool("force"); force {
+			baseRevision = nil
+		}
 
 		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
 		defer cancel()
 		defer conn.Close()
 
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			response, err := client.DiffPolicy(ctx, &v1.DiffPolicyRequest{Policy: policy})
+			if err != nil {
+				ErrorOutput(err, fmt.Sprintf("Failed to compare ACL Policy: %s", err), output)
+			}
+
+			SuccessOutput(response, formatPolicyDiff(response.GetNodes()), output)
+		}
+
+		message, _ := cmd.Flags().GetString("message")
+		request := &v1.SetPolicyRequest{
+			Policy:       policy,
+			Message:      message,
+			BaseRevision: baseRevision,
+		}
+
 		if _, err := client.SetPolicy(ctx, request); err != nil {
 			ErrorOutput(err, fmt.Sprintf("Failed to set ACL Policy: %s", err), output)
 		}
@@ -85,3 +149,304 @@ var setPolicy = &cobra.Command{
 		SuccessOutput(nil, "Policy updated.", "")
 	},
 }
+
+var checkPolicy = &cobra.Command{
+	Use:   "check",
+	Short: "Check if the ACL Policy allows a source to reach a destination",
+	Long: `
+	Checks if the current ACL Policy allows the source to reach the destination on the given
+	port and protocol, and prints the ACL or grant allowing it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		src, _ := cmd.Flags().GetString("src")
+		dst, _ := cmd.Flags().GetString("dst")
+		port, _ := cmd.Flags().GetUint32("port")
+		proto, _ := cmd.Flags().GetString("proto")
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		request := &v1.CheckAccessRequest{
+			Source:      src,
+			Destination: dst,
+			Port:        port,
+			Protocol:    proto,
+		}
+
+		response, err := client.CheckAccess(ctx, request)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Failed to check access: %s", err), output)
+		}
+
+		if !response.GetAllowed() {
+			SuccessOutput(response, fmt.Sprintf("%s cannot reach %s on %s/%d", src, dst, proto, port), output)
+		}
+
+		result := fmt.Sprintf("%s can reach %s on %s/%d", src, dst, proto, port)
+		if response.GetSection() != "" {
+			result += fmt.Sprintf(", allowed by %s[%d]", response.GetSection(), response.GetIndex())
+		}
+
+		SuccessOutput(response, result, output)
+	},
+}
+
+var policyHistory = &cobra.Command{
+	Use:   "history [revision]",
+	Short: "List the revisions of the ACL Policy",
+	Long: `
+	Lists the revisions of the ACL Policy stored in the database, newest first.
+	When a revision is given, the changes it made to the previous revision are shown.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		response, err := client.ListPolicyRevisions(ctx, &v1.ListPolicyRevisionsRequest{})
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Failed to list ACL Policy revisions: %s", err), output)
+		}
+
+		revisions := response.GetRevisions()
+
+		if len(args) == 1 {
+			revision, err := strconv.ParseUint(args[0], util.Base10, 64)
+			if err != nil {
+				ErrorOutput(err, fmt.Sprintf("Invalid revision %q: %s", args[0], err), output)
+			}
+
+			// Revisions are sorted newest first, so the previous
+			// revision is the next one in the list.
+			for index, rev := range revisions {
+				if rev.GetRevision() != revision {
+					continue
+				}
+
+				var previous *v1.PolicyRevision
+				if index+1 < len(revisions) {
+					previous = revisions[index+1]
+				}
+
+				SuccessOutput(rev, policyRevisionDiff(previous, rev), output)
+			}
+
+			ErrorOutput(
+				fmt.Errorf("revision %d not found", revision),
+				fmt.Sprintf("Revision %d not found", revision),
+				output,
+			)
+		}
+
+		if output != "" {
+			SuccessOutput(revisions, "", output)
+		}
+
+		tableData := pterm.TableData{
+			{"Revision", "Author", "Message", "Created"},
+		}
+		for _, rev := range revisions {
+			tableData = append(tableData, []string{
+				strconv.FormatUint(rev.GetRevision(), util.Base10),
+				rev.GetAuthor(),
+				rev.GetMessage(),
+				rev.GetCreatedAt().AsTime().Format(HeadscaleDateTimeFormat),
+			})
+		}
+		err = pterm.DefaultTable.WithHasHeader().WithData(tableData).Render()
+		if err != nil {
+			ErrorOutput(
+				err,
+				fmt.Sprintf("Failed to render pterm table: %s", err),
+				output,
+			)
+		}
+	},
+}
+
+var rollbackPolicy = &cobra.Command{
+	Use:   "rollback <revision>",
+	Short: "Restore a previous revision of the ACL Policy",
+	Long: `
+	Restores the ACL Policy of the given revision by storing it as a new revision.
+	The changes compared to the current policy are shown before it is applied.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		message, _ := cmd.Flags().GetString("message")
+
+		revision, err := strconv.ParseUint(args[0], util.Base10, 64)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Invalid revision %q: %s", args[0], err), output)
+		}
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		current, err := client.GetPolicy(ctx, &v1.GetPolicyRequest{})
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Failed loading ACL Policy: %s", err), output)
+		}
+
+		target, err := client.GetPolicyRevision(ctx, &v1.GetPolicyRevisionRequest{Revision: revision})
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Failed loading ACL Policy revision: %s", err), output)
+		}
+
+		response, err := client.RollbackPolicy(ctx, &v1.RollbackPolicyRequest{
+			Revision: revision,
+			Message:  message,
+		})
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Failed to roll back ACL Policy: %s", err), output)
+		}
+
+		diff := policyRevisionDiff(&v1.PolicyRevision{Policy: current.GetPolicy()}, target.GetRevision())
+		SuccessOutput(
+			response.GetRevision(),
+			fmt.Sprintf("%s\nPolicy rolled back to revision %d as revision %d.", diff, revision, response.GetRevision().GetRevision()),
+			output,
+		)
+	},
+}
+
+var migratePolicy = &cobra.Command{
+	Use:   "migrate",
+	Short: "Convert a v1 ACL Policy to the policy v2 format",
+	Long: `
+	Converts a v1 ACL Policy to the policy v2 format used with HEADSCALE_EXPERIMENTAL_POLICY_V2 and prints it.
+	Users are written in the "user@" form policy v2 requires, based on the users known to the server.
+	Constructs which could not be converted as is are reported, and the converted policy is checked to
+	produce the same filter rules for the current nodes as the v1 policy.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		policyPath, _ := cmd.Flags().GetString("file")
+
+		request := &v1.MigratePolicyRequest{}
+		if policyPath != "" {
+			policyBytes, err := os.ReadFile(policyPath)
+			if err != nil {
+				ErrorOutput(err, fmt.Sprintf("Error reading the policy file: %s", err), output)
+			}
+			request.Policy = string(policyBytes)
+		}
+
+		ctx, client, conn, cancel := newHeadscaleCLIWithConfig()
+		defer cancel()
+		defer conn.Close()
+
+		response, err := client.MigratePolicy(ctx, request)
+		if err != nil {
+			ErrorOutput(err, fmt.Sprintf("Failed to migrate ACL Policy: %s", err), output)
+		}
+
+		if output != "" {
+			SuccessOutput(response, "", output)
+		}
+
+		// The policy goes to stdout and the report to stderr, so the
+		// output can be redirected to a file.
+		fmt.Println(response.GetPolicy())
+
+		for _, issue := range response.GetIssues() {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", issue)
+		}
+
+		if !response.GetEquivalent() {
+			for _, rule := range response.GetFilterRulesLost() {
+				fmt.Fprintf(os.Stderr, "filter rule only in the v1 policy: %s\n", rule)
+			}
+			for _, rule := range response.GetFilterRulesGained() {
+				fmt.Fprintf(os.Stderr, "filter rule only in the v2 policy: %s\n", rule)
+			}
+
+			ErrorOutput(
+				errors.New("converted policy is not equivalent"),
+				"The converted policy does not produce the same filter rules for the current nodes.",
+				output,
+			)
+		}
+	},
+}
+
+// splitPolicyRevision removes the revision header written by "policy get"
+// from the policy and returns the revision it contained, or nil.
+func splitPolicyRevision(policy string) (string, *uint64) {
+	header, rest, _ := strings.Cut(policy, "\n")
+	value, ok := strings.CutPrefix(strings.TrimSpace(header), policyRevisionHeader)
+	if !ok {
+		return policy, nil
+	}
+
+	revision, err := strconv.ParseUint(value, util.Base10, 64)
+	if err != nil {
+		return policy, nil
+	}
+
+	return rest, &revision
+}
+
+// policyRevisionDiff returns a unified diff between two policy revisions,
+// from may be nil for the first revision.
+func policyRevisionDiff(from, to *v1.PolicyRevision) string {
+	fromName := "empty"
+	if from.GetRevision() != 0 {
+		fromName = fmt.Sprintf("revision %d", from.GetRevision())
+	} else if from != nil {
+		fromName = "current"
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from.GetPolicy()),
+		B:        difflib.SplitLines(to.GetPolicy()),
+		FromFile: fromName,
+		ToFile:   fmt.Sprintf("revision %d", to.GetRevision()),
+		Context:  3,
+	})
+	if err != nil || diff == "" {
+		return "No changes."
+	}
+
+	return strings.TrimSuffix(diff, "\n")
+}
+
+func formatPolicyDiff(nodes []*v1.NodePolicyDiff) string {
+	if len(nodes) == 0 {
+		return "No nodes are affected by the policy change."
+	}
+
+	var sb strings.Builder
+	for _, node := range nodes {
+		fmt.Fprintf(&sb, "%s (%d):\n", node.GetNodeName(), node.GetNodeId())
+
+		sections := []struct {
+			name  string
+			items []string
+		}{
+			{"peers gained", node.GetPeersGained()},
+			{"peers lost", node.GetPeersLost()},
+			{"filter rules added", node.GetFilterRulesAdded()},
+			{"filter rules removed", node.GetFilterRulesRemoved()},
+			{"SSH rules added", node.GetSshRulesAdded()},
+			{"SSH rules removed", node.GetSshRulesRemoved()},
+			{"routes auto approved", node.GetRoutesApproved()},
+			{"routes no longer auto approved", node.GetRoutesUnapproved()},
+		}
+		for _, section := range sections {
+			if len(section.items) == 0 {
+				continue
+			}
+
+			fmt.Fprintf(&sb, "  %s:\n", section.name)
+			for _, item := range section.items {
+				fmt.Fprintf(&sb, "    %s\n", item)
+			}
+		}
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
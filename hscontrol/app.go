@@ -25,14 +25,17 @@ import (
 	"github.com/juanfont/headscale"
 	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
 	"github.com/juanfont/headscale/hscontrol/capver"
+	"github.com/juanfont/headscale/hscontrol/cluster"
 	"github.com/juanfont/headscale/hscontrol/db"
 	"github.com/juanfont/headscale/hscontrol/derp"
 	derpServer "github.com/juanfont/headscale/hscontrol/derp/server"
 	"github.com/juanfont/headscale/hscontrol/dns"
+	"github.com/juanfont/headscale/hscontrol/events"
 	"github.com/juanfont/headscale/hscontrol/mapper"
 	"github.com/juanfont/headscale/hscontrol/notifier"
 	"github.com/juanfont/headscale/hscontrol/policy"
 	"github.com/juanfont/headscale/hscontrol/routes"
+	"github.com/juanfont/headscale/hscontrol/state"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
 	zerolog "github.com/philip-bui/grpc-zerolog"
@@ -86,23 +89,39 @@ type Headscale struct {
 	ipAlloc         *db.IPAllocator
 	noisePrivateKey *key.MachinePrivate
 	ephemeralGC     *db.EphemeralGarbageCollector
+	store           *state.Store
 
 	DERPMap    *tailcfg.DERPMap
 	DERPServer *derpServer.DERPServer
 
 	polManOnce     sync.Once
 	polMan         policy.PolicyManager
+	views          *policy.Views
+	policyWriteMu  sync.Mutex // serialises policy updates through the API
 	extraRecordMan *dns.ExtraRecordsMan
+	dnsProvider    dns.Provider
+	idTokens       *idTokenIssuer
 	primaryRoutes  *routes.PrimaryRoutes
 
 	mapper       *mapper.Mapper
 	nodeNotifier *notifier.Notifier
+	events       *events.Bus
+	pings        *pingTracker
+
+	// cluster connects this instance to the other instances in HA mode,
+	// it is nil otherwise.
+	cluster *cluster.Cluster
 
 	registrationCache *zcache.Cache[types.RegistrationID, types.RegisterNode]
 
 	authProvider AuthProvider
 
 	pollNetMapStreamWG sync.WaitGroup
+
+	// watchCtx is cancelled when headscale shuts down, ending the
+	// streaming API calls which would otherwise never return.
+	watchCtx    context.Context
+	watchCancel context.CancelFunc
 }
 
 var (
@@ -136,8 +155,24 @@ func NewHeadscale(cfg *types.Config) (*Headscale, error) {
 		registrationCache:  registrationCache,
 		pollNetMapStreamWG: sync.WaitGroup{},
 		nodeNotifier:       notifier.NewNotifier(cfg),
+		events:             events.NewBus(),
+		pings:              newPingTracker(),
 		primaryRoutes:      routes.New(),
 	}
+	if cfg.HA.Enabled {
+		app.primaryRoutes = routes.NewLowestID()
+	}
+	app.watchCtx, app.watchCancel = context.WithCancel(context.Background())
+
+	app.dnsProvider, err = dns.NewProvider(cfg.DNSConfig.Certs, cfg.BaseDomain)
+	if err != nil {
+		return nil, err
+	}
+
+	app.idTokens, err = newIDTokenIssuer(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read or create ID token signing key: %w", err)
+	}
 
 	app.db, err = db.NewHeadscaleDatabase(
 		cfg.Database,
@@ -153,9 +188,34 @@ func NewHeadscale(cfg *types.Config) (*Headscale, error) {
 		return nil, err
 	}
 
+	app.store, err = loadStore(app.db)
+	if err != nil {
+		return nil, err
+	}
+
 	app.ephemeralGC = db.NewEphemeralGarbageCollector(func(ni types.NodeID) {
+		// In HA mode, every instance schedules the deletion and the leader
+		// deletes the node, unless it connected to another instance. The
+		// others try again later in case the leader changes meanwhile.
+		if app.cluster != nil {
+			if app.nodeNotifier.IsConnected(ni) {
+				return
+			}
+
+			if !app.isLeader() {
+				app.ephemeralGC.Schedule(ni, cfg.EphemeralNodeInactivityTimeout)
+				return
+			}
+		}
+
 		if err := app.db.DeleteEphemeralNode(ni); err != nil {
 			log.Err(err).Uint64("node.id", ni.Uint64()).Msgf("failed to delete ephemeral node")
+			return
+		}
+		app.store.DeleteNode(ni)
+
+		if err := app.events.Publish(context.Background(), events.NodeDeleted{NodeID: ni}); err != nil {
+			log.Err(err).Uint64("node.id", ni.Uint64()).Msgf("failed to publish deletion of ephemeral node")
 		}
 	})
 
@@ -163,6 +223,13 @@ func NewHeadscale(cfg *types.Config) (*Headscale, error) {
 		return nil, fmt.Errorf("failed to load ACL policy: %w", err)
 	}
 
+	app.views = policy.NewViews()
+	if _, err = app.views.Update(app.polMan, app.primaryRoutes, app.store.Nodes()); err != nil {
+		return nil, fmt.Errorf("computing what nodes can see: %w", err)
+	}
+
+	app.subscribeEvents()
+
 	var authProvider AuthProvider
 	authProvider = NewAuthProviderWeb(cfg.ServerURL)
 	if cfg.OIDC.Issuer != "" {
@@ -173,9 +240,10 @@ func NewHeadscale(cfg *types.Config) (*Headscale, error) {
 			cfg.ServerURL,
 			&cfg.OIDC,
 			app.db,
-			app.nodeNotifier,
+			app.store,
+			app.events,
 			app.ipAlloc,
-			app.polMan,
+			cfg.HA.Enabled,
 		)
 		if err != nil {
 			if cfg.OIDC.OnlyStartIfOIDCIsAvailable {
@@ -273,6 +341,20 @@ func (h *Headscale) scheduledTasks(ctx context.Context) {
 			return
 
 		case <-expireTicker.C:
+			// In HA mode, the leader expires the nodes for all instances.
+			if !h.isLeader() {
+				continue
+			}
+
+			if h.cfg.HA.Enabled {
+				if err := h.db.Write(func(tx *gorm.DB) error {
+					_, err := db.DeleteExpiredRegistrations(tx)
+					return err
+				}); err != nil {
+					log.Error().Err(err).Msg("database error while deleting expired registrations")
+				}
+			}
+
 			var update types.StateUpdate
 			var changed bool
 
@@ -288,23 +370,36 @@ func (h *Headscale) scheduledTasks(ctx context.Context) {
 			if changed {
 				log.Trace().Interface("nodes", update.ChangePatches).Msgf("expiring nodes")
 
-				ctx := types.NotifyCtx(context.Background(), "expire-expired", "na")
-				h.nodeNotifier.NotifyAll(ctx, update)
+				var expired []events.Event
+				for _, patch := range update.ChangePatches {
+					if err := h.refreshStoreNode(types.NodeID(patch.NodeID)); err != nil {
+						log.Error().Err(err).Uint64("node.id", uint64(patch.NodeID)).Msg("failed to update expired node in store")
+					}
+
+					expired = append(expired, events.NodeExpired{
+						NodeID: types.NodeID(patch.NodeID),
+						Expiry: *patch.KeyExpiry,
+					})
+				}
+
+				if err := h.events.Publish(ctx, expired...); err != nil {
+					log.Error().Err(err).Msg("failed to publish expired nodes")
+				}
 			}
 
 		case <-derpTickerChan:
-			log.Info().Msg("Fetching DERPMap updates")
-			h.DERPMap = derp.GetDERPMap(h.cfg.DERP)
-			if h.cfg.DERP.ServerEnabled && h.cfg.DERP.AutomaticallyAddEmbeddedDerpRegion {
-				region, _ := h.DERPServer.GenerateRegion()
-				h.DERPMap.Regions[region.RegionID] = &region
+			// In HA mode, the other instances fetch the DERP map when
+			// the leader tells them.
+			if !h.isLeader() {
+				continue
 			}
 
-			ctx := types.NotifyCtx(context.Background(), "derpmap-update", "na")
-			h.nodeNotifier.NotifyAll(ctx, types.StateUpdate{
-				Type:    types.StateDERPUpdated,
-				DERPMap: h.DERPMap,
-			})
+			log.Info().Msg("Fetching DERPMap updates")
+			h.DERPMap = h.fetchDERPMap()
+
+			if err := h.events.Publish(ctx, events.DERPMapChanged{DERPMap: h.DERPMap}); err != nil {
+				log.Error().Err(err).Msg("failed to publish DERPMap update")
+			}
 
 		case records, ok := <-extraRecordsUpdate:
 			if !ok {
@@ -312,14 +407,25 @@ func (h *Headscale) scheduledTasks(ctx context.Context) {
 			}
 			h.cfg.TailcfgDNSConfig.ExtraRecords = records
 
-			ctx := types.NotifyCtx(context.Background(), "dns-extrarecord", "all")
-			// TODO(kradalby): We can probably do better than sending a full update here,
-			// but for now this will ensure that all of the nodes get the new records.
-			h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+			if err := h.events.Publish(ctx, events.DNSChanged{}); err != nil {
+				log.Error().Err(err).Msg("failed to publish extra DNS records update")
+			}
 		}
 	}
 }
 
+// fetchDERPMap fetches the DERP map and adds the region of the embedded
+// DERP server to it if enabled.
+func (h *Headscale) fetchDERPMap() *tailcfg.DERPMap {
+	derpMap := derp.GetDERPMap(h.cfg.DERP)
+	if h.cfg.DERP.ServerEnabled && h.cfg.DERP.AutomaticallyAddEmbeddedDerpRegion {
+		region, _ := h.DERPServer.GenerateRegion()
+		derpMap.Regions[region.RegionID] = &region
+	}
+
+	return derpMap
+}
+
 func (h *Headscale) grpcAuthenticationInterceptor(ctx context.Context,
 	req interface{},
 	info *grpc.UnaryServerInfo,
@@ -486,6 +592,12 @@ func (h *Headscale) createRouter(grpcMux *grpcRuntime.ServeMux) *mux.Router {
 
 	router.HandleFunc("/verify", h.VerifyHandler).Methods(http.MethodPost)
 
+	if h.idTokens != nil {
+		router.HandleFunc(jwksPath, h.JWKSHandler).Methods(http.MethodGet)
+		router.HandleFunc(openIDConfigPath, h.OpenIDConfigurationHandler).
+			Methods(http.MethodGet)
+	}
+
 	if h.cfg.DERP.ServerEnabled {
 		router.HandleFunc("/derp", h.DERPServer.DERPHandler)
 		router.HandleFunc("/derp/probe", derpServer.DERPProbeHandler)
@@ -495,6 +607,15 @@ func (h *Headscale) createRouter(grpcMux *grpcRuntime.ServeMux) *mux.Router {
 
 	apiRouter := router.PathPrefix("/api").Subrouter()
 	apiRouter.Use(h.httpAuthenticationMiddleware)
+	// Watching nodes streams the events for as long as the client is
+	// connected, the write timeout of the server does not apply to it.
+	apiRouter.Path("/v1/node/watch").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			log.Error().Err(err).Msg("failed to disable the write timeout for watching nodes")
+		}
+
+		grpcMux.ServeHTTP(w, req)
+	})
 	apiRouter.PathPrefix("/v1/").HandlerFunc(grpcMux.ServeHTTP)
 
 	router.PathPrefix("/").HandlerFunc(notFoundHandler)
@@ -502,56 +623,38 @@ func (h *Headscale) createRouter(grpcMux *grpcRuntime.ServeMux) *mux.Router {
 	return router
 }
 
-// TODO(kradalby): Do a variant of this, and polman which only updates the node that has changed.
-// Maybe we should attempt a new in memory state and not go via the DB?
-// Maybe this should be implemented as an event bus?
-// A bool is returned indicating if a full update was sent to all nodes
-func usersChangedHook(db *db.HSDatabase, polMan policy.PolicyManager, notif *notifier.Notifier) error {
-	users, err := db.ListUsers()
+// loadStore creates the in-memory store from the nodes and users in the
+// database.
+func loadStore(hsdb *db.HSDatabase) (*state.Store, error) {
+	users, err := hsdb.ListUsers()
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("loading users from database: %w", err)
 	}
 
-	changed, err := polMan.SetUsers(users)
+	nodes, err := hsdb.ListNodes()
 	if err != nil {
-		return err
-	}
-
-	if changed {
-		ctx := types.NotifyCtx(context.Background(), "acl-users-change", "all")
-		notif.NotifyAll(ctx, types.UpdateFull())
+		return nil, fmt.Errorf("loading nodes from database: %w", err)
 	}
 
-	return nil
+	return state.New(users, nodes), nil
 }
 
-// TODO(kradalby): Do a variant of this, and polman which only updates the node that has changed.
-// Maybe we should attempt a new in memory state and not go via the DB?
-// Maybe this should be implemented as an event bus?
-// A bool is returned indicating if a full update was sent to all nodes
-func nodesChangedHook(
-	db *db.HSDatabase,
-	polMan policy.PolicyManager,
-	notif *notifier.Notifier,
-) (bool, error) {
-	nodes, err := db.ListNodes()
-	if err != nil {
-		return false, err
-	}
+// refreshStoreNode reloads the node from the database into the store. It
+// must be called after the node has been written to the database outside
+// of a path that already updates the store.
+func (h *Headscale) refreshStoreNode(id types.NodeID) error {
+	return refreshStoreNode(h.db, h.store, id)
+}
 
-	filterChanged, err := polMan.SetNodes(nodes)
+func refreshStoreNode(hsdb *db.HSDatabase, store *state.Store, id types.NodeID) error {
+	node, err := hsdb.GetNodeByID(id)
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	if filterChanged {
-		ctx := types.NotifyCtx(context.Background(), "acl-nodes-change", "all")
-		notif.NotifyAll(ctx, types.UpdateFull())
-
-		return true, nil
-	}
+	store.PutNode(node)
 
-	return false, nil
+	return nil
 }
 
 // Serve launches the HTTP and gRPC server service Headscale and the API.
@@ -582,7 +685,15 @@ func (h *Headscale) Serve() error {
 
 	// Fetch an initial DERP Map before we start serving
 	h.DERPMap = derp.GetDERPMap(h.cfg.DERP)
-	h.mapper = mapper.NewMapper(h.db, h.cfg, h.DERPMap, h.nodeNotifier, h.polMan, h.primaryRoutes)
+	h.mapper = mapper.NewMapper(h.store, h.cfg, h.DERPMap, h.nodeNotifier, h.polMan, h.primaryRoutes)
+	h.events.Subscribe("mapper", h.mapper.HandleEvents)
+
+	if h.cfg.TailnetLock.Enabled {
+		// The mapper sends the state of tailnet lock to the nodes.
+		if err := h.publishTailnetLockChanged(context.Background()); err != nil {
+			return fmt.Errorf("loading tailnet lock state: %w", err)
+		}
+	}
 
 	if h.cfg.DERP.ServerEnabled {
 		// When embedded DERP is enabled we always need a STUN server
@@ -629,6 +740,10 @@ func (h *Headscale) Serve() error {
 		defer h.extraRecordMan.Close()
 	}
 
+	if err := h.startCluster(context.Background()); err != nil {
+		return err
+	}
+
 	// Start all scheduled tasks, e.g. expiring nodes, derp updates and
 	// records updates
 	scheduleCtx, scheduleCancel := context.WithCancel(context.Background())
@@ -859,20 +974,23 @@ func (h *Headscale) Serve() error {
 
 				changed, err := h.polMan.SetPolicy(pol)
 				if err != nil {
-					log.Error().Err(err).Msg("failed to set new policy")
+					log.Error().Err(err).Msg("failed to set new policy, keeping the current policy")
+					continue
 				}
 
 				if changed {
 					log.Info().
 						Msg("ACL policy successfully reloaded, notifying nodes of change")
 
-					err = h.autoApproveNodes()
+					approved, err := h.autoApproveNodes()
 					if err != nil {
 						log.Error().Err(err).Msg("failed to approve routes after new policy")
 					}
 
-					ctx := types.NotifyCtx(context.Background(), "acl-sighup", "na")
-					h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+					err = h.events.Publish(context.Background(), policyChangedEvents(approved)...)
+					if err != nil {
+						log.Error().Err(err).Msg("failed to notify nodes of new policy")
+					}
 				}
 			default:
 				info := func(msg string) { log.Info().Msg(msg) }
@@ -881,6 +999,7 @@ func (h *Headscale) Serve() error {
 					Msg("Received signal to stop, shutting down gracefully")
 
 				scheduleCancel()
+				h.watchCancel()
 				h.ephemeralGC.Close()
 
 				// Gracefully shut down servers
@@ -903,6 +1022,11 @@ func (h *Headscale) Serve() error {
 				info("waiting for netmap stream to close")
 				h.pollNetMapStreamWG.Wait()
 
+				if h.cluster != nil {
+					info("leaving the other headscale instances")
+					h.cluster.Close()
+				}
+
 				info("shutting down grpc server (socket)")
 				grpcSocket.GracefulStop()
 
@@ -1136,16 +1260,8 @@ func (h *Headscale) loadPolicyManager() error {
 		// Note that this check is only done for file-based policies in this function
 		// as the database-based policies are checked in the gRPC API where it is not
 		// allowed to be written to the database.
-		nodes, err := h.db.ListNodes()
-		if err != nil {
-			errOut = fmt.Errorf("loading nodes from database to validate policy: %w", err)
-			return
-		}
-		users, err := h.db.ListUsers()
-		if err != nil {
-			errOut = fmt.Errorf("loading users from database to validate policy: %w", err)
-			return
-		}
+		nodes := h.store.Nodes()
+		users := h.store.Users()
 
 		pol, err := h.policyBytes()
 		if err != nil {
@@ -1173,11 +1289,13 @@ func (h *Headscale) loadPolicyManager() error {
 }
 
 // autoApproveNodes mass approves routes on all nodes. It is _only_ intended for
-// use when the policy is replaced. It is not sending or reporting any changes
-// or updates as we send full updates after replacing the policy.
+// use when the policy is replaced. It is not sending any updates, it returns
+// the IDs of the nodes which routes were approved to be included in the
+// updates sent after replacing the policy.
 // TODO(kradalby): This is kind of messy, maybe this is another +1
 // for an event bus. See example comments here.
-func (h *Headscale) autoApproveNodes() error {
+func (h *Headscale) autoApproveNodes() ([]types.NodeID, error) {
+	var changedNodes types.Nodes
 	err := h.db.Write(func(tx *gorm.DB) error {
 		nodes, err := db.ListNodes(tx)
 		if err != nil {
@@ -1193,14 +1311,21 @@ func (h *Headscale) autoApproveNodes() error {
 				}
 
 				h.primaryRoutes.SetRoutes(node.ID, node.SubnetRoutes()...)
+				changedNodes = append(changedNodes, node)
 			}
 		}
 
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("auto approving routes for nodes: %w", err)
+		return nil, fmt.Errorf("auto approving routes for nodes: %w", err)
 	}
 
-	return nil
+	ids := make([]types.NodeID, 0, len(changedNodes))
+	for _, node := range changedNodes {
+		h.store.PutNode(node)
+		ids = append(ids, node.ID)
+	}
+
+	return ids, nil
 }
@@ -0,0 +1,88 @@
+package hscontrol
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+// auditLogRequest is the body of the audit log requests of the clients,
+// tailcfg.AuditLogRequest of newer Tailscale versions than the one
+// headscale is built with.
+type auditLogRequest struct {
+	Version   tailcfg.CapabilityVersion `json:",omitempty"`
+	NodeKey   key.NodePublic            `json:",omitempty"`
+	Action    string                    `json:",omitempty"`
+	Details   string                    `json:",omitempty"`
+	Timestamp time.Time                 `json:",omitempty"`
+}
+
+// NoiseAuditLogHandler logs the actions nodes report for the audit log,
+// such as a user disconnecting the node.
+func (ns *noiseServer) NoiseAuditLogHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		httpError(writer, err)
+
+		return
+	}
+
+	var auditLog auditLogRequest
+	if err := json.Unmarshal(body, &auditLog); err != nil {
+		httpError(writer, NewHTTPError(http.StatusBadRequest, "invalid audit log request", err))
+
+		return
+	}
+
+	if auditLog.Action == "" {
+		httpError(writer, NewHTTPError(http.StatusBadRequest, "missing audit log action", nil))
+
+		return
+	}
+
+	node, err := ns.headscale.db.GetNodeByNodeKey(auditLog.NodeKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			httpError(writer, NewHTTPError(http.StatusNotFound, "node not found", nil))
+
+			return
+		}
+		httpError(writer, err)
+
+		return
+	}
+
+	// A node can only log its own actions.
+	if node.MachineKey != ns.machineKey {
+		httpError(writer, NewHTTPError(http.StatusNotFound, "node not found", nil))
+
+		return
+	}
+
+	timestamp := auditLog.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	log.Info().
+		Caller().
+		Uint64("node.id", node.ID.Uint64()).
+		Str("node", node.Hostname).
+		Str("user", node.User.Username()).
+		Str("action", auditLog.Action).
+		Str("details", auditLog.Details).
+		Time("timestamp", timestamp).
+		Msg("node audit log")
+
+	writer.WriteHeader(http.StatusOK)
+}
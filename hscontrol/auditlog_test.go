@@ -0,0 +1,53 @@
+package hscontrol
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"gopkg.in/check.v1"
+	"tailscale.com/types/key"
+)
+
+func (s *Suite) TestNoiseAuditLogHandler(c *check.C) {
+	user, err := app.db.CreateUser(types.User{Name: "test-audit-log"})
+	c.Assert(err, check.IsNil)
+
+	machineKey := key.NewMachine()
+	nodeKey := key.NewNode()
+	node := types.Node{
+		MachineKey:     machineKey.Public(),
+		NodeKey:        nodeKey.Public(),
+		Hostname:       "test-audit-log",
+		UserID:         user.ID,
+		RegisterMethod: util.RegisterMethodAuthKey,
+	}
+	c.Assert(app.db.DB.Save(&node).Error, check.IsNil)
+
+	auditLog := func(machineKey key.MachinePublic, req auditLogRequest) int {
+		body, err := json.Marshal(req)
+		c.Assert(err, check.IsNil)
+
+		ns := &noiseServer{headscale: app, machineKey: machineKey}
+		rec := httptest.NewRecorder()
+		ns.NoiseAuditLogHandler(rec, httptest.NewRequest(http.MethodPost, "/machine/audit-log", strings.NewReader(string(body))))
+
+		return rec.Code
+	}
+
+	disconnect := auditLogRequest{
+		NodeKey: nodeKey.Public(),
+		Action:  "DISCONNECT_NODE",
+		Details: "disconnected by user",
+	}
+
+	c.Assert(auditLog(machineKey.Public(), disconnect), check.Equals, http.StatusOK)
+
+	// A node cannot log the actions of another node.
+	c.Assert(auditLog(key.NewMachine().Public(), disconnect), check.Equals, http.StatusNotFound)
+
+	c.Assert(auditLog(machineKey.Public(), auditLogRequest{NodeKey: nodeKey.Public()}), check.Equals, http.StatusBadRequest)
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/events"
 	"github.com/juanfont/headscale/hscontrol/policy"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
@@ -89,9 +90,12 @@ func (h *Headscale) handleExistingNode(
 				if err != nil {
 					return nil, fmt.Errorf("deleting ephemeral node: %w", err)
 				}
+				h.store.DeleteNode(node.ID)
 
-				ctx := types.NotifyCtx(context.Background(), "logout-ephemeral", "na")
-				h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerRemoved(node.ID))
+				err = h.events.Publish(context.Background(), events.NodeDeleted{NodeID: node.ID})
+				if err != nil {
+					return nil, fmt.Errorf("publishing node deletion: %w", err)
+				}
 			}
 
 			expired = true
@@ -102,8 +106,17 @@ func (h *Headscale) handleExistingNode(
 			return nil, fmt.Errorf("setting node expiry: %w", err)
 		}
 
-		ctx := types.NotifyCtx(context.Background(), "logout-expiry", "na")
-		h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdateExpire(node.ID, requestExpiry), node.ID)
+		// The node is not in the store anymore if it was ephemeral and
+		// deleted above.
+		if stored, ok := h.store.Node(node.ID); ok {
+			stored.Expiry = &requestExpiry
+			h.store.PutNode(stored)
+		}
+
+		err = h.events.Publish(context.Background(), events.NodeExpired{NodeID: node.ID, Expiry: requestExpiry})
+		if err != nil {
+			return nil, fmt.Errorf("publishing node expiry: %w", err)
+		}
 	}
 
 	return nodeToRegisterResponse(node), nil
@@ -138,7 +151,19 @@ func (h *Headscale) waitForFollowup(
 		return nil, NewHTTPError(http.StatusUnauthorized, "invalid registration ID", err)
 	}
 
-	if reg, ok := h.registrationCache.Get(followupReg); ok {
+	reg, ok := h.registrationCache.Get(followupReg)
+	if !ok && h.cfg.HA.Enabled {
+		var node *types.Node
+		reg, node, ok, err = h.remoteRegistration(followupReg)
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			return nodeToRegisterResponse(node), nil
+		}
+	}
+
+	if ok {
 		select {
 		case <-ctx.Done():
 			return nil, NewHTTPError(http.StatusUnauthorized, "registration timed out", err)
@@ -153,6 +178,42 @@ func (h *Headscale) waitForFollowup(
 	return nil, NewHTTPError(http.StatusNotFound, "followup registration not found", nil)
 }
 
+// remoteRegistration returns the registration started on another instance,
+// from the database, and caches it with a channel to wait for it. The
+// registration is completed on this instance or signalled when another
+// instance published that it completed. If it completed before the
+// channel was cached, the registered node is returned instead.
+func (h *Headscale) remoteRegistration(id types.RegistrationID) (types.RegisterNode, *types.Node, bool, error) {
+	stored, err := h.db.GetRegistration(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return types.RegisterNode{}, nil, false, nil
+	} else if err != nil {
+		return types.RegisterNode{}, nil, false, fmt.Errorf("looking up registration: %w", err)
+	}
+
+	reg := types.RegisterNode{
+		Node:       stored.Node,
+		Registered: make(chan *types.Node),
+	}
+	h.registrationCache.Set(id, reg)
+
+	// The registration is deleted from the database when it completes.
+	if _, err := h.db.GetRegistration(id); errors.Is(err, gorm.ErrRecordNotFound) {
+		h.registrationCache.Delete(id)
+
+		node, err := h.db.GetNodeByNodeKey(stored.Node.NodeKey)
+		if err != nil {
+			return types.RegisterNode{}, nil, false, NewHTTPError(http.StatusUnauthorized, "node not found", err)
+		}
+
+		return types.RegisterNode{}, node, false, nil
+	} else if err != nil {
+		return types.RegisterNode{}, nil, false, fmt.Errorf("looking up registration: %w", err)
+	}
+
+	return reg, nil, true, nil
+}
+
 // canUsePreAuthKey checks if a pre auth key can be used.
 func canUsePreAuthKey(pak *types.PreAuthKey) error {
 	if pak == nil {
@@ -197,6 +258,7 @@ func (h *Headscale) handleRegisterWithAuthKey(
 		User:           pak.User,
 		MachineKey:     machineKey,
 		NodeKey:        regReq.NodeKey,
+		KeySignature:   regReq.NodeKeySignature,
 		Hostinfo:       regReq.Hostinfo,
 		LastSeen:       ptr.To(time.Now()),
 		RegisterMethod: util.RegisterMethodAuthKey,
@@ -243,14 +305,14 @@ func (h *Headscale) handleRegisterWithAuthKey(
 		return nil, err
 	}
 
-	updateSent, err := nodesChangedHook(h.db, h.polMan, h.nodeNotifier)
+	err = h.refreshStoreNode(node.ID)
 	if err != nil {
-		return nil, fmt.Errorf("nodes changed hook: %w", err)
+		return nil, fmt.Errorf("updating node in store: %w", err)
 	}
 
-	if !updateSent {
-		ctx := types.NotifyCtx(context.Background(), "node updated", node.Hostname)
-		h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerChanged(node.ID))
+	err = h.events.Publish(context.Background(), events.NodeRegistered{NodeID: node.ID})
+	if err != nil {
+		return nil, fmt.Errorf("publishing node registration: %w", err)
 	}
 
 	return &tailcfg.RegisterResponse{
@@ -272,11 +334,12 @@ func (h *Headscale) handleRegisterInteractive(
 
 	nodeToRegister := types.RegisterNode{
 		Node: types.Node{
-			Hostname:   regReq.Hostinfo.Hostname,
-			MachineKey: machineKey,
-			NodeKey:    regReq.NodeKey,
-			Hostinfo:   regReq.Hostinfo,
-			LastSeen:   ptr.To(time.Now()),
+			Hostname:     regReq.Hostinfo.Hostname,
+			MachineKey:   machineKey,
+			NodeKey:      regReq.NodeKey,
+			KeySignature: regReq.NodeKeySignature,
+			Hostinfo:     regReq.Hostinfo,
+			LastSeen:     ptr.To(time.Now()),
 		},
 		Registered: make(chan *types.Node),
 	}
@@ -288,12 +351,29 @@ func (h *Headscale) handleRegisterInteractive(
 	// Ensure any auto approved routes are handled before saving.
 	policy.AutoApproveRoutes(h.polMan, &nodeToRegister.Node)
 
-	h.registrationCache.Set(
-		registrationId,
-		nodeToRegister,
-	)
+	if err := h.addRegistration(registrationId, nodeToRegister); err != nil {
+		return nil, err
+	}
 
 	return &tailcfg.RegisterResponse{
 		AuthURL: h.authProvider.AuthURL(registrationId),
 	}, nil
 }
+
+// addRegistration caches the interactive registration until the user logged
+// in. In HA mode it is also stored in the database, the user can log in and
+// the node can wait for the registration on other instances.
+func (h *Headscale) addRegistration(id types.RegistrationID, reg types.RegisterNode) error {
+	h.registrationCache.Set(id, reg)
+
+	if !h.cfg.HA.Enabled {
+		return nil
+	}
+
+	err := h.db.SaveRegistration(id, reg.Node, time.Now().Add(registerCacheExpiration))
+	if err != nil {
+		return fmt.Errorf("saving registration: %w", err)
+	}
+
+	return nil
+}
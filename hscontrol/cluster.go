@@ -0,0 +1,398 @@
+package hscontrol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/cluster"
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/events"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// startCluster connects this instance to the other instances sharing the
+// database, in HA mode. The events published on this instance are sent to
+// the other instances from then on.
+func (h *Headscale) startCluster(ctx context.Context) error {
+	if !h.cfg.HA.Enabled {
+		return nil
+	}
+
+	id, err := instanceID()
+	if err != nil {
+		return err
+	}
+
+	h.cluster = cluster.New(db.PostgresDSN(h.cfg.Database.Postgres), id, h.cfg.HA.HeartbeatInterval, h)
+	if err := h.cluster.Start(ctx); err != nil {
+		return fmt.Errorf("joining the other headscale instances: %w", err)
+	}
+
+	h.events.Subscribe("cluster", h.cluster.HandleEvents)
+
+	return nil
+}
+
+// instanceID returns a unique ID for this instance, the hostname helps to
+// find it in the logs of the other instances.
+func instanceID() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "headscale"
+	}
+
+	suffix, err := util.GenerateRandomStringDNSSafe(8)
+	if err != nil {
+		return "", fmt.Errorf("generating instance ID: %w", err)
+	}
+
+	return hostname + "-" + suffix, nil
+}
+
+// isLeader reports if this instance runs the tasks which must only run
+// once, all instances are the leader if HA mode is disabled.
+func (h *Headscale) isLeader() bool {
+	return h.cluster == nil || h.cluster.IsLeader()
+}
+
+// HandleRemoteEvents updates this instance with the events published on
+// another instance, and republishes them on this instance to update the
+// nodes connected to it.
+func (h *Headscale) HandleRemoteEvents(ctx context.Context, instance string, evs []events.Event) error {
+	var errs []error
+	local := make([]events.Event, 0, len(evs))
+	for _, ev := range evs {
+		localEv, err := h.applyRemoteEvent(ctx, instance, ev)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("applying %s: %w", ev.Type(), err))
+		}
+
+		if localEv != nil {
+			local = append(local, localEv)
+		}
+	}
+
+	if err := h.events.Publish(ctx, local...); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// applyRemoteEvent updates the store, the policy and the presence of the
+// nodes with an event of another instance. It returns the event to publish
+// on this instance, or nil if it does not concern this instance.
+func (h *Headscale) applyRemoteEvent(ctx context.Context, instance string, ev events.Event) (events.Event, error) {
+	switch ev := ev.(type) {
+	case events.NodeRegistered:
+		if err := h.refreshRemoteNode(ev.NodeID); err != nil {
+			return ev, err
+		}
+
+		node, ok := h.store.Node(ev.NodeID)
+		if !ok {
+			return ev, nil
+		}
+
+		// The IPs were allocated on the other instance.
+		h.ipAlloc.Reserve(node.IPv4, node.IPv6)
+
+		// The node may wait for the registration on this instance.
+		if ev.RegistrationID != "" {
+			if reg, ok := h.registrationCache.Pop(ev.RegistrationID); ok && reg.Registered != nil {
+				select {
+				case reg.Registered <- node:
+				default:
+				}
+				close(reg.Registered)
+			}
+		}
+
+		return ev, nil
+
+	case events.RoutesChanged:
+		if err := h.refreshRemoteNode(ev.NodeID); err != nil {
+			return ev, err
+		}
+
+		if node, ok := h.store.Node(ev.NodeID); ok && h.nodeNotifier.IsConnected(ev.NodeID) {
+			h.setRemoteRoutes(ctx, ev.NodeID, node)
+		}
+
+		return ev, nil
+
+	case events.NodeChanged, events.NodeRenamed, events.NodeMoved,
+		events.NodeExpired, events.NodeHealthChanged, events.NodeSignatureChanged,
+		events.TagsChanged:
+		return ev, h.refreshRemoteNode(nodeIDOf(ev))
+
+	case events.NodeDeleted:
+		h.store.DeleteNode(ev.NodeID)
+		h.ephemeralGC.Cancel(ev.NodeID)
+		h.nodeNotifier.RemoveRemoteNode(ev.NodeID, instance)
+		h.setRemoteRoutes(ctx, ev.NodeID, nil)
+
+		return ev, nil
+
+	case events.NodeConnected:
+		h.nodeNotifier.AddRemoteNode(ev.NodeID, instance)
+		h.ephemeralGC.Cancel(ev.NodeID)
+
+		if err := h.refreshRemoteNode(ev.NodeID); err != nil {
+			return ev, err
+		}
+
+		if node, ok := h.store.Node(ev.NodeID); ok {
+			h.setRemoteRoutes(ctx, ev.NodeID, node)
+		}
+
+		return ev, nil
+
+	case events.NodeDisconnected:
+		// The node connected to another instance since.
+		if !h.nodeNotifier.RemoveRemoteNode(ev.NodeID, instance) ||
+			h.nodeNotifier.IsConnected(ev.NodeID) {
+			return nil, nil
+		}
+
+		h.remoteNodeDisconnected(ctx, ev.NodeID, ev.LastSeen)
+
+		return ev, nil
+
+	case events.UserCreated:
+		return ev, h.refreshRemoteUser(ev.UserID)
+	case events.UserRenamed:
+		return ev, h.refreshRemoteUser(ev.UserID)
+	case events.UserUpdated:
+		return ev, h.refreshRemoteUser(ev.UserID)
+
+	case events.UserDeleted:
+		h.store.DeleteUser(ev.UserID)
+
+		return ev, nil
+
+	case events.PolicyChanged:
+		// Only a policy in the database is loaded again, a policy file can
+		// differ between the instances. The routes auto approved by the new
+		// policy are sent as RoutesChanged events of their own.
+		if h.cfg.Policy.Mode != types.PolicyModeDB {
+			return ev, nil
+		}
+
+		pol, err := h.policyBytes()
+		if err != nil {
+			return ev, fmt.Errorf("loading policy: %w", err)
+		}
+
+		if _, err := h.polMan.SetPolicy(pol); err != nil {
+			return ev, fmt.Errorf("setting policy: %w", err)
+		}
+
+		return ev, nil
+
+	case events.DERPMapChanged:
+		// The DERP map is not sent, see cluster.Send.
+		h.DERPMap = h.fetchDERPMap()
+
+		return events.DERPMapChanged{DERPMap: h.DERPMap}, nil
+
+	case events.TailnetLockChanged:
+		return ev, nil
+
+	// Every instance computes the primary routes and loads the extra DNS
+	// records itself.
+	case events.PrimaryRoutesChanged, events.DNSChanged:
+		return nil, nil
+	}
+
+	return ev, nil
+}
+
+// nodeIDOf returns the node of the events which only carry its ID.
+func nodeIDOf(ev events.Event) types.NodeID {
+	switch ev := ev.(type) {
+	case events.NodeChanged:
+		return ev.NodeID
+	case events.NodeRenamed:
+		return ev.NodeID
+	case events.NodeMoved:
+		return ev.NodeID
+	case events.NodeExpired:
+		return ev.NodeID
+	case events.NodeHealthChanged:
+		return ev.NodeID
+	case events.NodeSignatureChanged:
+		return ev.NodeID
+	case events.TagsChanged:
+		return ev.NodeID
+	}
+
+	return 0
+}
+
+// refreshRemoteNode reloads the node changed by another instance into the
+// store, the node may have been deleted since.
+func (h *Headscale) refreshRemoteNode(id types.NodeID) error {
+	err := h.refreshStoreNode(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		h.store.DeleteNode(id)
+		return nil
+	}
+
+	return err
+}
+
+// refreshRemoteUser reloads the user changed by another instance into the
+// store, the user may have been deleted since.
+func (h *Headscale) refreshRemoteUser(id types.UserID) error {
+	user, err := h.db.GetUserByID(id)
+	if errors.Is(err, db.ErrUserNotFound) {
+		h.store.DeleteUser(id)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	h.store.PutUser(*user)
+
+	return nil
+}
+
+// setRemoteRoutes sets the routes of a node connected to another instance,
+// or removes them if node is nil, and sends the primary routes to the
+// nodes connected to this instance if they changed.
+func (h *Headscale) setRemoteRoutes(ctx context.Context, id types.NodeID, node *types.Node) {
+	var changed bool
+	if node == nil {
+		changed = h.primaryRoutes.SetRoutes(id)
+	} else {
+		changed = h.primaryRoutes.SetRoutes(id, node.SubnetRoutes()...)
+	}
+
+	if changed {
+		if err := h.events.Publish(ctx, events.PrimaryRoutesChanged{}); err != nil {
+			log.Error().Err(err).Uint64("node.id", id.Uint64()).Msg("failed to send primary route changes")
+		}
+	}
+}
+
+// remoteNodeDisconnected updates this instance after a node disconnected
+// from another instance, as the poll session would on this instance.
+func (h *Headscale) remoteNodeDisconnected(ctx context.Context, id types.NodeID, lastSeen time.Time) {
+	node, ok := h.store.Node(id)
+	if !ok {
+		return
+	}
+
+	node.LastSeen = &lastSeen
+	h.store.PutNode(node)
+	h.setRemoteRoutes(ctx, id, nil)
+
+	if node.IsEphemeral() {
+		h.ephemeralGC.Schedule(id, h.cfg.EphemeralNodeInactivityTimeout)
+	}
+}
+
+// InstanceJoined tells the new instance which nodes are connected to this
+// instance.
+func (h *Headscale) InstanceJoined(ctx context.Context, instance string) {
+	var evs []events.Event
+	for _, id := range h.nodeNotifier.ConnectedNodes() {
+		evs = append(evs, events.NodeConnected{NodeID: id})
+	}
+
+	if err := h.cluster.Send(ctx, evs...); err != nil {
+		log.Error().Err(err).Str("instance", instance).Msg("failed to send connected nodes to new instance")
+	}
+}
+
+// InstanceLeft marks the nodes connected to the instance as disconnected.
+func (h *Headscale) InstanceLeft(ctx context.Context, instance string) {
+	now := time.Now()
+
+	var evs []events.Event
+	for _, id := range h.nodeNotifier.RemoveInstance(instance) {
+		if h.nodeNotifier.IsConnected(id) {
+			continue
+		}
+
+		h.remoteNodeDisconnected(ctx, id, now)
+		evs = append(evs, events.NodeDisconnected{NodeID: id, LastSeen: now})
+	}
+
+	if err := h.events.Publish(ctx, evs...); err != nil {
+		log.Error().Err(err).Str("instance", instance).Msg("failed to send nodes of stopped instance")
+	}
+}
+
+// Resync reloads the users, nodes and policy from the database after
+// events of other instances may have been missed, and sends all nodes
+// connected to this instance a full update.
+func (h *Headscale) Resync(ctx context.Context) {
+	if err := h.resync(); err != nil {
+		log.Error().Err(err).Msg("failed to resynchronise with the database")
+		return
+	}
+
+	h.nodeNotifier.NotifyAll(types.NotifyCtx(ctx, "resync", "na"), types.UpdateFull())
+}
+
+func (h *Headscale) resync() error {
+	store, err := loadStore(h.db)
+	if err != nil {
+		return err
+	}
+
+	users := store.Users()
+	for _, user := range h.store.Users() {
+		if !slices.ContainsFunc(users, func(u types.User) bool { return u.ID == user.ID }) {
+			h.store.DeleteUser(types.UserID(user.ID))
+		}
+	}
+	for _, user := range users {
+		h.store.PutUser(user)
+	}
+
+	nodes := store.Nodes()
+	for _, node := range h.store.Nodes() {
+		if _, ok := store.Node(node.ID); !ok {
+			h.store.DeleteNode(node.ID)
+		}
+	}
+	for _, node := range nodes {
+		h.store.PutNode(node)
+		h.ipAlloc.Reserve(node.IPv4, node.IPv6)
+	}
+
+	if h.cfg.Policy.Mode == types.PolicyModeDB {
+		pol, err := h.policyBytes()
+		if err != nil {
+			return fmt.Errorf("loading policy: %w", err)
+		}
+
+		if _, err := h.polMan.SetPolicy(pol); err != nil {
+			return fmt.Errorf("setting policy: %w", err)
+		}
+	}
+
+	if _, err := h.polMan.SetUsers(users); err != nil {
+		return err
+	}
+
+	if _, err := h.polMan.SetNodes(nodes); err != nil {
+		return err
+	}
+
+	if _, err := h.views.Update(h.polMan, h.primaryRoutes, nodes); err != nil {
+		return fmt.Errorf("computing what nodes can see: %w", err)
+	}
+
+	return nil
+}
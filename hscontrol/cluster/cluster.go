@@ -0,0 +1,476 @@
+// Package cluster connects the headscale instances sharing a postgres
+// database in HA mode.
+//
+// The events published on the bus of an instance are sent to the other
+// instances with postgres NOTIFY, so they can update their state and the
+// nodes connected to them. The instances tell each other that they are
+// alive with heartbeats, and one of them is elected leader with an
+// advisory lock, to run the tasks which must only run once.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/juanfont/headscale/hscontrol/events"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// channel is the channel of the notifications between the instances.
+	channel = "headscale_cluster"
+
+	// maxPayload is the maximum size of the payload of a notification,
+	// postgres allows up to 8000 bytes.
+	maxPayload = 7900
+
+	// leaderLockID is the key of the advisory lock held by the leader.
+	leaderLockID = 0x68656164
+
+	// missedHeartbeats is the number of heartbeats an instance can miss
+	// before it is considered gone.
+	missedHeartbeats = 3
+
+	// queryTimeout bounds the queries made outside of requests.
+	queryTimeout = 10 * time.Second
+)
+
+var (
+	ErrPayloadTooLarge = errors.New("event is too large to be sent to the other instances")
+	ErrClosed          = errors.New("connection to the other instances is closed")
+)
+
+type messageKind string
+
+const (
+	kindEvents    messageKind = "events"
+	kindHello     messageKind = "hello"
+	kindHeartbeat messageKind = "heartbeat"
+	kindBye       messageKind = "bye"
+)
+
+// message is the payload of a notification.
+type message struct {
+	Instance string           `json:"instance"`
+	Kind     messageKind      `json:"kind"`
+	Events   []events.Encoded `json:"events,omitempty"`
+}
+
+// Handler is what the cluster tells the instance about the other
+// instances. It is called with a context for which IsRemote is true.
+type Handler interface {
+	// HandleRemoteEvents is called with the events published on another
+	// instance, in the order they were published there.
+	HandleRemoteEvents(ctx context.Context, instance string, evs []events.Event) error
+
+	// InstanceJoined is called when another instance started, it does not
+	// know which nodes are connected to this instance yet.
+	InstanceJoined(ctx context.Context, instance string)
+
+	// InstanceLeft is called when another instance stopped, or was not
+	// heard from for too long.
+	InstanceLeft(ctx context.Context, instance string)
+
+	// Resync is called after the connection receiving the events of the
+	// other instances was lost, events may have been missed.
+	Resync(ctx context.Context)
+}
+
+// Cluster is the connection of an instance to the other instances.
+type Cluster struct {
+	id       string
+	dsn      string
+	interval time.Duration
+	handler  Handler
+
+	// listener receives the notifications, it is only used by listen.
+	listener *pgx.Conn
+
+	sendMu sync.Mutex
+	sender *pgx.Conn
+	closed bool
+
+	// leaderConn holds the advisory lock while this instance is the
+	// leader, it is only used by campaign.
+	leaderConn *pgx.Conn
+	leader     atomic.Bool
+
+	mu sync.Mutex
+	// instances are the other instances, with the time they were last
+	// heard from.
+	instances map[string]time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns the cluster connection of the instance with the given ID to
+// the database of dsn. The instances send heartbeats and try to become the
+// leader every interval.
+func New(dsn string, id string, interval time.Duration, handler Handler) *Cluster {
+	return &Cluster{
+		id:        id,
+		dsn:       dsn,
+		interval:  interval,
+		handler:   handler,
+		instances: make(map[string]time.Time),
+	}
+}
+
+// ID returns the ID of this instance.
+func (c *Cluster) ID() string {
+	return c.id
+}
+
+// IsLeader reports if this instance is the leader.
+func (c *Cluster) IsLeader() bool {
+	return c.leader.Load()
+}
+
+// Start connects to the database and starts exchanging events and
+// heartbeats with the other instances, and campaigning to be the leader.
+func (c *Cluster) Start(ctx context.Context) error {
+	var err error
+	c.listener, err = c.listen(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.sender, err = pgx.Connect(ctx, c.dsn)
+	if err != nil {
+		c.listener.Close(ctx)
+		return fmt.Errorf("connecting to the database: %w", err)
+	}
+
+	ctx, c.cancel = context.WithCancel(context.Background())
+
+	c.wg.Add(3)
+	go func() {
+		defer c.wg.Done()
+		c.receive(ctx)
+	}()
+	go func() {
+		defer c.wg.Done()
+		c.heartbeat(ctx)
+	}()
+	go func() {
+		defer c.wg.Done()
+		c.campaign(ctx)
+	}()
+
+	log.Info().Str("instance", c.id).Msg("Joining the other headscale instances")
+
+	return c.send(ctx, message{Kind: kindHello})
+}
+
+// Close tells the other instances that this instance stops, gives up the
+// leadership and closes the connections.
+func (c *Cluster) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+
+	if err := c.send(ctx, message{Kind: kindBye}); err != nil {
+		log.Error().Err(err).Msg("failed to tell the other instances that this instance stops")
+	}
+
+	c.cancel()
+	c.wg.Wait()
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	c.closed = true
+	c.sender.Close(ctx)
+	c.listener.Close(ctx)
+	if c.leaderConn != nil {
+		c.leaderConn.Close(ctx)
+	}
+	c.leader.Store(false)
+}
+
+// HandleEvents sends the events published on this instance to the other
+// instances. Events published while handling events of other instances
+// are not sent back.
+func (c *Cluster) HandleEvents(ctx context.Context, evs []events.Event) error {
+	if IsRemote(ctx) {
+		return nil
+	}
+
+	return c.Send(ctx, evs...)
+}
+
+// Send sends the events to the other instances, without publishing them
+// on this instance.
+func (c *Cluster) Send(ctx context.Context, evs ...events.Event) error {
+	if len(evs) == 0 {
+		return nil
+	}
+
+	msgs, err := eventMessages(evs)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range msgs {
+		if err := c.send(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// eventMessages encodes the events in as few messages as possible, each
+// small enough to be sent as a notification.
+func eventMessages(evs []events.Event) ([]message, error) {
+	// The size of a message without events, with a long instance ID.
+	const overhead = 128
+
+	var msgs []message
+	var curr []events.Encoded
+	size := overhead
+
+	for _, ev := range evs {
+		// The DERP map can be larger than a notification, the other
+		// instances fetch it themselves.
+		if _, ok := ev.(events.DERPMapChanged); ok {
+			ev = events.DERPMapChanged{}
+		}
+
+		enc, err := events.Encode(ev)
+		if err != nil {
+			return nil, err
+		}
+
+		encSize := len(enc.Type) + len(enc.Data) + len(`{"type":"","data":},`)
+		if overhead+encSize > maxPayload {
+			return nil, fmt.Errorf("%w: %s", ErrPayloadTooLarge, ev.Type())
+		}
+
+		if size+encSize > maxPayload {
+			msgs = append(msgs, message{Kind: kindEvents, Events: curr})
+			curr = nil
+			size = overhead
+		}
+
+		curr = append(curr, enc)
+		size += encSize
+	}
+
+	return append(msgs, message{Kind: kindEvents, Events: curr}), nil
+}
+
+func (c *Cluster) send(ctx context.Context, msg message) error {
+	msg.Instance = c.id
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encoding message: %w", err)
+	}
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	if c.sender.IsClosed() {
+		c.sender, err = pgx.Connect(ctx, c.dsn)
+		if err != nil {
+			return fmt.Errorf("connecting to the database: %w", err)
+		}
+	}
+
+	if _, err := c.sender.Exec(ctx, "SELECT pg_notify($1, $2)", channel, string(payload)); err != nil {
+		return fmt.Errorf("sending %s to the other instances: %w", msg.Kind, err)
+	}
+
+	return nil
+}
+
+// listen opens the connection receiving the notifications.
+func (c *Cluster) listen(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, c.dsn)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the database: %w", err)
+	}
+
+	if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		conn.Close(ctx)
+		return nil, fmt.Errorf("listening to the other instances: %w", err)
+	}
+
+	return conn, nil
+}
+
+// receive handles the notifications of the other instances until ctx is
+// done. If the connection is lost, it reconnects and resynchronises.
+func (c *Cluster) receive(ctx context.Context) {
+	for {
+		n, err := c.listener.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			log.Error().Err(err).Msg("lost the connection to the other instances, reconnecting")
+			if !c.reconnect(ctx) {
+				return
+			}
+
+			continue
+		}
+
+		var msg message
+		if err := json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+			log.Error().Err(err).Msg("failed to decode message of another instance")
+			continue
+		}
+
+		if msg.Instance == c.id {
+			continue
+		}
+
+		c.handle(withRemote(ctx), msg)
+	}
+}
+
+// reconnect opens a new connection receiving the notifications, and
+// tells the handler to resynchronise its state. The other instances are
+// forgotten and asked to announce themselves again. It returns false if
+// ctx is done before a connection could be opened.
+func (c *Cluster) reconnect(ctx context.Context) bool {
+	c.listener.Close(ctx)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		conn, err := c.listen(ctx)
+		if err == nil {
+			c.listener = conn
+			break
+		}
+		log.Error().Err(err).Msg("failed to reconnect to the other instances")
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+
+	c.mu.Lock()
+	instances := c.instances
+	c.instances = make(map[string]time.Time)
+	c.mu.Unlock()
+
+	remoteCtx := withRemote(ctx)
+	for instance := range instances {
+		c.handler.InstanceLeft(remoteCtx, instance)
+	}
+	c.handler.Resync(remoteCtx)
+
+	if err := c.send(ctx, message{Kind: kindHello}); err != nil {
+		log.Error().Err(err).Msg("failed to ask the other instances to announce themselves")
+	}
+
+	return true
+}
+
+func (c *Cluster) handle(ctx context.Context, msg message) {
+	c.mu.Lock()
+	_, known := c.instances[msg.Instance]
+	if msg.Kind == kindBye {
+		delete(c.instances, msg.Instance)
+	} else {
+		c.instances[msg.Instance] = time.Now()
+	}
+	c.mu.Unlock()
+
+	switch msg.Kind {
+	case kindHello:
+		log.Info().Str("instance", msg.Instance).Msg("Headscale instance joined")
+		c.handler.InstanceJoined(ctx, msg.Instance)
+
+	case kindBye:
+		if known {
+			log.Info().Str("instance", msg.Instance).Msg("Headscale instance left")
+			c.handler.InstanceLeft(ctx, msg.Instance)
+		}
+
+	case kindEvents:
+		evs := make([]events.Event, 0, len(msg.Events))
+		for _, enc := range msg.Events {
+			ev, err := events.Decode(enc)
+			if err != nil {
+				// An instance of a newer version can publish events this
+				// instance does not know.
+				log.Warn().Err(err).Str("instance", msg.Instance).Msg("ignoring event of another instance")
+				continue
+			}
+			evs = append(evs, ev)
+		}
+
+		if err := c.handler.HandleRemoteEvents(ctx, msg.Instance, evs); err != nil {
+			log.Error().Err(err).Str("instance", msg.Instance).Msg("failed to handle events of another instance")
+		}
+	}
+}
+
+// heartbeat tells the other instances that this instance is alive every
+// interval, and forgets the instances which were not heard from for too
+// long.
+func (c *Cluster) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, queryTimeout)
+		if err := c.send(sendCtx, message{Kind: kindHeartbeat}); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("failed to send heartbeat to the other instances")
+		}
+		cancel()
+
+		var gone []string
+		c.mu.Lock()
+		for instance, lastSeen := range c.instances {
+			if time.Since(lastSeen) > missedHeartbeats*c.interval {
+				gone = append(gone, instance)
+				delete(c.instances, instance)
+			}
+		}
+		c.mu.Unlock()
+
+		for _, instance := range gone {
+			log.Warn().Str("instance", instance).Msg("Headscale instance stopped sending heartbeats")
+			c.handler.InstanceLeft(withRemote(ctx), instance)
+		}
+	}
+}
+
+type remoteKey struct{}
+
+// withRemote marks ctx as handling the events of other instances.
+func withRemote(ctx context.Context) context.Context {
+	return context.WithValue(ctx, remoteKey{}, true)
+}
+
+// IsRemote reports if ctx is handling the events of other instances, the
+// events published with it are not sent to the other instances again.
+func IsRemote(ctx context.Context) bool {
+	remote, _ := ctx.Value(remoteKey{}).(bool)
+	return remote
+}
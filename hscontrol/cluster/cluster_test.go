@@ -0,0 +1,214 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/events"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+	"zombiezen.com/go/postgrestest"
+)
+
+func TestEventMessages(t *testing.T) {
+	msgs, err := eventMessages([]events.Event{
+		events.NodeConnected{NodeID: 1},
+		events.DERPMapChanged{DERPMap: &tailcfg.DERPMap{
+			Regions: map[int]*tailcfg.DERPRegion{999: {RegionID: 999}},
+		}},
+	})
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Len(t, msgs[0].Events, 2)
+
+	// The DERP map is not sent.
+	ev, err := events.Decode(msgs[0].Events[1])
+	require.NoError(t, err)
+	require.Equal(t, events.DERPMapChanged{}, ev)
+
+	// Events which do not fit in a notification are split in several
+	// messages, in order.
+	var evs []events.Event
+	for i := range 500 {
+		evs = append(evs, events.NodeChanged{NodeID: types.NodeID(i)})
+	}
+
+	msgs, err = eventMessages(evs)
+	require.NoError(t, err)
+	require.Greater(t, len(msgs), 1)
+
+	var got []events.Event
+	for _, msg := range msgs {
+		msg.Instance = strings.Repeat("i", 64)
+		payload, err := json.Marshal(msg)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(payload), maxPayload)
+
+		for _, enc := range msg.Events {
+			ev, err := events.Decode(enc)
+			require.NoError(t, err)
+			got = append(got, ev)
+		}
+	}
+	require.Equal(t, evs, got)
+
+	_, err = eventMessages([]events.Event{
+		events.TailnetLockChanged{Info: &tailcfg.TKAInfo{Head: strings.Repeat("h", maxPayload)}},
+	})
+	require.ErrorIs(t, err, ErrPayloadTooLarge)
+}
+
+// recorder is a Handler recording what it is called with.
+type recorder struct {
+	mu      sync.Mutex
+	events  []events.Event
+	joined  []string
+	left    []string
+	remote  bool
+	resyncs int
+}
+
+func (r *recorder) HandleRemoteEvents(ctx context.Context, instance string, evs []events.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, evs...)
+	r.remote = IsRemote(ctx)
+
+	return nil
+}
+
+func (r *recorder) InstanceJoined(ctx context.Context, instance string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.joined = append(r.joined, instance)
+}
+
+func (r *recorder) InstanceLeft(ctx context.Context, instance string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.left = append(r.left, instance)
+}
+
+func (r *recorder) Resync(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resyncs++
+}
+
+func (r *recorder) get() recorder {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return recorder{
+		events:  append([]events.Event(nil), r.events...),
+		joined:  append([]string(nil), r.joined...),
+		left:    append([]string(nil), r.left...),
+		remote:  r.remote,
+		resyncs: r.resyncs,
+	}
+}
+
+func newPostgresDSNForTest(t *testing.T) string {
+	t.Helper()
+
+	ctx := context.Background()
+	srv, err := postgrestest.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Cleanup)
+
+	dsn, err := srv.CreateDatabase(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dsn
+}
+
+func TestCluster(t *testing.T) {
+	dsn := newPostgresDSNForTest(t)
+	ctx := context.Background()
+	interval := 100 * time.Millisecond
+
+	var recA, recB recorder
+	a := New(dsn, "a", interval, &recA)
+	require.NoError(t, a.Start(ctx))
+	b := New(dsn, "b", interval, &recB)
+	require.NoError(t, b.Start(ctx))
+
+	require.Eventually(t, func() bool {
+		return len(recA.get().joined) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"b"}, recA.get().joined)
+
+	// The events are sent to the other instances, not back to this one.
+	require.NoError(t, a.HandleEvents(ctx, []events.Event{
+		events.NodeConnected{NodeID: 1},
+		events.DERPMapChanged{DERPMap: &tailcfg.DERPMap{}},
+	}))
+	// The events of other instances are not sent again.
+	require.NoError(t, a.HandleEvents(withRemote(ctx), []events.Event{events.NodeConnected{NodeID: 2}}))
+	require.NoError(t, a.Send(ctx, events.UserCreated{UserID: 3}))
+
+	require.Eventually(t, func() bool {
+		return len(recB.get().events) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	got := recB.get()
+	require.Equal(t, []events.Event{
+		events.NodeConnected{NodeID: 1},
+		events.DERPMapChanged{},
+		events.UserCreated{UserID: 3},
+	}, got.events)
+	require.True(t, got.remote)
+	require.Empty(t, recA.get().events)
+
+	// Exactly one instance is the leader, when it stops the other one
+	// takes over.
+	require.Eventually(t, func() bool {
+		return a.IsLeader() != b.IsLeader()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	leader, follower, recFollower := a, b, &recB
+	if b.IsLeader() {
+		leader, follower, recFollower = b, a, &recA
+	}
+
+	leader.Close()
+	require.False(t, leader.IsLeader())
+	require.Eventually(t, follower.IsLeader, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return len(recFollower.get().left) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{leader.ID()}, recFollower.get().left)
+
+	follower.Close()
+}
+
+func TestClusterHeartbeats(t *testing.T) {
+	dsn := newPostgresDSNForTest(t)
+	ctx := context.Background()
+	interval := 50 * time.Millisecond
+
+	var recA, recB recorder
+	a := New(dsn, "a", interval, &recA)
+	require.NoError(t, a.Start(ctx))
+	defer a.Close()
+
+	// b only sends a hello and never a heartbeat, as if it crashed.
+	b := New(dsn, "b", time.Hour, &recB)
+	require.NoError(t, b.Start(ctx))
+	b.cancel()
+	b.wg.Wait()
+
+	require.Eventually(t, func() bool {
+		return len(recA.get().left) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"b"}, recA.get().joined)
+	require.Equal(t, []string{"b"}, recA.get().left)
+}
@@ -0,0 +1,80 @@
+package cluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// campaign tries to become the leader every interval, until ctx is done.
+// The leader holds an advisory lock on a dedicated connection, postgres
+// releases it when the connection is lost, for example if the instance
+// crashed, and another instance takes over.
+func (c *Cluster) campaign(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.tryLead(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Cluster) tryLead(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	if c.leader.Load() {
+		// The lock is lost with the connection, the leader has to make
+		// sure it still has it.
+		if err := c.leaderConn.Ping(ctx); err != nil {
+			log.Error().Err(err).Msg("lost the connection holding the leadership")
+			c.resign(ctx)
+		}
+
+		return
+	}
+
+	if c.leaderConn == nil || c.leaderConn.IsClosed() {
+		conn, err := pgx.Connect(ctx, c.dsn)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to connect to the database to campaign for leadership")
+			return
+		}
+		c.leaderConn = conn
+	}
+
+	var locked bool
+	err := c.leaderConn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", int64(leaderLockID)).Scan(&locked)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to campaign for leadership")
+		c.resign(ctx)
+
+		return
+	}
+
+	if locked {
+		log.Info().Str("instance", c.id).Msg("This instance is now the leader")
+		c.leader.Store(true)
+	}
+}
+
+// resign gives up the leadership, if this instance has it, by closing the
+// connection holding the lock.
+func (c *Cluster) resign(ctx context.Context) {
+	if c.leader.Swap(false) {
+		log.Warn().Str("instance", c.id).Msg("This instance is not the leader anymore")
+	}
+
+	if c.leaderConn != nil {
+		c.leaderConn.Close(ctx)
+		c.leaderConn = nil
+	}
+}
@@ -0,0 +1,172 @@
+package hscontrol
+
+import (
+	"context"
+	"net/netip"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"zombiezen.com/go/postgrestest"
+)
+
+// newHATestServers returns two headscale instances in HA mode sharing a
+// local postgres database.
+func newHATestServers(t *testing.T) (*Headscale, *Headscale) {
+	t.Helper()
+
+	ctx := context.Background()
+	srv, err := postgrestest.Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Cleanup)
+
+	dsn, err := srv.CreateDatabase(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pu, err := url.Parse(dsn)
+	require.NoError(t, err)
+
+	pass, _ := pu.User.Password()
+	port, _ := strconv.Atoi(pu.Port())
+	prefix4 := netip.MustParsePrefix("100.64.0.0/10")
+	dir := t.TempDir()
+
+	newServer := func() *Headscale {
+		cfg := types.Config{
+			ServerURL:           "https://headscale.example.com",
+			NoisePrivateKeyPath: filepath.Join(dir, "noise_private.key"),
+			PrefixV4:            &prefix4,
+			IPAllocation:        types.IPAllocationStrategySequential,
+			Database: types.DatabaseConfig{
+				Type: types.DatabasePostgres,
+				Postgres: types.PostgresConfig{
+					Host: pu.Hostname(),
+					User: pu.User.Username(),
+					Name: strings.TrimLeft(pu.Path, "/"),
+					Pass: pass,
+					Port: port,
+					Ssl:  "disable",
+				},
+			},
+			HA: types.HAConfig{
+				Enabled:           true,
+				HeartbeatInterval: 100 * time.Millisecond,
+			},
+			Tuning: types.Tuning{
+				BatchChangeDelay:    time.Hour,
+				NodeUpdateQueueSize: 30,
+			},
+		}
+
+		h, err := NewHeadscale(&cfg)
+		require.NoError(t, err)
+		require.NoError(t, h.startCluster(ctx))
+		t.Cleanup(h.nodeNotifier.Close)
+
+		return h
+	}
+
+	a := newServer()
+	b := newServer()
+
+	return a, b
+}
+
+func TestHA(t *testing.T) {
+	a, b := newHATestServers(t)
+	defer a.cluster.Close()
+	ctx := context.Background()
+
+	// Users created on one instance are known to the other.
+	_, err := newHeadscaleV1APIServer(a).CreateUser(ctx, &v1.CreateUserRequest{Name: "user1"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return len(b.store.Users()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "user1", b.store.Users()[0].Name)
+
+	// An interactive registration started on a can be waited for on b,
+	// and completed on a.
+	regReq := tailcfg.RegisterRequest{
+		NodeKey:  key.NewNode().Public(),
+		Hostinfo: &tailcfg.Hostinfo{Hostname: "node1"},
+	}
+	resp, err := a.handleRegisterInteractive(regReq, key.NewMachine().Public())
+	require.NoError(t, err)
+	regReq.Followup = resp.AuthURL
+	regID := path.Base(resp.AuthURL)
+
+	waited := make(chan *tailcfg.RegisterResponse, 1)
+	go func() {
+		resp, err := b.waitForFollowup(ctx, regReq)
+		if err != nil {
+			t.Errorf("waitForFollowup() error = %v", err)
+		}
+		waited <- resp
+	}()
+
+	require.Eventually(t, func() bool {
+		_, ok := b.registrationCache.Get(types.RegistrationID(regID))
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	registered, err := newHeadscaleV1APIServer(a).RegisterNode(ctx, &v1.RegisterNodeRequest{
+		User: "user1",
+		Key:  regID,
+	})
+	require.NoError(t, err)
+
+	select {
+	case resp := <-waited:
+		require.NotNil(t, resp)
+		require.True(t, resp.MachineAuthorized)
+		require.Equal(t, "user1", resp.User.DisplayName)
+	case <-time.After(5 * time.Second):
+		t.Fatal("registration was not signalled on the other instance")
+	}
+
+	nodeID := types.NodeID(registered.GetNode().GetId())
+	node, ok := b.store.Node(nodeID)
+	require.True(t, ok)
+	require.Equal(t, "node1", node.Hostname)
+
+	// The IP of the node is not allocated again on b.
+	ipv4, _, err := b.ipAlloc.Next()
+	require.NoError(t, err)
+	require.NotEqual(t, *node.IPv4, *ipv4)
+
+	// A node connected to b is online on a, until b stops.
+	ch := make(chan types.StateUpdate, 30)
+	b.nodeNotifier.AddNode(nodeID, ch)
+	b.updateNodeOnlineStatus(true, node)
+	require.Eventually(t, func() bool {
+		return a.nodeNotifier.IsConnected(nodeID)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// One instance is the leader, a takes over when b stops.
+	require.Eventually(t, func() bool {
+		return a.isLeader() != b.isLeader()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	b.cluster.Close()
+	require.Eventually(t, func() bool {
+		return !a.nodeNotifier.IsConnected(nodeID)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, a.isLeader, 5*time.Second, 10*time.Millisecond)
+
+	node, ok = a.store.Node(nodeID)
+	require.True(t, ok)
+	require.NotNil(t, node.LastSeen)
+}
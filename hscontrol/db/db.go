@@ -678,6 +678,125 @@ AND auth_key_id NOT IN (
 				},
 				Rollback: func(db *gorm.DB) error { return nil },
 			},
+			// Add author and message to policies to keep a history
+			// of policy revisions.
+			{
+				ID: "202504011200",
+				Migrate: func(tx *gorm.DB) error {
+					return tx.AutoMigrate(&types.Policy{})
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			// Add the health warnings reported by the nodes.
+			{
+				ID: "202504151200",
+				Migrate: func(tx *gorm.DB) error {
+					if !tx.Migrator().HasColumn(&types.Node{}, "health_warnings") {
+						err := tx.Migrator().AddColumn(&types.Node{}, "health_warnings")
+						if err != nil {
+							return fmt.Errorf("adding column types.Node: %w", err)
+						}
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			// Add the storage of tailnet lock and the node key signatures.
+			{
+				ID: "202505011200",
+				Migrate: func(tx *gorm.DB) error {
+					err := tx.AutoMigrate(&types.TailnetLockAUM{}, &types.TailnetLockState{})
+					if err != nil {
+						return fmt.Errorf("creating tailnet lock tables: %w", err)
+					}
+
+					if !tx.Migrator().HasColumn(&types.Node{}, "key_signature") {
+						err := tx.Migrator().AddColumn(&types.Node{}, "key_signature")
+						if err != nil {
+							return fmt.Errorf("adding column types.Node: %w", err)
+						}
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			// Add the interactive registrations which are shared between
+			// the instances in HA mode, and make sure two instances can
+			// not hand out the same address.
+			{
+				ID: "202506011200",
+				Migrate: func(tx *gorm.DB) error {
+					err := tx.AutoMigrate(&types.Registration{}, &types.OIDCRegistration{})
+					if err != nil {
+						return fmt.Errorf("creating registration tables: %w", err)
+					}
+
+					// Nodes without an address of a family have NULL, which
+					// is not unique, rather than an empty string.
+					for _, stmt := range []string{
+						"UPDATE nodes SET ipv4 = NULL WHERE ipv4 = ''",
+						"UPDATE nodes SET ipv6 = NULL WHERE ipv6 = ''",
+						"CREATE UNIQUE INDEX IF NOT EXISTS idx_nodes_ipv4 ON nodes (ipv4)",
+						"CREATE UNIQUE INDEX IF NOT EXISTS idx_nodes_ipv6 ON nodes (ipv6)",
+					} {
+						if err := tx.Exec(stmt).Error; err != nil {
+							return fmt.Errorf("making node addresses unique: %w", err)
+						}
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			// Record the revision every policy replaced, the unique
+			// parent stops two concurrent updates based on the same
+			// revision from both being stored.
+			{
+				ID: "202507011200",
+				Migrate: func(tx *gorm.DB) error {
+					if !tx.Migrator().HasColumn(&types.Policy{}, "parent_id") {
+						err := tx.Migrator().AddColumn(&types.Policy{}, "parent_id")
+						if err != nil {
+							return fmt.Errorf("adding column types.Policy: %w", err)
+						}
+					}
+
+					err := tx.Exec(`
+UPDATE policies SET parent_id = COALESCE(
+	(SELECT MAX(previous.id) FROM policies previous WHERE previous.id < policies.id),
+	0
+)`).Error
+					if err != nil {
+						return fmt.Errorf("setting the parent of the policies: %w", err)
+					}
+
+					if !tx.Migrator().HasIndex(&types.Policy{}, "ParentID") {
+						err := tx.Migrator().CreateIndex(&types.Policy{}, "ParentID")
+						if err != nil {
+							return fmt.Errorf("creating index on the parent of the policies: %w", err)
+						}
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
+			// Store the initialisation of tailnet lock in progress, so
+			// it can be finished on another instance in HA mode.
+			{
+				ID: "202507151200",
+				Migrate: func(tx *gorm.DB) error {
+					err := tx.AutoMigrate(&types.TailnetLockInit{})
+					if err != nil {
+						return fmt.Errorf("creating tailnet lock initialisation table: %w", err)
+					}
+
+					return nil
+				},
+				Rollback: func(db *gorm.DB) error { return nil },
+			},
 		},
 	)
 
@@ -696,6 +815,35 @@ AND auth_key_id NOT IN (
 	return &db, err
 }
 
+// PostgresDSN returns the connection string of the postgres database, for
+// the connections which are not made through gorm.
+func PostgresDSN(cfg types.PostgresConfig) string {
+	dbString := fmt.Sprintf(
+		"host=%s dbname=%s user=%s",
+		cfg.Host,
+		cfg.Name,
+		cfg.User,
+	)
+
+	if sslEnabled, err := strconv.ParseBool(cfg.Ssl); err == nil {
+		if !sslEnabled {
+			dbString += " sslmode=disable"
+		}
+	} else {
+		dbString += fmt.Sprintf(" sslmode=%s", cfg.Ssl)
+	}
+
+	if cfg.Port != 0 {
+		dbString += fmt.Sprintf(" port=%d", cfg.Port)
+	}
+
+	if cfg.Pass != "" {
+		dbString += fmt.Sprintf(" password=%s", cfg.Pass)
+	}
+
+	return dbString
+}
+
 func openDB(cfg types.DatabaseConfig) (*gorm.DB, error) {
 	// TODO(kradalby): Integrate this with zerolog
 	var dbLogger logger.Interface
@@ -755,35 +903,17 @@ func openDB(cfg types.DatabaseConfig) (*gorm.DB, error) {
 		return db, err
 
 	case types.DatabasePostgres:
-		dbString := fmt.Sprintf(
-			"host=%s dbname=%s user=%s",
-			cfg.Postgres.Host,
-			cfg.Postgres.Name,
-			cfg.Postgres.User,
-		)
-
 		log.Info().
 			Str("database", types.DatabasePostgres).
-			Str("path", dbString).
+			Str("path", fmt.Sprintf(
+				"host=%s dbname=%s user=%s",
+				cfg.Postgres.Host,
+				cfg.Postgres.Name,
+				cfg.Postgres.User,
+			)).
 			Msg("Opening database")
 
-		if sslEnabled, err := strconv.ParseBool(cfg.Postgres.Ssl); err == nil {
-			if !sslEnabled {
-				dbString += " sslmode=disable"
-			}
-		} else {
-			dbString += fmt.Sprintf(" sslmode=%s", cfg.Postgres.Ssl)
-		}
-
-		if cfg.Postgres.Port != 0 {
-			dbString += fmt.Sprintf(" port=%d", cfg.Postgres.Port)
-		}
-
-		if cfg.Postgres.Pass != "" {
-			dbString += fmt.Sprintf(" password=%s", cfg.Postgres.Pass)
-		}
-
-		db, err := gorm.Open(postgres.Open(dbString), &gorm.Config{
+		db, err := gorm.Open(postgres.Open(PostgresDSN(cfg.Postgres)), &gorm.Config{
 			Logger: dbLogger,
 		})
 		if err != nil {
@@ -0,0 +1,285 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExportVersion is the version of the format written by Export. It must be
+// increased when a change of the format cannot be imported as is by older
+// versions of headscale.
+const ExportVersion = 1
+
+var (
+	ErrImportVersion      = errors.New("unsupported export version")
+	ErrImportNotEmpty     = errors.New("database is not empty")
+	ErrImportUnknownTable = errors.New("unknown table in export")
+	ErrBackupNotSupported = errors.New("online backups are only supported for sqlite, use pg_dump for postgres")
+)
+
+// exportHeader is the first line of an export.
+type exportHeader struct {
+	Version   int       `json:"version"`
+	Headscale string    `json:"headscale"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// exportRecord is a line of an export after the header, a row of a table.
+type exportRecord struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// exportTable is a table of the database which is exported.
+type exportTable struct {
+	name string
+
+	// sequence is true if the primary key is generated by the database,
+	// which has to be reset in postgres after rows were imported.
+	sequence bool
+
+	// rows returns pointers to all rows of the table, ordered by their
+	// primary key.
+	rows      func(rx *gorm.DB) ([]any, error)
+	importRow func(tx *gorm.DB, row json.RawMessage) error
+}
+
+// exportTables are the tables which are exported, in the order rows are
+// imported, so rows are imported after the rows they refer to. The KV
+// table is not included, it was removed by migration 202312101430.
+var exportTables = []exportTable{
+	newExportTable[types.User]("users", true),
+	newExportTable[types.PreAuthKey]("pre_auth_keys", true),
+	newExportTable[types.APIKey]("api_keys", true),
+	newExportTable[types.Node]("nodes", true),
+	newExportTable[types.Policy]("policies", true),
+	newExportTable[types.TailnetLockState]("tailnet_lock_states", true),
+	newExportTable[types.TailnetLockAUM]("tailnet_lock_aums", false),
+}
+
+func newExportTable[T any](name string, sequence bool) exportTable {
+	return exportTable{
+		name:     name,
+		sequence: sequence,
+		rows: func(rx *gorm.DB) ([]any, error) {
+			var rows []T
+			err := rx.Unscoped().
+				Order(clause.OrderByColumn{Column: clause.PrimaryColumn}).
+				Find(&rows).Error
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", name, err)
+			}
+
+			ret := make([]any, len(rows))
+			for i := range rows {
+				ret[i] = &rows[i]
+			}
+
+			return ret, nil
+		},
+		importRow: func(tx *gorm.DB, data json.RawMessage) error {
+			var row T
+			if err := json.Unmarshal(data, &row); err != nil {
+				return fmt.Errorf("decoding row of %s: %w", name, err)
+			}
+
+			if err := tx.Omit(clause.Associations).Create(&row).Error; err != nil {
+				return fmt.Errorf("inserting row of %s: %w", name, err)
+			}
+
+			return nil
+		},
+	}
+}
+
+// Export writes the users, nodes, pre auth keys, API keys, policies and the
+// tailnet lock state to w, as newline delimited JSON. The export does not
+// depend on the type of the database, it can be imported into both sqlite
+// and postgres. It returns the number of rows exported per table.
+func (hsdb *HSDatabase) Export(w io.Writer) (map[string]int, error) {
+	return Read(hsdb.DB, func(rx *gorm.DB) (map[string]int, error) {
+		enc := json.NewEncoder(w)
+
+		err := enc.Encode(exportHeader{
+			Version:   ExportVersion,
+			Headscale: types.Version,
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("writing export header: %w", err)
+		}
+
+		counts := make(map[string]int, len(exportTables))
+		for _, table := range exportTables {
+			rows, err := table.rows(rx)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, row := range rows {
+				data, err := json.Marshal(row)
+				if err != nil {
+					return nil, fmt.Errorf("encoding row of %s: %w", table.name, err)
+				}
+
+				if err := enc.Encode(exportRecord{Table: table.name, Row: data}); err != nil {
+					return nil, fmt.Errorf("writing export: %w", err)
+				}
+			}
+			counts[table.name] = len(rows)
+		}
+
+		return counts, nil
+	})
+}
+
+// Import reads an export written by Export into the database, which must
+// be empty. The migrations are run when the database is opened, so the
+// rows are always imported into the current schema. The primary keys of
+// the rows are kept. It returns the number of rows imported per table.
+func (hsdb *HSDatabase) Import(r io.Reader) (map[string]int, error) {
+	dec := json.NewDecoder(r)
+
+	var header exportHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("reading export header: %w", err)
+	}
+
+	if header.Version < 1 || header.Version > ExportVersion {
+		return nil, fmt.Errorf("%w: %d, headscale %s supports up to %d", ErrImportVersion, header.Version, types.Version, ExportVersion)
+	}
+
+	log.Info().
+		Int("version", header.Version).
+		Str("headscale", header.Headscale).
+		Time("created_at", header.CreatedAt).
+		Msg("Importing export")
+
+	tables := make(map[string]exportTable, len(exportTables))
+	for _, table := range exportTables {
+		tables[table.name] = table
+	}
+
+	return Write(hsdb.DB, func(tx *gorm.DB) (map[string]int, error) {
+		if err := requireEmpty(tx); err != nil {
+			return nil, err
+		}
+
+		counts := make(map[string]int, len(exportTables))
+		for {
+			var record exportRecord
+			if err := dec.Decode(&record); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("reading export: %w", err)
+			}
+
+			table, ok := tables[record.Table]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q", ErrImportUnknownTable, record.Table)
+			}
+
+			if err := table.importRow(tx, record.Row); err != nil {
+				return nil, err
+			}
+			counts[table.name]++
+		}
+
+		if hsdb.cfg.Type == types.DatabasePostgres {
+			if err := resetSequences(tx); err != nil {
+				return nil, err
+			}
+		}
+
+		return counts, nil
+	})
+}
+
+// requireEmpty returns ErrImportNotEmpty if any of the exported tables has
+// rows, the rows to import could have the same primary keys.
+func requireEmpty(tx *gorm.DB) error {
+	for _, table := range exportTables {
+		var count int64
+		if err := tx.Table(table.name).Count(&count).Error; err != nil {
+			return fmt.Errorf("counting %s: %w", table.name, err)
+		}
+
+		if count > 0 {
+			return fmt.Errorf("%w: %s has %d rows", ErrImportNotEmpty, table.name, count)
+		}
+	}
+
+	return nil
+}
+
+// resetSequences sets the sequences generating the primary keys in postgres
+// after the rows were inserted with their primary keys, so new rows do not
+// get the primary key of an existing row.
+func resetSequences(tx *gorm.DB) error {
+	for _, table := range exportTables {
+		if !table.sequence {
+			continue
+		}
+
+		err := tx.Exec(fmt.Sprintf(
+			`SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM %[1]s`,
+			table.name,
+		)).Error
+		if err != nil {
+			return fmt.Errorf("resetting sequence of %s: %w", table.name, err)
+		}
+	}
+
+	return nil
+}
+
+// Backup writes a consistent copy of the sqlite database to path, while
+// headscale keeps using the database. The migrations are not run, the
+// database may be used by another version of headscale.
+//
+// The sqlite driver does not expose the backup API, VACUUM INTO makes the
+// copy instead, in a read transaction which does not block writes in WAL
+// mode.
+func Backup(cfg types.DatabaseConfig, path string) error {
+	if cfg.Type != types.DatabaseSqlite {
+		return ErrBackupNotSupported
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup file %q already exists", path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("checking backup file: %w", err)
+	}
+
+	if err := util.EnsureDir(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("creating directory for backup: %w", err)
+	}
+
+	dbConn, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := dbConn.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	if err := dbConn.Exec("VACUUM INTO ?", path).Error; err != nil {
+		return fmt.Errorf("backing up database to %q: %w", path, err)
+	}
+
+	return nil
+}
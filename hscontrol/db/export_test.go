@@ -0,0 +1,205 @@
+package db
+
+import (
+	"bytes"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tka"
+	"tailscale.com/types/key"
+)
+
+// populateForExport creates a row in all exported tables.
+func populateForExport(t *testing.T, hsdb *HSDatabase) {
+	t.Helper()
+
+	user, err := hsdb.CreateUser(types.User{Name: "user1", DisplayName: "User One"})
+	require.NoError(t, err)
+
+	deleted, err := hsdb.CreateUser(types.User{Name: "deleted"})
+	require.NoError(t, err)
+	require.NoError(t, hsdb.DB.Delete(deleted).Error)
+
+	pak, err := hsdb.CreatePreAuthKey(types.UserID(user.ID), true, false, nil, []string{"tag:server"})
+	require.NoError(t, err)
+
+	_, _, err = hsdb.CreateAPIKey(nil)
+	require.NoError(t, err)
+
+	ipv4 := netip.MustParseAddr("100.64.0.1")
+	node := types.Node{
+		MachineKey:     key.NewMachine().Public(),
+		NodeKey:        key.NewNode().Public(),
+		DiscoKey:       key.NewDisco().Public(),
+		Hostname:       "server",
+		GivenName:      "server",
+		UserID:         user.ID,
+		RegisterMethod: util.RegisterMethodAuthKey,
+		AuthKeyID:      &pak.ID,
+		IPv4:           &ipv4,
+		Hostinfo:       &tailcfg.Hostinfo{Hostname: "server", OS: "linux"},
+		Endpoints:      []netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:41641")},
+		ApprovedRoutes: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")},
+		ForcedTags:     []string{"tag:server"},
+		KeySignature:   []byte("signature"),
+	}
+	require.NoError(t, hsdb.DB.Save(&node).Error)
+
+	_, err = hsdb.SetPolicy(`{"acls": []}`, types.PolicyAuthorCLI, "initial policy", nil)
+	require.NoError(t, err)
+
+	nlPriv := key.NewNLPrivate()
+	require.NoError(t, InitTailnetLock(hsdb.DB))
+	_, _, err = tka.Create(NewTailnetLockStorage(hsdb.DB), tka.State{
+		Keys:               []tka.Key{{Kind: tka.Key25519, Public: nlPriv.Public().Verifier(), Votes: 1}},
+		DisablementSecrets: [][]byte{tka.DisablementKDF([]byte("secret"))},
+	}, nlPriv)
+	require.NoError(t, err)
+}
+
+// requireSameRows checks that all exported tables have the same rows in
+// both databases.
+func requireSameRows(t *testing.T, want, got *HSDatabase) {
+	t.Helper()
+
+	var wantExport, gotExport bytes.Buffer
+	wantCounts, err := want.Export(&wantExport)
+	require.NoError(t, err)
+	gotCounts, err := got.Export(&gotExport)
+	require.NoError(t, err)
+	require.Equal(t, wantCounts, gotCounts)
+
+	// The header has the time of the export.
+	_, wantRows, _ := strings.Cut(wantExport.String(), "\n")
+	_, gotRows, _ := strings.Cut(gotExport.String(), "\n")
+	if diff := cmp.Diff(wantRows, gotRows); diff != "" {
+		t.Errorf("rows differ (-want +got):\n%s", diff)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	src := dbForTest(t)
+	populateForExport(t, src)
+
+	var export bytes.Buffer
+	counts, err := src.Export(&export)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{
+		"users":               2,
+		"pre_auth_keys":       1,
+		"api_keys":            1,
+		"nodes":               1,
+		"policies":            1,
+		"tailnet_lock_states": 1,
+		"tailnet_lock_aums":   1,
+	}, counts)
+
+	dst := dbForTest(t)
+	imported, err := dst.Import(bytes.NewReader(export.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, counts, imported)
+
+	requireSameRows(t, src, dst)
+
+	nodes, err := dst.ListNodes()
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	require.Equal(t, "user1", nodes[0].User.Name)
+	require.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")}, nodes[0].ApprovedRoutes)
+
+	// New rows do not reuse the primary keys of the imported rows.
+	user, err := dst.CreateUser(types.User{Name: "user2"})
+	require.NoError(t, err)
+	require.Equal(t, uint(3), user.ID)
+
+	// Importing into a database which is in use would mix the rows.
+	_, err = dst.Import(bytes.NewReader(export.Bytes()))
+	require.ErrorIs(t, err, ErrImportNotEmpty)
+}
+
+func TestImportInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		export  string
+		wantErr error
+	}{
+		{
+			name:    "newer-version",
+			export:  `{"version": 2}`,
+			wantErr: ErrImportVersion,
+		},
+		{
+			name: "unknown-table",
+			export: `{"version": 1}
+{"table": "kvs", "row": {"Key": "key", "Value": "value"}}`,
+			wantErr: ErrImportUnknownTable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hsdb := dbForTest(t)
+
+			_, err := hsdb.Import(strings.NewReader(tt.export))
+			require.ErrorIs(t, err, tt.wantErr)
+
+			users, err := hsdb.ListUsers()
+			require.NoError(t, err)
+			require.Empty(t, users)
+		})
+	}
+}
+
+func TestImportPostgres(t *testing.T) {
+	src := dbForTest(t)
+	populateForExport(t, src)
+
+	var export bytes.Buffer
+	counts, err := src.Export(&export)
+	require.NoError(t, err)
+
+	dst := newPostgresTestDB(t)
+	imported, err := dst.Import(&export)
+	require.NoError(t, err)
+	require.Equal(t, counts, imported)
+
+	// Postgres stores times with a lower precision, the rows are compared
+	// without them.
+	nodes, err := dst.ListNodes()
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	require.Equal(t, "user1", nodes[0].User.Name)
+	require.Equal(t, []byte("signature"), nodes[0].KeySignature)
+	require.Equal(t, "linux", nodes[0].Hostinfo.OS)
+
+	user, err := dst.CreateUser(types.User{Name: "user2"})
+	require.NoError(t, err)
+	require.Equal(t, uint(3), user.ID)
+}
+
+func TestBackup(t *testing.T) {
+	hsdb := dbForTest(t)
+	populateForExport(t, hsdb)
+
+	path := filepath.Join(t.TempDir(), "backup", "headscale.db")
+	require.NoError(t, Backup(*hsdb.cfg, path))
+
+	backupCfg := *hsdb.cfg
+	backupCfg.Sqlite.Path = path
+	backup, err := NewHeadscaleDatabase(backupCfg, "", emptyCache())
+	require.NoError(t, err)
+
+	requireSameRows(t, hsdb, backup)
+
+	// Existing files are not overwritten.
+	require.Error(t, Backup(*hsdb.cfg, path))
+
+	require.ErrorIs(t, Backup(types.DatabaseConfig{Type: types.DatabasePostgres}, path), ErrBackupNotSupported)
+}
@@ -156,6 +156,20 @@ func (i *IPAllocator) Next() (*netip.Addr, *netip.Addr, error) {
 	return ret4, ret6, nil
 }
 
+// Reserve marks the addresses as handed out, so they are not handed out
+// again. In HA mode, it is called with the addresses handed out by the
+// other instances.
+func (i *IPAllocator) Reserve(addrs ...*netip.Addr) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, addr := range addrs {
+		if addr != nil {
+			i.usedIPs.Add(*addr)
+		}
+	}
+}
+
 var ErrCouldNotAllocateIP = errors.New("failed to allocate IP")
 
 func (i *IPAllocator) nextLocked(prev netip.Addr, prefix *netip.Prefix) (*netip.Addr, error) {
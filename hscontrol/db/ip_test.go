@@ -517,3 +517,21 @@ func TestIPAllocatorNextNoReservedIPs(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, na("100.115.94.0"), *nextChrome)
 }
+
+func TestIPAllocatorReserve(t *testing.T) {
+	alloc, err := NewIPAllocator(
+		nil,
+		mpp("100.64.0.0/10"),
+		mpp("fd7a:115c:a1e0::/48"),
+		types.IPAllocationStrategySequential,
+	)
+	require.NoError(t, err)
+
+	// Another instance handed out the next addresses.
+	alloc.Reserve(nap("100.64.0.1"), nil, nap("fd7a:115c:a1e0::1"))
+
+	v4, v6, err := alloc.Next()
+	require.NoError(t, err)
+	assert.Equal(t, na("100.64.0.2"), *v4)
+	assert.Equal(t, na("fd7a:115c:a1e0::2"), *v6)
+}
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var ErrMigrateVerification = errors.New("migrated database differs from the source database")
+
+// MigratedTable is a table copied by MigrateDatabase, with the number of
+// rows and the checksum of the rows in both databases.
+type MigratedTable struct {
+	Table    string `json:"table"`
+	Rows     int64  `json:"rows"`
+	Checksum string `json:"checksum"`
+}
+
+// MigrateDatabase copies all rows of src to dst, which must be empty, for
+// example to move from sqlite to postgres. The tables are copied in the
+// order of their references and the primary keys are kept. Afterwards, the
+// number of rows and a checksum of the rows of every table are compared.
+//
+// Headscale must not use src while it is copied. Times are copied with
+// the precision of postgres, microseconds.
+func MigrateDatabase(src, dst *HSDatabase) ([]MigratedTable, error) {
+	_, err := Read(src.DB, func(rx *gorm.DB) (struct{}, error) {
+		return struct{}{}, dst.Write(func(tx *gorm.DB) error {
+			if err := requireEmpty(tx); err != nil {
+				return err
+			}
+
+			for _, table := range exportTables {
+				rows, err := table.rows(rx)
+				if err != nil {
+					return err
+				}
+
+				for _, row := range rows {
+					data, err := canonicalRow(row)
+					if err != nil {
+						return fmt.Errorf("encoding row of %s: %w", table.name, err)
+					}
+
+					if err := table.importRow(tx, data); err != nil {
+						return err
+					}
+				}
+
+				log.Info().
+					Str("table", table.name).
+					Int("rows", len(rows)).
+					Msg("Copied table")
+			}
+
+			if dst.cfg.Type == types.DatabasePostgres {
+				return resetSequences(tx)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	want, err := Read(src.DB, checksumTables)
+	if err != nil {
+		return nil, fmt.Errorf("verifying source database: %w", err)
+	}
+
+	got, err := Read(dst.DB, checksumTables)
+	if err != nil {
+		return nil, fmt.Errorf("verifying destination database: %w", err)
+	}
+
+	for i := range want {
+		if want[i] != got[i] {
+			return nil, fmt.Errorf(
+				"%w: %s has %d rows with checksum %s, instead of %d rows with checksum %s",
+				ErrMigrateVerification,
+				want[i].Table,
+				got[i].Rows, got[i].Checksum,
+				want[i].Rows, want[i].Checksum,
+			)
+		}
+	}
+
+	return want, nil
+}
+
+// checksumTables counts the rows of the tables and computes the checksum of
+// their rows, which does not depend on the type of the database.
+func checksumTables(rx *gorm.DB) ([]MigratedTable, error) {
+	ret := make([]MigratedTable, 0, len(exportTables))
+	for _, table := range exportTables {
+		var count int64
+		if err := rx.Table(table.name).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("counting %s: %w", table.name, err)
+		}
+
+		rows, err := table.rows(rx)
+		if err != nil {
+			return nil, err
+		}
+
+		// The rows are sorted by their encoding, the order of primary keys
+		// which are strings depends on the collation of the database.
+		encoded := make([][]byte, 0, len(rows))
+		for _, row := range rows {
+			data, err := canonicalRow(row)
+			if err != nil {
+				return nil, fmt.Errorf("encoding row of %s: %w", table.name, err)
+			}
+			encoded = append(encoded, data)
+		}
+		slices.SortFunc(encoded, bytes.Compare)
+
+		hash := sha256.New()
+		for _, data := range encoded {
+			hash.Write(data)
+			hash.Write([]byte{'\n'})
+		}
+
+		ret = append(ret, MigratedTable{
+			Table:    table.name,
+			Rows:     count,
+			Checksum: hex.EncodeToString(hash.Sum(nil)),
+		})
+	}
+
+	return ret, nil
+}
+
+// canonicalRow returns the row as JSON with the times in UTC, truncated to
+// microseconds, so the same row read from sqlite and postgres is equal.
+func canonicalRow(row any) ([]byte, error) {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(canonicalTimes(v))
+}
+
+func canonicalTimes(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = canonicalTimes(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = canonicalTimes(value)
+		}
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateDatabase(t *testing.T) {
+	src := dbForTest(t)
+	populateForExport(t, src)
+
+	dst := dbForTest(t)
+	tables, err := MigrateDatabase(src, dst)
+	require.NoError(t, err)
+	require.Len(t, tables, len(exportTables))
+	require.Equal(t, "users", tables[0].Table)
+	require.Equal(t, int64(2), tables[0].Rows)
+
+	// The times are truncated to microseconds, the rows are compared by
+	// their checksums.
+	got, err := Read(dst.DB, checksumTables)
+	require.NoError(t, err)
+	require.Equal(t, tables, got)
+
+	nodes, err := dst.ListNodes()
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	require.Equal(t, "user1", nodes[0].User.Name)
+
+	user, err := dst.CreateUser(types.User{Name: "user2"})
+	require.NoError(t, err)
+	require.Equal(t, uint(3), user.ID)
+
+	_, err = MigrateDatabase(src, dst)
+	require.ErrorIs(t, err, ErrImportNotEmpty)
+}
+
+func TestMigrateDatabasePostgres(t *testing.T) {
+	src := dbForTest(t)
+	populateForExport(t, src)
+
+	dst := newPostgresTestDB(t)
+	tables, err := MigrateDatabase(src, dst)
+	require.NoError(t, err)
+
+	got, err := Read(dst.DB, checksumTables)
+	require.NoError(t, err)
+	require.Equal(t, tables, got)
+
+	nodes, err := dst.ListNodes()
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	require.Equal(t, "user1", nodes[0].User.Name)
+	require.Equal(t, []byte("signature"), nodes[0].KeySignature)
+
+	user, err := dst.CreateUser(types.User{Name: "user2"})
+	require.NoError(t, err)
+	require.Equal(t, uint(3), user.ID)
+}
+
+func TestCanonicalRow(t *testing.T) {
+	at := time.Date(2025, 1, 2, 3, 4, 5, 123456789, time.FixedZone("CET", 3600))
+
+	got, err := canonicalRow(struct {
+		ID        uint64
+		Name      string
+		CreatedAt time.Time
+		Expiry    *time.Time
+		Tags      []string
+	}{
+		ID:        1 << 60,
+		Name:      "not a time",
+		CreatedAt: at,
+		Expiry:    &at,
+		Tags:      []string{"2025-01-02T03:04:05.123456789Z"},
+	})
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"ID": 1152921504606846976,
+		"Name": "not a time",
+		"CreatedAt": "2025-01-02T02:04:05.123456Z",
+		"Expiry": "2025-01-02T02:04:05.123456Z",
+		"Tags": ["2025-01-02T03:04:05.123456Z"]
+	}`, string(got))
+}
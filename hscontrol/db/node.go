@@ -287,6 +287,28 @@ func NodeSetExpiry(tx *gorm.DB,
 	return tx.Model(&types.Node{}).Where("id = ?", nodeID).Update("expiry", expiry).Error
 }
 
+func (hsdb *HSDatabase) NodeSetHealthWarnings(nodeID types.NodeID, warnings map[string]string) error {
+	return hsdb.Write(func(tx *gorm.DB) error {
+		return NodeSetHealthWarnings(tx, nodeID, warnings)
+	})
+}
+
+// NodeSetHealthWarnings saves the health warnings reported by the node.
+func NodeSetHealthWarnings(tx *gorm.DB,
+	nodeID types.NodeID, warnings map[string]string,
+) error {
+	b, err := json.Marshal(warnings)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Model(&types.Node{}).Where("id = ?", nodeID).Update("health_warnings", string(b)).Error; err != nil {
+		return fmt.Errorf("updating health warnings: %w", err)
+	}
+
+	return nil
+}
+
 func (hsdb *HSDatabase) DeleteNode(node *types.Node) error {
 	return hsdb.Write(func(tx *gorm.DB) error {
 		return DeleteNode(tx, node)
@@ -322,6 +344,8 @@ func (hsdb *HSDatabase) DeleteEphemeralNode(
 
 // HandleNodeFromAuthPath is called from the OIDC or CLI auth path
 // with a registrationID to register or reauthenticate a node.
+// The registration is looked up in the registration cache, and in the
+// database for registrations started on another instance in HA mode.
 // If the node found in the registration cache is not already registered,
 // it will be registered with the user and the node will be removed from the cache.
 // If the node is already registered, the expiry will be updated.
@@ -336,7 +360,21 @@ func (hsdb *HSDatabase) HandleNodeFromAuthPath(
 ) (*types.Node, bool, error) {
 	var newNode bool
 	node, err := Write(hsdb.DB, func(tx *gorm.DB) (*types.Node, error) {
-		if reg, ok := hsdb.regCache.Get(registrationID); ok {
+		reg, ok := hsdb.regCache.Get(registrationID)
+		if !ok {
+			stored, err := GetRegistration(tx, registrationID)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("looking up registration: %w", err)
+			}
+
+			// Nobody waits for a registration from the database on
+			// this instance, there is no channel to signal.
+			if stored != nil {
+				reg, ok = types.RegisterNode{Node: stored.Node}, true
+			}
+		}
+
+		if ok {
 			if node, _ := GetNodeByNodeKey(tx, reg.Node.NodeKey); node == nil {
 				user, err := GetUserByID(tx, userID)
 				if err != nil {
@@ -375,16 +413,22 @@ func (hsdb *HSDatabase) HandleNodeFromAuthPath(
 					ipv4, ipv6,
 				)
 
+				if err == nil {
+					err = tx.Delete(&types.Registration{}, "id = ?", registrationID).Error
+				}
+
 				if err == nil {
 					hsdb.regCache.Delete(registrationID)
 				}
 
 				// Signal to waiting clients that the machine has been registered.
-				select {
-				case reg.Registered <- node:
-				default:
+				if reg.Registered != nil {
+					select {
+					case reg.Registered <- node:
+					default:
+					}
+					close(reg.Registered)
 				}
-				close(reg.Registered)
 
 				newNode = true
 				return node, err
@@ -747,3 +747,39 @@ func TestRenameNode(t *testing.T) {
 	})
 	assert.ErrorContains(t, err, "name is not unique")
 }
+
+func TestNodeSetHealthWarnings(t *testing.T) {
+	db, err := newSQLiteTestDB()
+	if err != nil {
+		t.Fatalf("creating db: %s", err)
+	}
+
+	user, err := db.CreateUser(types.User{Name: "test"})
+	require.NoError(t, err)
+
+	node := types.Node{
+		MachineKey:     key.NewMachine().Public(),
+		NodeKey:        key.NewNode().Public(),
+		Hostname:       "test",
+		UserID:         user.ID,
+		RegisterMethod: util.RegisterMethodAuthKey,
+		Hostinfo:       &tailcfg.Hostinfo{},
+	}
+	err = db.DB.Save(&node).Error
+	require.NoError(t, err)
+
+	warnings := map[string]string{"dns-forward-failing": "DNS queries are failing"}
+	err = db.NodeSetHealthWarnings(node.ID, warnings)
+	require.NoError(t, err)
+
+	got, err := db.GetNodeByID(node.ID)
+	require.NoError(t, err)
+	assert.Equal(t, warnings, got.HealthWarnings)
+
+	err = db.NodeSetHealthWarnings(node.ID, nil)
+	require.NoError(t, err)
+
+	got, err = db.GetNodeByID(node.ID)
+	require.NoError(t, err)
+	assert.Empty(t, got.HealthWarnings)
+}
@@ -2,24 +2,66 @@ package db
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/juanfont/headscale/hscontrol/types"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
-// SetPolicy sets the policy in the database.
-func (hsdb *HSDatabase) SetPolicy(policy string) (*types.Policy, error) {
-	// Create a new policy.
-	p := types.Policy{
-		Data: policy,
+// SetPolicy sets the policy in the database. Every call stores a new
+// revision, older revisions are kept as history.
+// If base is not nil, the policy is only stored if base is still the
+// current revision, 0 meaning that there is no policy yet, otherwise
+// ErrPolicyChanged is returned.
+func (hsdb *HSDatabase) SetPolicy(policy, author, message string, base *uint) (*types.Policy, error) {
+	for {
+		parent, err := hsdb.currentPolicyID()
+		if err != nil {
+			return nil, err
+		}
+
+		if base != nil && *base != parent {
+			return nil, fmt.Errorf("%w since revision %d, the current revision is %d", types.ErrPolicyChanged, *base, parent)
+		}
+
+		p := types.Policy{
+			Data:     policy,
+			Author:   author,
+			Message:  message,
+			ParentID: parent,
+		}
+
+		err = hsdb.DB.Clauses(clause.Returning{}).Create(&p).Error
+		if err == nil {
+			return &p, nil
+		}
+
+		// The parent is unique, the insert fails if another revision
+		// was stored since the current one was read.
+		current, currentErr := hsdb.currentPolicyID()
+		if currentErr != nil || current == parent {
+			return nil, err
+		}
+
+		if base != nil {
+			return nil, fmt.Errorf("%w since revision %d, the current revision is %d", types.ErrPolicyChanged, *base, current)
+		}
 	}
+}
 
-	if err := hsdb.DB.Clauses(clause.Returning{}).Create(&p).Error; err != nil {
-		return nil, err
+// currentPolicyID returns the revision of the latest policy, or 0 if
+// there is no policy.
+func (hsdb *HSDatabase) currentPolicyID() (uint, error) {
+	p, err := hsdb.GetPolicy()
+	if errors.Is(err, types.ErrPolicyNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
 	}
 
-	return &p, nil
+	return p.ID, nil
 }
 
 // GetPolicy returns the latest policy in the database.
@@ -41,3 +83,42 @@ func (hsdb *HSDatabase) GetPolicy() (*types.Policy, error) {
 
 	return &p, nil
 }
+
+// ListPolicies returns all policy revisions, newest first.
+func (hsdb *HSDatabase) ListPolicies() ([]types.Policy, error) {
+	var policies []types.Policy
+	if err := hsdb.DB.Order("id DESC").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// GetPolicyByID returns the policy revision with the given ID.
+func (hsdb *HSDatabase) GetPolicyByID(id uint) (*types.Policy, error) {
+	var p types.Policy
+	if err := hsdb.DB.First(&p, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, types.ErrPolicyNotFound
+		}
+
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// RollbackPolicy stores the policy of revision id as a new revision,
+// the history itself is never rewritten.
+func (hsdb *HSDatabase) RollbackPolicy(id uint, author, message string) (*types.Policy, error) {
+	old, err := hsdb.GetPolicyByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("rollback to revision %d", id)
+	}
+
+	return hsdb.SetPolicy(old.Data, author, message, nil)
+}
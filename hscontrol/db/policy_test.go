@@ -0,0 +1,95 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"gopkg.in/check.v1"
+	"tailscale.com/types/ptr"
+)
+
+func (*Suite) TestPolicyHistory(c *check.C) {
+	_, err := db.GetPolicy()
+	c.Assert(err, check.Equals, types.ErrPolicyNotFound)
+
+	first, err := db.SetPolicy(`{"acls": []}`, "abcdefghij", "initial", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(first.Author, check.Equals, "abcdefghij")
+	c.Assert(first.Message, check.Equals, "initial")
+
+	second, err := db.SetPolicy(`{"acls": [{"action": "accept"}]}`, types.PolicyAuthorCLI, "", nil)
+	c.Assert(err, check.IsNil)
+
+	latest, err := db.GetPolicy()
+	c.Assert(err, check.IsNil)
+	c.Assert(latest.ID, check.Equals, second.ID)
+
+	policies, err := db.ListPolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(len(policies), check.Equals, 2)
+	c.Assert(policies[0].ID, check.Equals, second.ID)
+	c.Assert(policies[1].ID, check.Equals, first.ID)
+
+	got, err := db.GetPolicyByID(first.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(got.Data, check.Equals, first.Data)
+
+	_, err = db.GetPolicyByID(second.ID + 100)
+	c.Assert(err, check.Equals, types.ErrPolicyNotFound)
+}
+
+func (*Suite) TestRollbackPolicy(c *check.C) {
+	first, err := db.SetPolicy(`{"acls": []}`, types.PolicyAuthorCLI, "", nil)
+	c.Assert(err, check.IsNil)
+
+	_, err = db.SetPolicy(`{"acls": [{"action": "accept"}]}`, types.PolicyAuthorCLI, "", nil)
+	c.Assert(err, check.IsNil)
+
+	rolledBack, err := db.RollbackPolicy(first.ID, "abcdefghij", "")
+	c.Assert(err, check.IsNil)
+	c.Assert(rolledBack.ID > first.ID, check.Equals, true)
+	c.Assert(rolledBack.Data, check.Equals, first.Data)
+	c.Assert(rolledBack.Author, check.Equals, "abcdefghij")
+	c.Assert(rolledBack.Message, check.Equals, fmt.Sprintf("rollback to revision %d", first.ID))
+
+	latest, err := db.GetPolicy()
+	c.Assert(err, check.IsNil)
+	c.Assert(latest.Data, check.Equals, first.Data)
+
+	policies, err := db.ListPolicies()
+	c.Assert(err, check.IsNil)
+	c.Assert(len(policies), check.Equals, 3)
+
+	_, err = db.RollbackPolicy(1000, types.PolicyAuthorCLI, "")
+	c.Assert(err, check.Equals, types.ErrPolicyNotFound)
+}
+
+func (*Suite) TestSetPolicyBaseRevision(c *check.C) {
+	// 0 is the base revision when there is no policy yet.
+	first, err := db.SetPolicy(`{"acls": []}`, types.PolicyAuthorCLI, "", ptr.To(uint(0)))
+	c.Assert(err, check.IsNil)
+	c.Assert(first.ParentID, check.Equals, uint(0))
+
+	_, err = db.SetPolicy(`{"acls": []}`, types.PolicyAuthorCLI, "", ptr.To(uint(0)))
+	c.Assert(errors.Is(err, types.ErrPolicyChanged), check.Equals, true)
+
+	second, err := db.SetPolicy(`{"acls": [{"action": "accept"}]}`, types.PolicyAuthorCLI, "", ptr.To(first.ID))
+	c.Assert(err, check.IsNil)
+	c.Assert(second.ParentID, check.Equals, first.ID)
+
+	// Updating from a revision which is no longer the current one
+	// would silently overwrite the changes made since.
+	_, err = db.SetPolicy(`{"acls": []}`, types.PolicyAuthorCLI, "", ptr.To(first.ID))
+	c.Assert(errors.Is(err, types.ErrPolicyChanged), check.Equals, true)
+	c.Assert(err, check.ErrorMatches, fmt.Sprintf("policy was changed since revision %d, the current revision is %d", first.ID, second.ID))
+
+	// Another revision with the same parent cannot be stored, even when
+	// the check was passed before it was stored.
+	err = db.DB.Create(&types.Policy{Data: `{"acls": []}`, ParentID: first.ID}).Error
+	c.Assert(err, check.NotNil)
+
+	third, err := db.SetPolicy(`{"acls": []}`, types.PolicyAuthorCLI, "", nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(third.ParentID, check.Equals, second.ID)
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"gorm.io/gorm"
+)
+
+// SaveRegistration stores the interactive registration of node until
+// expiresAt, so it can be completed on another instance.
+func (hsdb *HSDatabase) SaveRegistration(id types.RegistrationID, node types.Node, expiresAt time.Time) error {
+	return hsdb.Write(func(tx *gorm.DB) error {
+		return tx.Create(&types.Registration{
+			ID:        id,
+			Node:      node,
+			ExpiresAt: expiresAt,
+		}).Error
+	})
+}
+
+func (hsdb *HSDatabase) GetRegistration(id types.RegistrationID) (*types.Registration, error) {
+	return Read(hsdb.DB, func(rx *gorm.DB) (*types.Registration, error) {
+		return GetRegistration(rx, id)
+	})
+}
+
+// GetRegistration returns the interactive registration with the given ID,
+// or gorm.ErrRecordNotFound if it does not exist or expired.
+func GetRegistration(tx *gorm.DB, id types.RegistrationID) (*types.Registration, error) {
+	var reg types.Registration
+	err := tx.Where("id = ? AND expires_at > ?", id, time.Now()).Take(&reg).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &reg, nil
+}
+
+// SaveOIDCRegistration stores the registration an OIDC login was started
+// for until expiresAt, so the login can end on another instance.
+func (hsdb *HSDatabase) SaveOIDCRegistration(reg types.OIDCRegistration) error {
+	return hsdb.Write(func(tx *gorm.DB) error {
+		return tx.Create(&reg).Error
+	})
+}
+
+// GetOIDCRegistration returns the registration of the OIDC login with the
+// given state, or gorm.ErrRecordNotFound if it does not exist or expired.
+func (hsdb *HSDatabase) GetOIDCRegistration(state string) (*types.OIDCRegistration, error) {
+	return Read(hsdb.DB, func(rx *gorm.DB) (*types.OIDCRegistration, error) {
+		var reg types.OIDCRegistration
+		err := rx.Where("state = ? AND expires_at > ?", state, time.Now()).Take(&reg).Error
+		if err != nil {
+			return nil, err
+		}
+
+		return &reg, nil
+	})
+}
+
+// DeleteExpiredRegistrations deletes the interactive registrations and OIDC
+// logins which expired, and returns how many were deleted.
+func DeleteExpiredRegistrations(tx *gorm.DB) (int64, error) {
+	now := time.Now()
+
+	regs := tx.Where("expires_at <= ?", now).Delete(&types.Registration{})
+	if regs.Error != nil {
+		return 0, fmt.Errorf("deleting expired registrations: %w", regs.Error)
+	}
+
+	logins := tx.Where("expires_at <= ?", now).Delete(&types.OIDCRegistration{})
+	if logins.Error != nil {
+		return 0, fmt.Errorf("deleting expired OIDC registrations: %w", logins.Error)
+	}
+
+	return regs.RowsAffected + logins.RowsAffected, nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/ptr"
+)
+
+func TestRegistrationFromDatabase(t *testing.T) {
+	hsdb := dbForTest(t)
+
+	user, err := hsdb.CreateUser(types.User{Name: "user1"})
+	require.NoError(t, err)
+
+	newNode := func(hostname string) types.Node {
+		return types.Node{
+			MachineKey: key.NewMachine().Public(),
+			NodeKey:    key.NewNode().Public(),
+			Hostname:   hostname,
+			Hostinfo:   &tailcfg.Hostinfo{Hostname: hostname},
+		}
+	}
+
+	id := types.MustRegistrationID()
+	laptop := newNode("laptop")
+	require.NoError(t, hsdb.SaveRegistration(id, laptop, time.Now().Add(time.Minute)))
+
+	expired := types.MustRegistrationID()
+	require.NoError(t, hsdb.SaveRegistration(expired, newNode("phone"), time.Now().Add(-time.Minute)))
+
+	reg, err := hsdb.GetRegistration(id)
+	require.NoError(t, err)
+	require.Equal(t, laptop.NodeKey, reg.Node.NodeKey)
+	require.Equal(t, "laptop", reg.Node.Hostinfo.Hostname)
+
+	_, err = hsdb.GetRegistration(expired)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// The registration was started on another instance, it is not in the
+	// registration cache.
+	ipv4 := netip.MustParseAddr("100.64.0.1")
+	node, created, err := hsdb.HandleNodeFromAuthPath(id, types.UserID(user.ID), nil, util.RegisterMethodCLI, &ipv4, nil)
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, laptop.NodeKey, node.NodeKey)
+	require.Equal(t, user.ID, node.UserID)
+
+	_, err = hsdb.GetRegistration(id)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	_, _, err = hsdb.HandleNodeFromAuthPath(expired, types.UserID(user.ID), nil, util.RegisterMethodCLI, nil, nil)
+	require.ErrorIs(t, err, ErrNodeNotFoundRegistrationCache)
+
+	require.NoError(t, hsdb.SaveOIDCRegistration(types.OIDCRegistration{
+		State:          "state",
+		RegistrationID: id,
+		Verifier:       ptr.To("verifier"),
+		ExpiresAt:      time.Now().Add(time.Minute),
+	}))
+	require.NoError(t, hsdb.SaveOIDCRegistration(types.OIDCRegistration{
+		State:     "expired",
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}))
+
+	login, err := hsdb.GetOIDCRegistration("state")
+	require.NoError(t, err)
+	require.Equal(t, id, login.RegistrationID)
+	require.Equal(t, "verifier", *login.Verifier)
+
+	_, err = hsdb.GetOIDCRegistration("expired")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	deleted, err := Write(hsdb.DB, DeleteExpiredRegistrations)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), deleted)
+
+	// Two instances registering nodes at the same time can not hand out
+	// the same address.
+	dup := newNode("dup")
+	dup.UserID = user.ID
+	dup.IPv4 = &ipv4
+	requireConstraintFailed(t, hsdb.DB.Save(&dup).Error)
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"tailscale.com/tka"
+)
+
+// tailnetLockStateID is the ID of the only TailnetLockState.
+const tailnetLockStateID = 1
+
+// TailnetLockStorage stores the AUMs of the tailnet key authority in the
+// database, within the transaction it was created with. It implements
+// tka.Chonk, so the authority can be opened and updated with the tka
+// package like the nodes do.
+type TailnetLockStorage struct {
+	tx *gorm.DB
+}
+
+func NewTailnetLockStorage(tx *gorm.DB) *TailnetLockStorage {
+	return &TailnetLockStorage{tx: tx}
+}
+
+// AUM returns the AUM with the given hash, or os.ErrNotExist.
+func (s *TailnetLockStorage) AUM(hash tka.AUMHash) (tka.AUM, error) {
+	var row types.TailnetLockAUM
+	if err := s.tx.First(&row, "hash = ?", hash.String()).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tka.AUM{}, os.ErrNotExist
+		}
+
+		return tka.AUM{}, err
+	}
+
+	return unserializeAUM(row)
+}
+
+// ChildAUMs returns the AUMs with the given parent.
+func (s *TailnetLockStorage) ChildAUMs(prevAUMHash tka.AUMHash) ([]tka.AUM, error) {
+	var rows []types.TailnetLockAUM
+	if err := s.tx.Where("prev_hash = ?", prevAUMHash.String()).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	return unserializeAUMs(rows)
+}
+
+// CommitVerifiedAUMs stores the AUMs, AUMs which are already stored are
+// skipped.
+func (s *TailnetLockStorage) CommitVerifiedAUMs(updates []tka.AUM) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	rows := make([]types.TailnetLockAUM, 0, len(updates))
+	for _, aum := range updates {
+		row := types.TailnetLockAUM{
+			Hash: aum.Hash().String(),
+			Data: aum.Serialize(),
+		}
+		if parent, ok := aum.Parent(); ok {
+			row.PrevHash = parent.String()
+		}
+		rows = append(rows, row)
+	}
+
+	return s.tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+}
+
+// Heads returns the AUMs without children, the latest AUM of every chain.
+func (s *TailnetLockStorage) Heads() ([]tka.AUM, error) {
+	var rows []types.TailnetLockAUM
+	err := s.tx.
+		Where("NOT EXISTS (SELECT 1 FROM tailnet_lock_aums AS child WHERE child.prev_hash = tailnet_lock_aums.hash)").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return unserializeAUMs(rows)
+}
+
+// SetLastActiveAncestor records the oldest AUM of the active chain.
+func (s *TailnetLockStorage) SetLastActiveAncestor(hash tka.AUMHash) error {
+	return s.tx.Model(&types.TailnetLockState{}).
+		Where("id = ?", tailnetLockStateID).
+		Update("last_active_ancestor", hash.String()).Error
+}
+
+// LastActiveAncestor returns the oldest AUM of the active chain, or nil
+// if it is not known.
+func (s *TailnetLockStorage) LastActiveAncestor() (*tka.AUMHash, error) {
+	state, err := GetTailnetLockState(s.tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.LastActiveAncestor == "" {
+		return nil, nil
+	}
+
+	var hash tka.AUMHash
+	if err := hash.UnmarshalText([]byte(state.LastActiveAncestor)); err != nil {
+		return nil, fmt.Errorf("parsing last active ancestor: %w", err)
+	}
+
+	return &hash, nil
+}
+
+func unserializeAUM(row types.TailnetLockAUM) (tka.AUM, error) {
+	var aum tka.AUM
+	if err := aum.Unserialize(row.Data); err != nil {
+		return tka.AUM{}, fmt.Errorf("unserializing AUM %s: %w", row.Hash, err)
+	}
+
+	return aum, nil
+}
+
+func unserializeAUMs(rows []types.TailnetLockAUM) ([]tka.AUM, error) {
+	aums := make([]tka.AUM, 0, len(rows))
+	for _, row := range rows {
+		aum, err := unserializeAUM(row)
+		if err != nil {
+			return nil, err
+		}
+		aums = append(aums, aum)
+	}
+
+	return aums, nil
+}
+
+func (hsdb *HSDatabase) GetTailnetLockState() (*types.TailnetLockState, error) {
+	return Read(hsdb.DB, GetTailnetLockState)
+}
+
+// GetTailnetLockState returns the state of tailnet lock, or
+// gorm.ErrRecordNotFound if it was never initialised.
+func GetTailnetLockState(tx *gorm.DB) (*types.TailnetLockState, error) {
+	var state types.TailnetLockState
+	if err := tx.First(&state, tailnetLockStateID).Error; err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// LockTailnetLockState is like GetTailnetLockState, but locks the state
+// until the end of the write transaction, so changes to the authority made
+// by the headscale instances sharing the database are serialised.
+func LockTailnetLockState(tx *gorm.DB) (*types.TailnetLockState, error) {
+	var state types.TailnetLockState
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&state, tailnetLockStateID).Error; err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// SetTailnetLockInit stores the initialisation of tailnet lock in
+// progress, replacing an earlier one.
+func SetTailnetLockInit(tx *gorm.DB, pending types.TailnetLockInit) error {
+	pending.ID = tailnetLockStateID
+	if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&pending).Error; err != nil {
+		return fmt.Errorf("storing tailnet lock initialisation: %w", err)
+	}
+
+	return nil
+}
+
+// LockTailnetLockInit returns the initialisation of tailnet lock in
+// progress, locked until the end of the write transaction, or
+// gorm.ErrRecordNotFound if there is none.
+func LockTailnetLockInit(tx *gorm.DB) (*types.TailnetLockInit, error) {
+	var pending types.TailnetLockInit
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pending, tailnetLockStateID).Error; err != nil {
+		return nil, err
+	}
+
+	return &pending, nil
+}
+
+// DeleteTailnetLockInit removes the initialisation of tailnet lock in
+// progress.
+func DeleteTailnetLockInit(tx *gorm.DB) error {
+	return tx.Delete(&types.TailnetLockInit{}, tailnetLockStateID).Error
+}
+
+// InitTailnetLock replaces the AUMs of a previous, disabled, tailnet lock
+// with a new authority and removes the signatures of the nodes. The
+// authority must be bootstrapped with the genesis AUM afterwards.
+func InitTailnetLock(tx *gorm.DB) error {
+	if err := tx.Where("1 = 1").Delete(&types.TailnetLockAUM{}).Error; err != nil {
+		return fmt.Errorf("deleting AUMs: %w", err)
+	}
+
+	if err := tx.Model(&types.Node{}).Where("key_signature IS NOT NULL").Update("key_signature", nil).Error; err != nil {
+		return fmt.Errorf("deleting node key signatures: %w", err)
+	}
+
+	state := types.TailnetLockState{
+		ID:      tailnetLockStateID,
+		Enabled: true,
+	}
+
+	return tx.Save(&state).Error
+}
+
+// DisableTailnetLock records that tailnet lock was disabled with the
+// given secret.
+func DisableTailnetLock(tx *gorm.DB, secret []byte) error {
+	return tx.Model(&types.TailnetLockState{}).
+		Where("id = ?", tailnetLockStateID).
+		Updates(map[string]any{
+			"enabled":            false,
+			"disablement_secret": secret,
+		}).Error
+}
+
+// NodeSetKeySignature saves the tailnet lock signature of the node key.
+func NodeSetKeySignature(tx *gorm.DB, nodeID types.NodeID, sig []byte) error {
+	if err := tx.Model(&types.Node{}).Where("id = ?", nodeID).Update("key_signature", sig).Error; err != nil {
+		return fmt.Errorf("updating node key signature: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+)
+
+// ExecProvider publishes DNS records by running a command with the name,
+// type and value of the record as arguments, for DNS providers without
+// RFC 2136 support.
+type ExecProvider struct {
+	cfg types.ExecDNSConfig
+}
+
+func NewExecProvider(cfg types.ExecDNSConfig) *ExecProvider {
+	return &ExecProvider{cfg: cfg}
+}
+
+// SetRecord runs the command to replace the records of type typ of name
+// with a record holding value.
+func (p *ExecProvider) SetRecord(ctx context.Context, name, typ, value string) error {
+	if p.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.cfg.Timeout)
+		defer cancel()
+	}
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.cfg.Command, name, typ, value)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s: %w: %s", p.cfg.Command, err, strings.TrimSpace(output.String()))
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package dns
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+)
+
+func TestExecProvider(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "records")
+	script := filepath.Join(dir, "set-record")
+
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+if [ "$2" != "TXT" ]; then
+	echo "unsupported type $2"
+	exit 1
+fi
+echo "$1 $2 $3" > `+out+`
+`), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewExecProvider(types.ExecDNSConfig{
+		Command: script,
+		Timeout: 10 * time.Second,
+	})
+
+	err = p.SetRecord(context.Background(), "_acme-challenge.node1.example.com", "TXT", "challenge")
+	if err != nil {
+		t.Fatalf("SetRecord() error = %v", err)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "_acme-challenge.node1.example.com TXT challenge\n"; string(got) != want {
+		t.Errorf("command got %q, want %q", got, want)
+	}
+
+	err = p.SetRecord(context.Background(), "node1.example.com", "A", "100.64.0.1")
+	if err == nil || !strings.Contains(err.Error(), "unsupported type A") {
+		t.Errorf("SetRecord() error = %v, want the output of the failed command", err)
+	}
+}
@@ -0,0 +1,35 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+)
+
+var errUnsupportedRecordType = errors.New("unsupported record type")
+
+// Provider publishes the DNS records requested by nodes, like the ACME
+// DNS-01 challenges of `tailscale cert`, in the DNS zone of the tailnet.
+type Provider interface {
+	// SetRecord replaces the records of type typ of name with a record
+	// holding value.
+	SetRecord(ctx context.Context, name, typ, value string) error
+}
+
+// NewProvider returns the provider configured in cfg, or nil if no
+// provider is configured. baseDomain is the zone the records are
+// published in, unless the provider configures another one.
+func NewProvider(cfg types.DNSCertsConfig, baseDomain string) (Provider, error) {
+	switch cfg.Provider {
+	case types.DNSCertProviderNone:
+		return nil, nil
+	case types.DNSCertProviderRFC2136:
+		return NewRFC2136Provider(cfg.RFC2136, baseDomain), nil
+	case types.DNSCertProviderExec:
+		return NewExecProvider(cfg.Exec), nil
+	default:
+		return nil, fmt.Errorf("unknown DNS provider %q", cfg.Provider)
+	}
+}
@@ -0,0 +1,91 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	miekgdns "github.com/miekg/dns"
+)
+
+// RFC2136Provider publishes DNS records with RFC 2136 dynamic updates to
+// an authoritative DNS server, optionally authenticated with TSIG.
+type RFC2136Provider struct {
+	server string
+	zone   string
+	ttl    uint32
+
+	tsigKey       string
+	tsigAlgorithm string
+
+	client *miekgdns.Client
+}
+
+// NewRFC2136Provider returns a provider sending dynamic updates of the
+// zone, defaulting to baseDomain, to the configured server.
+func NewRFC2136Provider(cfg types.RFC2136Config, baseDomain string) *RFC2136Provider {
+	server := cfg.Server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	zone := cfg.Zone
+	if zone == "" {
+		zone = baseDomain
+	}
+
+	p := &RFC2136Provider{
+		server: server,
+		zone:   miekgdns.Fqdn(zone),
+		ttl:    uint32(cfg.TTL.Seconds()),
+		client: &miekgdns.Client{Timeout: cfg.Timeout},
+	}
+
+	if cfg.TSIGKey != "" {
+		p.tsigKey = miekgdns.Fqdn(cfg.TSIGKey)
+		p.tsigAlgorithm = miekgdns.Fqdn(strings.ToLower(cfg.TSIGAlgorithm))
+		p.client.TsigSecret = map[string]string{p.tsigKey: cfg.TSIGSecret}
+	}
+
+	return p
+}
+
+// SetRecord replaces the TXT records of name with one holding value.
+func (p *RFC2136Provider) SetRecord(ctx context.Context, name, typ, value string) error {
+	if typ != "TXT" {
+		return fmt.Errorf("%w: %s", errUnsupportedRecordType, typ)
+	}
+
+	fqdn := miekgdns.Fqdn(name)
+	if !miekgdns.IsSubDomain(p.zone, fqdn) {
+		return fmt.Errorf("%s is not in zone %s", fqdn, p.zone)
+	}
+
+	msg := new(miekgdns.Msg)
+	msg.SetUpdate(p.zone)
+	msg.RemoveRRset([]miekgdns.RR{&miekgdns.TXT{
+		Hdr: miekgdns.RR_Header{Name: fqdn, Rrtype: miekgdns.TypeTXT, Class: miekgdns.ClassINET},
+	}})
+	msg.Insert([]miekgdns.RR{&miekgdns.TXT{
+		Hdr: miekgdns.RR_Header{Name: fqdn, Rrtype: miekgdns.TypeTXT, Class: miekgdns.ClassINET, Ttl: p.ttl},
+		Txt: []string{value},
+	}})
+
+	if p.tsigKey != "" {
+		msg.SetTsig(p.tsigKey, p.tsigAlgorithm, 300, time.Now().Unix())
+	}
+
+	resp, _, err := p.client.ExchangeContext(ctx, msg, p.server)
+	if err != nil {
+		return fmt.Errorf("sending DNS update to %s: %w", p.server, err)
+	}
+
+	if resp.Rcode != miekgdns.RcodeSuccess {
+		return fmt.Errorf("DNS update of %s refused by %s: %s", fqdn, p.server, miekgdns.RcodeToString[resp.Rcode])
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	miekgdns "github.com/miekg/dns"
+)
+
+const (
+	testTSIGKey    = "headscale."
+	testTSIGSecret = "aGVhZHNjYWxlIHRlc3Qgc2VjcmV0"
+)
+
+// updateServer is a stand-in authoritative DNS server, which applies
+// the dynamic updates of a zone to the TXT records it holds.
+type updateServer struct {
+	zone string
+
+	mu      sync.Mutex
+	records map[string][]string
+}
+
+func (s *updateServer) ServeDNS(w miekgdns.ResponseWriter, req *miekgdns.Msg) {
+	resp := new(miekgdns.Msg)
+	resp.SetReply(req)
+
+	switch {
+	case req.Opcode != miekgdns.OpcodeUpdate || len(req.Question) != 1 || req.Question[0].Name != s.zone:
+		resp.Rcode = miekgdns.RcodeNotZone
+	case req.IsTsig() == nil || w.TsigStatus() != nil:
+		resp.Rcode = miekgdns.RcodeRefused
+	default:
+		s.mu.Lock()
+		for _, rr := range req.Ns {
+			switch {
+			case rr.Header().Class == miekgdns.ClassANY:
+				delete(s.records, rr.Header().Name)
+			case rr.Header().Rrtype == miekgdns.TypeTXT:
+				s.records[rr.Header().Name] = append(s.records[rr.Header().Name], rr.(*miekgdns.TXT).Txt...)
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	if req.IsTsig() != nil && w.TsigStatus() == nil {
+		resp.SetTsig(testTSIGKey, miekgdns.HmacSHA256, 300, time.Now().Unix())
+	}
+
+	w.WriteMsg(resp)
+}
+
+func (s *updateServer) txt(name string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.records[name]
+}
+
+func startUpdateServer(t *testing.T, zone string) (*updateServer, string) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %s", err)
+	}
+
+	handler := &updateServer{
+		zone:    miekgdns.Fqdn(zone),
+		records: make(map[string][]string),
+	}
+
+	started := make(chan struct{})
+	server := &miekgdns.Server{
+		PacketConn:        conn,
+		Handler:           handler,
+		TsigSecret:        map[string]string{testTSIGKey: testTSIGSecret},
+		NotifyStartedFunc: func() { close(started) },
+		// The default only accepts queries and notifies.
+		MsgAcceptFunc: func(miekgdns.Header) miekgdns.MsgAcceptAction {
+			return miekgdns.MsgAccept
+		},
+	}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	<-started
+
+	return handler, conn.LocalAddr().String()
+}
+
+func TestRFC2136Provider(t *testing.T) {
+	server, addr := startUpdateServer(t, "example.com")
+
+	p := NewRFC2136Provider(types.RFC2136Config{
+		Server:        addr,
+		TSIGKey:       "headscale",
+		TSIGSecret:    testTSIGSecret,
+		TSIGAlgorithm: "hmac-sha256",
+		TTL:           time.Minute,
+		Timeout:       5 * time.Second,
+	}, "example.com")
+
+	ctx := context.Background()
+	name := "_acme-challenge.node1.example.com"
+
+	if err := p.SetRecord(ctx, name, "TXT", "challenge1"); err != nil {
+		t.Fatalf("SetRecord() error = %v", err)
+	}
+
+	// Setting the record again replaces the previous challenge.
+	if err := p.SetRecord(ctx, name, "TXT", "challenge2"); err != nil {
+		t.Fatalf("SetRecord() error = %v", err)
+	}
+
+	got := server.txt(miekgdns.Fqdn(name))
+	if len(got) != 1 || got[0] != "challenge2" {
+		t.Errorf("TXT records = %v, want [challenge2]", got)
+	}
+
+	if err := p.SetRecord(ctx, "_acme-challenge.node1.example.org", "TXT", "challenge"); err == nil {
+		t.Errorf("SetRecord() outside of the zone succeeded")
+	}
+
+	if err := p.SetRecord(ctx, name, "A", "100.64.0.1"); err == nil {
+		t.Errorf("SetRecord() of an A record succeeded")
+	}
+}
+
+func TestRFC2136ProviderRefused(t *testing.T) {
+	_, addr := startUpdateServer(t, "example.com")
+
+	// Without TSIG the server refuses the update.
+	p := NewRFC2136Provider(types.RFC2136Config{
+		Server:  addr,
+		TTL:     time.Minute,
+		Timeout: 5 * time.Second,
+	}, "example.com")
+
+	err := p.SetRecord(context.Background(), "_acme-challenge.node1.example.com", "TXT", "challenge")
+	if err == nil {
+		t.Fatalf("SetRecord() without TSIG succeeded")
+	}
+}
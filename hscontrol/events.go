@@ -0,0 +1,169 @@
+package hscontrol
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/juanfont/headscale/hscontrol/events"
+	"github.com/juanfont/headscale/hscontrol/notifier"
+	"github.com/juanfont/headscale/hscontrol/policy"
+	"github.com/juanfont/headscale/hscontrol/routes"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/rs/zerolog/log"
+)
+
+// subscribeEvents subscribes the parts of headscale reacting to state
+// changes to the event bus. The mapper subscribes when it is created.
+func (h *Headscale) subscribeEvents() {
+	h.events.Subscribe("log", func(ctx context.Context, evs []events.Event) error {
+		for _, ev := range evs {
+			log.Debug().
+				Str("event", ev.Type()).
+				Interface("data", ev).
+				Msg("event published")
+		}
+
+		return nil
+	})
+
+	h.events.Subscribe("metrics", func(ctx context.Context, evs []events.Event) error {
+		for _, ev := range evs {
+			eventsPublished.WithLabelValues(ev.Type()).Inc()
+		}
+
+		return nil
+	})
+
+	h.events.Subscribe("views", h.handleViewEvents)
+	h.events.Subscribe("notifier", h.nodeNotifier.HandleEvents)
+}
+
+// policyChangedEvents returns the events of a policy change, in which
+// the routes of the nodes in approved were auto approved.
+func policyChangedEvents(approved []types.NodeID) []events.Event {
+	evs := []events.Event{events.PolicyChanged{}}
+	for _, id := range approved {
+		evs = append(evs, events.RoutesChanged{NodeID: id})
+	}
+
+	return evs
+}
+
+// handleViewEvents updates the policy manager with the changed users and
+// nodes, and sends the nodes affected by the events the updates they need.
+// The changed nodes, and the nodes of changed users, are sent to all nodes
+// which can see them, and to themselves.
+func (h *Headscale) handleViewEvents(ctx context.Context, evs []events.Event) error {
+	var usersChanged, nodesChanged, viewsChanged, policyChanged bool
+	var changedUsers []types.UserID
+	var changedNodes []types.NodeID
+
+	for _, ev := range evs {
+		switch ev := ev.(type) {
+		case events.NodeRegistered:
+			nodesChanged = true
+			changedNodes = append(changedNodes, ev.NodeID)
+		case events.NodeRenamed:
+			nodesChanged = true
+			changedNodes = append(changedNodes, ev.NodeID)
+		case events.NodeMoved:
+			nodesChanged = true
+			changedNodes = append(changedNodes, ev.NodeID)
+		case events.TagsChanged:
+			nodesChanged = true
+			changedNodes = append(changedNodes, ev.NodeID)
+		case events.RoutesChanged:
+			nodesChanged = true
+			changedNodes = append(changedNodes, ev.NodeID)
+		case events.NodeDeleted:
+			nodesChanged = true
+		case events.PolicyChanged:
+			nodesChanged = true
+			policyChanged = true
+		case events.PrimaryRoutesChanged:
+			viewsChanged = true
+		case events.UserCreated, events.UserDeleted:
+			usersChanged = true
+		case events.UserRenamed:
+			usersChanged = true
+			changedUsers = append(changedUsers, ev.UserID)
+		case events.UserUpdated:
+			usersChanged = true
+			changedUsers = append(changedUsers, ev.UserID)
+		}
+	}
+
+	if !usersChanged && !nodesChanged && !viewsChanged {
+		return nil
+	}
+
+	if usersChanged {
+		if _, err := h.polMan.SetUsers(h.store.Users()); err != nil {
+			return err
+		}
+	}
+
+	nodes := h.store.Nodes()
+	if nodesChanged {
+		if _, err := h.polMan.SetNodes(nodes); err != nil {
+			return err
+		}
+	}
+
+	for _, node := range nodes {
+		if slices.Contains(changedUsers, types.UserID(node.UserID)) {
+			changedNodes = append(changedNodes, node.ID)
+		}
+	}
+
+	// Policy and user changes can change what every node sees, node changes
+	// only what the changed nodes and their peers see.
+	all := policyChanged || usersChanged
+
+	return notifyViewChanges(ctx, h.polMan, h.views, h.primaryRoutes, h.nodeNotifier, evs[0].Type(), all, nodes, changedNodes...)
+}
+
+// notifyViewChanges recomputes what the nodes can see of the tailnet, all
+// of them or only the ones affected by the changed nodes, and only sends
+// updates to the nodes which view changed, instead of sending a full update
+// to all nodes.
+func notifyViewChanges(
+	ctx context.Context,
+	polMan policy.PolicyManager,
+	views *policy.Views,
+	primary *routes.PrimaryRoutes,
+	notif *notifier.Notifier,
+	origin string,
+	all bool,
+	nodes types.Nodes,
+	changed ...types.NodeID,
+) error {
+	update := views.UpdateNodes
+	if all {
+		update = views.Update
+	}
+
+	changes, err := update(polMan, primary, nodes, changed...)
+	if err != nil {
+		return fmt.Errorf("computing changes to send to nodes: %w", err)
+	}
+
+	for id, change := range changes {
+		ctx := types.NotifyCtx(ctx, origin, "na")
+
+		// The packet filter and the node itself are sent with every peer
+		// change, a self update is only needed if there are no peer changes.
+		if len(change.PeersRemoved) > 0 {
+			notif.NotifyByNodeID(ctx, types.UpdatePeerRemoved(change.PeersRemoved...), id)
+		}
+
+		if len(change.PeersChanged) > 0 {
+			notif.NotifyByNodeID(ctx, types.UpdatePeerChanged(change.PeersChanged...), id)
+		} else if change.SelfChanged && len(change.PeersRemoved) == 0 {
+			notif.NotifyByNodeID(ctx, types.UpdateSelf(id), id)
+		}
+	}
+
+	return nil
+}
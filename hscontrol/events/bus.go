@@ -0,0 +1,109 @@
+// Package events implements the internal event bus of headscale.
+//
+// Changes to the state of headscale, such as a node registering or the
+// policy changing, are published as typed events. The parts of headscale
+// reacting to them, like the notifier sending updates to nodes, the mapper
+// and metrics, subscribe to the bus instead of being called by every place
+// changing the state.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Event is a change to the state of headscale.
+type Event interface {
+	// Type returns the name of the event, used in logs and metrics.
+	Type() string
+}
+
+// Handler handles the events published together. Events published
+// together describe one change and can be handled at once.
+type Handler func(ctx context.Context, evs []Event) error
+
+type subscriber struct {
+	id      uint64
+	name    string
+	handler Handler
+}
+
+// Bus delivers the published events to all subscribers.
+// Events are delivered synchronously, in the order the subscribers
+// subscribed, so a subscriber sees the state the event was published for.
+// Subscribers which do slow work, like calling a webhook, should do so in
+// the background.
+type Bus struct {
+	mu          sync.RWMutex
+	nextID      uint64
+	subscribers []subscriber
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe adds a handler for all events published on the bus.
+// The returned function removes it again.
+func (b *Bus) Subscribe(name string, handler Handler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	id := b.nextID
+
+	// The subscribers are replaced rather than changed in place, as
+	// Publish delivers to the subscribers without holding the lock.
+	subscribers := slices.Clip(b.subscribers)
+	b.subscribers = append(subscribers, subscriber{id: id, name: name, handler: handler})
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.subscribers = slices.DeleteFunc(slices.Clone(b.subscribers), func(sub subscriber) bool {
+			return sub.id == id
+		})
+	}
+}
+
+// Publish delivers evs to all subscribers. All subscribers are called, even
+// if one fails, and their errors are returned joined.
+func (b *Bus) Publish(ctx context.Context, evs ...Event) error {
+	if len(evs) == 0 {
+		return nil
+	}
+
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, sub := range subscribers {
+		if err := sub.handler(ctx, evs); err != nil {
+			errs = append(errs, fmt.Errorf("handling events in %s: %w", sub.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// On returns a Handler calling fn for each of the events of type T, and
+// ignoring all other events.
+func On[T Event](fn func(ctx context.Context, ev T) error) Handler {
+	return func(ctx context.Context, evs []Event) error {
+		var errs []error
+		for _, ev := range evs {
+			if ev, ok := ev.(T); ok {
+				if err := fn(ctx, ev); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+
+		return errors.Join(errs...)
+	}
+}
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBusPublish(t *testing.T) {
+	bus := NewBus()
+
+	var got []string
+	record := func(name string) Handler {
+		return func(ctx context.Context, evs []Event) error {
+			for _, ev := range evs {
+				got = append(got, name+":"+ev.Type())
+			}
+
+			return nil
+		}
+	}
+
+	errFailed := errors.New("failed")
+
+	bus.Subscribe("first", record("first"))
+	bus.Subscribe("failing", func(ctx context.Context, evs []Event) error {
+		return errFailed
+	})
+	bus.Subscribe("second", record("second"))
+
+	require.NoError(t, bus.Publish(context.Background()))
+	require.Empty(t, got)
+
+	err := bus.Publish(context.Background(), NodeRegistered{NodeID: 1}, PolicyChanged{})
+	require.ErrorIs(t, err, errFailed)
+	require.ErrorContains(t, err, "handling events in failing")
+
+	require.Equal(t, []string{
+		"first:node-registered",
+		"first:policy-changed",
+		"second:node-registered",
+		"second:policy-changed",
+	}, got)
+
+	// Unsubscribed handlers are not called anymore.
+	unsubscribe := bus.Subscribe("third", record("third"))
+	require.ErrorIs(t, bus.Publish(context.Background(), DNSChanged{}), errFailed)
+	unsubscribe()
+	require.ErrorIs(t, bus.Publish(context.Background(), DNSChanged{}), errFailed)
+
+	require.Equal(t, []string{
+		"first:dns-changed",
+		"second:dns-changed",
+		"third:dns-changed",
+		"first:dns-changed",
+		"second:dns-changed",
+	}, got[4:])
+}
+
+func TestOn(t *testing.T) {
+	var got []NodeDeleted
+	handler := On(func(ctx context.Context, ev NodeDeleted) error {
+		got = append(got, ev)
+		if ev.NodeID == 3 {
+			return errors.New("node 3")
+		}
+
+		return nil
+	})
+
+	err := handler(context.Background(), []Event{
+		NodeDeleted{NodeID: 1},
+		NodeRegistered{NodeID: 2},
+		NodeDeleted{NodeID: 3},
+	})
+	require.ErrorContains(t, err, "node 3")
+	require.Equal(t, []NodeDeleted{{NodeID: 1}, {NodeID: 3}}, got)
+}
@@ -0,0 +1,82 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrUnknownEvent = errors.New("unknown event type")
+
+// Encoded is an event encoded as JSON with its type, so it can be sent to
+// other headscale instances and decoded there.
+type Encoded struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type decoder func(data json.RawMessage) (Event, error)
+
+// decoders are the decoders of all events, by their type.
+var decoders = map[string]decoder{}
+
+func init() {
+	register[NodeRegistered]()
+	register[NodeChanged]()
+	register[NodeRenamed]()
+	register[NodeMoved]()
+	register[NodeExpired]()
+	register[NodeDeleted]()
+	register[NodeConnected]()
+	register[NodeDisconnected]()
+	register[NodeHealthChanged]()
+	register[NodeSignatureChanged]()
+	register[TagsChanged]()
+	register[RoutesChanged]()
+	register[PrimaryRoutesChanged]()
+	register[PolicyChanged]()
+	register[UserCreated]()
+	register[UserRenamed]()
+	register[UserUpdated]()
+	register[UserDeleted]()
+	register[DERPMapChanged]()
+	register[TailnetLockChanged]()
+	register[DNSChanged]()
+}
+
+func register[T Event]() {
+	var zero T
+	decoders[zero.Type()] = func(data json.RawMessage) (Event, error) {
+		var ev T
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return nil, err
+		}
+
+		return ev, nil
+	}
+}
+
+// Encode encodes the event, it can be decoded with Decode.
+func Encode(ev Event) (Encoded, error) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return Encoded{}, fmt.Errorf("encoding %s: %w", ev.Type(), err)
+	}
+
+	return Encoded{Type: ev.Type(), Data: data}, nil
+}
+
+// Decode decodes an event encoded with Encode, to the same type of event.
+func Decode(enc Encoded) (Event, error) {
+	decode, ok := decoders[enc.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEvent, enc.Type)
+	}
+
+	ev, err := decode(enc.Data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", enc.Type, err)
+	}
+
+	return ev, nil
+}
@@ -0,0 +1,37 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	for _, ev := range []Event{
+		NodeRegistered{NodeID: 1, RegistrationID: "registration"},
+		NodeExpired{NodeID: 2, Expiry: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)},
+		NodeDisconnected{NodeID: 3, LastSeen: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)},
+		PrimaryRoutesChanged{},
+		UserRenamed{UserID: 4},
+		TailnetLockChanged{Info: &tailcfg.TKAInfo{Head: "head"}},
+		DNSChanged{},
+	} {
+		t.Run(ev.Type(), func(t *testing.T) {
+			enc, err := Encode(ev)
+			require.NoError(t, err)
+			require.Equal(t, ev.Type(), enc.Type)
+
+			got, err := Decode(enc)
+			require.NoError(t, err)
+			require.Equal(t, ev, got)
+		})
+	}
+
+	_, err := Decode(Encoded{Type: "node-teleported", Data: []byte(`{}`)})
+	require.ErrorIs(t, err, ErrUnknownEvent)
+
+	_, err = Decode(Encoded{Type: "node-deleted", Data: []byte(`[]`)})
+	require.ErrorContains(t, err, "decoding node-deleted")
+}
@@ -0,0 +1,146 @@
+package events
+
+import (
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"tailscale.com/tailcfg"
+)
+
+// NodeRegistered is published when a node is registered, or registered
+// again by logging in. RegistrationID is the interactive registration
+// which was completed, if any.
+type NodeRegistered struct {
+	NodeID         types.NodeID
+	RegistrationID types.RegistrationID
+}
+
+// NodeChanged is published when a node changed itself, for example its
+// endpoints or hostinfo, without changing what it can access.
+type NodeChanged struct {
+	NodeID types.NodeID
+}
+
+// NodeRenamed is published when the given name of a node changed.
+type NodeRenamed struct {
+	NodeID types.NodeID
+}
+
+// NodeMoved is published when a node was moved to another user.
+type NodeMoved struct {
+	NodeID types.NodeID
+}
+
+// NodeExpired is published when the key of a node expired or was
+// expired.
+type NodeExpired struct {
+	NodeID types.NodeID
+	Expiry time.Time
+}
+
+// NodeDeleted is published when a node was deleted.
+type NodeDeleted struct {
+	NodeID types.NodeID
+}
+
+// NodeConnected is published when a node opened a streaming map session.
+type NodeConnected struct {
+	NodeID types.NodeID
+}
+
+// NodeDisconnected is published when the streaming map session of a node
+// ended.
+type NodeDisconnected struct {
+	NodeID   types.NodeID
+	LastSeen time.Time
+}
+
+// NodeHealthChanged is published when a node reported a change to its
+// health. It does not change anything for the other nodes.
+type NodeHealthChanged struct {
+	NodeID types.NodeID
+}
+
+// NodeSignatureChanged is published when the tailnet lock signature of
+// the node key of a node changed.
+type NodeSignatureChanged struct {
+	NodeID types.NodeID
+}
+
+// TagsChanged is published when the forced tags of a node changed.
+type TagsChanged struct {
+	NodeID types.NodeID
+}
+
+// RoutesChanged is published when the announced or approved routes of a
+// node changed.
+type RoutesChanged struct {
+	NodeID types.NodeID
+}
+
+// PrimaryRoutesChanged is published when the primary routes changed, as a
+// node serving routes connected or disconnected.
+type PrimaryRoutesChanged struct{}
+
+// PolicyChanged is published when a new policy was loaded which changed
+// the packet filter.
+type PolicyChanged struct{}
+
+// UserCreated is published when a user was created.
+type UserCreated struct {
+	UserID types.UserID
+}
+
+// UserRenamed is published when a user was renamed.
+type UserRenamed struct {
+	UserID types.UserID
+}
+
+// UserUpdated is published when the information of a user changed, for
+// example from the claims of an OIDC login.
+type UserUpdated struct {
+	UserID types.UserID
+}
+
+// UserDeleted is published when a user was deleted.
+type UserDeleted struct {
+	UserID types.UserID
+}
+
+// DERPMapChanged is published when the DERP map was updated.
+type DERPMapChanged struct {
+	DERPMap *tailcfg.DERPMap
+}
+
+// TailnetLockChanged is published when tailnet lock was initialised,
+// updated or disabled. Info is what the nodes are sent, nil if tailnet
+// lock was never initialised.
+type TailnetLockChanged struct {
+	Info *tailcfg.TKAInfo
+}
+
+// DNSChanged is published when the DNS configuration sent to the nodes
+// changed, for example the extra records.
+type DNSChanged struct{}
+
+func (NodeRegistered) Type() string       { return "node-registered" }
+func (NodeChanged) Type() string          { return "node-changed" }
+func (NodeRenamed) Type() string          { return "node-renamed" }
+func (NodeMoved) Type() string            { return "node-moved" }
+func (NodeExpired) Type() string          { return "node-expired" }
+func (NodeDeleted) Type() string          { return "node-deleted" }
+func (NodeConnected) Type() string        { return "node-connected" }
+func (NodeDisconnected) Type() string     { return "node-disconnected" }
+func (NodeHealthChanged) Type() string    { return "node-health-changed" }
+func (NodeSignatureChanged) Type() string { return "node-signature-changed" }
+func (TagsChanged) Type() string          { return "tags-changed" }
+func (RoutesChanged) Type() string        { return "routes-changed" }
+func (PrimaryRoutesChanged) Type() string { return "primary-routes-changed" }
+func (PolicyChanged) Type() string        { return "policy-changed" }
+func (UserCreated) Type() string          { return "user-created" }
+func (UserRenamed) Type() string          { return "user-renamed" }
+func (UserUpdated) Type() string          { return "user-updated" }
+func (UserDeleted) Type() string          { return "user-deleted" }
+func (DERPMapChanged) Type() string       { return "derpmap-changed" }
+func (TailnetLockChanged) Type() string   { return "tailnet-lock-changed" }
+func (DNSChanged) Type() string           { return "dns-changed" }
@@ -3,31 +3,38 @@ package hscontrol
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/netip"
 	"os"
 	"slices"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/puzpuzpuz/xsync/v3"
 	"github.com/rs/zerolog/log"
 	"github.com/samber/lo"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
 	"gorm.io/gorm"
 	"tailscale.com/net/tsaddr"
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/key"
+	"tailscale.com/types/ptr"
 
 	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
 	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/events"
 	"github.com/juanfont/headscale/hscontrol/policy"
 	"github.com/juanfont/headscale/hscontrol/routes"
+	"github.com/juanfont/headscale/hscontrol/state"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
 )
@@ -57,8 +64,9 @@ func (api headscaleV1APIServer) CreateUser(
 	if err != nil {
 		return nil, err
 	}
+	api.h.store.PutUser(*user)
 
-	err = usersChangedHook(api.h.db, api.h.polMan, api.h.nodeNotifier)
+	err = api.h.events.Publish(ctx, events.UserCreated{UserID: types.UserID(user.ID)})
 	if err != nil {
 		return nil, fmt.Errorf("updating resources using user: %w", err)
 	}
@@ -84,6 +92,12 @@ func (api headscaleV1APIServer) RenameUser(
 	if err != nil {
 		return nil, err
 	}
+	api.h.store.PutUser(*newUser)
+
+	err = api.h.events.Publish(ctx, events.UserRenamed{UserID: types.UserID(newUser.ID)})
+	if err != nil {
+		return nil, fmt.Errorf("updating resources using user: %w", err)
+	}
 
 	return &v1.RenameUserResponse{User: newUser.Proto()}, nil
 }
@@ -101,8 +115,9 @@ func (api headscaleV1APIServer) DeleteUser(
 	if err != nil {
 		return nil, err
 	}
+	api.h.store.DeleteUser(types.UserID(user.ID))
 
-	err = usersChangedHook(api.h.db, api.h.polMan, api.h.nodeNotifier)
+	err = api.h.events.Publish(ctx, events.UserDeleted{UserID: types.UserID(user.ID)})
 	if err != nil {
 		return nil, fmt.Errorf("updating resources using user: %w", err)
 	}
@@ -264,13 +279,17 @@ func (api headscaleV1APIServer) RegisterNode(
 		return nil, err
 	}
 
-	updateSent, err := nodesChangedHook(api.h.db, api.h.polMan, api.h.nodeNotifier)
+	err = api.h.refreshStoreNode(node.ID)
 	if err != nil {
-		return nil, fmt.Errorf("updating resources using node: %w", err)
+		return nil, fmt.Errorf("updating node in store: %w", err)
 	}
-	if !updateSent {
-		ctx = types.NotifyCtx(context.Background(), "web-node-login", node.Hostname)
-		api.h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerChanged(node.ID))
+
+	err = api.h.events.Publish(ctx, events.NodeRegistered{
+		NodeID:         node.ID,
+		RegistrationID: registrationId,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("updating resources using node: %w", err)
 	}
 
 	return &v1.RegisterNodeResponse{Node: node.Proto()}, nil
@@ -318,9 +337,12 @@ func (api headscaleV1APIServer) SetTags(
 			Node: nil,
 		}, status.Error(codes.InvalidArgument, err.Error())
 	}
+	api.h.store.PutNode(node)
 
-	ctx = types.NotifyCtx(ctx, "cli-settags", node.Hostname)
-	api.h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdatePeerChanged(node.ID), node.ID)
+	err = api.h.events.Publish(ctx, events.TagsChanged{NodeID: node.ID})
+	if err != nil {
+		return nil, fmt.Errorf("updating resources using node: %w", err)
+	}
 
 	log.Trace().
 		Str("node", node.Hostname).
@@ -363,13 +385,13 @@ func (api headscaleV1APIServer) SetApprovedRoutes(
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
+	api.h.store.PutNode(node)
+
+	api.h.primaryRoutes.SetRoutes(node.ID, node.SubnetRoutes()...)
 
-	if api.h.primaryRoutes.SetRoutes(node.ID, node.SubnetRoutes()...) {
-		ctx := types.NotifyCtx(ctx, "poll-primary-change", node.Hostname)
-		api.h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
-	} else {
-		ctx = types.NotifyCtx(ctx, "cli-approveroutes", node.Hostname)
-		api.h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdatePeerChanged(node.ID), node.ID)
+	err = api.h.events.Publish(ctx, events.RoutesChanged{NodeID: node.ID})
+	if err != nil {
+		return nil, fmt.Errorf("updating resources using node: %w", err)
 	}
 
 	proto := node.Proto()
@@ -404,9 +426,12 @@ func (api headscaleV1APIServer) DeleteNode(
 	if err != nil {
 		return nil, err
 	}
+	api.h.store.DeleteNode(node.ID)
 
-	ctx = types.NotifyCtx(ctx, "cli-deletenode", node.Hostname)
-	api.h.nodeNotifier.NotifyAll(ctx, types.UpdatePeerRemoved(node.ID))
+	err = api.h.events.Publish(ctx, events.NodeDeleted{NodeID: node.ID})
+	if err != nil {
+		return nil, fmt.Errorf("updating resources using node: %w", err)
+	}
 
 	return &v1.DeleteNodeResponse{}, nil
 }
@@ -429,15 +454,12 @@ func (api headscaleV1APIServer) ExpireNode(
 	if err != nil {
 		return nil, err
 	}
+	api.h.store.PutNode(node)
 
-	ctx = types.NotifyCtx(ctx, "cli-expirenode-self", node.Hostname)
-	api.h.nodeNotifier.NotifyByNodeID(
-		ctx,
-		types.UpdateSelf(node.ID),
-		node.ID)
-
-	ctx = types.NotifyCtx(ctx, "cli-expirenode-peers", node.Hostname)
-	api.h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdateExpire(node.ID, now), node.ID)
+	err = api.h.events.Publish(ctx, events.NodeExpired{NodeID: node.ID, Expiry: now})
+	if err != nil {
+		return nil, fmt.Errorf("updating resources using node: %w", err)
+	}
 
 	log.Trace().
 		Str("node", node.Hostname).
@@ -466,9 +488,12 @@ func (api headscaleV1APIServer) RenameNode(
 	if err != nil {
 		return nil, err
 	}
+	api.h.store.PutNode(node)
 
-	ctx = types.NotifyCtx(ctx, "cli-renamenode", node.Hostname)
-	api.h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdatePeerChanged(node.ID), node.ID)
+	err = api.h.events.Publish(ctx, events.NodeRenamed{NodeID: node.ID})
+	if err != nil {
+		return nil, fmt.Errorf("updating resources using node: %w", err)
+	}
 
 	log.Trace().
 		Str("node", node.Hostname).
@@ -563,6 +588,16 @@ func (api headscaleV1APIServer) MoveNode(
 		return nil, err
 	}
 
+	err = api.h.refreshStoreNode(node.ID)
+	if err != nil {
+		return nil, fmt.Errorf("updating node in store: %w", err)
+	}
+
+	err = api.h.events.Publish(ctx, events.NodeMoved{NodeID: node.ID})
+	if err != nil {
+		return nil, fmt.Errorf("updating resources using node: %w", err)
+	}
+
 	return &v1.MoveNodeResponse{Node: node.Proto()}, nil
 }
 
@@ -581,9 +616,258 @@ func (api headscaleV1APIServer) BackfillNodeIPs(
 		return nil, err
 	}
 
+	nodes, err := api.h.db.ListNodes()
+	if err != nil {
+		return nil, fmt.Errorf("updating nodes in store: %w", err)
+	}
+
+	for _, node := range nodes {
+		api.h.store.PutNode(node)
+	}
+
 	return &v1.BackfillNodeIPsResponse{Changes: changes}, nil
 }
 
+func (api headscaleV1APIServer) PingNode(
+	ctx context.Context,
+	request *v1.PingNodeRequest,
+) (*v1.PingNodeResponse, error) {
+	node, ok := api.h.store.Node(types.NodeID(request.GetNodeId()))
+	if !ok {
+		return nil, status.Error(codes.NotFound, fmt.Sprintf("node %d not found", request.GetNodeId()))
+	}
+
+	var target netip.Addr
+	if request.GetTarget() != "" {
+		var err error
+		target, err = netip.ParseAddr(request.GetTarget())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("target: %s", err))
+		}
+	}
+
+	result, err := api.h.pingNode(ctx, node, target, request.GetType())
+	switch {
+	case errors.Is(err, errPingNotConnected), errors.Is(err, errPingOtherInstance):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, errPingTimeout):
+		return nil, status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, errPingC2NFailed):
+		return nil, status.Error(codes.Unavailable, err.Error())
+	case err != nil:
+		return nil, err
+	}
+
+	resp := &v1.PingNodeResponse{
+		LatencySeconds: result.Latency.Seconds(),
+		Path:           result.path(),
+	}
+	if result.Response != nil {
+		if result.Response.Err != "" {
+			return nil, status.Error(codes.Unavailable, result.Response.Err)
+		}
+
+		resp.Endpoint = result.Response.Endpoint
+		resp.DerpRegionId = int32(result.Response.DERPRegionID)
+		resp.DerpRegionCode = result.Response.DERPRegionCode
+	}
+
+	return resp, nil
+}
+
+// watchNodesBuffer is the number of node events queued for a watcher
+// before it is considered too slow and disconnected.
+const watchNodesBuffer = 256
+
+func (api headscaleV1APIServer) WatchNodes(
+	request *v1.WatchNodesRequest,
+	stream v1.HeadscaleService_WatchNodesServer,
+) error {
+	w := newNodeWatcher(request.GetUser(), api.h.store, func(node *types.Node) *v1.Node {
+		return nodesToProto(api.h.polMan, api.h.nodeNotifier.LikelyConnectedMap(), api.h.primaryRoutes, types.Nodes{node})[0]
+	})
+
+	// The current nodes are taken while holding the watcher, so no event
+	// published meanwhile is missed or sent before them.
+	w.mu.Lock()
+	unsubscribe := api.h.events.Subscribe("watch-nodes", w.handleEvents)
+	initial := w.current()
+	w.mu.Unlock()
+	defer unsubscribe()
+
+	for _, resp := range initial {
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-api.h.watchCtx.Done():
+			return status.Error(codes.Unavailable, "headscale is shutting down")
+		case <-w.overflow:
+			return status.Error(codes.ResourceExhausted, "not receiving node events fast enough")
+		case resp := <-w.updates:
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// nodeWatcher turns the events published on the bus into the node events
+// of a WatchNodes call, keeping track of the nodes the watcher was told
+// about.
+type nodeWatcher struct {
+	mu sync.Mutex
+
+	user  string
+	store *state.Store
+	proto func(*types.Node) *v1.Node
+
+	// sent holds the nodes the watcher has been told about and not
+	// been told that they were removed.
+	sent map[types.NodeID]bool
+
+	updates      chan *v1.WatchNodesResponse
+	overflow     chan struct{}
+	overflowOnce sync.Once
+}
+
+func newNodeWatcher(
+	user string,
+	store *state.Store,
+	proto func(*types.Node) *v1.Node,
+) *nodeWatcher {
+	return &nodeWatcher{
+		user:     user,
+		store:    store,
+		proto:    proto,
+		sent:     make(map[types.NodeID]bool),
+		updates:  make(chan *v1.WatchNodesResponse, watchNodesBuffer),
+		overflow: make(chan struct{}),
+	}
+}
+
+// current returns the events for all nodes, adding the nodes which match
+// the watcher and have not been sent, and removing those which do not
+// match anymore.
+// w.mu must be held.
+func (w *nodeWatcher) current() []*v1.WatchNodesResponse {
+	var resps []*v1.WatchNodesResponse
+	for _, node := range w.store.Nodes() {
+		if resp := w.nodeEvent(node.ID, v1.NodeEventType_NODE_EVENT_TYPE_CHANGED); resp != nil {
+			resps = append(resps, resp)
+		}
+	}
+
+	return resps
+}
+
+// handleEvents queues the node events for evs. A watcher which does not
+// keep up is disconnected instead of slowing down the publishers.
+func (w *nodeWatcher) handleEvents(ctx context.Context, evs []events.Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, ev := range evs {
+		for _, resp := range w.responses(ev) {
+			select {
+			case w.updates <- resp:
+			default:
+				w.overflowOnce.Do(func() { close(w.overflow) })
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *nodeWatcher) responses(ev events.Event) []*v1.WatchNodesResponse {
+	var resps []*v1.WatchNodesResponse
+	add := func(resp *v1.WatchNodesResponse) {
+		if resp != nil {
+			resps = append(resps, resp)
+		}
+	}
+
+	changed := v1.NodeEventType_NODE_EVENT_TYPE_CHANGED
+	switch ev := ev.(type) {
+	case events.NodeRegistered:
+		add(w.nodeEvent(ev.NodeID, changed))
+	case events.NodeChanged:
+		add(w.nodeEvent(ev.NodeID, changed))
+	case events.NodeRenamed:
+		add(w.nodeEvent(ev.NodeID, changed))
+	case events.NodeMoved:
+		add(w.nodeEvent(ev.NodeID, changed))
+	case events.NodeExpired:
+		add(w.nodeEvent(ev.NodeID, changed))
+	case events.NodeHealthChanged:
+		add(w.nodeEvent(ev.NodeID, changed))
+	case events.NodeSignatureChanged:
+		add(w.nodeEvent(ev.NodeID, changed))
+	case events.TagsChanged:
+		add(w.nodeEvent(ev.NodeID, changed))
+	case events.RoutesChanged:
+		add(w.nodeEvent(ev.NodeID, changed))
+	case events.NodeConnected:
+		add(w.nodeEvent(ev.NodeID, v1.NodeEventType_NODE_EVENT_TYPE_ONLINE))
+	case events.NodeDisconnected:
+		add(w.nodeEvent(ev.NodeID, v1.NodeEventType_NODE_EVENT_TYPE_OFFLINE))
+	case events.NodeDeleted:
+		add(w.removed(ev.NodeID))
+
+	// A renamed user can change which nodes match the watcher.
+	case events.UserRenamed:
+		if w.user != "" {
+			resps = w.current()
+		}
+	}
+
+	return resps
+}
+
+// nodeEvent returns the event of type typ for the node, or the event
+// adding or removing it if it started or stopped matching the watcher.
+// It returns nil if the watcher is not interested in the node.
+func (w *nodeWatcher) nodeEvent(id types.NodeID, typ v1.NodeEventType) *v1.WatchNodesResponse {
+	node, ok := w.store.Node(id)
+	if !ok {
+		return w.removed(id)
+	}
+
+	matches := w.user == "" || node.User.Name == w.user
+	switch {
+	case !matches:
+		return w.removed(id)
+	case !w.sent[id]:
+		w.sent[id] = true
+		typ = v1.NodeEventType_NODE_EVENT_TYPE_ADDED
+	}
+
+	return &v1.WatchNodesResponse{
+		Type:   typ,
+		NodeId: id.Uint64(),
+		Node:   w.proto(node),
+	}
+}
+
+func (w *nodeWatcher) removed(id types.NodeID) *v1.WatchNodesResponse {
+	if !w.sent[id] {
+		return nil
+	}
+	delete(w.sent, id)
+
+	return &v1.WatchNodesResponse{
+		Type:   v1.NodeEventType_NODE_EVENT_TYPE_REMOVED,
+		NodeId: id.Uint64(),
+	}
+}
+
 func (api headscaleV1APIServer) CreateApiKey(
 	ctx context.Context,
 	request *v1.CreateApiKeyRequest,
@@ -679,6 +963,7 @@ func (api headscaleV1APIServer) GetPolicy(
 		return &v1.GetPolicyResponse{
 			Policy:    p.Data,
 			UpdatedAt: timestamppb.New(p.UpdatedAt),
+			Revision:  uint64(p.ID),
 		}, nil
 	case types.PolicyModeFile:
 		// Read the file and return the contents as-is.
@@ -702,24 +987,56 @@ func (api headscaleV1APIServer) GetPolicy(
 }
 
 func (api headscaleV1APIServer) SetPolicy(
-	_ context.Context,
+	ctx context.Context,
 	request *v1.SetPolicyRequest,
 ) (*v1.SetPolicyResponse, error) {
 	if api.h.cfg.Policy.Mode != types.PolicyModeDB {
 		return nil, types.ErrPolicyUpdateIsDisabled
 	}
 
-	p := request.GetPolicy()
+	api.h.policyWriteMu.Lock()
+	defer api.h.policyWriteMu.Unlock()
+
+	// The base revision is checked when the policy is stored, so it
+	// also holds against updates through other instances.
+	var base *uint
+	if request.BaseRevision != nil {
+		base = ptr.To(uint(request.GetBaseRevision()))
+	}
+
+	updated, err := api.applyPolicy(request.GetPolicy(), func() (*types.Policy, error) {
+		return api.h.db.SetPolicy(request.GetPolicy(), policyAuthor(ctx), request.GetMessage(), base)
+	})
+	if err != nil {
+		if errors.Is(err, types.ErrPolicyChanged) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+
+		return nil, err
+	}
+
+	response := &v1.SetPolicyResponse{
+		Policy:    updated.Data,
+		UpdatedAt: timestamppb.New(updated.UpdatedAt),
+		Revision:  uint64(updated.ID),
+	}
 
+	return response, nil
+}
+
+// applyPolicy validates and loads p into the policy manager, stores it
+// with store and notifies all nodes if the packet filter changed.
+// The caller must hold policyWriteMu.
+func (api headscaleV1APIServer) applyPolicy(
+	p string,
+	store func() (*types.Policy, error),
+) (*types.Policy, error) {
 	// Validate and reject configuration that would error when applied
 	// when creating a map response. This requires nodes, so there is still
 	// a scenario where they might be allowed if the server has no nodes
 	// yet, but it should help for the general case and for hot reloading
 	// configurations.
-	nodes, err := api.h.db.ListNodes()
-	if err != nil {
-		return nil, fmt.Errorf("loading nodes from database to validate policy: %w", err)
-	}
+	nodes := api.h.store.Nodes()
 	changed, err := api.h.polMan.SetPolicy([]byte(p))
 	if err != nil {
 		return nil, fmt.Errorf("setting policy: %w", err)
@@ -732,30 +1049,275 @@ func (api headscaleV1APIServer) SetPolicy(
 		}
 	}
 
-	updated, err := api.h.db.SetPolicy(p)
+	updated, err := store()
 	if err != nil {
+		// The policy manager must keep the policy that is stored.
+		if pol, polErr := api.h.policyBytes(); polErr == nil {
+			_, _ = api.h.polMan.SetPolicy(pol)
+		}
+
 		return nil, err
 	}
 
-	// Only send update if the packet filter has changed.
+	// Only send updates if the packet filter has changed.
 	if changed {
-		err = api.h.autoApproveNodes()
+		approved, err := api.h.autoApproveNodes()
 		if err != nil {
 			return nil, err
 		}
 
-		ctx := types.NotifyCtx(context.Background(), "acl-update", "na")
-		api.h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+		err = api.h.events.Publish(context.Background(), policyChangedEvents(approved)...)
+		if err != nil {
+			return nil, fmt.Errorf("notifying nodes of policy change: %w", err)
+		}
 	}
 
-	response := &v1.SetPolicyResponse{
-		Policy:    updated.Data,
-		UpdatedAt: timestamppb.New(updated.UpdatedAt),
+	return updated, nil
+}
+
+// policyAuthor returns the prefix of the API key the request was
+// authenticated with, or types.PolicyAuthorCLI for requests over the
+// local socket which are not authenticated.
+func policyAuthor(ctx context.Context) string {
+	meta, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return types.PolicyAuthorCLI
+	}
+
+	authHeader := meta.Get("authorization")
+	if len(authHeader) == 0 {
+		return types.PolicyAuthorCLI
+	}
+
+	prefix, _, found := strings.Cut(strings.TrimPrefix(authHeader[0], AuthPrefix), ".")
+	if !found || prefix == "" {
+		return types.PolicyAuthorCLI
+	}
+
+	return prefix
+}
+
+func (api headscaleV1APIServer) ListPolicyRevisions(
+	_ context.Context,
+	_ *v1.ListPolicyRevisionsRequest,
+) (*v1.ListPolicyRevisionsResponse, error) {
+	if api.h.cfg.Policy.Mode != types.PolicyModeDB {
+		return nil, status.Error(codes.FailedPrecondition, types.ErrPolicyHistoryDisabled.Error())
+	}
+
+	policies, err := api.h.db.ListPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]*v1.PolicyRevision, len(policies))
+	for index, p := range policies {
+		response[index] = p.Proto()
+	}
+
+	return &v1.ListPolicyRevisionsResponse{Revisions: response}, nil
+}
+
+func (api headscaleV1APIServer) GetPolicyRevision(
+	_ context.Context,
+	request *v1.GetPolicyRevisionRequest,
+) (*v1.GetPolicyRevisionResponse, error) {
+	if api.h.cfg.Policy.Mode != types.PolicyModeDB {
+		return nil, status.Error(codes.FailedPrecondition, types.ErrPolicyHistoryDisabled.Error())
+	}
+
+	p, err := api.h.db.GetPolicyByID(uint(request.GetRevision()))
+	if err != nil {
+		if errors.Is(err, types.ErrPolicyNotFound) {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("policy revision %d not found", request.GetRevision()))
+		}
+
+		return nil, err
+	}
+
+	return &v1.GetPolicyRevisionResponse{Revision: p.Proto()}, nil
+}
+
+func (api headscaleV1APIServer) RollbackPolicy(
+	ctx context.Context,
+	request *v1.RollbackPolicyRequest,
+) (*v1.RollbackPolicyResponse, error) {
+	if api.h.cfg.Policy.Mode != types.PolicyModeDB {
+		return nil, types.ErrPolicyUpdateIsDisabled
+	}
+
+	api.h.policyWriteMu.Lock()
+	defer api.h.policyWriteMu.Unlock()
+
+	old, err := api.h.db.GetPolicyByID(uint(request.GetRevision()))
+	if err != nil {
+		if errors.Is(err, types.ErrPolicyNotFound) {
+			return nil, status.Error(codes.NotFound, fmt.Sprintf("policy revision %d not found", request.GetRevision()))
+		}
+
+		return nil, err
+	}
+
+	updated, err := api.applyPolicy(old.Data, func() (*types.Policy, error) {
+		return api.h.db.RollbackPolicy(old.ID, policyAuthor(ctx), request.GetMessage())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &v1.RollbackPolicyResponse{Revision: updated.Proto()}, nil
+}
+
+func (api headscaleV1APIServer) CheckAccess(
+	_ context.Context,
+	request *v1.CheckAccessRequest,
+) (*v1.CheckAccessResponse, error) {
+	nodes := api.h.store.Nodes()
+
+	srcs, err := resolveAccessEndpoint(request.GetSource(), nodes)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("source: %s", err))
+	}
+
+	dsts, err := resolveAccessEndpoint(request.GetDestination(), nodes)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("destination: %s", err))
+	}
+
+	if request.GetPort() > math.MaxUint16 {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("invalid port %d", request.GetPort()))
+	}
+
+	protocol, err := policy.ParseProtocol(request.GetProtocol())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	check := policy.CheckAccess(api.h.polMan, srcs, dsts, uint16(request.GetPort()), protocol)
+
+	response := &v1.CheckAccessResponse{Allowed: check.Allowed}
+	if check.Origin != nil {
+		response.Section = check.Origin.Section
+		response.Index = int32(check.Origin.Index)
 	}
 
 	return response, nil
 }
 
+// DiffPolicy reports how the given policy would affect the nodes if it was
+// applied, without applying it.
+func (api headscaleV1APIServer) DiffPolicy(
+	_ context.Context,
+	request *v1.DiffPolicyRequest,
+) (*v1.DiffPolicyResponse, error) {
+	users := api.h.store.Users()
+
+	nodes := api.h.store.Nodes()
+
+	candidate, err := policy.NewPolicyManager([]byte(request.GetPolicy()), users, nodes)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("loading policy: %s", err))
+	}
+
+	diffs, err := policy.DiffPolicyManagers(api.h.polMan, candidate, nodes)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("comparing policies: %s", err))
+	}
+
+	response := &v1.DiffPolicyResponse{}
+	for _, diff := range diffs {
+		response.Nodes = append(response.Nodes, nodePolicyDiffToProto(diff))
+	}
+
+	return response, nil
+}
+
+func (api headscaleV1APIServer) MigratePolicy(
+	ctx context.Context,
+	request *v1.MigratePolicyRequest,
+) (*v1.MigratePolicyResponse, error) {
+	pol := request.GetPolicy()
+	if pol == "" {
+		if api.h.polMan.Version() != 1 {
+			return nil, status.Error(codes.FailedPrecondition, "the current policy is already a v2 policy")
+		}
+
+		current, err := api.GetPolicy(ctx, &v1.GetPolicyRequest{})
+		if err != nil {
+			return nil, err
+		}
+		pol = current.GetPolicy()
+	}
+
+	users := api.h.store.Users()
+
+	nodes := api.h.store.Nodes()
+
+	migration, err := policy.MigratePolicyV1ToV2([]byte(pol), users, nodes)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	toJSON := func(v any) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+
+	return &v1.MigratePolicyResponse{
+		Policy:            string(migration.Policy),
+		Issues:            lo.Map(migration.Issues, func(issue policy.MigrationIssue, _ int) string { return issue.String() }),
+		Equivalent:        migration.Equivalent(),
+		FilterRulesLost:   lo.Map(migration.FilterRulesLost, func(rule tailcfg.FilterRule, _ int) string { return toJSON(rule) }),
+		FilterRulesGained: lo.Map(migration.FilterRulesGained, func(rule tailcfg.FilterRule, _ int) string { return toJSON(rule) }),
+	}, nil
+}
+
+func nodePolicyDiffToProto(diff policy.NodeDiff) *v1.NodePolicyDiff {
+	nodeNames := func(nodes types.Nodes) []string {
+		return lo.Map(nodes, func(node *types.Node, _ int) string {
+			return node.GivenName
+		})
+	}
+
+	toJSON := func(v any) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+
+	return &v1.NodePolicyDiff{
+		NodeId:             uint64(diff.Node.ID),
+		NodeName:           diff.Node.GivenName,
+		PeersGained:        nodeNames(diff.PeersGained),
+		PeersLost:          nodeNames(diff.PeersLost),
+		FilterRulesAdded:   lo.Map(diff.FilterRulesAdded, func(rule tailcfg.FilterRule, _ int) string { return toJSON(rule) }),
+		FilterRulesRemoved: lo.Map(diff.FilterRulesRemoved, func(rule tailcfg.FilterRule, _ int) string { return toJSON(rule) }),
+		SshRulesAdded:      lo.Map(diff.SSHRulesAdded, func(rule *tailcfg.SSHRule, _ int) string { return toJSON(rule) }),
+		SshRulesRemoved:    lo.Map(diff.SSHRulesRemoved, func(rule *tailcfg.SSHRule, _ int) string { return toJSON(rule) }),
+		RoutesApproved:     util.PrefixesToString(diff.RoutesApproved),
+		RoutesUnapproved:   util.PrefixesToString(diff.RoutesUnapproved),
+	}
+}
+
+// resolveAccessEndpoint returns the addresses of an endpoint of an access
+// check, which is either an IP address or the name of a node.
+func resolveAccessEndpoint(endpoint string, nodes types.Nodes) ([]netip.Addr, error) {
+	if endpoint == "" {
+		return nil, errors.New("must be an IP address or a node name")
+	}
+
+	if addr, err := netip.ParseAddr(endpoint); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+
+	for _, node := range nodes {
+		if node.GivenName == endpoint || node.Hostname == endpoint {
+			return node.IPs(), nil
+		}
+	}
+
+	return nil, fmt.Errorf("node %q not found", endpoint)
+}
+
 // The following service calls are for testing and debugging
 func (api headscaleV1APIServer) DebugCreateNode(
 	ctx context.Context,
@@ -807,10 +1369,9 @@ func (api headscaleV1APIServer) DebugCreateNode(
 		Str("registration_id", registrationId.String()).
 		Msg("adding debug machine via CLI, appending to registration cache")
 
-	api.h.registrationCache.Set(
-		registrationId,
-		newNode,
-	)
+	if err := api.h.addRegistration(registrationId, newNode); err != nil {
+		return nil, err
+	}
 
 	return &v1.DebugCreateNodeResponse{Node: newNode.Node.Proto()}, nil
 }
@@ -1,6 +1,18 @@
 package hscontrol
 
-import "testing"
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"testing"
+
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"github.com/juanfont/headscale/hscontrol/events"
+	"github.com/juanfont/headscale/hscontrol/state"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"google.golang.org/grpc/metadata"
+	"gorm.io/gorm"
+)
 
 func Test_validateTag(t *testing.T) {
 	type args struct {
@@ -40,3 +52,199 @@ func Test_validateTag(t *testing.T) {
 		})
 	}
 }
+
+func Test_resolveAccessEndpoint(t *testing.T) {
+	ipv4 := netip.MustParseAddr("100.64.0.1")
+	ipv6 := netip.MustParseAddr("fd7a:115c:a1e0::1")
+
+	nodes := types.Nodes{
+		{ID: 1, Hostname: "db-host", GivenName: "db", IPv4: &ipv4, IPv6: &ipv6},
+	}
+
+	tests := []struct {
+		name     string
+		endpoint string
+		want     []netip.Addr
+		wantErr  bool
+	}{
+		{
+			name:     "ip",
+			endpoint: "100.64.0.2",
+			want:     []netip.Addr{netip.MustParseAddr("100.64.0.2")},
+		},
+		{
+			name:     "given-name",
+			endpoint: "db",
+			want:     []netip.Addr{ipv4, ipv6},
+		},
+		{
+			name:     "hostname",
+			endpoint: "db-host",
+			want:     []netip.Addr{ipv4, ipv6},
+		},
+		{
+			name:     "unknown-node",
+			endpoint: "web",
+			wantErr:  true,
+		},
+		{
+			name:     "empty",
+			endpoint: "",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveAccessEndpoint(tt.endpoint, nodes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveAccessEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("resolveAccessEndpoint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_policyAuthor(t *testing.T) {
+	tests := []struct {
+		name string
+		md   metadata.MD
+		want string
+	}{
+		{
+			name: "no-metadata",
+			want: types.PolicyAuthorCLI,
+		},
+		{
+			name: "no-authorization",
+			md:   metadata.Pairs("user-agent", "headscale"),
+			want: types.PolicyAuthorCLI,
+		},
+		{
+			name: "api-key",
+			md:   metadata.Pairs("authorization", AuthPrefix+"abcdefg.secret"),
+			want: "abcdefg",
+		},
+		{
+			name: "malformed-api-key",
+			md:   metadata.Pairs("authorization", AuthPrefix+"secret"),
+			want: types.PolicyAuthorCLI,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+			if got := policyAuthor(ctx); got != tt.want {
+				t.Errorf("policyAuthor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_nodeWatcher(t *testing.T) {
+	user1 := types.User{Model: gorm.Model{ID: 1}, Name: "user1"}
+	user2 := types.User{Model: gorm.Model{ID: 2}, Name: "user2"}
+
+	store := state.New(
+		[]types.User{user1, user2},
+		types.Nodes{
+			{ID: 1, Hostname: "one", UserID: user1.ID, User: user1},
+			{ID: 2, Hostname: "two", UserID: user2.ID, User: user2},
+		},
+	)
+
+	w := newNodeWatcher("user1", store, func(node *types.Node) *v1.Node {
+		return &v1.Node{Id: node.ID.Uint64(), Name: node.Hostname}
+	})
+
+	type event struct {
+		typ v1.NodeEventType
+		id  uint64
+	}
+	drain := func(resps []*v1.WatchNodesResponse) []event {
+		for {
+			select {
+			case resp := <-w.updates:
+				resps = append(resps, resp)
+			default:
+				var got []event
+				for _, resp := range resps {
+					if resp.GetNode() != nil && resp.GetNode().GetId() != resp.GetNodeId() {
+						t.Errorf("event for node %d has node %d", resp.GetNodeId(), resp.GetNode().GetId())
+					}
+					got = append(got, event{resp.GetType(), resp.GetNodeId()})
+				}
+
+				return got
+			}
+		}
+	}
+	publish := func(evs ...events.Event) []event {
+		if err := w.handleEvents(context.Background(), evs); err != nil {
+			t.Fatalf("handleEvents() = %v", err)
+		}
+
+		return drain(nil)
+	}
+	check := func(name string, got []event, want ...event) {
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: got events %v, want %v", name, got, want)
+		}
+	}
+
+	check("current", drain(w.current()),
+		event{v1.NodeEventType_NODE_EVENT_TYPE_ADDED, 1})
+
+	check("online", publish(events.NodeConnected{NodeID: 1}, events.NodeConnected{NodeID: 2}),
+		event{v1.NodeEventType_NODE_EVENT_TYPE_ONLINE, 1})
+
+	// Moving a node to the watched user adds it, and away removes it.
+	store.PutNode(&types.Node{ID: 2, Hostname: "two", UserID: user1.ID, User: user1})
+	check("moved-in", publish(events.NodeMoved{NodeID: 2}),
+		event{v1.NodeEventType_NODE_EVENT_TYPE_ADDED, 2})
+
+	store.PutNode(&types.Node{ID: 1, Hostname: "one", UserID: user2.ID, User: user2})
+	check("moved-out", publish(events.NodeMoved{NodeID: 1}, events.NodeDisconnected{NodeID: 1}),
+		event{v1.NodeEventType_NODE_EVENT_TYPE_REMOVED, 1})
+
+	// Renaming the watched user removes all its nodes.
+	user1.Name = "renamed"
+	store.PutUser(user1)
+	check("user-renamed", publish(events.UserRenamed{UserID: types.UserID(user1.ID)}),
+		event{v1.NodeEventType_NODE_EVENT_TYPE_REMOVED, 2})
+
+	user2.Name = "user1"
+	store.PutUser(user2)
+	check("user-renamed-to", publish(events.UserRenamed{UserID: types.UserID(user2.ID)}),
+		event{v1.NodeEventType_NODE_EVENT_TYPE_ADDED, 1})
+
+	check("changed", publish(events.NodeRenamed{NodeID: 1}),
+		event{v1.NodeEventType_NODE_EVENT_TYPE_CHANGED, 1})
+
+	check("health-changed", publish(events.NodeHealthChanged{NodeID: 1}),
+		event{v1.NodeEventType_NODE_EVENT_TYPE_CHANGED, 1})
+
+	check("signature-changed", publish(events.NodeSignatureChanged{NodeID: 1}),
+		event{v1.NodeEventType_NODE_EVENT_TYPE_CHANGED, 1})
+
+	store.DeleteNode(1)
+	check("deleted", publish(events.NodeDeleted{NodeID: 1}, events.NodeDeleted{NodeID: 2}),
+		event{v1.NodeEventType_NODE_EVENT_TYPE_REMOVED, 1})
+
+	// A watcher not keeping up is disconnected.
+	store.PutNode(&types.Node{ID: 3, Hostname: "three", UserID: user2.ID, User: user2})
+	for range watchNodesBuffer + 1 {
+		if err := w.handleEvents(context.Background(), []events.Event{events.NodeChanged{NodeID: 3}}); err != nil {
+			t.Fatalf("handleEvents() = %v", err)
+		}
+	}
+	select {
+	case <-w.overflow:
+	default:
+		t.Errorf("watcher not keeping up was not disconnected")
+	}
+}
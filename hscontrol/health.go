@@ -0,0 +1,104 @@
+package hscontrol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/events"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+// NoiseUpdateHealthHandler receives the changes to the health of a node,
+// which clients report whenever one of their subsystems becomes unhealthy
+// or healthy again.
+func (ns *noiseServer) NoiseUpdateHealthHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		httpError(writer, err)
+
+		return
+	}
+
+	var healthChange tailcfg.HealthChangeRequest
+	if err := json.Unmarshal(body, &healthChange); err != nil {
+		httpError(writer, NewHTTPError(http.StatusBadRequest, "invalid health change request", err))
+
+		return
+	}
+
+	err = ns.headscale.updateNodeHealth(req.Context(), ns.machineKey, healthChange)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			httpError(writer, NewHTTPError(http.StatusNotFound, "node not found", nil))
+
+			return
+		}
+		httpError(writer, err)
+
+		return
+	}
+
+	writer.WriteHeader(http.StatusOK)
+}
+
+// updateNodeHealth records the health change reported by the node with
+// the given machine key. Clients up to 1.62 do not send their node key,
+// the node is then looked up by its machine key.
+func (h *Headscale) updateNodeHealth(
+	ctx context.Context,
+	machineKey key.MachinePublic,
+	healthChange tailcfg.HealthChangeRequest,
+) error {
+	var node *types.Node
+	var changed bool
+	err := h.db.Write(func(tx *gorm.DB) error {
+		var err error
+		if healthChange.NodeKey.IsZero() {
+			node, err = db.GetNodeByMachineKey(tx, machineKey)
+		} else {
+			node, err = db.GetNodeByNodeKey(tx, healthChange.NodeKey)
+		}
+		if err != nil {
+			return err
+		}
+
+		// A node can only report its own health.
+		if node.MachineKey != machineKey {
+			return gorm.ErrRecordNotFound
+		}
+
+		changed = node.SetHealthWarning(healthChange.Subsys, healthChange.Error)
+		if !changed {
+			return nil
+		}
+
+		return db.NodeSetHealthWarnings(tx, node.ID, node.HealthWarnings)
+	})
+	if err != nil || !changed {
+		return err
+	}
+
+	log.Debug().
+		Caller().
+		Uint64("node.id", node.ID.Uint64()).
+		Str("subsystem", healthChange.Subsys).
+		Str("error", healthChange.Error).
+		Msg("node health changed")
+
+	if err := h.refreshStoreNode(node.ID); err != nil {
+		return err
+	}
+
+	return h.events.Publish(ctx, events.NodeHealthChanged{NodeID: node.ID})
+}
@@ -0,0 +1,73 @@
+package hscontrol
+
+import (
+	"context"
+	"errors"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"gopkg.in/check.v1"
+	"gorm.io/gorm"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+func (s *Suite) TestUpdateNodeHealth(c *check.C) {
+	user, err := app.db.CreateUser(types.User{Name: "test"})
+	c.Assert(err, check.IsNil)
+
+	machineKey := key.NewMachine()
+	nodeKey := key.NewNode()
+	node := types.Node{
+		MachineKey:     machineKey.Public(),
+		NodeKey:        nodeKey.Public(),
+		Hostname:       "test",
+		UserID:         user.ID,
+		RegisterMethod: util.RegisterMethodAuthKey,
+	}
+	c.Assert(app.db.DB.Save(&node).Error, check.IsNil)
+	c.Assert(app.refreshStoreNode(node.ID), check.IsNil)
+
+	warnings := func() map[string]string {
+		stored, ok := app.store.Node(node.ID)
+		c.Assert(ok, check.Equals, true)
+
+		return stored.HealthWarnings
+	}
+
+	err = app.updateNodeHealth(context.Background(), machineKey.Public(), tailcfg.HealthChangeRequest{
+		Subsys:  "dns-forward-failing",
+		Error:   "DNS queries are failing",
+		NodeKey: nodeKey.Public(),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(warnings(), check.DeepEquals, map[string]string{"dns-forward-failing": "DNS queries are failing"})
+
+	// Old clients do not send their node key.
+	err = app.updateNodeHealth(context.Background(), machineKey.Public(), tailcfg.HealthChangeRequest{
+		Subsys: "derp-home-region",
+		Error:  "no home region",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(warnings(), check.HasLen, 2)
+
+	err = app.updateNodeHealth(context.Background(), machineKey.Public(), tailcfg.HealthChangeRequest{
+		Subsys:  "dns-forward-failing",
+		NodeKey: nodeKey.Public(),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(warnings(), check.DeepEquals, map[string]string{"derp-home-region": "no home region"})
+
+	// A node cannot report the health of another node.
+	err = app.updateNodeHealth(context.Background(), key.NewMachine().Public(), tailcfg.HealthChangeRequest{
+		Subsys:  "dns-forward-failing",
+		Error:   "DNS queries are failing",
+		NodeKey: nodeKey.Public(),
+	})
+	c.Assert(errors.Is(err, gorm.ErrRecordNotFound), check.Equals, true)
+	c.Assert(warnings(), check.HasLen, 1)
+
+	stored, err := app.db.GetNodeByID(node.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert(stored.HealthWarnings, check.DeepEquals, map[string]string{"derp-home-region": "no home region"})
+}
@@ -0,0 +1,350 @@
+package hscontrol
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/rs/zerolog/log"
+	"github.com/samber/lo"
+	"gorm.io/gorm"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+const (
+	idTokenKeyBits     = 2048
+	idTokenPEMType     = "PRIVATE KEY"
+	jwksPath           = "/.well-known/jwks.json"
+	openIDConfigPath   = "/.well-known/openid-configuration"
+	idTokenJTIByteSize = 16
+)
+
+var errInvalidIDTokenKey = errors.New("ID token signing key is not an RSA private key")
+
+// idTokenIssuer signs the OIDC ID tokens nodes request for workload
+// identity, with headscale as the issuer.
+type idTokenIssuer struct {
+	issuer string
+	expiry time.Duration
+	key    jose.JSONWebKey
+	signer jose.Signer
+}
+
+// idTokenClaims are the claims of the ID tokens, as documented on
+// tailcfg.TokenResponse.
+type idTokenClaims struct {
+	jwt.Claims
+
+	Key       string         `json:"key"`
+	Addresses []string       `json:"addresses"`
+	NodeID    tailcfg.NodeID `json:"nid"`
+	Node      string         `json:"node"`
+	Domain    string         `json:"domain"`
+	Tags      []string       `json:"tags,omitempty"`
+	User      string         `json:"user,omitempty"`
+	UserID    tailcfg.UserID `json:"uid,omitempty"`
+}
+
+// newIDTokenIssuer returns the issuer of ID tokens, or nil if ID tokens
+// are not enabled.
+func newIDTokenIssuer(cfg *types.Config) (*idTokenIssuer, error) {
+	if !cfg.IDToken.Enabled() {
+		return nil, nil
+	}
+
+	privateKey, err := readOrCreateIDTokenKey(cfg.IDToken.PrivateKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	jwk := jose.JSONWebKey{
+		Key:       privateKey,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}
+
+	thumbprint, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("computing ID token key ID: %w", err)
+	}
+	jwk.KeyID = base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jwk},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating ID token signer: %w", err)
+	}
+
+	return &idTokenIssuer{
+		issuer: strings.TrimSuffix(cfg.ServerURL, "/"),
+		expiry: cfg.IDToken.Expiry,
+		key:    jwk,
+		signer: signer,
+	}, nil
+}
+
+// readOrCreateIDTokenKey reads the RSA key signing the ID tokens, and
+// creates it if it does not exist yet.
+func readOrCreateIDTokenKey(path string) (*rsa.PrivateKey, error) {
+	err := util.EnsureDir(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("ensuring ID token key directory: %w", err)
+	}
+
+	keyPEM, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Info().Str("path", path).Msg("No ID token signing key file at path, creating...")
+
+		privateKey, err := rsa.GenerateKey(rand.Reader, idTokenKeyBits)
+		if err != nil {
+			return nil, fmt.Errorf("generating ID token signing key: %w", err)
+		}
+
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("encoding ID token signing key: %w", err)
+		}
+
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: idTokenPEMType, Bytes: der})
+		if err := os.WriteFile(path, keyPEM, privateKeyFileMode); err != nil {
+			return nil, fmt.Errorf("saving ID token signing key to %q: %w", path, err)
+		}
+
+		return privateKey, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("reading ID token signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil || block.Type != idTokenPEMType {
+		return nil, fmt.Errorf("parsing ID token signing key %q: no %s PEM block", path, idTokenPEMType)
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing ID token signing key %q: %w", path, err)
+	}
+
+	rsaKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errInvalidIDTokenKey
+	}
+
+	return rsaKey, nil
+}
+
+// jwks returns the key set relying parties verify the ID tokens with.
+func (i *idTokenIssuer) jwks() jose.JSONWebKeySet {
+	return jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{i.key.Public()},
+	}
+}
+
+// sign completes the registered claims of the token and signs it.
+func (i *idTokenIssuer) sign(claims idTokenClaims, now time.Time) (string, error) {
+	jti, err := util.GenerateRandomStringURLSafe(idTokenJTIByteSize)
+	if err != nil {
+		return "", err
+	}
+
+	claims.Issuer = i.issuer
+	claims.ID = jti
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.NotBefore = jwt.NewNumericDate(now)
+	claims.Expiry = jwt.NewNumericDate(now.Add(i.expiry))
+
+	return jwt.Signed(i.signer).Claims(claims).Serialize()
+}
+
+// NoiseIDTokenHandler issues OIDC ID tokens identifying the node, which
+// nodes exchange for credentials of other services, e.g. with workload
+// identity federation of cloud providers.
+func (ns *noiseServer) NoiseIDTokenHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		httpError(writer, err)
+
+		return
+	}
+
+	var tokenReq tailcfg.TokenRequest
+	if err := json.Unmarshal(body, &tokenReq); err != nil {
+		httpError(writer, NewHTTPError(http.StatusBadRequest, "invalid token request", err))
+
+		return
+	}
+
+	tokenResp, err := ns.headscale.idToken(req.Context(), ns.machineKey, tokenReq)
+	if err != nil {
+		httpError(writer, err)
+
+		return
+	}
+
+	respBody, err := json.Marshal(tokenResp)
+	if err != nil {
+		httpError(writer, err)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(respBody)
+}
+
+// idToken issues an ID token for the audience requested by the node with
+// the given machine key.
+func (h *Headscale) idToken(
+	ctx context.Context,
+	machineKey key.MachinePublic,
+	tokenReq tailcfg.TokenRequest,
+) (*tailcfg.TokenResponse, error) {
+	if h.idTokens == nil {
+		return nil, NewHTTPError(http.StatusNotImplemented, "ID tokens are not enabled on this server", nil)
+	}
+
+	if tokenReq.Audience == "" {
+		return nil, NewHTTPError(http.StatusBadRequest, "missing audience", nil)
+	}
+
+	node, err := h.db.GetNodeByNodeKey(tokenReq.NodeKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewHTTPError(http.StatusNotFound, "node not found", nil)
+		}
+
+		return nil, err
+	}
+
+	if node.MachineKey != machineKey {
+		return nil, NewHTTPError(http.StatusNotFound, "node not found", nil)
+	}
+
+	if node.IsExpired() {
+		return nil, NewHTTPError(http.StatusForbidden, "node is expired", nil)
+	}
+
+	claims, err := h.idTokenClaims(node)
+	if err != nil {
+		return nil, err
+	}
+	claims.Audience = jwt.Audience{tokenReq.Audience}
+
+	token, err := h.idTokens.sign(claims, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("signing ID token: %w", err)
+	}
+
+	log.Info().
+		Caller().
+		Uint64("node.id", node.ID.Uint64()).
+		Str("audience", tokenReq.Audience).
+		Msg("issued ID token for node")
+
+	return &tailcfg.TokenResponse{IDToken: token}, nil
+}
+
+// idTokenClaims returns the claims identifying the node. Tagged nodes are
+// identified by their tags instead of their user.
+func (h *Headscale) idTokenClaims(node *types.Node) (idTokenClaims, error) {
+	fqdn, err := node.GetFQDN(h.cfg.BaseDomain)
+	if err != nil {
+		return idTokenClaims{}, NewHTTPError(http.StatusForbidden, "node has no valid DNS name", err)
+	}
+
+	domain := h.cfg.Domain()
+
+	var tags []string
+	for _, tag := range node.RequestTags() {
+		if h.polMan.NodeCanHaveTag(node, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	tags = lo.Uniq(append(tags, node.ForcedTags...))
+
+	claims := idTokenClaims{
+		Claims: jwt.Claims{
+			Subject: fqdn,
+		},
+		Key:       node.NodeKey.String(),
+		Addresses: node.IPsAsString(),
+		NodeID:    tailcfg.NodeID(node.ID),
+		Node:      node.GivenName,
+		Domain:    domain,
+	}
+
+	if len(tags) > 0 {
+		for _, tag := range tags {
+			claims.Tags = append(claims.Tags, domain+":"+tag)
+		}
+	} else {
+		claims.User = domain + ":" + node.User.Username()
+		claims.UserID = tailcfg.UserID(node.User.ID)
+	}
+
+	return claims, nil
+}
+
+// JWKSHandler serves the keys the ID tokens of nodes are signed with.
+func (h *Headscale) JWKSHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	writeJSON(writer, h.idTokens.jwks())
+}
+
+// OpenIDConfigurationHandler serves the OpenID Connect discovery document
+// of the ID tokens of nodes, which relying parties use to find the keys.
+func (h *Headscale) OpenIDConfigurationHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	writeJSON(writer, map[string]any{
+		"issuer":                                h.idTokens.issuer,
+		"jwks_uri":                              h.idTokens.issuer + jwksPath,
+		"response_types_supported":              []string{"id_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{string(jose.RS256)},
+		"claims_supported": []string{
+			"sub", "aud", "exp", "iat", "iss", "jti", "nbf",
+			"key", "addresses", "nid", "node", "domain", "tags", "user", "uid",
+		},
+	})
+}
+
+func writeJSON(writer http.ResponseWriter, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		httpError(writer, err)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(body)
+}
@@ -0,0 +1,178 @@
+package hscontrol
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/check.v1"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+// fatalfer is implemented by both *testing.T and *check.C.
+type fatalfer interface {
+	Fatalf(format string, args ...any)
+}
+
+func newTestIDTokenIssuer(t fatalfer, dir string) *idTokenIssuer {
+	issuer, err := newIDTokenIssuer(&types.Config{
+		ServerURL: "https://headscale.example.com/",
+		IDToken: types.IDTokenConfig{
+			PrivateKeyPath: filepath.Join(dir, "id_token_private.pem"),
+			Expiry:         5 * time.Minute,
+		},
+	})
+	if err != nil {
+		t.Fatalf("newIDTokenIssuer() error = %v", err)
+	}
+
+	return issuer
+}
+
+// verifyIDToken checks the token against the published keys the way a
+// relying party does, and returns its claims.
+func verifyIDToken(t fatalfer, h *Headscale, token string) idTokenClaims {
+	rec := httptest.NewRecorder()
+	h.JWKSHandler(rec, httptest.NewRequest(http.MethodGet, jwksPath, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("JWKS status = %d", rec.Code)
+	}
+
+	var jwks jose.JSONWebKeySet
+	if err := json.Unmarshal(rec.Body.Bytes(), &jwks); err != nil {
+		t.Fatalf("decoding JWKS: %s", err)
+	}
+
+	parsed, err := jwt.ParseSigned(token, []jose.SignatureAlgorithm{jose.RS256})
+	if err != nil {
+		t.Fatalf("parsing ID token: %s", err)
+	}
+
+	var claims idTokenClaims
+	if err := parsed.Claims(jwks, &claims); err != nil {
+		t.Fatalf("verifying ID token: %s", err)
+	}
+
+	return claims
+}
+
+func TestIDTokenIssuer(t *testing.T) {
+	dir := t.TempDir()
+	h := &Headscale{idTokens: newTestIDTokenIssuer(t, dir)}
+
+	now := time.Now()
+	token, err := h.idTokens.sign(idTokenClaims{
+		Claims: jwt.Claims{
+			Subject:  "node1.tailnet.example.com",
+			Audience: jwt.Audience{"sts.example.com"},
+		},
+		NodeID: 1,
+		Node:   "node1",
+	}, now)
+	require.NoError(t, err)
+
+	claims := verifyIDToken(t, h, token)
+	require.NoError(t, claims.ValidateWithLeeway(jwt.Expected{
+		Issuer:      "https://headscale.example.com",
+		AnyAudience: jwt.Audience{"sts.example.com"},
+		Time:        now.Add(time.Minute),
+	}, 0))
+	assert.Equal(t, "node1.tailnet.example.com", claims.Subject)
+	assert.NotEmpty(t, claims.ID)
+	assert.Equal(t, tailcfg.NodeID(1), claims.NodeID)
+
+	// Tokens are short lived.
+	assert.Error(t, claims.ValidateWithLeeway(jwt.Expected{Time: now.Add(10 * time.Minute)}, 0))
+
+	// The signing key is kept across restarts, so relying parties do not
+	// have to refetch it.
+	reloaded := newTestIDTokenIssuer(t, dir)
+	assert.Equal(t, h.idTokens.key.KeyID, reloaded.key.KeyID)
+
+	rec := httptest.NewRecorder()
+	h.OpenIDConfigurationHandler(rec, httptest.NewRequest(http.MethodGet, openIDConfigPath, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var discovery map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &discovery))
+	assert.Equal(t, "https://headscale.example.com", discovery["issuer"])
+	assert.Equal(t, "https://headscale.example.com/.well-known/jwks.json", discovery["jwks_uri"])
+}
+
+func (s *Suite) TestIDToken(c *check.C) {
+	app.cfg.ServerURL = "https://headscale.example.com"
+	app.cfg.BaseDomain = "tailnet.example.com"
+
+	user, err := app.db.CreateUser(types.User{Name: "ci"})
+	c.Assert(err, check.IsNil)
+
+	machineKey := key.NewMachine().Public()
+	nodeKey := key.NewNode().Public()
+	ip := netip.MustParseAddr("100.64.0.1")
+	node := types.Node{
+		MachineKey:     machineKey,
+		NodeKey:        nodeKey,
+		Hostname:       "runner",
+		GivenName:      "runner",
+		UserID:         user.ID,
+		IPv4:           &ip,
+		RegisterMethod: util.RegisterMethodAuthKey,
+	}
+	c.Assert(app.db.DB.Save(&node).Error, check.IsNil)
+
+	tokenReq := tailcfg.TokenRequest{
+		NodeKey:  nodeKey,
+		Audience: "sts.example.com",
+	}
+
+	// Without a signing key, nodes cannot get ID tokens.
+	_, err = app.idToken(context.Background(), machineKey, tokenReq)
+	c.Assert(err, check.NotNil)
+
+	app.idTokens = newTestIDTokenIssuer(c, tmpDir)
+
+	resp, err := app.idToken(context.Background(), machineKey, tokenReq)
+	c.Assert(err, check.IsNil)
+
+	claims := verifyIDToken(c, app, resp.IDToken)
+	c.Assert(claims.Subject, check.Equals, "runner.tailnet.example.com")
+	c.Assert(claims.Audience, check.DeepEquals, jwt.Audience{"sts.example.com"})
+	c.Assert(claims.Key, check.Equals, nodeKey.String())
+	c.Assert(claims.Addresses, check.DeepEquals, []string{"100.64.0.1"})
+	c.Assert(claims.NodeID, check.Equals, tailcfg.NodeID(node.ID))
+	c.Assert(claims.Node, check.Equals, "runner")
+	c.Assert(claims.Domain, check.Equals, "headscale.example.com")
+	c.Assert(claims.User, check.Equals, "headscale.example.com:ci")
+	c.Assert(claims.UserID, check.Equals, tailcfg.UserID(user.ID))
+	c.Assert(claims.Tags, check.IsNil)
+
+	// Tagged nodes are identified by their tags instead of their user.
+	c.Assert(app.db.SetTags(node.ID, []string{"tag:ci"}), check.IsNil)
+
+	resp, err = app.idToken(context.Background(), machineKey, tokenReq)
+	c.Assert(err, check.IsNil)
+
+	claims = verifyIDToken(c, app, resp.IDToken)
+	c.Assert(claims.Tags, check.DeepEquals, []string{"headscale.example.com:tag:ci"})
+	c.Assert(claims.User, check.Equals, "")
+	c.Assert(claims.UserID, check.Equals, tailcfg.UserID(0))
+
+	// A node cannot get a token for another node.
+	_, err = app.idToken(context.Background(), key.NewMachine().Public(), tokenReq)
+	c.Assert(err, check.NotNil)
+
+	_, err = app.idToken(context.Background(), machineKey, tailcfg.TokenRequest{NodeKey: nodeKey})
+	c.Assert(err, check.NotNil)
+}
@@ -0,0 +1,286 @@
+package mapper
+
+import (
+	"encoding/json"
+	"sync"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/util/deephash"
+	"tailscale.com/util/lru"
+)
+
+// The number of encoded peers and sections kept, enough for the nodes of
+// a large tailnet at a few capability versions.
+const (
+	encodeCacheMaxPeers    = 65536
+	encodeCacheMaxSections = 4096
+)
+
+// encodeCache holds the JSON encoding of the peers and the shared sections
+// of map responses, for the capability version of the node receiving them.
+// A peer, DERP map or DNS config sent to many nodes is only encoded once,
+// and a peer is encoded again only when it changed.
+// It is safe for concurrent use.
+type encodeCache struct {
+	mu sync.Mutex
+
+	// peers holds the last encoding of every peer, which is used as
+	// long as the peer is equal to the encoded one.
+	peers lru.Cache[peerKey, encodedPeer]
+
+	// sections holds the encoded sections addressed by a hash of their
+	// content.
+	sections lru.Cache[sectionKey, []byte]
+}
+
+type peerKey struct {
+	id     tailcfg.NodeID
+	capVer tailcfg.CapabilityVersion
+}
+
+type encodedPeer struct {
+	node *tailcfg.Node
+	json []byte
+}
+
+type sectionKey struct {
+	capVer tailcfg.CapabilityVersion
+	sum    deephash.Sum
+}
+
+func newEncodeCache() *encodeCache {
+	return &encodeCache{
+		peers:    lru.Cache[peerKey, encodedPeer]{MaxEntries: encodeCacheMaxPeers},
+		sections: lru.Cache[sectionKey, []byte]{MaxEntries: encodeCacheMaxSections},
+	}
+}
+
+// encodedField is a field of a map response and its encoding, a list
+// field has one encoding per element.
+type encodedField struct {
+	name string
+	json []byte
+	list [][]byte
+}
+
+// marshal returns the JSON encoding of resp, using the cached encoding of
+// its peers and shared sections. The fields are in a different order than
+// json.Marshal produces, but are otherwise the same.
+// A nil encodeCache encodes resp with json.Marshal.
+func (c *encodeCache) marshal(
+	capVer tailcfg.CapabilityVersion,
+	resp *tailcfg.MapResponse,
+) ([]byte, error) {
+	if c == nil {
+		return json.Marshal(resp)
+	}
+
+	peers := func(nodes []*tailcfg.Node) ([][]byte, error) {
+		list := make([][]byte, len(nodes))
+		for i, node := range nodes {
+			b, err := c.encodePeer(capVer, node)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = b
+		}
+
+		return list, nil
+	}
+
+	// The fields follow the omitempty of tailcfg.MapResponse.
+	encoders := []struct {
+		name   string
+		set    bool
+		encode func() ([]byte, error)
+		list   func() ([][]byte, error)
+	}{
+		{
+			name:   "Node",
+			set:    resp.Node != nil,
+			encode: func() ([]byte, error) { return c.encodePeer(capVer, resp.Node) },
+		},
+		{
+			name:   "DERPMap",
+			set:    resp.DERPMap != nil,
+			encode: func() ([]byte, error) { return encodeSection(c, capVer, resp.DERPMap) },
+		},
+		{
+			name: "Peers",
+			set:  len(resp.Peers) > 0,
+			list: func() ([][]byte, error) { return peers(resp.Peers) },
+		},
+		{
+			name: "PeersChanged",
+			set:  len(resp.PeersChanged) > 0,
+			list: func() ([][]byte, error) { return peers(resp.PeersChanged) },
+		},
+		{
+			name:   "DNSConfig",
+			set:    resp.DNSConfig != nil,
+			encode: func() ([]byte, error) { return encodeSection(c, capVer, resp.DNSConfig) },
+		},
+		{
+			name:   "PacketFilters",
+			set:    len(resp.PacketFilters) > 0,
+			encode: func() ([]byte, error) { return encodeSection(c, capVer, &resp.PacketFilters) },
+		},
+		{
+			name: "UserProfiles",
+			set:  len(resp.UserProfiles) > 0,
+			list: func() ([][]byte, error) {
+				list := make([][]byte, len(resp.UserProfiles))
+				for i := range resp.UserProfiles {
+					b, err := encodeSection(c, capVer, &resp.UserProfiles[i])
+					if err != nil {
+						return nil, err
+					}
+					list[i] = b
+				}
+
+				return list, nil
+			},
+		},
+		{
+			name:   "SSHPolicy",
+			set:    resp.SSHPolicy != nil,
+			encode: func() ([]byte, error) { return encodeSection(c, capVer, resp.SSHPolicy) },
+		},
+	}
+
+	var fields []encodedField
+	for _, encoder := range encoders {
+		if !encoder.set {
+			continue
+		}
+
+		field := encodedField{name: encoder.name}
+		var err error
+		if encoder.list != nil {
+			field.list, err = encoder.list()
+		} else {
+			field.json, err = encoder.encode()
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+
+	// The rest of the response is specific to the node and encoded as is.
+	rest := *resp
+	rest.Node = nil
+	rest.DERPMap = nil
+	rest.Peers = nil
+	rest.PeersChanged = nil
+	rest.DNSConfig = nil
+	rest.PacketFilters = nil
+	rest.UserProfiles = nil
+	rest.SSHPolicy = nil
+
+	restBody, err := json.Marshal(&rest)
+	if err != nil {
+		return nil, err
+	}
+
+	size := len(restBody)
+	for _, field := range fields {
+		size += len(field.name) + len(`"":[],`) + len(field.json)
+		for _, b := range field.list {
+			size += len(b) + 1
+		}
+	}
+
+	buf := make([]byte, 0, size)
+	buf = append(buf, '{')
+	for _, field := range fields {
+		buf = append(buf, '"')
+		buf = append(buf, field.name...)
+		buf = append(buf, '"', ':')
+
+		if field.list == nil {
+			buf = append(buf, field.json...)
+		} else {
+			buf = append(buf, '[')
+			for i, b := range field.list {
+				if i > 0 {
+					buf = append(buf, ',')
+				}
+				buf = append(buf, b...)
+			}
+			buf = append(buf, ']')
+		}
+		buf = append(buf, ',')
+	}
+
+	if len(restBody) == len("{}") {
+		if len(buf) == 1 {
+			return append(buf, '}'), nil
+		}
+		buf[len(buf)-1] = '}'
+
+		return buf, nil
+	}
+
+	return append(buf, restBody[1:]...), nil
+}
+
+// encodePeer returns the JSON encoding of node from the cache, encoding
+// and adding it if the node changed since it was last encoded.
+func (c *encodeCache) encodePeer(capVer tailcfg.CapabilityVersion, node *tailcfg.Node) ([]byte, error) {
+	key := peerKey{id: node.ID, capVer: capVer}
+
+	c.mu.Lock()
+	cached, ok := c.peers.GetOk(key)
+	c.mu.Unlock()
+
+	if ok && cached.node.Equal(node) {
+		encodeCacheLookups.WithLabelValues("peer", "hit").Inc()
+
+		return cached.json, nil
+	}
+	encodeCacheLookups.WithLabelValues("peer", "miss").Inc()
+
+	b, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+
+	// The node is cloned as the caller might change it after it
+	// has been sent.
+	c.mu.Lock()
+	c.peers.Set(key, encodedPeer{node: node.Clone(), json: b})
+	c.mu.Unlock()
+
+	return b, nil
+}
+
+// encodeSection returns the JSON encoding of v from the cache, encoding
+// and adding it if it is not present.
+// As the hash of a time.Time is the instant it represents, values only
+// differing in the time zone of a time share their encoding.
+func encodeSection[T any](c *encodeCache, capVer tailcfg.CapabilityVersion, v *T) ([]byte, error) {
+	key := sectionKey{capVer: capVer, sum: deephash.Hash(v)}
+
+	c.mu.Lock()
+	b, ok := c.sections.GetOk(key)
+	c.mu.Unlock()
+
+	if ok {
+		encodeCacheLookups.WithLabelValues("section", "hit").Inc()
+
+		return b, nil
+	}
+	encodeCacheLookups.WithLabelValues("section", "miss").Inc()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.sections.Set(key, b)
+	c.mu.Unlock()
+
+	return b, nil
+}
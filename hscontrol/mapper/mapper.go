@@ -1,6 +1,7 @@
 package mapper
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -15,10 +16,11 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/events"
 	"github.com/juanfont/headscale/hscontrol/notifier"
 	"github.com/juanfont/headscale/hscontrol/policy"
 	"github.com/juanfont/headscale/hscontrol/routes"
+	"github.com/juanfont/headscale/hscontrol/state"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
 	"github.com/klauspost/compress/zstd"
@@ -52,13 +54,21 @@ var debugDumpMapResponsePath = envknob.String("HEADSCALE_DEBUG_DUMP_MAPRESPONSE_
 type Mapper struct {
 	// Configuration
 	// TODO(kradalby): figure out if this is the format we want this in
-	db      *db.HSDatabase
+	store   *state.Store
 	cfg     *types.Config
 	derpMap *tailcfg.DERPMap
 	notif   *notifier.Notifier
 	polMan  policy.PolicyManager
 	primary *routes.PrimaryRoutes
 
+	// tkaInfo is the state of tailnet lock sent to the nodes, nil if
+	// tailnet lock was never initialised.
+	tkaInfo *tailcfg.TKAInfo
+
+	// cache holds the encoded peers and sections shared between
+	// the responses to different nodes.
+	cache *encodeCache
+
 	uid     string
 	created time.Time
 	seq     uint64
@@ -70,7 +80,7 @@ type patch struct {
 }
 
 func NewMapper(
-	db *db.HSDatabase,
+	store *state.Store,
 	cfg *types.Config,
 	derpMap *tailcfg.DERPMap,
 	notif *notifier.Notifier,
@@ -80,12 +90,13 @@ func NewMapper(
 	uid, _ := util.GenerateRandomStringDNSSafe(mapperIDLength)
 
 	return &Mapper{
-		db:      db,
+		store:   store,
 		cfg:     cfg,
 		derpMap: derpMap,
 		notif:   notif,
 		polMan:  polMan,
 		primary: primary,
+		cache:   newEncodeCache(),
 
 		uid:     uid,
 		created: time.Now(),
@@ -97,6 +108,21 @@ func (m *Mapper) String() string {
 	return fmt.Sprintf("Mapper: { seq: %d, uid: %s, created: %s }", m.seq, m.uid, m.created)
 }
 
+// HandleEvents keeps the DERP map and the state of tailnet lock sent in
+// map responses up to date.
+func (m *Mapper) HandleEvents(ctx context.Context, evs []events.Event) error {
+	for _, ev := range evs {
+		switch ev := ev.(type) {
+		case events.DERPMapChanged:
+			m.derpMap = ev.DERPMap
+		case events.TailnetLockChanged:
+			m.tkaInfo = ev.Info
+		}
+	}
+
+	return nil
+}
+
 func generateUserProfiles(
 	node *types.Node,
 	peers types.Nodes,
@@ -134,6 +160,12 @@ func generateDNSConfig(
 
 	addNextDNSMetadata(dnsConfig.Resolvers, node)
 
+	if cfg.DNSConfig.Certs.Enabled() {
+		if fqdn, err := node.GetFQDN(cfg.BaseDomain); err == nil {
+			dnsConfig.CertDomains = []string{fqdn}
+		}
+	}
+
 	return dnsConfig
 }
 
@@ -191,18 +223,22 @@ func (m *Mapper) fullMapResponse(
 }
 
 // FullMapResponse returns a MapResponse for the given node.
+// If state is not nil, only the difference to the netmap last sent
+// to the node is returned, and nil if there is no difference.
 func (m *Mapper) FullMapResponse(
 	mapRequest tailcfg.MapRequest,
 	node *types.Node,
+	state *NetmapState,
 	messages ...string,
 ) ([]byte, error) {
-	peers, err := m.ListPeers(node.ID)
+	peers := m.ListPeers(node.ID)
+
+	resp, err := m.fullMapResponse(node, peers, mapRequest.Version)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := m.fullMapResponse(node, peers, mapRequest.Version)
-	if err != nil {
+	if send, err := state.minimise(resp, true); err != nil || !send {
 		return nil, err
 	}
 
@@ -238,29 +274,64 @@ func (m *Mapper) KeepAliveResponse(
 func (m *Mapper) DERPMapResponse(
 	mapRequest tailcfg.MapRequest,
 	node *types.Node,
+	state *NetmapState,
 	derpMap *tailcfg.DERPMap,
 ) ([]byte, error) {
-	m.derpMap = derpMap
-
 	resp := m.baseMapResponse()
 	resp.DERPMap = derpMap
 
+	if send, err := state.minimise(&resp, false); err != nil || !send {
+		return nil, err
+	}
+
+	return m.marshalMapResponse(mapRequest, &resp, node, mapRequest.Compress)
+}
+
+// DNSConfigResponse returns a MapResponse with the current DNS
+// configuration of the node.
+func (m *Mapper) DNSConfigResponse(
+	mapRequest tailcfg.MapRequest,
+	node *types.Node,
+	state *NetmapState,
+) ([]byte, error) {
+	resp := m.baseMapResponse()
+	resp.DNSConfig = generateDNSConfig(m.cfg, node)
+
+	if send, err := state.minimise(&resp, false); err != nil || !send {
+		return nil, err
+	}
+
+	return m.marshalMapResponse(mapRequest, &resp, node, mapRequest.Compress)
+}
+
+// PingResponse returns a MapResponse asking the node to answer ping.
+func (m *Mapper) PingResponse(
+	mapRequest tailcfg.MapRequest,
+	node *types.Node,
+	state *NetmapState,
+	ping *tailcfg.PingRequest,
+) ([]byte, error) {
+	resp := m.baseMapResponse()
+	resp.PingRequest = ping
+
+	if send, err := state.minimise(&resp, false); err != nil || !send {
+		return nil, err
+	}
+
 	return m.marshalMapResponse(mapRequest, &resp, node, mapRequest.Compress)
 }
 
 func (m *Mapper) PeerChangedResponse(
 	mapRequest tailcfg.MapRequest,
 	node *types.Node,
+	state *NetmapState,
 	changed map[types.NodeID]bool,
 	patches []*tailcfg.PeerChange,
 	messages ...string,
 ) ([]byte, error) {
 	resp := m.baseMapResponse()
 
-	peers, err := m.ListPeers(node.ID)
-	if err != nil {
-		return nil, err
-	}
+	peers := m.ListPeers(node.ID)
 
 	var removedIDs []tailcfg.NodeID
 	var changedIDs []types.NodeID
@@ -279,7 +350,7 @@ func (m *Mapper) PeerChangedResponse(
 		}
 	}
 
-	err = appendPeerChanges(
+	err := appendPeerChanges(
 		&resp,
 		false, // partial change
 		m.polMan,
@@ -317,6 +388,11 @@ func (m *Mapper) PeerChangedResponse(
 		return nil, err
 	}
 	resp.Node = tailnode
+	resp.TKAInfo = m.tkaInfo
+
+	if send, err := state.minimise(&resp, false); err != nil || !send {
+		return nil, err
+	}
 
 	return m.marshalMapResponse(mapRequest, &resp, node, mapRequest.Compress, messages...)
 }
@@ -326,11 +402,16 @@ func (m *Mapper) PeerChangedResponse(
 func (m *Mapper) PeerChangedPatchResponse(
 	mapRequest tailcfg.MapRequest,
 	node *types.Node,
+	state *NetmapState,
 	changed []*tailcfg.PeerChange,
 ) ([]byte, error) {
 	resp := m.baseMapResponse()
 	resp.PeersChangedPatch = changed
 
+	if send, err := state.minimise(&resp, false); err != nil || !send {
+		return nil, err
+	}
+
 	return m.marshalMapResponse(mapRequest, &resp, node, mapRequest.Compress)
 }
 
@@ -343,7 +424,7 @@ func (m *Mapper) marshalMapResponse(
 ) ([]byte, error) {
 	atomic.AddUint64(&m.seq, 1)
 
-	jsonBody, err := json.Marshal(resp)
+	jsonBody, err := m.cache.marshal(mapRequest.Version, resp)
 	if err != nil {
 		return nil, fmt.Errorf("marshalling map response: %w", err)
 	}
@@ -443,7 +524,6 @@ func (m *Mapper) baseMapResponse() tailcfg.MapResponse {
 	resp := tailcfg.MapResponse{
 		KeepAlive:   false,
 		ControlTime: &now,
-		// TODO(kradalby): Implement PingRequest?
 	}
 
 	return resp
@@ -479,21 +559,22 @@ func (m *Mapper) baseWithConfigMapResponse(
 		DisableLogTail: !m.cfg.LogTail.Enabled,
 	}
 
+	resp.TKAInfo = m.tkaInfo
+
 	return &resp, nil
 }
 
-func (m *Mapper) ListPeers(nodeID types.NodeID) (types.Nodes, error) {
-	peers, err := m.db.ListPeers(nodeID)
-	if err != nil {
-		return nil, err
-	}
+// ListPeers returns all peers of the node from the store, with their
+// online status set from the notifier.
+func (m *Mapper) ListPeers(nodeID types.NodeID) types.Nodes {
+	peers := m.store.Peers(nodeID)
 
 	for _, peer := range peers {
 		online := m.notif.IsLikelyConnected(peer.ID)
 		peer.IsOnline = &online
 	}
 
-	return peers, nil
+	return peers
 }
 
 func nodeMapToList(nodes map[uint64]*types.Node) types.Nodes {
@@ -519,7 +600,10 @@ func appendPeerChanges(
 	changed types.Nodes,
 	cfg *types.Config,
 ) error {
-	filter := polMan.Filter()
+	filter, err := polMan.FilterForNode(node)
+	if err != nil {
+		return err
+	}
 
 	sshPolicy, err := polMan.SSHPolicy(node)
 	if err != nil {
@@ -528,7 +612,10 @@ func appendPeerChanges(
 
 	// If there are filter rules present, see if there are any nodes that cannot
 	// access each-other at all and remove them from the peers.
-	if len(filter) > 0 {
+	// The filter of the tailnet is used to determine if there are rules, as the
+	// filter of the node can be empty while a policy is in place, e.g. a tagged
+	// node with a policy only using autogroup:self.
+	if len(polMan.Filter()) > 0 {
 		changed = policy.FilterNodesByACL(node, changed, filter)
 	}
 
@@ -1,6 +1,7 @@
 package mapper
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/netip"
 	"testing"
@@ -9,6 +10,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/juanfont/headscale/hscontrol/policy"
+	policyv2 "github.com/juanfont/headscale/hscontrol/policy/v2"
 	"github.com/juanfont/headscale/hscontrol/routes"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/stretchr/testify/require"
@@ -84,6 +86,71 @@ func TestDNSConfigMapResponse(t *testing.T) {
 	}
 }
 
+func TestDNSConfigCertDomains(t *testing.T) {
+	node := &types.Node{
+		Hostname:  "node1",
+		GivenName: "node1",
+	}
+
+	cfg := &types.Config{
+		BaseDomain:       "tailnet.example.com",
+		TailcfgDNSConfig: &tailcfg.DNSConfig{Proxied: true},
+	}
+
+	if got := generateDNSConfig(cfg, node); len(got.CertDomains) != 0 {
+		t.Errorf("cert domains = %v without a DNS provider, want none", got.CertDomains)
+	}
+
+	cfg.DNSConfig.Certs.Provider = types.DNSCertProviderExec
+
+	got := generateDNSConfig(cfg, node)
+	if diff := cmp.Diff([]string{"node1.tailnet.example.com"}, got.CertDomains); diff != "" {
+		t.Errorf("unexpected cert domains (-want +got):\n%s", diff)
+	}
+
+	if len(cfg.TailcfgDNSConfig.CertDomains) != 0 {
+		t.Errorf("cert domains were added to the shared DNS config")
+	}
+}
+
+func TestDNSConfigResponseExtraRecords(t *testing.T) {
+	node := &types.Node{
+		Hostname:  "node1",
+		GivenName: "node1",
+	}
+
+	cfg := &types.Config{
+		BaseDomain:       "tailnet.example.com",
+		TailcfgDNSConfig: &tailcfg.DNSConfig{Proxied: true},
+	}
+
+	mappy := NewMapper(nil, cfg, nil, nil, nil, nil)
+
+	// The session of the node got the DNS config with its first netmap.
+	state := NewNetmapState()
+	send, err := state.minimise(&tailcfg.MapResponse{DNSConfig: generateDNSConfig(cfg, node)}, true)
+	require.NoError(t, err)
+	require.True(t, send)
+
+	data, err := mappy.DNSConfigResponse(tailcfg.MapRequest{}, node, state)
+	require.NoError(t, err)
+	require.Nil(t, data, "unchanged DNS config was sent")
+
+	records := []tailcfg.DNSRecord{{Name: "grafana.tailnet.example.com", Type: "A", Value: "100.64.0.3"}}
+	cfg.TailcfgDNSConfig.ExtraRecords = records
+
+	data, err = mappy.DNSConfigResponse(tailcfg.MapRequest{}, node, state)
+	require.NoError(t, err)
+	require.NotNil(t, data)
+
+	var resp tailcfg.MapResponse
+	require.NoError(t, json.Unmarshal(data[reservedResponseHeaderSize:], &resp))
+	require.NotNil(t, resp.DNSConfig)
+	if diff := cmp.Diff(records, resp.DNSConfig.ExtraRecords); diff != "" {
+		t.Errorf("unexpected extra records (-want +got):\n%s", diff)
+	}
+}
+
 func Test_fullMapResponse(t *testing.T) {
 	mustNK := func(str string) key.NodePublic {
 		var k key.NodePublic
@@ -440,3 +507,250 @@ func Test_fullMapResponse(t *testing.T) {
 		})
 	}
 }
+
+func Test_appendPeerChangesAutogroupSelf(t *testing.T) {
+	user1 := types.User{Model: gorm.Model{ID: 1}, Name: "user1"}
+	user2 := types.User{Model: gorm.Model{ID: 2}, Name: "user2"}
+
+	mach := func(id types.NodeID, ip string, user types.User, tags ...string) *types.Node {
+		return &types.Node{
+			ID:         id,
+			IPv4:       iap(ip),
+			GivenName:  fmt.Sprintf("node%d", id),
+			UserID:     user.ID,
+			User:       user,
+			ForcedTags: tags,
+			Hostinfo:   &tailcfg.Hostinfo{},
+		}
+	}
+
+	nodes := types.Nodes{
+		mach(1, "100.64.0.1", user1),
+		mach(2, "100.64.0.2", user1),
+		mach(3, "100.64.0.3", user2),
+		mach(4, "100.64.0.4", user2, "tag:server"),
+	}
+
+	pol := []byte(`
+{
+	"acls": [
+		{"action": "accept", "src": ["*"], "dst": ["autogroup:self:*"]},
+	],
+}`)
+
+	tests := []struct {
+		name      string
+		node      *types.Node
+		wantPeers []tailcfg.NodeID
+	}{
+		{
+			name:      "user-with-other-nodes",
+			node:      nodes[0],
+			wantPeers: []tailcfg.NodeID{2},
+		},
+		{
+			name:      "user-without-other-nodes",
+			node:      nodes[2],
+			wantPeers: nil,
+		},
+		{
+			// The filter of a tagged node is empty as it is not part of
+			// any autogroup:self, it must not be given all the peers.
+			name:      "tagged-node",
+			node:      nodes[3],
+			wantPeers: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			polMan, err := policyv2.NewPolicyManager(pol, []types.User{user1, user2}, nodes)
+			require.NoError(t, err)
+
+			var peers types.Nodes
+			for _, node := range nodes {
+				if node.ID != tt.node.ID {
+					peers = append(peers, node)
+				}
+			}
+
+			resp := &tailcfg.MapResponse{}
+			err = appendPeerChanges(
+				resp,
+				true,
+				polMan,
+				routes.New(),
+				tt.node,
+				0,
+				peers,
+				&types.Config{TailcfgDNSConfig: &tailcfg.DNSConfig{}},
+			)
+			require.NoError(t, err)
+
+			var got []tailcfg.NodeID
+			for _, peer := range resp.Peers {
+				got = append(got, peer.ID)
+			}
+
+			if diff := cmp.Diff(tt.wantPeers, got); diff != "" {
+				t.Errorf("appendPeerChanges() unexpected peers (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// encodeTestResponses returns the full map responses of n nodes, which
+// all see each other, sharing the DERP map, DNS config and packet filter.
+func encodeTestResponses(n int) []*tailcfg.MapResponse {
+	now := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	online := true
+
+	nodes := make([]*tailcfg.Node, n)
+	for i := range n {
+		id := tailcfg.NodeID(i + 1)
+		addr := netip.AddrFrom4([4]byte{100, 64, byte(i >> 8), byte(i)})
+		hostinfo := tailcfg.Hostinfo{
+			Hostname: fmt.Sprintf("node-%d", id),
+			OS:       "linux",
+		}
+
+		nodes[i] = &tailcfg.Node{
+			ID:                id,
+			StableID:          tailcfg.StableNodeID(fmt.Sprintf("stable-%d", id)),
+			Name:              fmt.Sprintf("node-%d.example.com.", id),
+			User:              tailcfg.UserID(i%10 + 1),
+			Key:               key.NewNode().Public(),
+			DiscoKey:          key.NewDisco().Public(),
+			Machine:           key.NewMachine().Public(),
+			Addresses:         []netip.Prefix{netip.PrefixFrom(addr, 32)},
+			AllowedIPs:        []netip.Prefix{netip.PrefixFrom(addr, 32)},
+			Endpoints:         []netip.AddrPort{netip.AddrPortFrom(netip.MustParseAddr("192.0.2.1"), uint16(41641+i))},
+			HomeDERP:          1,
+			Hostinfo:          hostinfo.View(),
+			Created:           now,
+			LastSeen:          &now,
+			Online:            &online,
+			MachineAuthorized: true,
+			CapMap: tailcfg.NodeCapMap{
+				tailcfg.CapabilityFileSharing: []tailcfg.RawMessage{},
+				tailcfg.CapabilityAdmin:       []tailcfg.RawMessage{},
+			},
+		}
+	}
+
+	derpMap := &tailcfg.DERPMap{
+		Regions: map[int]*tailcfg.DERPRegion{
+			1: {
+				RegionID:   1,
+				RegionCode: "test",
+				Nodes: []*tailcfg.DERPNode{
+					{Name: "1a", RegionID: 1, HostName: "derp.example.com"},
+				},
+			},
+		},
+	}
+	dnsConfig := &tailcfg.DNSConfig{
+		Domains: []string{"example.com"},
+		Proxied: true,
+	}
+
+	resps := make([]*tailcfg.MapResponse, n)
+	for i, node := range nodes {
+		peers := make([]*tailcfg.Node, 0, n-1)
+		for _, peer := range nodes {
+			if peer.ID != node.ID {
+				peers = append(peers, peer)
+			}
+		}
+
+		resps[i] = &tailcfg.MapResponse{
+			ControlTime:     &now,
+			Node:            node,
+			DERPMap:         derpMap,
+			Peers:           peers,
+			DNSConfig:       dnsConfig,
+			Domain:          "example.com",
+			CollectServices: "false",
+			PacketFilters: map[string][]tailcfg.FilterRule{
+				"base": {
+					{
+						SrcIPs: []string{"100.64.0.0/10"},
+						DstPorts: []tailcfg.NetPortRange{
+							{IP: "*", Ports: tailcfg.PortRangeAny},
+						},
+					},
+				},
+			},
+			UserProfiles: []tailcfg.UserProfile{
+				{ID: 1, LoginName: "user1", DisplayName: "user1"},
+			},
+			Debug: &tailcfg.Debug{DisableLogTail: true},
+		}
+	}
+
+	return resps
+}
+
+func TestEncodeCacheMarshal(t *testing.T) {
+	resps := encodeTestResponses(3)
+	resps = append(resps,
+		&tailcfg.MapResponse{},
+		&tailcfg.MapResponse{KeepAlive: true},
+		&tailcfg.MapResponse{PeersChanged: resps[0].Peers, PacketFilters: map[string][]tailcfg.FilterRule{}},
+		&tailcfg.MapResponse{Node: resps[1].Node, Peers: []*tailcfg.Node{}},
+	)
+
+	cache := newEncodeCache()
+
+	check := func() {
+		for _, resp := range resps {
+			want, err := json.Marshal(resp)
+			require.NoError(t, err)
+
+			got, err := cache.marshal(tailcfg.CurrentCapabilityVersion, resp)
+			require.NoError(t, err)
+
+			require.JSONEq(t, string(want), string(got))
+		}
+	}
+
+	// Encoding twice must give the same result from the cache.
+	check()
+	check()
+
+	// A changed peer must be encoded again.
+	resps[0].Peers[0].Name = "renamed.example.com."
+	online := false
+	resps[0].Peers[1].Online = &online
+	check()
+}
+
+func BenchmarkMarshalMapResponse(b *testing.B) {
+	for _, n := range []int{10, 100, 500} {
+		resps := encodeTestResponses(n)
+
+		b.Run(fmt.Sprintf("json-%d", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				for _, resp := range resps {
+					if _, err := json.Marshal(resp); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("cache-%d", n), func(b *testing.B) {
+			cache := newEncodeCache()
+
+			b.ReportAllocs()
+			for range b.N {
+				for _, resp := range resps {
+					if _, err := cache.marshal(tailcfg.CurrentCapabilityVersion, resp); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
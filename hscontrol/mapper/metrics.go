@@ -0,0 +1,20 @@
+package mapper
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const prometheusNamespace = "headscale"
+
+var mapResponseBytesSaved = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: prometheusNamespace,
+	Name:      "mapresponse_bytes_saved_total",
+	Help:      "total count of uncompressed mapresponse bytes not sent as the node already had them",
+}, []string{"section"})
+
+var encodeCacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: prometheusNamespace,
+	Name:      "mapresponse_encode_cache_lookups_total",
+	Help:      "total count of lookups of encoded peers and sections in the mapresponse encode cache",
+}, []string{"kind", "result"})
@@ -0,0 +1,311 @@
+package mapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"tailscale.com/tailcfg"
+)
+
+// NetmapState is the netmap as last sent to a node in a streaming map
+// session. The Tailscale clients keep the netmap for the duration of the
+// session and apply every MapResponse on top of it, so only the parts which
+// changed since the previous response have to be sent.
+// It is not safe for concurrent use, a map session sends one response at a
+// time.
+type NetmapState struct {
+	initialised bool
+
+	// peers holds the peers as last sent, a nil node means that the peer
+	// has been patched since and its content is not known.
+	peers map[tailcfg.NodeID]*tailcfg.Node
+
+	node          []byte
+	dnsConfig     []byte
+	derpMap       []byte
+	packetFilters []byte
+	sshPolicy     []byte
+	debug         []byte
+	tkaInfo       []byte
+	userProfiles  map[tailcfg.UserID][]byte
+}
+
+func NewNetmapState() *NetmapState {
+	return &NetmapState{
+		peers:        make(map[tailcfg.NodeID]*tailcfg.Node),
+		userProfiles: make(map[tailcfg.UserID][]byte),
+	}
+}
+
+// minimise removes the parts of resp the node already has from the last
+// sent responses, and records what is left to be sent. full must be true
+// if resp is a full netmap, it is turned into the peer changes since the
+// last response.
+// It returns false if there is nothing left to send.
+// A nil NetmapState leaves resp unchanged.
+func (s *NetmapState) minimise(resp *tailcfg.MapResponse, full bool) (bool, error) {
+	if s == nil {
+		return true, nil
+	}
+
+	// Nothing is known about what the node has before the first full
+	// netmap of the session.
+	if !s.initialised && !full {
+		return true, nil
+	}
+
+	sections := []struct {
+		name string
+		last *[]byte
+		set  bool
+		v    any
+		omit func()
+	}{
+		{"node", &s.node, resp.Node != nil, resp.Node, func() { resp.Node = nil }},
+		{"dnsconfig", &s.dnsConfig, resp.DNSConfig != nil, resp.DNSConfig, func() { resp.DNSConfig = nil }},
+		{"derpmap", &s.derpMap, resp.DERPMap != nil, resp.DERPMap, func() { resp.DERPMap = nil }},
+		{"packetfilter", &s.packetFilters, resp.PacketFilters != nil, resp.PacketFilters, func() { resp.PacketFilters = nil }},
+		{"sshpolicy", &s.sshPolicy, resp.SSHPolicy != nil, resp.SSHPolicy, func() { resp.SSHPolicy = nil }},
+		{"debug", &s.debug, resp.Debug != nil, resp.Debug, func() { resp.Debug = nil }},
+		{"tkainfo", &s.tkaInfo, resp.TKAInfo != nil, resp.TKAInfo, func() { resp.TKAInfo = nil }},
+	}
+
+	for _, section := range sections {
+		if !section.set {
+			continue
+		}
+
+		b, err := json.Marshal(section.v)
+		if err != nil {
+			return false, err
+		}
+
+		if s.initialised && bytes.Equal(*section.last, b) {
+			section.omit()
+			mapResponseBytesSaved.WithLabelValues(section.name).Add(float64(len(b)))
+
+			continue
+		}
+		*section.last = b
+	}
+
+	// User profiles are kept by the client, only new and changed profiles
+	// have to be sent.
+	var profiles []tailcfg.UserProfile
+	for _, profile := range resp.UserProfiles {
+		b, err := json.Marshal(profile)
+		if err != nil {
+			return false, err
+		}
+
+		if s.initialised && bytes.Equal(s.userProfiles[profile.ID], b) {
+			mapResponseBytesSaved.WithLabelValues("userprofiles").Add(float64(len(b)))
+
+			continue
+		}
+		s.userProfiles[profile.ID] = b
+		profiles = append(profiles, profile)
+	}
+	resp.UserProfiles = profiles
+
+	if err := s.minimisePeers(resp, full); err != nil {
+		return false, err
+	}
+
+	s.initialised = true
+
+	return resp.Node != nil || resp.DNSConfig != nil || resp.DERPMap != nil ||
+		resp.PacketFilters != nil || resp.SSHPolicy != nil || resp.Debug != nil ||
+		resp.TKAInfo != nil ||
+		len(resp.UserProfiles) > 0 || resp.Peers != nil ||
+		len(resp.PeersChanged) > 0 || len(resp.PeersRemoved) > 0 ||
+		len(resp.PeersChangedPatch) > 0 || resp.PingRequest != nil, nil
+}
+
+func (s *NetmapState) minimisePeers(resp *tailcfg.MapResponse, full bool) error {
+	// The first full netmap is sent as is and records all peers.
+	if !s.initialised {
+		for _, peer := range resp.Peers {
+			s.peers[peer.ID] = peer
+		}
+
+		return nil
+	}
+
+	// Patches from other sources leave the peer in a state which is not
+	// known, the next change to it must be sent in full.
+	for _, patch := range resp.PeersChangedPatch {
+		if _, ok := s.peers[patch.NodeID]; ok {
+			s.peers[patch.NodeID] = nil
+		}
+	}
+
+	changed := resp.PeersChanged
+	if full {
+		present := make(map[tailcfg.NodeID]bool, len(resp.Peers))
+		for _, peer := range resp.Peers {
+			present[peer.ID] = true
+		}
+
+		for id := range s.peers {
+			if !present[id] {
+				resp.PeersRemoved = append(resp.PeersRemoved, id)
+			}
+		}
+		slices.Sort(resp.PeersRemoved)
+
+		changed = resp.Peers
+		resp.Peers = nil
+	}
+
+	var peersChanged []*tailcfg.Node
+	for _, peer := range changed {
+		last := s.peers[peer.ID]
+		s.peers[peer.ID] = peer
+
+		if last == nil {
+			peersChanged = append(peersChanged, peer)
+			continue
+		}
+
+		if last.Equal(peer) {
+			b, err := json.Marshal(peer)
+			if err != nil {
+				return err
+			}
+			mapResponseBytesSaved.WithLabelValues("peers").Add(float64(len(b)))
+
+			continue
+		}
+
+		if patch, ok := peerPatch(last, peer); ok {
+			b, err := json.Marshal(peer)
+			if err != nil {
+				return err
+			}
+			p, err := json.Marshal(patch)
+			if err != nil {
+				return err
+			}
+			mapResponseBytesSaved.WithLabelValues("peers").Add(float64(len(b) - len(p)))
+
+			resp.PeersChangedPatch = append(resp.PeersChangedPatch, patch)
+
+			continue
+		}
+
+		peersChanged = append(peersChanged, peer)
+	}
+	resp.PeersChanged = peersChanged
+
+	for _, id := range resp.PeersRemoved {
+		delete(s.peers, id)
+	}
+
+	return nil
+}
+
+// peerPatch returns the PeerChange turning last into peer, if the fields
+// which differ can be expressed as a patch.
+func peerPatch(last, peer *tailcfg.Node) (*tailcfg.PeerChange, bool) {
+	patch := &tailcfg.PeerChange{NodeID: peer.ID}
+	rest := peer.Clone()
+
+	if rest.HomeDERP != last.HomeDERP {
+		if rest.HomeDERP == 0 {
+			return nil, false
+		}
+		patch.DERPRegion = rest.HomeDERP
+	}
+	rest.HomeDERP, rest.LegacyDERPString = last.HomeDERP, last.LegacyDERPString
+
+	if rest.Cap != last.Cap {
+		if rest.Cap == 0 {
+			return nil, false
+		}
+		patch.Cap = rest.Cap
+	}
+	rest.Cap = last.Cap
+
+	if !rest.CapMap.Equal(last.CapMap) {
+		if len(rest.CapMap) == 0 {
+			return nil, false
+		}
+		patch.CapMap = rest.CapMap
+	}
+	rest.CapMap = last.CapMap
+
+	if !slices.Equal(rest.Endpoints, last.Endpoints) {
+		if len(rest.Endpoints) == 0 {
+			return nil, false
+		}
+		patch.Endpoints = rest.Endpoints
+	}
+	rest.Endpoints = last.Endpoints
+
+	if rest.Key != last.Key {
+		key := rest.Key
+		patch.Key = &key
+	}
+	rest.Key = last.Key
+
+	if !bytes.Equal(rest.KeySignature, last.KeySignature) {
+		if len(rest.KeySignature) == 0 {
+			return nil, false
+		}
+		patch.KeySignature = rest.KeySignature
+	}
+	rest.KeySignature = last.KeySignature
+
+	if rest.DiscoKey != last.DiscoKey {
+		key := rest.DiscoKey
+		patch.DiscoKey = &key
+	}
+	rest.DiscoKey = last.DiscoKey
+
+	if !rest.KeyExpiry.Equal(last.KeyExpiry) {
+		expiry := rest.KeyExpiry
+		patch.KeyExpiry = &expiry
+	}
+	rest.KeyExpiry = last.KeyExpiry
+
+	if !ptrEqual(rest.Online, last.Online) {
+		if rest.Online == nil {
+			return nil, false
+		}
+		patch.Online = rest.Online
+	}
+	rest.Online = last.Online
+
+	if !timePtrEqual(rest.LastSeen, last.LastSeen) {
+		if rest.LastSeen == nil {
+			return nil, false
+		}
+		patch.LastSeen = rest.LastSeen
+	}
+	rest.LastSeen = last.LastSeen
+
+	if !rest.Equal(last) {
+		return nil, false
+	}
+
+	return patch, true
+}
+
+func ptrEqual[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
+
+func timePtrEqual(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
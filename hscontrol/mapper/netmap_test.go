@@ -0,0 +1,204 @@
+package mapper
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"github.com/stretchr/testify/require"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+func TestNetmapStateMinimise(t *testing.T) {
+	online := true
+	offline := false
+	lastSeen := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	disco := key.NewDisco().Public()
+
+	peer := func(id tailcfg.NodeID, name string) *tailcfg.Node {
+		return &tailcfg.Node{
+			ID:       id,
+			Name:     name,
+			HomeDERP: 1,
+			Online:   &online,
+		}
+	}
+
+	full := func(peers ...*tailcfg.Node) *tailcfg.MapResponse {
+		return &tailcfg.MapResponse{
+			Node:          &tailcfg.Node{ID: 1, Name: "self"},
+			DNSConfig:     &tailcfg.DNSConfig{Domains: []string{"example.com"}},
+			DERPMap:       &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{1: {RegionID: 1}}},
+			PacketFilters: map[string][]tailcfg.FilterRule{"base": {{SrcIPs: []string{"*"}}}},
+			SSHPolicy:     &tailcfg.SSHPolicy{},
+			UserProfiles:  []tailcfg.UserProfile{{ID: 1, LoginName: "user1"}},
+			Peers:         peers,
+		}
+	}
+
+	opts := append([]cmp.Option{cmpopts.EquateEmpty()}, util.Comparers...)
+
+	s := NewNetmapState()
+
+	// The first full netmap is sent as is.
+	resp := full(peer(2, "two"), peer(3, "three"))
+	want := full(peer(2, "two"), peer(3, "three"))
+	send, err := s.minimise(resp, true)
+	require.NoError(t, err)
+	require.True(t, send)
+	if diff := cmp.Diff(want, resp, opts...); diff != "" {
+		t.Errorf("first full minimise() unexpected result (-want +got):\n%s", diff)
+	}
+
+	// A full netmap without changes has nothing left to send.
+	resp = full(peer(2, "two"), peer(3, "three"))
+	send, err = s.minimise(resp, true)
+	require.NoError(t, err)
+	require.False(t, send)
+
+	// Changes in peers become the minimal peer changes, and only
+	// changed sections are kept.
+	patched := peer(2, "two")
+	patched.HomeDERP = 2
+	patched.DiscoKey = disco
+	patched.Online = &offline
+	patched.LastSeen = &lastSeen
+
+	renamed := peer(3, "three-renamed")
+
+	resp = full(patched, renamed, peer(4, "four"))
+	resp.DNSConfig = &tailcfg.DNSConfig{Domains: []string{"example.org"}}
+	send, err = s.minimise(resp, true)
+	require.NoError(t, err)
+	require.True(t, send)
+	if diff := cmp.Diff(&tailcfg.MapResponse{
+		DNSConfig:    &tailcfg.DNSConfig{Domains: []string{"example.org"}},
+		PeersChanged: []*tailcfg.Node{peer(3, "three-renamed"), peer(4, "four")},
+		PeersChangedPatch: []*tailcfg.PeerChange{
+			{
+				NodeID:     2,
+				DERPRegion: 2,
+				DiscoKey:   &disco,
+				Online:     &offline,
+				LastSeen:   &lastSeen,
+			},
+		},
+	}, resp, opts...); diff != "" {
+		t.Errorf("changed full minimise() unexpected result (-want +got):\n%s", diff)
+	}
+
+	// Peers missing from a full netmap are removed.
+	resp = full(patched, renamed)
+	resp.DNSConfig = &tailcfg.DNSConfig{Domains: []string{"example.org"}}
+	send, err = s.minimise(resp, true)
+	require.NoError(t, err)
+	require.True(t, send)
+	if diff := cmp.Diff(&tailcfg.MapResponse{
+		PeersRemoved: []tailcfg.NodeID{4},
+	}, resp, opts...); diff != "" {
+		t.Errorf("removed full minimise() unexpected result (-want +got):\n%s", diff)
+	}
+
+	// Changed peers which are the same as sent are dropped.
+	resp = &tailcfg.MapResponse{
+		Node:         &tailcfg.Node{ID: 1, Name: "self"},
+		PeersChanged: []*tailcfg.Node{renamed},
+	}
+	send, err = s.minimise(resp, false)
+	require.NoError(t, err)
+	require.False(t, send)
+
+	// After a patch the peer is sent in full on the next change.
+	resp = &tailcfg.MapResponse{
+		PeersChangedPatch: []*tailcfg.PeerChange{{NodeID: 3, Online: &offline}},
+	}
+	send, err = s.minimise(resp, false)
+	require.NoError(t, err)
+	require.True(t, send)
+
+	resp = &tailcfg.MapResponse{
+		PeersChanged: []*tailcfg.Node{renamed},
+	}
+	send, err = s.minimise(resp, false)
+	require.NoError(t, err)
+	require.True(t, send)
+	require.Len(t, resp.PeersChanged, 1)
+
+	// Peers removed by a partial update are added back in full.
+	resp = &tailcfg.MapResponse{
+		PeersRemoved: []tailcfg.NodeID{3},
+	}
+	send, err = s.minimise(resp, false)
+	require.NoError(t, err)
+	require.True(t, send)
+
+	resp = full(patched, renamed)
+	resp.DNSConfig = &tailcfg.DNSConfig{Domains: []string{"example.org"}}
+	send, err = s.minimise(resp, true)
+	require.NoError(t, err)
+	require.True(t, send)
+	if diff := cmp.Diff(&tailcfg.MapResponse{
+		PeersChanged: []*tailcfg.Node{peer(3, "three-renamed")},
+	}, resp, opts...); diff != "" {
+		t.Errorf("re-added full minimise() unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestPeerPatch(t *testing.T) {
+	online := true
+
+	tests := []struct {
+		name      string
+		last      *tailcfg.Node
+		peer      *tailcfg.Node
+		want      *tailcfg.PeerChange
+		wantPatch bool
+	}{
+		{
+			name:      "endpoints",
+			last:      &tailcfg.Node{ID: 1, Endpoints: []netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:41641")}},
+			peer:      &tailcfg.Node{ID: 1, Endpoints: []netip.AddrPort{netip.MustParseAddrPort("192.0.2.2:41641")}},
+			want:      &tailcfg.PeerChange{NodeID: 1, Endpoints: []netip.AddrPort{netip.MustParseAddrPort("192.0.2.2:41641")}},
+			wantPatch: true,
+		},
+		{
+			name:      "online",
+			last:      &tailcfg.Node{ID: 1},
+			peer:      &tailcfg.Node{ID: 1, Online: &online},
+			want:      &tailcfg.PeerChange{NodeID: 1, Online: &online},
+			wantPatch: true,
+		},
+		{
+			name:      "online-cleared",
+			last:      &tailcfg.Node{ID: 1, Online: &online},
+			peer:      &tailcfg.Node{ID: 1},
+			wantPatch: false,
+		},
+		{
+			name:      "name",
+			last:      &tailcfg.Node{ID: 1, Name: "a"},
+			peer:      &tailcfg.Node{ID: 1, Name: "b"},
+			wantPatch: false,
+		},
+		{
+			name:      "derp-and-name",
+			last:      &tailcfg.Node{ID: 1, HomeDERP: 1, Name: "a"},
+			peer:      &tailcfg.Node{ID: 1, HomeDERP: 2, Name: "b"},
+			wantPatch: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := peerPatch(tt.last, tt.peer)
+			require.Equal(t, tt.wantPatch, ok)
+			if diff := cmp.Diff(tt.want, got, util.Comparers...); diff != "" {
+				t.Errorf("peerPatch() unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
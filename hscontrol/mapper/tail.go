@@ -2,6 +2,7 @@ package mapper
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/juanfont/headscale/hscontrol/policy"
@@ -39,6 +40,10 @@ func tailNodes(
 	return tNodes, nil
 }
 
+// capabilityURLPrefix is the prefix of the names of the capabilities
+// given to all nodes by default.
+const capabilityURLPrefix = "https://tailscale.com/cap/"
+
 // tailNode converts a Node into a Tailscale Node.
 func tailNode(
 	node *types.Node,
@@ -93,8 +98,9 @@ func tailNode(
 
 		User: tailcfg.UserID(node.UserID),
 
-		Key:       node.NodeKey,
-		KeyExpiry: keyExpiry.UTC(),
+		Key:          node.NodeKey,
+		KeyExpiry:    keyExpiry.UTC(),
+		KeySignature: node.KeySignature,
 
 		Machine:          node.MachineKey,
 		DiscoKey:         node.DiscoKey,
@@ -125,6 +131,31 @@ func tailNode(
 		tNode.CapMap[tailcfg.NodeAttrRandomizeClientPort] = []tailcfg.RawMessage{}
 	}
 
+	// Nodes can only get certificates for their name with a DNS provider
+	// publishing their ACME challenges.
+	if cfg.DNSConfig.Certs.Enabled() {
+		tNode.CapMap[tailcfg.CapabilityHTTPS] = []tailcfg.RawMessage{}
+	}
+
+	// Nodes only initialise and synchronise tailnet lock with the
+	// capability.
+	if cfg.TailnetLock.Enabled {
+		tNode.CapMap[tailcfg.CapabilityTailnetLock] = []tailcfg.RawMessage{}
+	}
+
+	if polMan != nil {
+		for _, attr := range polMan.NodeAttributes(node) {
+			// The capabilities given by default have a URL as name, they
+			// are removed with their short name, e.g. "-file-sharing".
+			if capability, ok := strings.CutPrefix(attr, "-"); ok {
+				delete(tNode.CapMap, tailcfg.NodeCapability(capability))
+				delete(tNode.CapMap, tailcfg.NodeCapability(capabilityURLPrefix+capability))
+				continue
+			}
+			tNode.CapMap[tailcfg.NodeCapability(attr)] = []tailcfg.RawMessage{}
+		}
+	}
+
 	if node.IsOnline == nil || !*node.IsOnline {
 		// LastSeen is only set when node is
 		// not connected to the control server.
@@ -9,12 +9,15 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/juanfont/headscale/hscontrol/policy"
+	policyv2 "github.com/juanfont/headscale/hscontrol/policy/v2"
 	"github.com/juanfont/headscale/hscontrol/routes"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 	"tailscale.com/net/tsaddr"
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/key"
+	"tailscale.com/types/tkatype"
 )
 
 func TestTailNode(t *testing.T) {
@@ -275,3 +278,114 @@ func TestNodeExpiry(t *testing.T) {
 		})
 	}
 }
+
+func TestTailNodeNodeAttributes(t *testing.T) {
+	user := types.User{Model: gorm.Model{ID: 1}, Name: "user1"}
+
+	kiosk := &types.Node{
+		ID:         1,
+		GivenName:  "kiosk",
+		IPv4:       iap("100.64.0.1"),
+		User:       user,
+		ForcedTags: []string{"tag:kiosk"},
+		Hostinfo:   &tailcfg.Hostinfo{},
+	}
+	laptop := &types.Node{
+		ID:        2,
+		GivenName: "laptop",
+		IPv4:      iap("100.64.0.2"),
+		User:      user,
+		Hostinfo:  &tailcfg.Hostinfo{},
+	}
+
+	pol := []byte(`
+{
+	"tagOwners": {
+		"tag:kiosk": ["user1@"],
+	},
+	"nodeAttrs": [
+		{"target": ["*"], "attr": ["randomize-client-port"]},
+		{"target": ["tag:kiosk"], "attr": ["-file-sharing", "funnel"]},
+	],
+}`)
+
+	polMan, err := policyv2.NewPolicyManager(pol, []types.User{user}, types.Nodes{kiosk, laptop})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		node   *types.Node
+		polMan policy.PolicyManager
+		want   tailcfg.NodeCapMap
+	}{
+		{
+			// "-file-sharing" removes the default capability named
+			// "https://tailscale.com/cap/file-sharing".
+			name:   "kiosk-short-name-removes-default",
+			node:   kiosk,
+			polMan: polMan,
+			want: tailcfg.NodeCapMap{
+				tailcfg.CapabilityAdmin:             []tailcfg.RawMessage{},
+				tailcfg.CapabilitySSH:               []tailcfg.RawMessage{},
+				tailcfg.NodeAttrRandomizeClientPort: []tailcfg.RawMessage{},
+				tailcfg.NodeAttrFunnel:              []tailcfg.RawMessage{},
+			},
+		},
+		{
+			name:   "laptop",
+			node:   laptop,
+			polMan: polMan,
+			want: tailcfg.NodeCapMap{
+				tailcfg.CapabilityFileSharing:       []tailcfg.RawMessage{},
+				tailcfg.CapabilityAdmin:             []tailcfg.RawMessage{},
+				tailcfg.CapabilitySSH:               []tailcfg.RawMessage{},
+				tailcfg.NodeAttrRandomizeClientPort: []tailcfg.RawMessage{},
+			},
+		},
+		{
+			name:   "nil-policy-manager",
+			node:   kiosk,
+			polMan: nil,
+			want: tailcfg.NodeCapMap{
+				tailcfg.CapabilityFileSharing: []tailcfg.RawMessage{},
+				tailcfg.CapabilityAdmin:       []tailcfg.RawMessage{},
+				tailcfg.CapabilitySSH:         []tailcfg.RawMessage{},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tailNode(tt.node, 0, tt.polMan, routes.New(), &types.Config{})
+			require.NoError(t, err)
+
+			if diff := cmp.Diff(tt.want, got.CapMap); diff != "" {
+				t.Errorf("tailNode() unexpected CapMap (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTailNodeTailnetLock(t *testing.T) {
+	node := &types.Node{
+		ID:           1,
+		GivenName:    "node1",
+		IPv4:         iap("100.64.0.1"),
+		KeySignature: []byte("signature"),
+		Hostinfo:     &tailcfg.Hostinfo{},
+	}
+
+	polMan, err := policy.NewPolicyManager(nil, []types.User{}, types.Nodes{node})
+	require.NoError(t, err)
+
+	got, err := tailNode(node, 0, polMan, routes.New(), &types.Config{})
+	require.NoError(t, err)
+	require.Equal(t, tkatype.MarshaledSignature("signature"), got.KeySignature)
+	require.NotContains(t, got.CapMap, tailcfg.CapabilityTailnetLock)
+
+	got, err = tailNode(node, 0, polMan, routes.New(), &types.Config{
+		TailnetLock: types.TailnetLockConfig{Enabled: true},
+	})
+	require.NoError(t, err)
+	require.Contains(t, got.CapMap, tailcfg.CapabilityTailnetLock)
+}
@@ -32,6 +32,16 @@ var (
 		Name:      "mapresponse_sent_total",
 		Help:      "total count of mapresponses sent to clients",
 	}, []string{"status", "type"})
+	mapResponseBytesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: prometheusNamespace,
+		Name:      "mapresponse_bytes_sent_total",
+		Help:      "total count of mapresponse bytes sent to clients",
+	}, []string{"type"})
+	eventsPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: prometheusNamespace,
+		Name:      "events_published_total",
+		Help:      "total count of events published on the event bus",
+	}, []string{"type"})
 	mapResponseUpdateReceived = promauto.NewCounterVec(prometheus.CounterOpts{
 		Namespace: prometheusNamespace,
 		Name:      "mapresponse_updates_received_total",
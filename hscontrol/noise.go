@@ -101,6 +101,33 @@ func (h *Headscale) NoiseUpgradeHandler(
 	router.HandleFunc("/machine/register", noiseServer.NoiseRegistrationHandler).
 		Methods(http.MethodPost)
 	router.HandleFunc("/machine/map", noiseServer.NoisePollNetMapHandler)
+	router.HandleFunc("/machine/ping/{id}", noiseServer.NoisePingHandler).
+		Methods(http.MethodHead, http.MethodGet, http.MethodPost)
+	router.HandleFunc("/machine/update-health", noiseServer.NoiseUpdateHealthHandler).
+		Methods(http.MethodPost)
+	router.HandleFunc("/machine/set-dns", noiseServer.NoiseSetDNSHandler).
+		Methods(http.MethodPost)
+	router.HandleFunc("/machine/id-token", noiseServer.NoiseIDTokenHandler).
+		Methods(http.MethodPost)
+	router.HandleFunc("/machine/audit-log", noiseServer.NoiseAuditLogHandler).
+		Methods(http.MethodPost)
+
+	if h.cfg.TailnetLock.Enabled {
+		// The tailnet lock RPCs of the clients are GET requests with a
+		// JSON body.
+		for path, handler := range map[string]http.HandlerFunc{
+			"/machine/tka/init/begin":    noiseJSONHandler(&noiseServer, h.tailnetLockInitBegin),
+			"/machine/tka/init/finish":   noiseJSONHandler(&noiseServer, h.tailnetLockInitFinish),
+			"/machine/tka/bootstrap":     noiseJSONHandler(&noiseServer, h.tailnetLockBootstrap),
+			"/machine/tka/sync/offer":    noiseJSONHandler(&noiseServer, h.tailnetLockSyncOffer),
+			"/machine/tka/sync/send":     noiseJSONHandler(&noiseServer, h.tailnetLockSyncSend),
+			"/machine/tka/disable":       noiseJSONHandler(&noiseServer, h.tailnetLockDisable),
+			"/machine/tka/sign":          noiseJSONHandler(&noiseServer, h.tailnetLockSign),
+			"/machine/tka/affected-sigs": noiseJSONHandler(&noiseServer, h.tailnetLockAffectedSigs),
+		} {
+			router.HandleFunc(path, handler).Methods(http.MethodGet, http.MethodPost)
+		}
+	}
 
 	noiseServer.httpBaseConfig = &http.Server{
 		Handler:           router,
@@ -50,6 +50,16 @@ var (
 		Name:      "notifier_open_channels_total",
 		Help:      "total count open channels in notifier",
 	})
+	notifierNodeQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: prometheusNamespace,
+		Name:      "notifier_node_queue_depth",
+		Help:      "gauge of updates queued for a node not keeping up with them",
+	}, []string{"id"})
+	notifierNodeQueueFullUpdates = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: prometheusNamespace,
+		Name:      "notifier_node_queue_full_updates_total",
+		Help:      "total count of queued updates replaced by a full update",
+	})
 	notifierBatcherWaitersForLock = promauto.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: prometheusNamespace,
 		Name:      "notifier_batcher_waiters_for_lock",
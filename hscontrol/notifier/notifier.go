@@ -3,11 +3,14 @@ package notifier
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/juanfont/headscale/hscontrol/events"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/puzpuzpuz/xsync/v3"
 	"github.com/rs/zerolog/log"
@@ -32,17 +35,23 @@ func init() {
 
 type Notifier struct {
 	l         deadlock.Mutex
-	nodes     map[types.NodeID]chan<- types.StateUpdate
+	nodes     map[types.NodeID]*nodeQueue
 	connected *xsync.MapOf[types.NodeID, bool]
-	b         *batcher
-	cfg       *types.Config
-	closed    bool
+
+	// remote are the nodes with a poll session open on another headscale
+	// instance in HA mode, with the ID of the instance.
+	remote *xsync.MapOf[types.NodeID, string]
+
+	b      *batcher
+	cfg    *types.Config
+	closed bool
 }
 
 func NewNotifier(cfg *types.Config) *Notifier {
 	n := &Notifier{
-		nodes:     make(map[types.NodeID]chan<- types.StateUpdate),
+		nodes:     make(map[types.NodeID]*nodeQueue),
 		connected: xsync.NewMapOf[types.NodeID, bool](),
+		remote:    xsync.NewMapOf[types.NodeID, string](),
 		cfg:       cfg,
 		closed:    false,
 	}
@@ -63,8 +72,9 @@ func (n *Notifier) Close() {
 	n.closed = true
 	n.b.close()
 
-	for _, c := range n.nodes {
-		close(c)
+	for _, q := range n.nodes {
+		q.stop()
+		close(q.c)
 	}
 }
 
@@ -90,10 +100,11 @@ func (n *Notifier) AddNode(nodeID types.NodeID, c chan<- types.StateUpdate) {
 	// connection. Close the old channel and replace it.
 	if curr, ok := n.nodes[nodeID]; ok {
 		n.tracef(nodeID, "channel present, closing and replacing")
-		close(curr)
+		curr.stop()
+		close(curr.c)
 	}
 
-	n.nodes[nodeID] = c
+	n.nodes[nodeID] = newNodeQueue(nodeID, c, n.cfg.Tuning.NodeUpdateQueueSize)
 	n.connected.Store(nodeID, true)
 
 	n.tracef(nodeID, "added new channel")
@@ -123,10 +134,11 @@ func (n *Notifier) RemoveNode(nodeID types.NodeID, c chan<- types.StateUpdate) b
 	// If the channel exist, but it does not belong
 	// to the caller, ignore.
 	if curr, ok := n.nodes[nodeID]; ok {
-		if curr != c {
+		if curr.c != c {
 			n.tracef(nodeID, "channel has been replaced, not removing")
 			return false
 		}
+		curr.stop()
 	}
 
 	delete(n.nodes, nodeID)
@@ -139,30 +151,110 @@ func (n *Notifier) RemoveNode(nodeID types.NodeID, c chan<- types.StateUpdate) b
 }
 
 // IsConnected reports if a node is connected to headscale and has a
-// poll session open.
+// poll session open, on this or another instance.
 func (n *Notifier) IsConnected(nodeID types.NodeID) bool {
 	notifierWaitersForLock.WithLabelValues("lock", "conncheck").Inc()
 	n.l.Lock()
 	defer n.l.Unlock()
 	notifierWaitersForLock.WithLabelValues("lock", "conncheck").Dec()
 
-	if val, ok := n.connected.Load(nodeID); ok {
-		return val
-	}
-	return false
+	return n.IsLikelyConnected(nodeID)
 }
 
 // IsLikelyConnected reports if a node is connected to headscale and has a
 // poll session open, but doesn't lock, so might be wrong.
 func (n *Notifier) IsLikelyConnected(nodeID types.NodeID) bool {
-	if val, ok := n.connected.Load(nodeID); ok {
-		return val
+	if val, ok := n.connected.Load(nodeID); ok && val {
+		return true
 	}
-	return false
+
+	_, ok := n.remote.Load(nodeID)
+
+	return ok
 }
 
+// RemoteInstance returns the instance the node has a poll session open
+// on, if it is connected to another instance and not to this one.
+func (n *Notifier) RemoteInstance(nodeID types.NodeID) (string, bool) {
+	if val, ok := n.connected.Load(nodeID); ok && val {
+		return "", false
+	}
+
+	return n.remote.Load(nodeID)
+}
+
+// LikelyConnectedMap returns if the nodes are connected, to this or
+// another instance.
 func (n *Notifier) LikelyConnectedMap() *xsync.MapOf[types.NodeID, bool] {
-	return n.connected
+	if n.remote.Size() == 0 {
+		return n.connected
+	}
+
+	connected := xsync.NewMapOf[types.NodeID, bool]()
+	n.connected.Range(func(key types.NodeID, value bool) bool {
+		connected.Store(key, value)
+		return true
+	})
+	n.remote.Range(func(key types.NodeID, _ string) bool {
+		connected.Store(key, true)
+		return true
+	})
+
+	return connected
+}
+
+// ConnectedNodes returns the nodes with a poll session open on this
+// instance.
+func (n *Notifier) ConnectedNodes() []types.NodeID {
+	var ids []types.NodeID
+	n.connected.Range(func(key types.NodeID, value bool) bool {
+		if value {
+			ids = append(ids, key)
+		}
+		return true
+	})
+	slices.Sort(ids)
+
+	return ids
+}
+
+// AddRemoteNode records that the node opened a poll session on another
+// instance, replacing the session on the instance it was connected to
+// before.
+func (n *Notifier) AddRemoteNode(nodeID types.NodeID, instance string) {
+	n.remote.Store(nodeID, instance)
+}
+
+// RemoveRemoteNode records that the poll session of the node on instance
+// ended. It reports if the node was connected to instance, and not
+// connected to another instance since.
+func (n *Notifier) RemoveRemoteNode(nodeID types.NodeID, instance string) bool {
+	removed := false
+	n.remote.Compute(nodeID, func(curr string, loaded bool) (string, bool) {
+		if !loaded || curr != instance {
+			return curr, !loaded
+		}
+		removed = true
+
+		return "", true
+	})
+
+	return removed
+}
+
+// RemoveInstance removes all nodes connected to instance, after it was
+// stopped, and returns them.
+func (n *Notifier) RemoveInstance(instance string) []types.NodeID {
+	var removed []types.NodeID
+	n.remote.Range(func(key types.NodeID, value string) bool {
+		if value == instance && n.RemoveRemoteNode(key, instance) {
+			removed = append(removed, key)
+		}
+		return true
+	})
+	slices.Sort(removed)
+
+	return removed
 }
 
 func (n *Notifier) NotifyAll(ctx context.Context, update types.StateUpdate) {
@@ -182,6 +274,22 @@ func (n *Notifier) NotifyWithIgnore(
 	n.b.addOrPassthrough(update)
 }
 
+// notifyAllByEvent sends update to all nodes with the next batch. Only the
+// update of the last event of each type in a batch is sent, as it replaces
+// the updates of the earlier ones.
+func (n *Notifier) notifyAllByEvent(
+	ctx context.Context,
+	ev events.Event,
+	update types.StateUpdate,
+) {
+	if n.closed {
+		return
+	}
+
+	notifierUpdateReceived.WithLabelValues(update.Type.String(), types.NotifyOriginKey.Value(ctx)).Inc()
+	n.b.addEvent(ev.Type(), update)
+}
+
 func (n *Notifier) NotifyByNodeID(
 	ctx context.Context,
 	update types.StateUpdate,
@@ -198,31 +306,77 @@ func (n *Notifier) NotifyByNodeID(
 		return
 	}
 
-	if c, ok := n.nodes[nodeID]; ok {
-		select {
-		case <-ctx.Done():
-			log.Error().
-				Err(ctx.Err()).
-				Uint64("node.id", nodeID.Uint64()).
-				Any("origin", types.NotifyOriginKey.Value(ctx)).
-				Any("origin-hostname", types.NotifyHostnameKey.Value(ctx)).
-				Msgf("update not sent, context cancelled")
-			if debugHighCardinalityMetrics {
-				notifierUpdateSent.WithLabelValues("cancelled", update.Type.String(), types.NotifyOriginKey.Value(ctx), nodeID.String()).Inc()
-			} else {
-				notifierUpdateSent.WithLabelValues("cancelled", update.Type.String(), types.NotifyOriginKey.Value(ctx)).Inc()
-			}
+	if q, ok := n.nodes[nodeID]; ok {
+		q.push(update, types.NotifyOriginKey.Value(ctx))
+		n.tracef(nodeID, "update added to queue, origin: %s, origin-hostname: %s", ctx.Value("origin"), ctx.Value("hostname"))
+	}
+}
 
-			return
-		case c <- update:
-			n.tracef(nodeID, "update successfully sent on chan, origin: %s, origin-hostname: %s", ctx.Value("origin"), ctx.Value("hostname"))
-			if debugHighCardinalityMetrics {
-				notifierUpdateSent.WithLabelValues("ok", update.Type.String(), types.NotifyOriginKey.Value(ctx), nodeID.String()).Inc()
-			} else {
-				notifierUpdateSent.WithLabelValues("ok", update.Type.String(), types.NotifyOriginKey.Value(ctx)).Inc()
-			}
+// HandleEvents sends the updates for the events which are sent the same
+// way to all nodes. Changes to what nodes can see of each other depend on
+// the policy and are sent by the subscriber keeping track of it.
+func (n *Notifier) HandleEvents(ctx context.Context, evs []events.Event) error {
+	var removed []types.NodeID
+	for _, ev := range evs {
+		notifyCtx := types.NotifyCtx(ctx, ev.Type(), "na")
+
+		switch ev := ev.(type) {
+		case events.NodeDeleted:
+			removed = append(removed, ev.NodeID)
+
+		case events.NodeExpired:
+			n.NotifyByNodeID(notifyCtx, types.UpdateSelf(ev.NodeID), ev.NodeID)
+			n.NotifyWithIgnore(notifyCtx, types.UpdateExpire(ev.NodeID, ev.Expiry), ev.NodeID)
+
+		case events.NodeChanged:
+			n.NotifyWithIgnore(notifyCtx, types.UpdatePeerChanged(ev.NodeID), ev.NodeID)
+
+		case events.NodeSignatureChanged:
+			// The node checks its own signature to show if it is
+			// locked out.
+			n.NotifyByNodeID(notifyCtx, types.UpdateSelf(ev.NodeID), ev.NodeID)
+			n.NotifyWithIgnore(notifyCtx, types.UpdatePeerChanged(ev.NodeID), ev.NodeID)
+
+		case events.NodeConnected:
+			online := true
+			n.NotifyWithIgnore(notifyCtx, types.UpdatePeerPatch(&tailcfg.PeerChange{
+				NodeID: ev.NodeID.NodeID(),
+				Online: &online,
+			}), ev.NodeID)
+
+		case events.NodeDisconnected:
+			online := false
+			lastSeen := ev.LastSeen
+			n.NotifyWithIgnore(notifyCtx, types.UpdatePeerPatch(&tailcfg.PeerChange{
+				NodeID:   ev.NodeID.NodeID(),
+				Online:   &online,
+				LastSeen: &lastSeen,
+			}), ev.NodeID)
+
+		case events.DERPMapChanged:
+			n.notifyAllByEvent(notifyCtx, ev, types.StateUpdate{
+				Type:    types.StateDERPUpdated,
+				DERPMap: ev.DERPMap,
+			})
+
+		case events.TailnetLockChanged:
+			// The state of tailnet lock is sent with every self update,
+			// the nodes synchronise the authority themselves.
+			n.notifyAllByEvent(notifyCtx, ev, types.StateUpdate{Type: types.StateSelfUpdate})
+
+		case events.DNSChanged:
+			// The mapper sends the current DNS config of each node, the
+			// peers of the nodes did not change.
+			n.notifyAllByEvent(notifyCtx, ev, types.StateUpdate{Type: types.StateDNSUpdated})
 		}
 	}
+
+	if len(removed) > 0 {
+		ctx = types.NotifyCtx(ctx, events.NodeDeleted{}.Type(), "na")
+		n.NotifyAll(ctx, types.UpdatePeerRemoved(removed...))
+	}
+
+	return nil
 }
 
 func (n *Notifier) sendAll(update types.StateUpdate) {
@@ -237,36 +391,10 @@ func (n *Notifier) sendAll(update types.StateUpdate) {
 		return
 	}
 
-	for id, c := range n.nodes {
-		// Whenever an update is sent to all nodes, there is a chance that the node
-		// has disconnected and the goroutine that was supposed to consume the update
-		// has shut down the channel and is waiting for the lock held here in RemoveNode.
-		// This means that there is potential for a deadlock which would stop all updates
-		// going out to clients. This timeout prevents that from happening by moving on to the
-		// next node if the context is cancelled. After sendAll releases the lock, the add/remove
-		// call will succeed and the update will go to the correct nodes on the next call.
-		ctx, cancel := context.WithTimeout(context.Background(), n.cfg.Tuning.NotifierSendTimeout)
-		defer cancel()
-		select {
-		case <-ctx.Done():
-			log.Error().
-				Err(ctx.Err()).
-				Uint64("node.id", id.Uint64()).
-				Msgf("update not sent, context cancelled")
-			if debugHighCardinalityMetrics {
-				notifierUpdateSent.WithLabelValues("cancelled", update.Type.String(), "send-all", id.String()).Inc()
-			} else {
-				notifierUpdateSent.WithLabelValues("cancelled", update.Type.String(), "send-all").Inc()
-			}
-
-			return
-		case c <- update:
-			if debugHighCardinalityMetrics {
-				notifierUpdateSent.WithLabelValues("ok", update.Type.String(), "send-all", id.String()).Inc()
-			} else {
-				notifierUpdateSent.WithLabelValues("ok", update.Type.String(), "send-all").Inc()
-			}
-		}
+	// The queues never block, a node which does not keep up with the
+	// updates does not hold up the others.
+	for _, q := range n.nodes {
+		q.push(update, "send-all")
 	}
 }
 
@@ -289,7 +417,20 @@ func (n *Notifier) String() string {
 	})
 
 	for _, key := range keys {
-		fmt.Fprintf(&b, "\t%d: %p\n", key, n.nodes[key])
+		var c chan<- types.StateUpdate
+		if q, ok := n.nodes[key]; ok {
+			c = q.c
+		}
+		fmt.Fprintf(&b, "\t%d: %p\n", key, c)
+	}
+
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "queued updates (%d):\n", len(n.nodes))
+
+	for _, key := range keys {
+		if q, ok := n.nodes[key]; ok {
+			fmt.Fprintf(&b, "\t%d: %d\n", key, q.len())
+		}
 	}
 
 	b.WriteString("\n")
@@ -315,6 +456,11 @@ type batcher struct {
 	patches        map[types.NodeID]tailcfg.PeerChange
 	patchesChanged bool
 
+	// events are the updates sent to all nodes for the events which only
+	// the last one of each type matters, by event type. Changes to nodes
+	// are coalesced by node instead, in changedNodeIDs and patches.
+	events map[string]types.StateUpdate
+
 	n *Notifier
 }
 
@@ -323,6 +469,7 @@ func newBatcher(batchTime time.Duration, n *Notifier) *batcher {
 		tick:     time.NewTicker(batchTime),
 		cancelCh: make(chan struct{}),
 		patches:  make(map[types.NodeID]tailcfg.PeerChange),
+		events:   make(map[string]types.StateUpdate),
 		n:        n,
 	}
 }
@@ -362,7 +509,18 @@ func (b *batcher) addOrPassthrough(update types.StateUpdate) {
 	}
 }
 
-// flush sends all the accumulated patches to all
+// addEvent adds the update for an event of type eventType to the batcher,
+// replacing the update of an earlier event of the same type.
+func (b *batcher) addEvent(eventType string, update types.StateUpdate) {
+	notifierBatcherWaitersForLock.WithLabelValues("lock", "add").Inc()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	notifierBatcherWaitersForLock.WithLabelValues("lock", "add").Dec()
+
+	b.events[eventType] = update
+}
+
+// flush sends all the accumulated patches and updates to all
 // nodes in the notifier.
 func (b *batcher) flush() {
 	notifierBatcherWaitersForLock.WithLabelValues("lock", "flush").Inc()
@@ -406,6 +564,14 @@ func (b *batcher) flush() {
 		notifierBatcherPatches.WithLabelValues().Set(0)
 		b.patchesChanged = false
 	}
+
+	if len(b.events) > 0 {
+		for _, eventType := range slices.Sorted(maps.Keys(b.events)) {
+			b.n.sendAll(b.events[eventType])
+		}
+
+		clear(b.events)
+	}
 }
 
 func (b *batcher) doWork() {
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/juanfont/headscale/hscontrol/events"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
 	"tailscale.com/tailcfg"
@@ -222,11 +223,6 @@ func TestBatcher(t *testing.T) {
 					// We will call flush manually for the tests,
 					// so do not run the worker.
 					BatchChangeDelay: time.Hour,
-
-					// Since we do not load the config, we won't get the
-					// default, so set it manually so we dont time out
-					// and have flakes.
-					NotifierSendTimeout: time.Second,
 				},
 			})
 
@@ -263,3 +259,103 @@ func TestBatcher(t *testing.T) {
 		})
 	}
 }
+
+func TestBatcherEvents(t *testing.T) {
+	n := NewNotifier(&types.Config{
+		Tuning: types.Tuning{
+			BatchChangeDelay: time.Hour,
+		},
+	})
+
+	ch := make(chan types.StateUpdate, 30)
+	defer close(ch)
+	n.AddNode(1, ch)
+	defer n.RemoveNode(1, ch)
+
+	derp1 := &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{1: {RegionID: 1}}}
+	derp2 := &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{2: {RegionID: 2}}}
+
+	err := n.HandleEvents(context.Background(), []events.Event{
+		events.DNSChanged{},
+		events.DERPMapChanged{DERPMap: derp1},
+		events.DNSChanged{},
+		events.DERPMapChanged{DERPMap: derp2},
+	})
+	if err != nil {
+		t.Fatalf("handling events: %s", err)
+	}
+
+	n.b.flush()
+
+	var got []types.StateUpdate
+	for len(ch) > 0 {
+		got = append(got, <-ch)
+	}
+
+	// Only the last event of each type is sent.
+	want := []types.StateUpdate{
+		{Type: types.StateDERPUpdated, DERPMap: derp2},
+		{Type: types.StateDNSUpdated},
+	}
+	if diff := cmp.Diff(want, got, util.Comparers...); diff != "" {
+		t.Errorf("batcher() unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestRemoteNodes(t *testing.T) {
+	n := NewNotifier(&types.Config{
+		Tuning: types.Tuning{
+			BatchChangeDelay: time.Hour,
+		},
+	})
+
+	ch := make(chan types.StateUpdate, 1)
+	defer close(ch)
+	n.AddNode(1, ch)
+
+	n.AddRemoteNode(2, "a")
+	n.AddRemoteNode(3, "a")
+	n.AddRemoteNode(4, "b")
+
+	for _, id := range []types.NodeID{1, 2, 3, 4} {
+		if !n.IsConnected(id) {
+			t.Errorf("IsConnected(%d) = false, want true", id)
+		}
+	}
+
+	if diff := cmp.Diff([]types.NodeID{1}, n.ConnectedNodes()); diff != "" {
+		t.Errorf("ConnectedNodes() unexpected result (-want +got):\n%s", diff)
+	}
+
+	connected := n.LikelyConnectedMap()
+	if val, _ := connected.Load(4); !val {
+		t.Errorf("LikelyConnectedMap() does not contain the remote node 4")
+	}
+
+	// Node 3 moved to instance b, its old session on a ends afterwards.
+	n.AddRemoteNode(3, "b")
+	if n.RemoveRemoteNode(3, "a") {
+		t.Errorf("RemoveRemoteNode(3, a) removed the session on b")
+	}
+
+	if !n.RemoveRemoteNode(2, "a") {
+		t.Errorf("RemoveRemoteNode(2, a) = false, want true")
+	}
+	if n.IsConnected(2) {
+		t.Errorf("IsConnected(2) = true after it disconnected")
+	}
+
+	if diff := cmp.Diff([]types.NodeID{3, 4}, n.RemoveInstance("b")); diff != "" {
+		t.Errorf("RemoveInstance() unexpected result (-want +got):\n%s", diff)
+	}
+	if n.IsConnected(4) {
+		t.Errorf("IsConnected(4) = true after its instance was removed")
+	}
+
+	if !n.RemoveNode(1, ch) {
+		t.Errorf("RemoveNode(1) = false, want true")
+	}
+	if n.IsConnected(1) {
+		t.Errorf("IsConnected(1) = true after it disconnected")
+	}
+}
@@ -0,0 +1,209 @@
+package notifier
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+)
+
+// nodeQueue delivers the updates for a node to the channel of its map
+// session. Updates are sent to the channel directly while it has room.
+// When the session does not keep up, the updates are queued and merged,
+// and sent in the background as soon as the session reads from the
+// channel again. No update is dropped and the notifier never waits for a
+// node.
+type nodeQueue struct {
+	nodeID types.NodeID
+	c      chan<- types.StateUpdate
+
+	// maxPending is the number of pending updates after which they are
+	// replaced by a full update.
+	maxPending int
+
+	mu      sync.Mutex
+	pending []types.StateUpdate
+	// sending reports if a goroutine is sending the pending updates.
+	sending bool
+	stopped bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newNodeQueue(nodeID types.NodeID, c chan<- types.StateUpdate, maxPending int) *nodeQueue {
+	return &nodeQueue{
+		nodeID:     nodeID,
+		c:          c,
+		maxPending: maxPending,
+		done:       make(chan struct{}),
+	}
+}
+
+// push adds the update for the node. It never blocks.
+func (q *nodeQueue) push(update types.StateUpdate, trigger string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stopped {
+		return
+	}
+
+	// Updates can only go to the channel directly if nothing is waiting
+	// to be sent before them.
+	if len(q.pending) == 0 && !q.sending {
+		select {
+		case q.c <- update:
+			q.sent("ok", update, trigger)
+
+			return
+		default:
+		}
+	}
+
+	var full bool
+	q.pending, full = mergeUpdate(q.pending, update, q.maxPending)
+	if full {
+		notifierNodeQueueFullUpdates.Inc()
+	}
+	q.sent("queued", update, trigger)
+	notifierNodeQueueDepth.WithLabelValues(q.nodeID.String()).Set(float64(len(q.pending)))
+
+	if !q.sending {
+		q.sending = true
+		q.wg.Add(1)
+		go q.send()
+	}
+}
+
+func (q *nodeQueue) sent(status string, update types.StateUpdate, trigger string) {
+	if debugHighCardinalityMetrics {
+		notifierUpdateSent.WithLabelValues(status, update.Type.String(), trigger, q.nodeID.String()).Inc()
+	} else {
+		notifierUpdateSent.WithLabelValues(status, update.Type.String(), trigger).Inc()
+	}
+}
+
+// send sends the pending updates to the channel until there are none
+// left or the queue is stopped.
+func (q *nodeQueue) send() {
+	defer q.wg.Done()
+
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.sending = false
+			q.mu.Unlock()
+
+			return
+		}
+		update := q.pending[0]
+		q.pending = slices.Delete(q.pending, 0, 1)
+		notifierNodeQueueDepth.WithLabelValues(q.nodeID.String()).Set(float64(len(q.pending)))
+		q.mu.Unlock()
+
+		select {
+		case q.c <- update:
+		case <-q.done:
+			return
+		}
+	}
+}
+
+// len returns the number of updates waiting to be sent.
+func (q *nodeQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending)
+}
+
+// stop drops the pending updates and waits for the queue to stop sending
+// to the channel, after which the channel can be closed.
+func (q *nodeQueue) stop() {
+	q.mu.Lock()
+	if q.stopped {
+		q.mu.Unlock()
+
+		return
+	}
+	q.stopped = true
+	q.pending = nil
+	close(q.done)
+	q.mu.Unlock()
+
+	q.wg.Wait()
+	notifierNodeQueueDepth.DeleteLabelValues(q.nodeID.String())
+}
+
+// mergeUpdate adds update to the pending updates of a node. It is merged
+// into the last pending update if they are of the same kind, and a full
+// update replaces all pending updates as the node gets the current state
+// with it. If more than maxPending updates are pending, they are replaced
+// by a full update too, it is cheaper to send the node the current state
+// than all changes to it.
+// Pings are not part of the state of the node and are always kept.
+// It reports if the pending updates were replaced by a full update.
+func mergeUpdate(
+	pending []types.StateUpdate,
+	update types.StateUpdate,
+	maxPending int,
+) ([]types.StateUpdate, bool) {
+	if update.Type == types.StatePingRequest {
+		return append(pending, update), false
+	}
+
+	if update.Type == types.StateFullUpdate {
+		return append([]types.StateUpdate{update}, pendingPings(pending)...), false
+	}
+
+	if len(pending) == 0 {
+		return []types.StateUpdate{update}, false
+	}
+
+	// A pending full update is the first pending update, and covers
+	// all changes after it.
+	if pending[0].Type == types.StateFullUpdate {
+		return pending, false
+	}
+
+	// The slices of an update are shared with the queues of all other
+	// nodes, merging creates new ones.
+	last := &pending[len(pending)-1]
+	if last.Type == update.Type {
+		switch update.Type {
+		case types.StatePeerChanged:
+			last.ChangeNodes = slices.Concat(last.ChangeNodes, update.ChangeNodes)
+
+			return pending, false
+		case types.StatePeerChangedPatch:
+			last.ChangePatches = slices.Concat(last.ChangePatches, update.ChangePatches)
+
+			return pending, false
+		case types.StatePeerRemoved:
+			last.Removed = slices.Concat(last.Removed, update.Removed)
+
+			return pending, false
+		case types.StateDERPUpdated, types.StateDNSUpdated:
+			*last = update
+
+			return pending, false
+		}
+	}
+
+	if len(pending) >= maxPending {
+		return append([]types.StateUpdate{types.UpdateFull()}, pendingPings(pending)...), true
+	}
+
+	return append(pending, update), false
+}
+
+func pendingPings(pending []types.StateUpdate) []types.StateUpdate {
+	var pings []types.StateUpdate
+	for _, update := range pending {
+		if update.Type == types.StatePingRequest {
+			pings = append(pings, update)
+		}
+	}
+
+	return pings
+}
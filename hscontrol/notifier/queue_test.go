@@ -0,0 +1,226 @@
+package notifier
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"tailscale.com/tailcfg"
+)
+
+func TestMergeUpdate(t *testing.T) {
+	derp1 := &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{1: {RegionID: 1}}}
+	derp2 := &tailcfg.DERPMap{Regions: map[int]*tailcfg.DERPRegion{2: {RegionID: 2}}}
+	ping1 := &tailcfg.PingRequest{URL: "https://headscale.example.com/machine/ping/1"}
+	ping2 := &tailcfg.PingRequest{URL: "https://headscale.example.com/machine/ping/2"}
+
+	tests := []struct {
+		name     string
+		pending  []types.StateUpdate
+		update   types.StateUpdate
+		want     []types.StateUpdate
+		wantFull bool
+	}{
+		{
+			name:   "empty",
+			update: types.UpdatePeerChanged(1),
+			want:   []types.StateUpdate{types.UpdatePeerChanged(1)},
+		},
+		{
+			name:    "merge-changed",
+			pending: []types.StateUpdate{types.UpdatePeerChanged(1, 2)},
+			update:  types.UpdatePeerChanged(3),
+			want:    []types.StateUpdate{types.UpdatePeerChanged(1, 2, 3)},
+		},
+		{
+			name:    "merge-removed",
+			pending: []types.StateUpdate{types.UpdatePeerRemoved(1)},
+			update:  types.UpdatePeerRemoved(2),
+			want:    []types.StateUpdate{types.UpdatePeerRemoved(1, 2)},
+		},
+		{
+			name: "merge-patches",
+			pending: []types.StateUpdate{
+				types.UpdatePeerPatch(&tailcfg.PeerChange{NodeID: 1, DERPRegion: 1}),
+			},
+			update: types.UpdatePeerPatch(&tailcfg.PeerChange{NodeID: 1, DERPRegion: 2}),
+			want: []types.StateUpdate{
+				types.UpdatePeerPatch(
+					&tailcfg.PeerChange{NodeID: 1, DERPRegion: 1},
+					&tailcfg.PeerChange{NodeID: 1, DERPRegion: 2},
+				),
+			},
+		},
+		{
+			name: "newest-derpmap",
+			pending: []types.StateUpdate{
+				{Type: types.StateDERPUpdated, DERPMap: derp1},
+			},
+			update: types.StateUpdate{Type: types.StateDERPUpdated, DERPMap: derp2},
+			want: []types.StateUpdate{
+				{Type: types.StateDERPUpdated, DERPMap: derp2},
+			},
+		},
+		{
+			name:    "single-dns-update",
+			pending: []types.StateUpdate{{Type: types.StateDNSUpdated}},
+			update:  types.StateUpdate{Type: types.StateDNSUpdated},
+			want:    []types.StateUpdate{{Type: types.StateDNSUpdated}},
+		},
+		{
+			name:    "keep-order",
+			pending: []types.StateUpdate{types.UpdatePeerChanged(1)},
+			update:  types.UpdatePeerRemoved(1),
+			want: []types.StateUpdate{
+				types.UpdatePeerChanged(1),
+				types.UpdatePeerRemoved(1),
+			},
+		},
+		{
+			name: "full-replaces-pending",
+			pending: []types.StateUpdate{
+				types.UpdatePeerChanged(1),
+				types.UpdatePeerRemoved(2),
+			},
+			update: types.UpdateFull(),
+			want:   []types.StateUpdate{types.UpdateFull()},
+		},
+		{
+			name:    "pending-full-covers-update",
+			pending: []types.StateUpdate{types.UpdateFull()},
+			update:  types.UpdatePeerRemoved(2),
+			want:    []types.StateUpdate{types.UpdateFull()},
+		},
+		{
+			name:    "pings-not-merged",
+			pending: []types.StateUpdate{types.UpdatePing(ping1)},
+			update:  types.UpdatePing(ping2),
+			want: []types.StateUpdate{
+				types.UpdatePing(ping1),
+				types.UpdatePing(ping2),
+			},
+		},
+		{
+			name: "full-keeps-pings",
+			pending: []types.StateUpdate{
+				types.UpdatePeerChanged(1),
+				types.UpdatePing(ping1),
+			},
+			update: types.UpdateFull(),
+			want: []types.StateUpdate{
+				types.UpdateFull(),
+				types.UpdatePing(ping1),
+			},
+		},
+		{
+			name: "too-many-pending-keeps-pings",
+			pending: []types.StateUpdate{
+				types.UpdatePeerChanged(1),
+				types.UpdatePing(ping1),
+				types.UpdatePeerChanged(3),
+			},
+			update: types.UpdatePeerRemoved(4),
+			want: []types.StateUpdate{
+				types.UpdateFull(),
+				types.UpdatePing(ping1),
+			},
+			wantFull: true,
+		},
+		{
+			name: "too-many-pending",
+			pending: []types.StateUpdate{
+				types.UpdatePeerChanged(1),
+				types.UpdatePeerRemoved(2),
+				types.UpdatePeerChanged(3),
+			},
+			update:   types.UpdatePeerRemoved(4),
+			want:     []types.StateUpdate{types.UpdateFull()},
+			wantFull: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, full := mergeUpdate(tt.pending, tt.update, 3)
+			if full != tt.wantFull {
+				t.Errorf("mergeUpdate() full = %t, want %t", full, tt.wantFull)
+			}
+
+			if diff := cmp.Diff(tt.want, got, util.Comparers...); diff != "" {
+				t.Errorf("mergeUpdate() unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMergeUpdateSharedUpdate(t *testing.T) {
+	// The same update is queued for all nodes, merging into it for one
+	// node must not change it for the others.
+	shared := types.UpdatePeerChanged(1)
+	shared.ChangeNodes = make([]types.NodeID, 1, 4)
+	shared.ChangeNodes[0] = 1
+
+	node1, _ := mergeUpdate([]types.StateUpdate{shared}, types.UpdatePeerChanged(2), 3)
+	node2, _ := mergeUpdate([]types.StateUpdate{shared}, types.UpdatePeerChanged(3), 3)
+
+	want1 := []types.StateUpdate{types.UpdatePeerChanged(1, 2)}
+	if diff := cmp.Diff(want1, node1, util.Comparers...); diff != "" {
+		t.Errorf("mergeUpdate() node 1 unexpected result (-want +got):\n%s", diff)
+	}
+
+	want2 := []types.StateUpdate{types.UpdatePeerChanged(1, 3)}
+	if diff := cmp.Diff(want2, node2, util.Comparers...); diff != "" {
+		t.Errorf("mergeUpdate() node 2 unexpected result (-want +got):\n%s", diff)
+	}
+}
+
+func TestNodeQueue(t *testing.T) {
+	c := make(chan types.StateUpdate, 1)
+	q := newNodeQueue(1, c, 2)
+	defer q.stop()
+
+	// The node does not read the updates, they pile up until they are
+	// replaced by a full update.
+	for id := range types.NodeID(10) {
+		if id%2 == 0 {
+			q.push(types.UpdatePeerChanged(id), "test")
+		} else {
+			q.push(types.UpdatePeerRemoved(id), "test")
+		}
+
+		if got := q.len(); got > 2 {
+			t.Fatalf("queue length = %d, want at most 2", got)
+		}
+	}
+
+	// All updates are delivered, or covered by a full update.
+	seen := make(map[types.NodeID]bool)
+	for len(seen) < 10 {
+		update := <-c
+		if update.Type == types.StateFullUpdate {
+			break
+		}
+
+		for _, id := range append(update.ChangeNodes, update.Removed...) {
+			seen[id] = true
+		}
+	}
+
+	// Later updates are still delivered.
+	q.push(types.UpdatePeerRemoved(10), "test")
+	for {
+		update := <-c
+		if update.Type == types.StatePeerRemoved && slices.Contains(update.Removed, 10) {
+			break
+		}
+	}
+
+	// A stopped queue does not send anymore.
+	q.stop()
+	q.push(types.UpdatePeerRemoved(11), "test")
+	if len(c) != 0 {
+		t.Errorf("stopped queue sent an update")
+	}
+}
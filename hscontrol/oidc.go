@@ -15,12 +15,13 @@ import (
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gorilla/mux"
 	"github.com/juanfont/headscale/hscontrol/db"
-	"github.com/juanfont/headscale/hscontrol/notifier"
-	"github.com/juanfont/headscale/hscontrol/policy"
+	"github.com/juanfont/headscale/hscontrol/events"
+	"github.com/juanfont/headscale/hscontrol/state"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/oauth2"
+	"gorm.io/gorm"
 	"zgo.at/zcache/v2"
 )
 
@@ -56,10 +57,14 @@ type AuthProviderOIDC struct {
 	serverURL         string
 	cfg               *types.OIDCConfig
 	db                *db.HSDatabase
+	store             *state.Store
 	registrationCache *zcache.Cache[string, RegistrationInfo]
-	notifier          *notifier.Notifier
+	events            *events.Bus
 	ipAlloc           *db.IPAllocator
-	polMan            policy.PolicyManager
+
+	// ha stores the registrations in the database as well, the callback
+	// can reach another instance than the one the login started on.
+	ha bool
 
 	oidcProvider *oidc.Provider
 	oauth2Config *oauth2.Config
@@ -70,9 +75,10 @@ func NewAuthProviderOIDC(
 	serverURL string,
 	cfg *types.OIDCConfig,
 	db *db.HSDatabase,
-	notif *notifier.Notifier,
+	store *state.Store,
+	bus *events.Bus,
 	ipAlloc *db.IPAllocator,
-	polMan policy.PolicyManager,
+	ha bool,
 ) (*AuthProviderOIDC, error) {
 	var err error
 	// grab oidc config if it hasn't been already
@@ -101,10 +107,11 @@ func NewAuthProviderOIDC(
 		serverURL:         serverURL,
 		cfg:               cfg,
 		db:                db,
+		store:             store,
 		registrationCache: registrationCache,
-		notifier:          notif,
+		events:            bus,
 		ipAlloc:           ipAlloc,
-		polMan:            polMan,
+		ha:                ha,
 
 		oidcProvider: oidcProvider,
 		oauth2Config: oauth2Config,
@@ -188,7 +195,10 @@ func (a *AuthProviderOIDC) RegisterHandler(
 	extras = append(extras, oidc.Nonce(nonce))
 
 	// Cache the registration info
-	a.registrationCache.Set(state, registrationInfo)
+	if err := a.saveRegistrationInfo(state, registrationInfo); err != nil {
+		httpError(writer, err)
+		return
+	}
 
 	authURL := a.oauth2Config.AuthCodeURL(state, extras...)
 	log.Debug().Msgf("Redirecting to %s for authentication", authURL)
@@ -359,7 +369,7 @@ func (a *AuthProviderOIDC) getOauth2Token(
 	var exchangeOpts []oauth2.AuthCodeOption
 
 	if a.cfg.PKCE.Enabled {
-		regInfo, ok := a.registrationCache.Get(state)
+		regInfo, ok := a.registrationInfo(state)
 		if !ok {
 			return nil, NewHTTPError(http.StatusNotFound, "registration not found", errNoOIDCRegistrationInfo)
 		}
@@ -447,7 +457,7 @@ func validateOIDCAllowedUsers(
 
 // getRegistrationIDFromState retrieves the registration ID from the state.
 func (a *AuthProviderOIDC) getRegistrationIDFromState(state string) *types.RegistrationID {
-	regInfo, ok := a.registrationCache.Get(state)
+	regInfo, ok := a.registrationInfo(state)
 	if !ok {
 		return nil
 	}
@@ -455,6 +465,54 @@ func (a *AuthProviderOIDC) getRegistrationIDFromState(state string) *types.Regis
 	return &regInfo.RegistrationID
 }
 
+// saveRegistrationInfo caches the registration info of the login with the
+// given state, and stores it in the database in HA mode.
+func (a *AuthProviderOIDC) saveRegistrationInfo(state string, regInfo RegistrationInfo) error {
+	a.registrationCache.Set(state, regInfo)
+
+	if !a.ha {
+		return nil
+	}
+
+	err := a.db.SaveOIDCRegistration(types.OIDCRegistration{
+		State:          state,
+		RegistrationID: regInfo.RegistrationID,
+		Verifier:       regInfo.Verifier,
+		ExpiresAt:      time.Now().Add(registerCacheExpiration),
+	})
+	if err != nil {
+		return fmt.Errorf("saving OIDC registration: %w", err)
+	}
+
+	return nil
+}
+
+// registrationInfo returns the registration info of the login with the
+// given state, from the cache or, in HA mode, from the database.
+func (a *AuthProviderOIDC) registrationInfo(state string) (RegistrationInfo, bool) {
+	if regInfo, ok := a.registrationCache.Get(state); ok {
+		return regInfo, true
+	}
+
+	if !a.ha {
+		return RegistrationInfo{}, false
+	}
+
+	reg, err := a.db.GetOIDCRegistration(state)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Error().Err(err).Msg("failed to look up OIDC registration")
+		}
+
+		return RegistrationInfo{}, false
+	}
+
+	return RegistrationInfo{
+		RegistrationID: reg.RegistrationID,
+		Verifier:       reg.Verifier,
+	}, true
+}
+
 func (a *AuthProviderOIDC) createOrUpdateUserFromClaim(
 	claims *types.OIDCClaims,
 ) (*types.User, error) {
@@ -470,13 +528,22 @@ func (a *AuthProviderOIDC) createOrUpdateUserFromClaim(
 		user = &types.User{}
 	}
 
+	created := user.ID == 0
+
 	user.FromClaim(claims)
 	err = a.db.DB.Save(user).Error
 	if err != nil {
 		return nil, fmt.Errorf("creating or updating user: %w", err)
 	}
 
-	err = usersChangedHook(a.db, a.polMan, a.notifier)
+	a.store.PutUser(*user)
+
+	var ev events.Event = events.UserUpdated{UserID: types.UserID(user.ID)}
+	if created {
+		ev = events.UserCreated{UserID: types.UserID(user.ID)}
+	}
+
+	err = a.events.Publish(context.Background(), ev)
 	if err != nil {
 		return nil, fmt.Errorf("updating resources using user: %w", err)
 	}
@@ -505,24 +572,19 @@ func (a *AuthProviderOIDC) handleRegistration(
 		return false, fmt.Errorf("could not register node: %w", err)
 	}
 
-	// Send an update to all nodes if this is a new node that they need to know
-	// about.
-	// If this is a refresh, just send new expiry updates.
-	updateSent, err := nodesChangedHook(a.db, a.polMan, a.notifier)
+	err = refreshStoreNode(a.db, a.store, node.ID)
 	if err != nil {
-		return false, fmt.Errorf("updating resources using node: %w", err)
+		return false, fmt.Errorf("updating node in store: %w", err)
 	}
 
-	if !updateSent {
-		ctx := types.NotifyCtx(context.Background(), "oidc-expiry-self", node.Hostname)
-		a.notifier.NotifyByNodeID(
-			ctx,
-			types.UpdateSelf(node.ID),
-			node.ID,
-		)
-
-		ctx = types.NotifyCtx(context.Background(), "oidc-expiry-peers", node.Hostname)
-		a.notifier.NotifyWithIgnore(ctx, types.UpdatePeerChanged(node.ID), node.ID)
+	// Send the node to all nodes that can see it, and to itself, both if
+	// it is a new node and if this is a refresh with a new expiry.
+	err = a.events.Publish(context.Background(), events.NodeRegistered{
+		NodeID:         node.ID,
+		RegistrationID: registrationID,
+	})
+	if err != nil {
+		return false, fmt.Errorf("updating resources using node: %w", err)
 	}
 
 	return newNode, nil
@@ -0,0 +1,327 @@
+package hscontrol
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+const (
+	// pingTimeout is how long to wait for a node to answer a ping.
+	pingTimeout = 30 * time.Second
+
+	pingIDLength = 32
+
+	// pingTypeC2N is the type of the pings carrying a request to the
+	// control-to-node (c2n) HTTP handler of the node.
+	pingTypeC2N = "c2n"
+)
+
+var (
+	errPingTimeout       = errors.New("node did not answer the ping")
+	errPingNotConnected  = errors.New("node is not connected")
+	errPingOtherInstance = errors.New("node is connected to another instance")
+	errPingC2NFailed     = errors.New("c2n request failed")
+)
+
+// pingResult is the answer of a node to a PingRequest.
+type pingResult struct {
+	// Latency is the round-trip time of the ping. For pings of the node
+	// itself it is measured by headscale, for pings of a target by the
+	// node.
+	Latency time.Duration
+
+	// Response is the result reported by the node for pings of a
+	// target.
+	Response *tailcfg.PingResponse
+
+	// C2N is the response of the c2n handler of the node for c2n pings,
+	// with its body read.
+	C2N *http.Response
+}
+
+// path returns how the ping was answered: control if the node answered
+// the ping itself, otherwise peerapi, direct or derp.
+func (r pingResult) path() string {
+	switch {
+	case r.C2N != nil:
+		return pingTypeC2N
+	case r.Response == nil:
+		return "control"
+	case r.Response.Type == tailcfg.PingPeerAPI:
+		return "peerapi"
+	case r.Response.Endpoint != "":
+		return "direct"
+	case r.Response.DERPRegionID != 0:
+		return "derp"
+	default:
+		return strings.ToLower(string(r.Response.Type))
+	}
+}
+
+type pendingPing struct {
+	machineKey key.MachinePublic
+	c2n        bool
+	start      time.Time
+	result     chan pingResult
+}
+
+// pingTracker keeps track of the PingRequests sent to nodes and waiting
+// for an answer. Every ping has its own unguessable URL, which only the
+// pinged node can answer.
+type pingTracker struct {
+	mu      sync.Mutex
+	pending map[string]*pendingPing
+}
+
+func newPingTracker() *pingTracker {
+	return &pingTracker{
+		pending: make(map[string]*pendingPing),
+	}
+}
+
+// start registers a ping of the node with the given machine key, c2n
+// tells if it is answered with the response of the c2n handler of the
+// node. It returns the ID of the ping, the channel receiving the result
+// and a function which must be called once the ping is no longer waited
+// for.
+func (p *pingTracker) start(machineKey key.MachinePublic, c2n bool) (string, <-chan pingResult, func(), error) {
+	id, err := util.GenerateRandomStringURLSafe(pingIDLength)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("generating ping ID: %w", err)
+	}
+
+	ping := &pendingPing{
+		machineKey: machineKey,
+		c2n:        c2n,
+		start:      time.Now(),
+		result:     make(chan pingResult, 1),
+	}
+
+	p.mu.Lock()
+	p.pending[id] = ping
+	p.mu.Unlock()
+
+	return id, ping.result, func() {
+		p.mu.Lock()
+		delete(p.pending, id)
+		p.mu.Unlock()
+	}, nil
+}
+
+// handle handles the answer to the ping from the node with the given
+// machine key. Nodes answer pings of themselves with a HEAD request, pings
+// of a target by POSTing a tailcfg.PingResponse and c2n pings by POSTing
+// the HTTP response of their c2n handler.
+func (p *pingTracker) handle(
+	machineKey key.MachinePublic,
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	id := mux.Vars(req)["id"]
+
+	p.mu.Lock()
+	ping, ok := p.pending[id]
+	if ok && ping.machineKey == machineKey {
+		delete(p.pending, id)
+	}
+	p.mu.Unlock()
+
+	if !ok || ping.machineKey != machineKey {
+		httpError(writer, NewHTTPError(http.StatusNotFound, "unknown ping", nil))
+
+		return
+	}
+
+	result := pingResult{Latency: time.Since(ping.start)}
+
+	switch req.Method {
+	case http.MethodHead, http.MethodGet:
+	case http.MethodPost:
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			httpError(writer, err)
+
+			return
+		}
+
+		if ping.c2n {
+			resp, err := readC2NResponse(body)
+			if err != nil {
+				httpError(writer, NewHTTPError(http.StatusBadRequest, "invalid c2n response", err))
+
+				return
+			}
+			result.C2N = resp
+
+			break
+		}
+
+		var resp tailcfg.PingResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			httpError(writer, NewHTTPError(http.StatusBadRequest, "invalid ping response", err))
+
+			return
+		}
+		result.Response = &resp
+		result.Latency = time.Duration(resp.LatencySeconds * float64(time.Second))
+	default:
+		httpError(writer, errMethodNotAllowed)
+
+		return
+	}
+
+	ping.result <- result
+	writer.WriteHeader(http.StatusOK)
+}
+
+// NoisePingHandler receives the answers of nodes to the PingRequests sent
+// to them.
+func (ns *noiseServer) NoisePingHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	ns.headscale.pings.handle(ns.machineKey, writer, req)
+}
+
+// readC2NResponse reads the HTTP response of a c2n handler from body,
+// along with its own body.
+func readC2NResponse(body []byte) (*http.Response, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(body)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	return resp, nil
+}
+
+// pingNode asks the node to ping target, and waits for its answer. If
+// target is not valid, the node answers the ping itself, which tells if
+// it is reachable and responsive through its map session.
+// pingType is the comma separated tailcfg.PingType of the ping of a target,
+// and defaults to disco. Without a target, a pingType of c2n makes the node
+// answer through its c2n handler instead.
+func (h *Headscale) pingNode(
+	ctx context.Context,
+	node *types.Node,
+	target netip.Addr,
+	pingType string,
+) (pingResult, error) {
+	if !target.IsValid() && pingType == pingTypeC2N {
+		return h.pingNodeC2N(ctx, node)
+	}
+
+	ping := &tailcfg.PingRequest{Log: true}
+	if target.IsValid() {
+		if pingType == "" {
+			pingType = string(tailcfg.PingDisco)
+		}
+		ping.Types = pingType
+		ping.IP = target
+	}
+
+	return h.sendPing(ctx, node, ping)
+}
+
+// pingNodeC2N pings the c2n echo handler of the node, which tells if the
+// node is responsive and can answer c2n requests.
+func (h *Headscale) pingNodeC2N(ctx context.Context, node *types.Node) (pingResult, error) {
+	const payload = "headscale"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/echo", strings.NewReader(payload))
+	if err != nil {
+		return pingResult{}, err
+	}
+
+	res, err := h.c2nRequest(ctx, node, req)
+	if err != nil {
+		return pingResult{}, err
+	}
+
+	body, _ := io.ReadAll(res.C2N.Body)
+	if res.C2N.StatusCode != http.StatusOK || string(body) != payload {
+		return pingResult{}, fmt.Errorf("%w: %s", errPingC2NFailed, res.C2N.Status)
+	}
+
+	return res, nil
+}
+
+// c2nRequest sends req to the c2n handler of the node, as the payload of
+// a ping, and waits for its response.
+func (h *Headscale) c2nRequest(
+	ctx context.Context,
+	node *types.Node,
+	req *http.Request,
+) (pingResult, error) {
+	var payload bytes.Buffer
+	if err := req.Write(&payload); err != nil {
+		return pingResult{}, fmt.Errorf("writing c2n request: %w", err)
+	}
+
+	return h.sendPing(ctx, node, &tailcfg.PingRequest{
+		Types:   pingTypeC2N,
+		Payload: payload.Bytes(),
+		Log:     true,
+	})
+}
+
+// sendPing sends ping to the node through its map session, with a URL to
+// answer it, and waits for the answer.
+func (h *Headscale) sendPing(
+	ctx context.Context,
+	node *types.Node,
+	ping *tailcfg.PingRequest,
+) (pingResult, error) {
+	// The answer would be sent to the instance the node is connected to,
+	// which does not know about the ping.
+	if instance, ok := h.nodeNotifier.RemoteInstance(node.ID); ok {
+		return pingResult{}, fmt.Errorf("%w: %s", errPingOtherInstance, instance)
+	}
+
+	if !h.nodeNotifier.IsLikelyConnected(node.ID) {
+		return pingResult{}, errPingNotConnected
+	}
+
+	id, result, done, err := h.pings.start(node.MachineKey, ping.Types == pingTypeC2N)
+	if err != nil {
+		return pingResult{}, err
+	}
+	defer done()
+
+	ping.URL = strings.TrimSuffix(h.cfg.ServerURL, "/") + "/machine/ping/" + id
+	ping.URLIsNoise = true
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	h.nodeNotifier.NotifyByNodeID(types.NotifyCtx(ctx, "ping", node.Hostname), types.UpdatePing(ping), node.ID)
+
+	select {
+	case res := <-result:
+		return res, nil
+	case <-ctx.Done():
+		return pingResult{}, errPingTimeout
+	}
+}
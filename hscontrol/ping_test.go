@@ -0,0 +1,293 @@
+package hscontrol
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/juanfont/headscale/hscontrol/notifier"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+// answerPing answers the ping like a node would over its Noise
+// connection, and returns the status code of the answer.
+func answerPing(
+	pings *pingTracker,
+	machineKey key.MachinePublic,
+	id string,
+	resp *tailcfg.PingResponse,
+) int {
+	req := httptest.NewRequest(http.MethodHead, "/machine/ping/"+id, nil)
+	if resp != nil {
+		body, _ := json.Marshal(resp)
+		req = httptest.NewRequest(http.MethodPost, "/machine/ping/"+id, strings.NewReader(string(body)))
+	}
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+
+	rec := httptest.NewRecorder()
+	pings.handle(machineKey, rec, req)
+
+	return rec.Code
+}
+
+func TestPingTracker(t *testing.T) {
+	pings := newPingTracker()
+	machineKey := key.NewMachine().Public()
+
+	id, result, done, err := pings.start(machineKey, false)
+	if err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+	defer done()
+
+	if code := answerPing(pings, machineKey, "unknown", nil); code != http.StatusNotFound {
+		t.Errorf("answer of unknown ping status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	if code := answerPing(pings, key.NewMachine().Public(), id, nil); code != http.StatusNotFound {
+		t.Errorf("answer of other node status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	if code := answerPing(pings, machineKey, id, nil); code != http.StatusOK {
+		t.Errorf("answer status = %d, want %d", code, http.StatusOK)
+	}
+
+	select {
+	case res := <-result:
+		if res.Response != nil {
+			t.Errorf("result response = %v, want nil", res.Response)
+		}
+		if got := res.path(); got != "control" {
+			t.Errorf("result path = %q, want %q", got, "control")
+		}
+	default:
+		t.Fatal("no result after answer")
+	}
+
+	// A ping can only be answered once.
+	if code := answerPing(pings, machineKey, id, nil); code != http.StatusNotFound {
+		t.Errorf("second answer status = %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestPingNode(t *testing.T) {
+	node := &types.Node{
+		ID:         1,
+		Hostname:   "node1",
+		MachineKey: key.NewMachine().Public(),
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		resp     *tailcfg.PingResponse
+		wantPath string
+	}{
+		{
+			name:     "self",
+			wantPath: "control",
+		},
+		{
+			name:   "direct",
+			target: "100.64.0.2",
+			resp: &tailcfg.PingResponse{
+				Type:           tailcfg.PingDisco,
+				LatencySeconds: 0.01,
+				Endpoint:       "192.0.2.1:41641",
+			},
+			wantPath: "direct",
+		},
+		{
+			name:   "derp",
+			target: "100.64.0.2",
+			resp: &tailcfg.PingResponse{
+				Type:           tailcfg.PingDisco,
+				LatencySeconds: 0.05,
+				DERPRegionID:   1,
+				DERPRegionCode: "test",
+			},
+			wantPath: "derp",
+		},
+		{
+			name:   "peerapi",
+			target: "100.64.0.2",
+			resp: &tailcfg.PingResponse{
+				Type:           tailcfg.PingPeerAPI,
+				LatencySeconds: 0.02,
+			},
+			wantPath: "peerapi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Headscale{
+				cfg: &types.Config{ServerURL: "https://headscale.example.com"},
+				nodeNotifier: notifier.NewNotifier(&types.Config{
+					Tuning: types.Tuning{
+						BatchChangeDelay:    time.Hour,
+						NodeUpdateQueueSize: 30,
+					},
+				}),
+				pings: newPingTracker(),
+			}
+			defer h.nodeNotifier.Close()
+
+			// The fake client reads its map session and answers the
+			// ping like a node would.
+			ch := make(chan types.StateUpdate, 1)
+			h.nodeNotifier.AddNode(node.ID, ch)
+			go func() {
+				for update := range ch {
+					if update.Type != types.StatePingRequest {
+						continue
+					}
+
+					ping := update.PingRequest
+					if !ping.URLIsNoise || ping.IP.IsValid() != (tt.target != "") {
+						t.Errorf("unexpected ping request %+v", ping)
+					}
+
+					answerPing(h.pings, node.MachineKey, path.Base(ping.URL), tt.resp)
+				}
+			}()
+
+			var target netip.Addr
+			if tt.target != "" {
+				target = netip.MustParseAddr(tt.target)
+			}
+
+			res, err := h.pingNode(context.Background(), node, target, "")
+			if err != nil {
+				t.Fatalf("pingNode() error = %v", err)
+			}
+
+			if got := res.path(); got != tt.wantPath {
+				t.Errorf("pingNode() path = %q, want %q", got, tt.wantPath)
+			}
+
+			if tt.resp != nil && res.Latency != time.Duration(tt.resp.LatencySeconds*float64(time.Second)) {
+				t.Errorf("pingNode() latency = %s, want %gs", res.Latency, tt.resp.LatencySeconds)
+			}
+		})
+	}
+}
+
+func TestPingNodeC2N(t *testing.T) {
+	node := &types.Node{
+		ID:         1,
+		Hostname:   "node1",
+		MachineKey: key.NewMachine().Public(),
+	}
+
+	h := &Headscale{
+		cfg: &types.Config{ServerURL: "https://headscale.example.com"},
+		nodeNotifier: notifier.NewNotifier(&types.Config{
+			Tuning: types.Tuning{
+				BatchChangeDelay:    time.Hour,
+				NodeUpdateQueueSize: 30,
+			},
+		}),
+		pings: newPingTracker(),
+	}
+	defer h.nodeNotifier.Close()
+
+	// The fake client serves the c2n request of the ping with an echo
+	// handler, and posts the response back like a node would.
+	ch := make(chan types.StateUpdate, 1)
+	h.nodeNotifier.AddNode(node.ID, ch)
+	go func() {
+		for update := range ch {
+			if update.Type != types.StatePingRequest {
+				continue
+			}
+
+			ping := update.PingRequest
+			if ping.Types != pingTypeC2N || !ping.URLIsNoise {
+				t.Errorf("unexpected ping request %+v", ping)
+			}
+
+			c2nReq, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(ping.Payload)))
+			if err != nil {
+				t.Errorf("reading c2n request: %s", err)
+
+				continue
+			}
+			if c2nReq.URL.Path != "/echo" {
+				t.Errorf("c2n request path = %q, want %q", c2nReq.URL.Path, "/echo")
+			}
+
+			rec := httptest.NewRecorder()
+			body, _ := io.ReadAll(c2nReq.Body)
+			rec.Write(body)
+
+			var resp bytes.Buffer
+			rec.Result().Write(&resp)
+
+			id := path.Base(ping.URL)
+			req := httptest.NewRequest(http.MethodPost, "/machine/ping/"+id, &resp)
+			req = mux.SetURLVars(req, map[string]string{"id": id})
+			h.pings.handle(node.MachineKey, httptest.NewRecorder(), req)
+		}
+	}()
+
+	res, err := h.pingNode(context.Background(), node, netip.Addr{}, pingTypeC2N)
+	if err != nil {
+		t.Fatalf("pingNode() error = %v", err)
+	}
+
+	if got := res.path(); got != pingTypeC2N {
+		t.Errorf("pingNode() path = %q, want %q", got, pingTypeC2N)
+	}
+}
+
+func TestPingNodeNotConnected(t *testing.T) {
+	h := &Headscale{
+		cfg: &types.Config{ServerURL: "https://headscale.example.com"},
+		nodeNotifier: notifier.NewNotifier(&types.Config{
+			Tuning: types.Tuning{BatchChangeDelay: time.Hour},
+		}),
+		pings: newPingTracker(),
+	}
+	defer h.nodeNotifier.Close()
+
+	_, err := h.pingNode(context.Background(), &types.Node{ID: 1}, netip.Addr{}, "")
+	if !errors.Is(err, errPingNotConnected) {
+		t.Errorf("pingNode() error = %v, want %v", err, errPingNotConnected)
+	}
+}
+
+func TestPingNodeOtherInstance(t *testing.T) {
+	h := &Headscale{
+		cfg: &types.Config{ServerURL: "https://headscale.example.com"},
+		nodeNotifier: notifier.NewNotifier(&types.Config{
+			Tuning: types.Tuning{BatchChangeDelay: time.Hour},
+		}),
+		pings: newPingTracker(),
+	}
+	defer h.nodeNotifier.Close()
+
+	h.nodeNotifier.AddRemoteNode(1, "instance-b")
+
+	_, err := h.pingNode(context.Background(), &types.Node{ID: 1}, netip.Addr{}, "")
+	if !errors.Is(err, errPingOtherInstance) {
+		t.Fatalf("pingNode() error = %v, want %v", err, errPingOtherInstance)
+	}
+
+	if !strings.Contains(err.Error(), "instance-b") {
+		t.Errorf("pingNode() error = %v, want the instance of the node", err)
+	}
+}
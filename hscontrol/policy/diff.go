@@ -0,0 +1,167 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"tailscale.com/tailcfg"
+)
+
+// NodeDiff describes how a policy change affects a node.
+type NodeDiff struct {
+	Node *types.Node
+
+	// PeersGained and PeersLost are the peers the node would gain or
+	// lose visibility of.
+	PeersGained types.Nodes
+	PeersLost   types.Nodes
+
+	// FilterRulesAdded and FilterRulesRemoved are the changes to the
+	// packet filter sent to the node.
+	FilterRulesAdded   []tailcfg.FilterRule
+	FilterRulesRemoved []tailcfg.FilterRule
+
+	SSHRulesAdded   []*tailcfg.SSHRule
+	SSHRulesRemoved []*tailcfg.SSHRule
+
+	// RoutesApproved and RoutesUnapproved are the announced routes of
+	// the node which would become, or stop being, auto approved.
+	RoutesApproved   []netip.Prefix
+	RoutesUnapproved []netip.Prefix
+}
+
+// IsEmpty reports whether the policy change does not affect the node.
+func (d NodeDiff) IsEmpty() bool {
+	return len(d.PeersGained) == 0 && len(d.PeersLost) == 0 &&
+		len(d.FilterRulesAdded) == 0 && len(d.FilterRulesRemoved) == 0 &&
+		len(d.SSHRulesAdded) == 0 && len(d.SSHRulesRemoved) == 0 &&
+		len(d.RoutesApproved) == 0 && len(d.RoutesUnapproved) == 0
+}
+
+// DiffPolicyManagers compares what the current and the candidate policy
+// managers would send to each of the nodes, and returns the differences for
+// the nodes affected by the change.
+func DiffPolicyManagers(current, candidate PolicyManager, nodes types.Nodes) ([]NodeDiff, error) {
+	var diffs []NodeDiff
+
+	for _, node := range nodes {
+		diff := NodeDiff{Node: node}
+
+		currentPeers, err := peersOf(current, node, nodes)
+		if err != nil {
+			return nil, err
+		}
+		candidatePeers, err := peersOf(candidate, node, nodes)
+		if err != nil {
+			return nil, err
+		}
+		diff.PeersGained, diff.PeersLost = diffByKey(currentPeers, candidatePeers, func(n *types.Node) string {
+			return n.ID.String()
+		})
+
+		currentFilter, err := current.FilterForNode(node)
+		if err != nil {
+			return nil, err
+		}
+		candidateFilter, err := candidate.FilterForNode(node)
+		if err != nil {
+			return nil, err
+		}
+		diff.FilterRulesAdded, diff.FilterRulesRemoved = diffByKey(
+			ReduceFilterRules(node, currentFilter),
+			ReduceFilterRules(node, candidateFilter),
+			jsonKey[tailcfg.FilterRule],
+		)
+
+		currentSSH, err := current.SSHPolicy(node)
+		if err != nil {
+			return nil, fmt.Errorf("compiling current SSH policy: %w", err)
+		}
+		candidateSSH, err := candidate.SSHPolicy(node)
+		if err != nil {
+			return nil, fmt.Errorf("compiling candidate SSH policy: %w", err)
+		}
+		diff.SSHRulesAdded, diff.SSHRulesRemoved = diffByKey(
+			sshRules(currentSSH),
+			sshRules(candidateSSH),
+			jsonKey[*tailcfg.SSHRule],
+		)
+
+		for _, route := range node.AnnouncedRoutes() {
+			was, is := current.NodeCanApproveRoute(node, route), candidate.NodeCanApproveRoute(node, route)
+			switch {
+			case is && !was:
+				diff.RoutesApproved = append(diff.RoutesApproved, route)
+			case was && !is:
+				diff.RoutesUnapproved = append(diff.RoutesUnapproved, route)
+			}
+		}
+
+		if !diff.IsEmpty() {
+			diffs = append(diffs, diff)
+		}
+	}
+
+	return diffs, nil
+}
+
+// peersOf returns the peers of the node, in the same way as they are
+// determined when creating a map response.
+func peersOf(pm PolicyManager, node *types.Node, nodes types.Nodes) (types.Nodes, error) {
+	if len(pm.Filter()) == 0 {
+		return slices.DeleteFunc(slices.Clone(nodes), func(n *types.Node) bool {
+			return n.ID == node.ID
+		}), nil
+	}
+
+	filter, err := pm.FilterForNode(node)
+	if err != nil {
+		return nil, err
+	}
+
+	return FilterNodesByACL(node, nodes, filter), nil
+}
+
+func sshRules(pol *tailcfg.SSHPolicy) []*tailcfg.SSHRule {
+	if pol == nil {
+		return nil
+	}
+
+	return pol.Rules
+}
+
+func jsonKey[T any](v T) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// diffByKey returns the elements only present in after, and the elements
+// only present in before, compared by the key of the elements.
+func diffByKey[T any](before, after []T, key func(T) string) ([]T, []T) {
+	beforeKeys := make(map[string]bool, len(before))
+	for _, v := range before {
+		beforeKeys[key(v)] = true
+	}
+
+	afterKeys := make(map[string]bool, len(after))
+	for _, v := range after {
+		afterKeys[key(v)] = true
+	}
+
+	var added, removed []T
+	for _, v := range after {
+		if !beforeKeys[key(v)] {
+			added = append(added, v)
+		}
+	}
+	for _, v := range before {
+		if !afterKeys[key(v)] {
+			removed = append(removed, v)
+		}
+	}
+
+	return added, removed
+}
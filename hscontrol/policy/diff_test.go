@@ -0,0 +1,153 @@
+package policy
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"tailscale.com/tailcfg"
+)
+
+func TestDiffPolicyManagers(t *testing.T) {
+	users := types.Users{
+		types.User{Model: gorm.Model{ID: 1}, Name: "user1"},
+		types.User{Model: gorm.Model{ID: 2}, Name: "user2"},
+		types.User{Model: gorm.Model{ID: 3}, Name: "user3"},
+	}
+
+	nodes := types.Nodes{
+		&types.Node{ID: 1, IPv4: ap("100.64.0.1"), User: users[0], UserID: 1},
+		&types.Node{ID: 2, IPv4: ap("100.64.0.2"), User: users[1], UserID: 2},
+		&types.Node{
+			ID:     3,
+			IPv4:   ap("100.64.0.3"),
+			User:   users[2],
+			UserID: 3,
+			Hostinfo: &tailcfg.Hostinfo{
+				RoutableIPs: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")},
+			},
+		},
+	}
+
+	current := `
+{
+  "acls": [
+    {"action": "accept", "src": ["user1@"], "dst": ["user2@:22"]}
+  ]
+}
+`
+
+	candidate := `
+{
+  "autoApprovers": {
+    "routes": {
+      "10.0.0.0/8": ["user3@"]
+    }
+  },
+  "acls": [
+    {"action": "accept", "src": ["user1@"], "dst": ["user3@:22"]}
+  ]
+}
+`
+
+	type nodeDiff struct {
+		ID                 types.NodeID
+		PeersGained        []types.NodeID
+		PeersLost          []types.NodeID
+		FilterRulesAdded   int
+		FilterRulesRemoved int
+		RoutesApproved     []netip.Prefix
+	}
+
+	want := []nodeDiff{
+		{
+			ID:          1,
+			PeersGained: []types.NodeID{3},
+			PeersLost:   []types.NodeID{2},
+		},
+		{
+			ID:                 2,
+			PeersLost:          []types.NodeID{1},
+			FilterRulesRemoved: 1,
+		},
+		{
+			ID:               3,
+			PeersGained:      []types.NodeID{1},
+			FilterRulesAdded: 1,
+			RoutesApproved:   []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")},
+		},
+	}
+
+	currentFuncs := PolicyManagerFuncsForTest([]byte(current))
+	candidateFuncs := PolicyManagerFuncsForTest([]byte(candidate))
+
+	for idx := range currentFuncs {
+		t.Run(fmt.Sprintf("v%d", idx+1), func(t *testing.T) {
+			currentPM, err := currentFuncs[idx](users, nodes)
+			require.NoError(t, err)
+			candidatePM, err := candidateFuncs[idx](users, nodes)
+			require.NoError(t, err)
+
+			diffs, err := DiffPolicyManagers(currentPM, candidatePM, nodes)
+			require.NoError(t, err)
+
+			var got []nodeDiff
+			for _, diff := range diffs {
+				got = append(got, nodeDiff{
+					ID:                 diff.Node.ID,
+					PeersGained:        nodeIDs(diff.PeersGained),
+					PeersLost:          nodeIDs(diff.PeersLost),
+					FilterRulesAdded:   len(diff.FilterRulesAdded),
+					FilterRulesRemoved: len(diff.FilterRulesRemoved),
+					RoutesApproved:     diff.RoutesApproved,
+				})
+			}
+
+			require.Equal(t, want, got)
+		})
+	}
+}
+
+func TestDiffPolicyManagersUnchanged(t *testing.T) {
+	users := types.Users{
+		types.User{Model: gorm.Model{ID: 1}, Name: "user1"},
+	}
+
+	nodes := types.Nodes{
+		&types.Node{ID: 1, IPv4: ap("100.64.0.1"), User: users[0], UserID: 1},
+		&types.Node{ID: 2, IPv4: ap("100.64.0.2"), User: users[0], UserID: 1},
+	}
+
+	pol := []byte(`
+{
+  "acls": [
+    {"action": "accept", "src": ["user1@"], "dst": ["user1@:*"]}
+  ]
+}
+`)
+
+	for idx, pmf := range PolicyManagerFuncsForTest(pol) {
+		t.Run(fmt.Sprintf("v%d", idx+1), func(t *testing.T) {
+			current, err := pmf(users, nodes)
+			require.NoError(t, err)
+			candidate, err := pmf(users, nodes)
+			require.NoError(t, err)
+
+			diffs, err := DiffPolicyManagers(current, candidate, nodes)
+			require.NoError(t, err)
+			require.Empty(t, diffs)
+		})
+	}
+}
+
+func nodeIDs(nodes types.Nodes) []types.NodeID {
+	var ids []types.NodeID
+	for _, node := range nodes {
+		ids = append(ids, node.ID)
+	}
+
+	return ids
+}
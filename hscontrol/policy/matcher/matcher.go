@@ -2,10 +2,12 @@ package matcher
 
 import (
 	"net/netip"
+	"slices"
 
 	"github.com/juanfont/headscale/hscontrol/util"
 	"go4.org/netipx"
 	"tailscale.com/tailcfg"
+	"tailscale.com/types/ipproto"
 )
 
 type Match struct {
@@ -88,3 +90,58 @@ func (m *Match) DestsOverlapsPrefixes(prefixes ...netip.Prefix) bool {
 
 	return false
 }
+
+// FilterAllows reports whether the filter allows any of the sources to reach
+// any of the destinations on the given port and protocol, and the index of
+// the first rule allowing it.
+func FilterAllows(
+	filter []tailcfg.FilterRule,
+	srcs, dsts []netip.Addr,
+	port uint16,
+	proto int,
+) (int, bool) {
+	for index, rule := range filter {
+		if !ruleHasProto(rule, proto) {
+			continue
+		}
+
+		if !prefixStringsContain(rule.SrcIPs, srcs) {
+			continue
+		}
+
+		for _, dest := range rule.DstPorts {
+			if dest.Ports.Contains(port) && prefixStringsContain([]string{dest.IP}, dsts) {
+				return index, true
+			}
+		}
+	}
+
+	return -1, false
+}
+
+// ruleHasProto reports whether the rule applies to the protocol, a rule
+// without protocols applies to TCP, UDP and ICMP.
+func ruleHasProto(rule tailcfg.FilterRule, proto int) bool {
+	if len(rule.IPProto) == 0 {
+		return slices.Contains([]int{int(ipproto.TCP), int(ipproto.UDP), int(ipproto.ICMPv4), int(ipproto.ICMPv6)}, proto)
+	}
+
+	return slices.Contains(rule.IPProto, proto)
+}
+
+// prefixStringsContain reports whether any of the prefixes, in the format of
+// a FilterRule, contains any of the addresses.
+func prefixStringsContain(prefixes []string, addrs []netip.Addr) bool {
+	for _, pref := range prefixes {
+		ips, err := util.ParseIPSet(pref, nil)
+		if err != nil {
+			continue
+		}
+
+		if slices.ContainsFunc(addrs, ips.Contains) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,432 @@
+package policy
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	policyv1 "github.com/juanfont/headscale/hscontrol/policy/v1"
+	policyv2 "github.com/juanfont/headscale/hscontrol/policy/v2"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"tailscale.com/tailcfg"
+)
+
+// MigrationIssue is a construct of a v1 policy that could not be converted
+// to policy v2 as is, it was either changed or dropped.
+type MigrationIssue struct {
+	// Path is the location of the construct in the v1 policy,
+	// e.g. "acls[2].src[0]".
+	Path    string
+	Message string
+}
+
+func (i MigrationIssue) String() string {
+	return i.Path + ": " + i.Message
+}
+
+// Migration is the result of converting a v1 policy to policy v2.
+type Migration struct {
+	// Policy is the converted policy in the policy v2 format.
+	Policy []byte
+	Issues []MigrationIssue
+
+	// FilterRulesLost are the filter rules the v1 policy produces for the
+	// current nodes, but the converted policy does not, and FilterRulesGained
+	// the other way around.
+	FilterRulesLost   []tailcfg.FilterRule
+	FilterRulesGained []tailcfg.FilterRule
+}
+
+// Equivalent reports whether the converted policy produces the same filter
+// rules as the v1 policy for the current nodes.
+func (m *Migration) Equivalent() bool {
+	return len(m.FilterRulesLost) == 0 && len(m.FilterRulesGained) == 0
+}
+
+// MigratePolicyV1ToV2 converts a v1 policy to the policy v2 format.
+// Users are written in the "user@" form required by policy v2, resolved
+// against the given users the same way policy v1 does. The equivalence of
+// the converted policy is checked by comparing the filter rules of both
+// policies for the given nodes.
+func MigratePolicyV1ToV2(polB []byte, users []types.User, nodes types.Nodes) (*Migration, error) {
+	pol, err := policyv1.LoadACLPolicyFromBytes(polB)
+	if err != nil {
+		return nil, fmt.Errorf("parsing v1 policy: %w", err)
+	}
+
+	m := migrator{pol: pol, users: users}
+	converted, err := json.MarshalIndent(m.policy(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding v2 policy: %w", err)
+	}
+
+	v1pm, err := policyv1.NewPolicyManager(polB, users, nodes)
+	if err != nil {
+		return nil, fmt.Errorf("loading v1 policy: %w", err)
+	}
+
+	v2pm, err := policyv2.NewPolicyManager(converted, users, nodes)
+	if err != nil {
+		return nil, fmt.Errorf("loading converted v2 policy: %w", err)
+	}
+
+	gained, lost := diffByKey(
+		normaliseFilter(v1pm.Filter()),
+		normaliseFilter(v2pm.Filter()),
+		jsonKey[tailcfg.FilterRule],
+	)
+
+	return &Migration{
+		Policy:            converted,
+		Issues:            m.issues,
+		FilterRulesLost:   lost,
+		FilterRulesGained: gained,
+	}, nil
+}
+
+// normaliseFilter sorts the fields of the filter rules which are sets, so
+// rules can be compared independent of the order they were compiled in.
+// Rules without sources or destinations never match and are dropped,
+// policy v1 keeps them while policy v2 does not.
+func normaliseFilter(rules []tailcfg.FilterRule) []tailcfg.FilterRule {
+	ret := make([]tailcfg.FilterRule, 0, len(rules))
+	for _, rule := range rules {
+		if len(rule.SrcIPs) == 0 || (len(rule.DstPorts) == 0 && len(rule.CapGrant) == 0) {
+			continue
+		}
+
+		rule.SrcIPs = slices.Sorted(slices.Values(rule.SrcIPs))
+		rule.IPProto = slices.Sorted(slices.Values(rule.IPProto))
+		rule.DstPorts = slices.SortedFunc(slices.Values(rule.DstPorts), func(a, b tailcfg.NetPortRange) int {
+			return cmp.Or(
+				cmp.Compare(a.IP, b.IP),
+				cmp.Compare(a.Ports.First, b.Ports.First),
+				cmp.Compare(a.Ports.Last, b.Ports.Last),
+			)
+		})
+		ret = append(ret, rule)
+	}
+
+	return ret
+}
+
+// The types below mirror the JSON format of a v2 policy, the v2 types
+// only implement decoding.
+type migratedPolicy struct {
+	Groups        map[string][]string    `json:"groups,omitempty"`
+	Hosts         map[string]string      `json:"hosts,omitempty"`
+	TagOwners     map[string][]string    `json:"tagOwners,omitempty"`
+	ACLs          []migratedACL          `json:"acls"`
+	AutoApprovers *migratedAutoApprovers `json:"autoApprovers,omitempty"`
+	SSHs          []migratedSSH          `json:"ssh,omitempty"`
+	Tests         []migratedTest         `json:"tests,omitempty"`
+}
+
+type migratedACL struct {
+	Action       string   `json:"action"`
+	Protocol     string   `json:"proto,omitempty"`
+	Sources      []string `json:"src"`
+	Destinations []string `json:"dst"`
+}
+
+type migratedAutoApprovers struct {
+	Routes   map[string][]string `json:"routes,omitempty"`
+	ExitNode []string            `json:"exitNode,omitempty"`
+}
+
+type migratedSSH struct {
+	Action       string   `json:"action"`
+	Sources      []string `json:"src"`
+	Destinations []string `json:"dst"`
+	Users        []string `json:"users"`
+	CheckPeriod  string   `json:"checkPeriod,omitempty"`
+}
+
+type migratedTest struct {
+	Source string   `json:"src"`
+	Accept []string `json:"accept"`
+	Deny   []string `json:"deny,omitempty"`
+}
+
+type migrator struct {
+	pol    *policyv1.ACLPolicy
+	users  []types.User
+	issues []MigrationIssue
+}
+
+func (m *migrator) issue(path string, format string, args ...any) {
+	m.issues = append(m.issues, MigrationIssue{
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (m *migrator) policy() migratedPolicy {
+	var out migratedPolicy
+
+	if len(m.pol.Groups) > 0 {
+		out.Groups = make(map[string][]string, len(m.pol.Groups))
+		for group, members := range m.pol.Groups {
+			out.Groups[group] = m.usernames(fmt.Sprintf("groups[%q]", group), members)
+		}
+	}
+
+	if len(m.pol.Hosts) > 0 {
+		out.Hosts = make(map[string]string, len(m.pol.Hosts))
+		for host, prefix := range m.pol.Hosts {
+			out.Hosts[host] = prefix.String()
+		}
+	}
+
+	if len(m.pol.TagOwners) > 0 {
+		out.TagOwners = make(map[string][]string, len(m.pol.TagOwners))
+		for tag, owners := range m.pol.TagOwners {
+			out.TagOwners[tag] = m.usernames(fmt.Sprintf("tagOwners[%q]", tag), owners)
+		}
+	}
+
+	out.ACLs = make([]migratedACL, 0, len(m.pol.ACLs))
+	for i, acl := range m.pol.ACLs {
+		path := fmt.Sprintf("acls[%d]", i)
+		out.ACLs = append(out.ACLs, migratedACL{
+			Action:       acl.Action,
+			Protocol:     acl.Protocol,
+			Sources:      m.aliases(path+".src", acl.Sources),
+			Destinations: m.destinations(path+".dst", acl.Destinations),
+		})
+	}
+
+	if len(m.pol.AutoApprovers.Routes) > 0 || len(m.pol.AutoApprovers.ExitNode) > 0 {
+		out.AutoApprovers = &migratedAutoApprovers{
+			ExitNode: m.usernames("autoApprovers.exitNode", m.pol.AutoApprovers.ExitNode),
+		}
+		if len(m.pol.AutoApprovers.Routes) > 0 {
+			out.AutoApprovers.Routes = make(map[string][]string, len(m.pol.AutoApprovers.Routes))
+			for prefix, approvers := range m.pol.AutoApprovers.Routes {
+				path := fmt.Sprintf("autoApprovers.routes[%q]", prefix)
+				out.AutoApprovers.Routes[prefix] = m.usernames(path, approvers)
+			}
+		}
+	}
+
+	for i, ssh := range m.pol.SSHs {
+		if rule, ok := m.ssh(fmt.Sprintf("ssh[%d]", i), ssh); ok {
+			out.SSHs = append(out.SSHs, rule)
+		}
+	}
+
+	for i, test := range m.pol.Tests {
+		path := fmt.Sprintf("tests[%d]", i)
+		migrated := migratedTest{
+			Source: m.alias(path+".src", test.Source),
+			Accept: m.testDestinations(path+".accept", test.Accept),
+			Deny:   m.testDestinations(path+".deny", test.Deny),
+		}
+		if len(migrated.Accept) == 0 && len(migrated.Deny) == 0 {
+			m.issue(path, "no destinations left, test dropped")
+			continue
+		}
+
+		out.Tests = append(out.Tests, migrated)
+	}
+
+	return out
+}
+
+// ssh converts an SSH rule, dropping the sources and destinations policy
+// v2 does not support in SSH rules. It reports false if no sources or no
+// destinations are left.
+func (m *migrator) ssh(path string, ssh policyv1.SSH) (migratedSSH, bool) {
+	rule := migratedSSH{
+		Action: ssh.Action,
+		Users:  ssh.Users,
+	}
+
+	for i, src := range ssh.Sources {
+		alias := m.alias(fmt.Sprintf("%s.src[%d]", path, i), src)
+		if isSSHAlias(alias) {
+			rule.Sources = append(rule.Sources, alias)
+			continue
+		}
+
+		m.issue(fmt.Sprintf("%s.src[%d]", path, i), "%q is not supported as SSH source in policy v2, dropped", src)
+	}
+
+	for i, dst := range ssh.Destinations {
+		alias := m.alias(fmt.Sprintf("%s.dst[%d]", path, i), dst)
+		if alias == "*" || isSSHAlias(alias) {
+			rule.Destinations = append(rule.Destinations, alias)
+			continue
+		}
+
+		m.issue(fmt.Sprintf("%s.dst[%d]", path, i), "%q is not supported as SSH destination in policy v2, dropped", dst)
+	}
+
+	if ssh.CheckPeriod != "" {
+		if _, err := time.ParseDuration(ssh.CheckPeriod); err != nil {
+			m.issue(path+".checkPeriod", "invalid check period %q, dropped: %s", ssh.CheckPeriod, err)
+		} else {
+			rule.CheckPeriod = ssh.CheckPeriod
+		}
+	}
+
+	if len(rule.Sources) == 0 || len(rule.Destinations) == 0 {
+		m.issue(path, "no sources or destinations left, SSH rule dropped")
+		return migratedSSH{}, false
+	}
+
+	return rule, true
+}
+
+// isSSHAlias reports whether the alias is a user, group, tag or autogroup,
+// the aliases policy v2 supports as source of an SSH rule.
+func isSSHAlias(alias string) bool {
+	return strings.Contains(alias, "@") ||
+		strings.HasPrefix(alias, "group:") ||
+		strings.HasPrefix(alias, "tag:") ||
+		strings.HasPrefix(alias, "autogroup:")
+}
+
+func (m *migrator) aliases(path string, aliases []string) []string {
+	ret := make([]string, len(aliases))
+	for i, alias := range aliases {
+		ret[i] = m.alias(fmt.Sprintf("%s[%d]", path, i), alias)
+	}
+
+	return ret
+}
+
+// destinations converts destinations of the form "alias:ports".
+func (m *migrator) destinations(path string, dests []string) []string {
+	var ret []string
+	for i, dest := range dests {
+		idx := strings.LastIndex(dest, ":")
+		if idx == -1 {
+			m.issue(fmt.Sprintf("%s[%d]", path, i), "destination %q has no ports, dropped", dest)
+			continue
+		}
+
+		alias := m.alias(fmt.Sprintf("%s[%d]", path, i), dest[:idx])
+		ret = append(ret, alias+dest[idx:])
+	}
+
+	return ret
+}
+
+// testDestinations converts the destinations of a test, policy v2 only
+// supports a single port per destination, other destinations are dropped.
+func (m *migrator) testDestinations(path string, dests []string) []string {
+	var ret []string
+	for i, dest := range dests {
+		destPath := fmt.Sprintf("%s[%d]", path, i)
+		idx := strings.LastIndex(dest, ":")
+		if idx == -1 {
+			m.issue(destPath, "destination %q has no ports, dropped", dest)
+			continue
+		}
+
+		if _, err := strconv.ParseUint(dest[idx+1:], util.Base10, 16); err != nil {
+			m.issue(destPath, "destination %q must have a single port in policy v2, dropped", dest)
+			continue
+		}
+
+		ret = append(ret, m.alias(destPath, dest[:idx])+dest[idx:])
+	}
+
+	return ret
+}
+
+// alias converts an alias the way policy v1 resolves it: wildcards, groups,
+// tags and autogroups are the same in both versions, other aliases are
+// matched against users first, then hosts, then IPs and prefixes.
+func (m *migrator) alias(path, alias string) string {
+	if alias == "*" ||
+		strings.HasPrefix(alias, "group:") ||
+		strings.HasPrefix(alias, "tag:") ||
+		strings.HasPrefix(alias, "autogroup:") {
+		return alias
+	}
+
+	_, isHost := m.pol.Hosts[alias]
+	if username, ok := m.findUser(alias); ok {
+		if isHost {
+			m.issue(path, "%q matches both a user and a host, converted to the user %q", alias, username)
+		}
+
+		return username
+	}
+
+	if isHost {
+		return alias
+	}
+
+	if _, err := netip.ParseAddr(alias); err == nil {
+		return alias
+	}
+
+	if _, err := netip.ParsePrefix(alias); err == nil {
+		return alias
+	}
+
+	username := toUsername(alias)
+	m.issue(path, "%q does not match any user, host or IP, converted to the user %q", alias, username)
+
+	return username
+}
+
+// usernames converts a list of users and groups, tags and autogroups are
+// kept as they are.
+func (m *migrator) usernames(path string, tokens []string) []string {
+	ret := make([]string, len(tokens))
+	for i, token := range tokens {
+		if strings.HasPrefix(token, "group:") ||
+			strings.HasPrefix(token, "tag:") ||
+			strings.HasPrefix(token, "autogroup:") {
+			ret[i] = token
+			continue
+		}
+
+		username, ok := m.findUser(token)
+		if !ok {
+			username = toUsername(token)
+			m.issue(fmt.Sprintf("%s[%d]", path, i), "%q does not match any user, converted to %q", token, username)
+		}
+		ret[i] = username
+	}
+
+	return ret
+}
+
+// findUser returns the v2 username of the user matching the token. The
+// token is matched like in policy v1, by provider identifier, email or
+// name, and must match a single user.
+func (m *migrator) findUser(token string) (string, bool) {
+	var matches int
+	for _, user := range m.users {
+		if user.ProviderIdentifier.Valid && user.ProviderIdentifier.String == token {
+			return toUsername(token), true
+		}
+
+		if user.Email == token || user.Name == token {
+			matches++
+		}
+	}
+
+	return toUsername(token), matches == 1
+}
+
+// toUsername returns the token in the form policy v2 requires for users,
+// which must contain an "@".
+func toUsername(token string) string {
+	if strings.Contains(token, "@") {
+		return token
+	}
+
+	return token + "@"
+}
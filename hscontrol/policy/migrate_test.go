@@ -0,0 +1,209 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	policyv2 "github.com/juanfont/headscale/hscontrol/policy/v2"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestMigratePolicyV1ToV2(t *testing.T) {
+	users := types.Users{
+		types.User{Model: gorm.Model{ID: 1}, Name: "user1"},
+		types.User{Model: gorm.Model{ID: 2}, Name: "user2", Email: "user2@example.com"},
+		types.User{Model: gorm.Model{ID: 3}, Name: "server"},
+	}
+
+	nodes := types.Nodes{
+		&types.Node{ID: 1, IPv4: ap("100.64.0.1"), User: users[0], UserID: 1},
+		&types.Node{ID: 2, IPv4: ap("100.64.0.2"), User: users[1], UserID: 2},
+		&types.Node{
+			ID:         3,
+			IPv4:       ap("100.64.0.3"),
+			User:       users[2],
+			UserID:     3,
+			ForcedTags: []string{"tag:server"},
+		},
+	}
+
+	pol := `
+{
+  // Bare usernames are not valid in policy v2.
+  "groups": {
+    "group:admins": ["user1"],
+  },
+  "hosts": {
+    "db": "100.64.0.10",
+  },
+  "tagOwners": {
+    "tag:server": ["group:admins"],
+  },
+  "autoApprovers": {
+    "routes": {
+      "10.0.0.0/8": ["user1"],
+    },
+  },
+  "acls": [
+    {"action": "accept", "src": ["group:admins"], "dst": ["*:*"]},
+    {"action": "accept", "proto": "tcp", "src": ["user2@example.com"], "dst": ["db:5432", "tag:server:22"]},
+    {"action": "accept", "src": ["nobody"], "dst": ["100.64.0.0/10:443"]},
+  ],
+  "ssh": [
+    {"action": "accept", "src": ["user2"], "dst": ["tag:server"], "users": ["root"]},
+    {"action": "accept", "src": ["100.64.0.1"], "dst": ["tag:server"], "users": ["root"]},
+  ],
+}
+`
+
+	migration, err := MigratePolicyV1ToV2([]byte(pol), users, nodes)
+	require.NoError(t, err)
+
+	assert.True(t, migration.Equivalent(), "lost: %v, gained: %v", migration.FilterRulesLost, migration.FilterRulesGained)
+	assert.JSONEq(t, `
+{
+  "groups": {
+    "group:admins": ["user1@"]
+  },
+  "hosts": {
+    "db": "100.64.0.10/32"
+  },
+  "tagOwners": {
+    "tag:server": ["group:admins"]
+  },
+  "autoApprovers": {
+    "routes": {
+      "10.0.0.0/8": ["user1@"]
+    }
+  },
+  "acls": [
+    {"action": "accept", "src": ["group:admins"], "dst": ["*:*"]},
+    {"action": "accept", "proto": "tcp", "src": ["user2@example.com"], "dst": ["db:5432", "tag:server:22"]},
+    {"action": "accept", "src": ["nobody@"], "dst": ["100.64.0.0/10:443"]}
+  ],
+  "ssh": [
+    {"action": "accept", "src": ["user2@"], "dst": ["tag:server"], "users": ["root"]}
+  ]
+}
+`, string(migration.Policy))
+
+	assert.Equal(t, []MigrationIssue{
+		{Path: "acls[2].src[0]", Message: `"nobody" does not match any user, host or IP, converted to the user "nobody@"`},
+		{Path: "ssh[1].src[0]", Message: `"100.64.0.1" is not supported as SSH source in policy v2, dropped`},
+		{Path: "ssh[1]", Message: "no sources or destinations left, SSH rule dropped"},
+	}, migration.Issues)
+
+	// The converted policy must be usable as a v2 policy.
+	_, err = policyv2.NewPolicyManager(migration.Policy, users, nodes)
+	require.NoError(t, err)
+}
+
+func TestMigratePolicyV1ToV2NotEquivalent(t *testing.T) {
+	users := types.Users{
+		types.User{Model: gorm.Model{ID: 1}, Name: "user1"},
+		types.User{Model: gorm.Model{ID: 2}, Name: "user2"},
+	}
+
+	nodes := types.Nodes{
+		&types.Node{ID: 1, IPv4: ap("100.64.0.1"), User: users[0], UserID: 1},
+	}
+
+	// "user2" is both a user and a host, policy v1 only resolves it to the
+	// user if the user has nodes, otherwise it falls back to the host.
+	pol := `
+{
+  "hosts": {
+    "user2": "100.64.0.100",
+  },
+  "acls": [
+    {"action": "accept", "src": ["user1"], "dst": ["user2:*"]},
+  ],
+}
+`
+
+	migration, err := MigratePolicyV1ToV2([]byte(pol), users, nodes)
+	require.NoError(t, err)
+
+	assert.Equal(t, []MigrationIssue{
+		{Path: "acls[0].dst[0]", Message: `"user2" matches both a user and a host, converted to the user "user2@"`},
+	}, migration.Issues)
+	assert.False(t, migration.Equivalent())
+	assert.Len(t, migration.FilterRulesLost, 1)
+	assert.Empty(t, migration.FilterRulesGained)
+}
+
+func TestMigratePolicyV1ToV2SSHCheckAndTests(t *testing.T) {
+	users := types.Users{
+		types.User{Model: gorm.Model{ID: 1}, Name: "user1"},
+		types.User{Model: gorm.Model{ID: 2}, Name: "server"},
+	}
+
+	nodes := types.Nodes{
+		&types.Node{ID: 1, IPv4: ap("100.64.0.1"), User: users[0], UserID: 1},
+		&types.Node{
+			ID:         2,
+			IPv4:       ap("100.64.0.2"),
+			User:       users[1],
+			UserID:     2,
+			ForcedTags: []string{"tag:server"},
+		},
+	}
+
+	pol := `
+{
+  "tagOwners": {
+    "tag:server": ["server"],
+  },
+  "acls": [
+    {"action": "accept", "src": ["user1"], "dst": ["tag:server:22"]},
+  ],
+  "ssh": [
+    {"action": "check", "src": ["user1"], "dst": ["tag:server"], "users": ["root"], "checkPeriod": "12h"},
+  ],
+  "tests": [
+    {"src": "user1", "accept": ["tag:server:22", "tag:server:22,80"], "deny": ["tag:server:*"]},
+    {"src": "user1", "accept": ["tag:server:1000-2000"]},
+  ],
+}
+`
+
+	migration, err := MigratePolicyV1ToV2([]byte(pol), users, nodes)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `
+{
+  "tagOwners": {
+    "tag:server": ["server@"]
+  },
+  "acls": [
+    {"action": "accept", "src": ["user1@"], "dst": ["tag:server:22"]}
+  ],
+  "ssh": [
+    {"action": "check", "src": ["user1@"], "dst": ["tag:server"], "users": ["root"], "checkPeriod": "12h"}
+  ],
+  "tests": [
+    {"src": "user1@", "accept": ["tag:server:22"]}
+  ]
+}
+`, string(migration.Policy))
+
+	assert.Equal(t, []MigrationIssue{
+		{Path: "tests[0].accept[1]", Message: `destination "tag:server:22,80" must have a single port in policy v2, dropped`},
+		{Path: "tests[0].deny[0]", Message: `destination "tag:server:*" must have a single port in policy v2, dropped`},
+		{Path: "tests[1].accept[0]", Message: `destination "tag:server:1000-2000" must have a single port in policy v2, dropped`},
+		{Path: "tests[1]", Message: "no destinations left, test dropped"},
+	}, migration.Issues)
+
+	// The converted policy must be usable as a v2 policy, with the check
+	// period read back as a duration.
+	pm, err := policyv2.NewPolicyManager(migration.Policy, users, nodes)
+	require.NoError(t, err)
+
+	sshPol, err := pm.SSHPolicy(nodes[1])
+	require.NoError(t, err)
+	require.Len(t, sshPol.Rules, 1)
+	assert.Equal(t, 12*time.Hour, sshPol.Rules[0].Action.SessionDuration)
+}
@@ -15,7 +15,15 @@ var (
 )
 
 type PolicyManager interface {
+	// Filter returns the filter rules for the entire tailnet.
 	Filter() []tailcfg.FilterRule
+	// FilterForNode returns the filter rules from the perspective of the
+	// given node. Rules like autogroup:self resolves differently per node.
+	FilterForNode(*types.Node) ([]tailcfg.FilterRule, error)
+	// FilterWithOrigins returns the filter rules for the entire tailnet
+	// together with the entry of the policy each rule was compiled from,
+	// at the same index. The origins are empty if they are not known.
+	FilterWithOrigins() ([]tailcfg.FilterRule, []types.PolicyRuleOrigin)
 	SSHPolicy(*types.Node) (*tailcfg.SSHPolicy, error)
 	SetPolicy([]byte) (bool, error)
 	SetUsers(users []types.User) (bool, error)
@@ -26,6 +34,10 @@ type PolicyManager interface {
 	// NodeCanApproveRoute reports whether the given node can approve the given route.
 	NodeCanApproveRoute(*types.Node, netip.Prefix) bool
 
+	// NodeAttributes returns the node attributes given to the node by
+	// the policy, attributes prefixed with "-" remove a capability.
+	NodeAttributes(*types.Node) []string
+
 	Version() int
 	DebugString() string
 }
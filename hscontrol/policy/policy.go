@@ -1,9 +1,13 @@
 package policy
 
 import (
+	"errors"
+	"fmt"
 	"net/netip"
 	"slices"
 
+	"github.com/juanfont/headscale/hscontrol/policy/matcher"
+	policyv2 "github.com/juanfont/headscale/hscontrol/policy/v2"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
 	"github.com/samber/lo"
@@ -11,6 +15,8 @@ import (
 	"tailscale.com/tailcfg"
 )
 
+var ErrInvalidProtocol = errors.New("invalid protocol")
+
 // FilterNodesByACL returns the list of peers authorized to be accessed from a given node.
 func FilterNodesByACL(
 	node *types.Node,
@@ -75,6 +81,24 @@ func ReduceFilterRules(node *types.Node, rules []tailcfg.FilterRule) []tailcfg.F
 				IPProto:  rule.IPProto,
 			})
 		}
+
+		// Keep the capability grants where the node is a destination.
+		var capGrants []tailcfg.CapGrant
+		for _, capGrant := range rule.CapGrant {
+			for _, dst := range capGrant.Dsts {
+				if slices.ContainsFunc(node.IPs(), dst.Contains) {
+					capGrants = append(capGrants, capGrant)
+					break
+				}
+			}
+		}
+
+		if len(capGrants) > 0 {
+			ret = append(ret, tailcfg.FilterRule{
+				SrcIPs:   rule.SrcIPs,
+				CapGrant: capGrants,
+			})
+		}
 	}
 
 	return ret
@@ -107,3 +131,57 @@ func AutoApproveRoutes(pm PolicyManager, node *types.Node) bool {
 
 	return false
 }
+
+// Protocol numbers supported by CheckAccess.
+const (
+	ProtocolICMP     = 1
+	ProtocolTCP      = 6
+	ProtocolUDP      = 17
+	ProtocolIPv6ICMP = 58
+	ProtocolSCTP     = 132
+)
+
+// ParseProtocol returns the IANA protocol number of the given protocol name
+// or number, an empty protocol is TCP.
+func ParseProtocol(protocol string) (int, error) {
+	proto, err := policyv2.ParseProtocol(protocol)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidProtocol, protocol)
+	}
+
+	return proto, nil
+}
+
+// AccessCheck is the result of CheckAccess.
+type AccessCheck struct {
+	Allowed bool
+
+	// Origin is the entry of the policy allowing the access, it is nil
+	// if the access is denied or the allowing rule has no known origin,
+	// e.g. when no policy is loaded and all traffic is allowed.
+	Origin *types.PolicyRuleOrigin
+}
+
+// CheckAccess reports whether any of the source addresses can reach any of
+// the destination addresses on the given port and protocol according to the
+// filter of the policy manager, and which entry of the policy allows it.
+func CheckAccess(
+	pm PolicyManager,
+	srcs, dsts []netip.Addr,
+	port uint16,
+	protocol int,
+) AccessCheck {
+	filter, origins := pm.FilterWithOrigins()
+
+	index, ok := matcher.FilterAllows(filter, srcs, dsts, port, protocol)
+	if !ok {
+		return AccessCheck{}
+	}
+
+	check := AccessCheck{Allowed: true}
+	if index < len(origins) {
+		check.Origin = &origins[index]
+	}
+
+	return check
+}
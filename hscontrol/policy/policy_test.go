@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	policyv2 "github.com/juanfont/headscale/hscontrol/policy/v2"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
 	"github.com/rs/zerolog/log"
@@ -781,6 +782,114 @@ func TestReduceFilterRules(t *testing.T) {
 	}
 }
 
+func TestReduceFilterRulesCapGrant(t *testing.T) {
+	node := &types.Node{
+		IPv4: ap("100.64.0.1"),
+		IPv6: ap("fd7a:115c:a1e0::1"),
+	}
+
+	capMap := tailcfg.PeerCapMap{
+		"example.com/cap/test": []tailcfg.RawMessage{`{"role":"admin"}`},
+	}
+
+	tests := []struct {
+		name  string
+		rules []tailcfg.FilterRule
+		want  []tailcfg.FilterRule
+	}{
+		{
+			name: "node-is-destination",
+			rules: []tailcfg.FilterRule{
+				{
+					SrcIPs: []string{"100.64.0.2/32"},
+					CapGrant: []tailcfg.CapGrant{
+						{
+							Dsts:   []netip.Prefix{netip.MustParsePrefix("100.64.0.0/31")},
+							CapMap: capMap,
+						},
+					},
+				},
+			},
+			want: []tailcfg.FilterRule{
+				{
+					SrcIPs: []string{"100.64.0.2/32"},
+					CapGrant: []tailcfg.CapGrant{
+						{
+							Dsts:   []netip.Prefix{netip.MustParsePrefix("100.64.0.0/31")},
+							CapMap: capMap,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "node-is-not-destination",
+			rules: []tailcfg.FilterRule{
+				{
+					SrcIPs: []string{"100.64.0.1/32"},
+					CapGrant: []tailcfg.CapGrant{
+						{
+							Dsts:   []netip.Prefix{netip.MustParsePrefix("100.64.0.2/32")},
+							CapMap: capMap,
+						},
+					},
+				},
+			},
+			want: []tailcfg.FilterRule{},
+		},
+		{
+			name: "network-and-capability-rule",
+			rules: []tailcfg.FilterRule{
+				{
+					SrcIPs: []string{"100.64.0.2/32"},
+					DstPorts: []tailcfg.NetPortRange{
+						{IP: "100.64.0.1/32", Ports: tailcfg.PortRangeAny},
+					},
+				},
+				{
+					SrcIPs: []string{"100.64.0.2/32"},
+					CapGrant: []tailcfg.CapGrant{
+						{
+							Dsts:   []netip.Prefix{netip.MustParsePrefix("100.64.0.3/32")},
+							CapMap: capMap,
+						},
+						{
+							Dsts:   []netip.Prefix{netip.MustParsePrefix("fd7a:115c:a1e0::1/128")},
+							CapMap: capMap,
+						},
+					},
+				},
+			},
+			want: []tailcfg.FilterRule{
+				{
+					SrcIPs: []string{"100.64.0.2/32"},
+					DstPorts: []tailcfg.NetPortRange{
+						{IP: "100.64.0.1/32", Ports: tailcfg.PortRangeAny},
+					},
+				},
+				{
+					SrcIPs: []string{"100.64.0.2/32"},
+					CapGrant: []tailcfg.CapGrant{
+						{
+							Dsts:   []netip.Prefix{netip.MustParsePrefix("fd7a:115c:a1e0::1/128")},
+							CapMap: capMap,
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ReduceFilterRules(node, tt.rules)
+			if diff := cmp.Diff(tt.want, got, util.Comparers...); diff != "" {
+				t.Errorf("ReduceFilterRules() unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
 func TestFilterNodesByACL(t *testing.T) {
 	type args struct {
 		nodes types.Nodes
@@ -1436,3 +1545,182 @@ func TestFilterNodesByACL(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckAccess(t *testing.T) {
+	users := types.Users{
+		types.User{Model: gorm.Model{ID: 1}, Name: "user1"},
+		types.User{Model: gorm.Model{ID: 2}, Name: "user2"},
+	}
+
+	nodes := types.Nodes{
+		&types.Node{ID: 1, IPv4: ap("100.64.0.1"), User: users[0]},
+		&types.Node{ID: 2, IPv4: ap("100.64.0.2"), User: users[1]},
+		&types.Node{ID: 3, IPv4: ap("100.64.0.3"), User: users[1]},
+	}
+
+	pol := `
+{
+  "groups": {
+    "group:admins": ["user1@"]
+  },
+  "acls": [
+    {
+      "action": "accept",
+      "proto": "tcp",
+      "src": ["group:admins"],
+      "dst": ["100.64.0.2:22"]
+    },
+    {
+      "action": "accept",
+      "src": ["100.64.0.3"],
+      "dst": ["100.64.0.2:5432"]
+    }
+  ]
+}
+`
+
+	tests := []struct {
+		name     string
+		src      netip.Addr
+		dst      netip.Addr
+		port     uint16
+		protocol int
+		want     AccessCheck
+	}{
+		{
+			name:     "allowed-by-first-acl",
+			src:      netip.MustParseAddr("100.64.0.1"),
+			dst:      netip.MustParseAddr("100.64.0.2"),
+			port:     22,
+			protocol: ProtocolTCP,
+			want: AccessCheck{
+				Allowed: true,
+				Origin:  &types.PolicyRuleOrigin{Section: types.PolicySectionACLs, Index: 0},
+			},
+		},
+		{
+			name:     "allowed-by-second-acl",
+			src:      netip.MustParseAddr("100.64.0.3"),
+			dst:      netip.MustParseAddr("100.64.0.2"),
+			port:     5432,
+			protocol: ProtocolUDP,
+			want: AccessCheck{
+				Allowed: true,
+				Origin:  &types.PolicyRuleOrigin{Section: types.PolicySectionACLs, Index: 1},
+			},
+		},
+		{
+			name:     "denied-protocol",
+			src:      netip.MustParseAddr("100.64.0.1"),
+			dst:      netip.MustParseAddr("100.64.0.2"),
+			port:     22,
+			protocol: ProtocolUDP,
+			want:     AccessCheck{},
+		},
+		{
+			name:     "denied-port",
+			src:      netip.MustParseAddr("100.64.0.1"),
+			dst:      netip.MustParseAddr("100.64.0.2"),
+			port:     5432,
+			protocol: ProtocolTCP,
+			want:     AccessCheck{},
+		},
+		{
+			name:     "denied-reverse",
+			src:      netip.MustParseAddr("100.64.0.2"),
+			dst:      netip.MustParseAddr("100.64.0.3"),
+			port:     5432,
+			protocol: ProtocolTCP,
+			want:     AccessCheck{},
+		},
+	}
+
+	for _, tt := range tests {
+		for idx, pmf := range PolicyManagerFuncsForTest([]byte(pol)) {
+			version := idx + 1
+			t.Run(fmt.Sprintf("%s-v%d", tt.name, version), func(t *testing.T) {
+				pm, err := pmf(users, nodes)
+				require.NoError(t, err)
+
+				got := CheckAccess(pm, []netip.Addr{tt.src}, []netip.Addr{tt.dst}, tt.port, tt.protocol)
+				require.Equal(t, tt.want, got)
+			})
+		}
+	}
+}
+
+func TestCheckAccessGrant(t *testing.T) {
+	users := types.Users{
+		types.User{Model: gorm.Model{ID: 1}, Name: "user1"},
+		types.User{Model: gorm.Model{ID: 2}, Name: "user2"},
+	}
+
+	nodes := types.Nodes{
+		&types.Node{ID: 1, IPv4: ap("100.64.0.1"), User: users[0]},
+		&types.Node{ID: 2, IPv4: ap("100.64.0.2"), User: users[1]},
+	}
+
+	pol := `
+{
+  "acls": [
+    {"action": "accept", "src": ["user2@"], "dst": ["user1@:80"]}
+  ],
+  "grants": [
+    {"src": ["user1@"], "dst": ["user2@"], "ip": ["tcp:443"]},
+    {"src": ["user1@"], "dst": ["user2@"], "ip": ["tcp:5432"]}
+  ]
+}
+`
+
+	pm, err := policyv2.NewPolicyManager([]byte(pol), users, nodes)
+	require.NoError(t, err)
+
+	got := CheckAccess(pm, nodes[0].IPs(), nodes[1].IPs(), 5432, ProtocolTCP)
+	require.Equal(t, AccessCheck{
+		Allowed: true,
+		Origin:  &types.PolicyRuleOrigin{Section: types.PolicySectionGrants, Index: 1},
+	}, got)
+
+	got = CheckAccess(pm, nodes[0].IPs(), nodes[1].IPs(), 80, ProtocolTCP)
+	require.Equal(t, AccessCheck{}, got)
+}
+
+func TestCheckAccessWithoutPolicy(t *testing.T) {
+	for idx, pmf := range PolicyManagerFuncsForTest(nil) {
+		t.Run(fmt.Sprintf("v%d", idx+1), func(t *testing.T) {
+			pm, err := pmf(nil, nil)
+			require.NoError(t, err)
+
+			got := CheckAccess(pm, []netip.Addr{netip.MustParseAddr("100.64.0.1")}, []netip.Addr{netip.MustParseAddr("100.64.0.2")}, 22, ProtocolTCP)
+			require.Equal(t, AccessCheck{Allowed: true}, got)
+		})
+	}
+}
+
+func TestParseProtocol(t *testing.T) {
+	tests := []struct {
+		protocol string
+		want     int
+		wantErr  bool
+	}{
+		{protocol: "", want: ProtocolTCP},
+		{protocol: "tcp", want: ProtocolTCP},
+		{protocol: "udp", want: ProtocolUDP},
+		{protocol: "icmp", want: ProtocolICMP},
+		{protocol: "47", want: 47},
+		{protocol: "256", wantErr: true},
+		{protocol: "foo", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			got, err := ParseProtocol(tt.protocol)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidProtocol)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
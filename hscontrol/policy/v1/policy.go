@@ -92,6 +92,30 @@ func (pm *PolicyManager) Filter() []tailcfg.FilterRule {
 	return pm.filter
 }
 
+// FilterForNode returns the filter rules for the given node, policy v1
+// does not have any rules that differ between nodes.
+func (pm *PolicyManager) FilterForNode(_ *types.Node) ([]tailcfg.FilterRule, error) {
+	return pm.Filter(), nil
+}
+
+// FilterWithOrigins returns the filter rules with the ACL each rule was
+// compiled from, policy v1 compiles exactly one rule per ACL.
+func (pm *PolicyManager) FilterWithOrigins() ([]tailcfg.FilterRule, []types.PolicyRuleOrigin) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.pol == nil {
+		return pm.filter, nil
+	}
+
+	origins := make([]types.PolicyRuleOrigin, len(pm.pol.ACLs))
+	for index := range origins {
+		origins[index] = types.PolicyRuleOrigin{Section: types.PolicySectionACLs, Index: index}
+	}
+
+	return pm.filter, origins
+}
+
 func (pm *PolicyManager) SSHPolicy(node *types.Node) (*tailcfg.SSHPolicy, error) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
@@ -182,6 +206,12 @@ func (pm *PolicyManager) NodeCanApproveRoute(node *types.Node, route netip.Prefi
 	return false
 }
 
+// NodeAttributes returns the node attributes for the given node, policy v1
+// does not support node attributes.
+func (pm *PolicyManager) NodeAttributes(_ *types.Node) []string {
+	return nil
+}
+
 func (pm *PolicyManager) Version() int {
 	return 1
 }
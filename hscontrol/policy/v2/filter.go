@@ -3,34 +3,91 @@ package v2
 import (
 	"errors"
 	"fmt"
+	"net/netip"
+	"slices"
 	"time"
 
+	"github.com/juanfont/headscale/hscontrol/policy/matcher"
 	"github.com/juanfont/headscale/hscontrol/types"
 	"github.com/juanfont/headscale/hscontrol/util"
 	"github.com/rs/zerolog/log"
 	"go4.org/netipx"
 	"tailscale.com/tailcfg"
+	"tailscale.com/util/multierr"
 )
 
 var (
-	ErrInvalidAction = errors.New("invalid action")
+	ErrInvalidAction    = errors.New("invalid action")
+	ErrPolicyTestFailed = errors.New("policy test failed")
 )
 
 // compileFilterRules takes a set of nodes and an ACLPolicy and generates a
 // set of Tailscale compatible FilterRules used to allow traffic on clients.
+// Destinations using autogroup:self are expanded for every user, resulting
+// in one rule per user, see compileFilterRulesForNode for a filter only
+// containing the rules relevant for a given node.
 func (pol *Policy) compileFilterRules(
 	users types.Users,
 	nodes types.Nodes,
 ) ([]tailcfg.FilterRule, error) {
+	rules, _, err := pol.compileFilterRulesForUsers(users, nodes, users)
+	return rules, err
+}
+
+// compileFilterRulesForNode generates the FilterRules from the perspective of
+// the given node, autogroup:self is only expanded for the user owning the node.
+// Tagged nodes are not owned by a user, and will therefore not be part of any
+// autogroup:self rule.
+func (pol *Policy) compileFilterRulesForNode(
+	users types.Users,
+	node *types.Node,
+	nodes types.Nodes,
+) ([]tailcfg.FilterRule, error) {
+	isTagged, err := taggedFunc(pol, users, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	var selfUsers types.Users
+	if !isTagged(node) {
+		selfUsers = types.Users{node.User}
+	}
+
+	rules, _, err := pol.compileFilterRulesForUsers(users, nodes, selfUsers)
+	return rules, err
+}
+
+// compileFilterRulesForUsers generates the FilterRules for the policy where
+// autogroup:self destinations are resolved for each of the selfUsers.
+// For every rule, the entry of the policy it was compiled from is returned
+// at the same index.
+func (pol *Policy) compileFilterRulesForUsers(
+	users types.Users,
+	nodes types.Nodes,
+	selfUsers types.Users,
+) ([]tailcfg.FilterRule, []types.PolicyRuleOrigin, error) {
 	if pol == nil {
-		return tailcfg.FilterAllowAll, nil
+		return tailcfg.FilterAllowAll, nil, nil
+	}
+
+	isTagged, err := taggedFunc(pol, users, nodes)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	var rules []tailcfg.FilterRule
+	var origins []types.PolicyRuleOrigin
 
-	for _, acl := range pol.ACLs {
+	addRules := func(section string, index int, compiled []tailcfg.FilterRule) {
+		rules = append(rules, compiled...)
+		for range compiled {
+			origins = append(origins, types.PolicyRuleOrigin{Section: section, Index: index})
+		}
+	}
+
+	for index, acl := range pol.ACLs {
 		if acl.Action != "accept" {
-			return nil, ErrInvalidAction
+			return nil, nil, ErrInvalidAction
 		}
 
 		srcIPs, err := acl.Sources.Resolve(pol, users, nodes)
@@ -46,31 +103,97 @@ func (pol *Policy) compileFilterRules(
 		// TODO(kradalby): figure out the _ is wildcard stuff
 		protocols, _, err := parseProtocol(acl.Protocol)
 		if err != nil {
-			return nil, fmt.Errorf("parsing policy, protocol err: %w ", err)
+			return nil, nil, fmt.Errorf("parsing policy, protocol err: %w ", err)
 		}
 
-		var destPorts []tailcfg.NetPortRange
-		for _, dest := range acl.Destinations {
-			ips, err := dest.Alias.Resolve(pol, users, nodes)
+		aclRules, err := pol.compileDestinations(users, nodes, selfUsers, isTagged, srcIPs, protocols, acl.Destinations)
+		if err != nil {
+			return nil, nil, err
+		}
+		addRules(types.PolicySectionACLs, index, aclRules)
+	}
+
+	for index, grant := range pol.Grants {
+		srcIPs, err := grant.Sources.Resolve(pol, users, nodes)
+		if err != nil {
+			log.Trace().Err(err).Msgf("resolving source ips")
+		}
+
+		if len(srcIPs.Prefixes()) == 0 {
+			continue
+		}
+
+		// Entries with the same protocol are compiled to the same rule.
+		var protos []string
+		portsByProto := make(map[string][]tailcfg.PortRange)
+		for _, ip := range grant.IP {
+			if _, ok := portsByProto[ip.Protocol]; !ok {
+				protos = append(protos, ip.Protocol)
+			}
+			portsByProto[ip.Protocol] = append(portsByProto[ip.Protocol], ip.Ports...)
+		}
+
+		for _, proto := range protos {
+			protocols, _, err := parseProtocol(proto)
 			if err != nil {
-				log.Trace().Err(err).Msgf("resolving destination ips")
+				return nil, nil, fmt.Errorf("parsing policy, protocol err: %w ", err)
 			}
 
-			for _, pref := range ips.Prefixes() {
-				for _, port := range dest.Ports {
-					pr := tailcfg.NetPortRange{
-						IP:    pref.String(),
-						Ports: port,
-					}
-					destPorts = append(destPorts, pr)
-				}
+			dests := make([]AliasWithPorts, 0, len(grant.Destinations))
+			for _, dest := range grant.Destinations {
+				dests = append(dests, AliasWithPorts{Alias: dest, Ports: portsByProto[proto]})
+			}
+
+			grantRules, err := pol.compileDestinations(users, nodes, selfUsers, isTagged, srcIPs, protocols, dests)
+			if err != nil {
+				return nil, nil, err
 			}
+			addRules(types.PolicySectionGrants, index, grantRules)
 		}
 
-		if len(destPorts) == 0 {
+		if len(grant.App) > 0 {
+			capRules, err := pol.compileCapGrants(users, nodes, selfUsers, isTagged, srcIPs, grant.Destinations, grant.App)
+			if err != nil {
+				return nil, nil, err
+			}
+			addRules(types.PolicySectionGrants, index, capRules)
+		}
+	}
+
+	return rules, origins, nil
+}
+
+// compileDestinations creates the FilterRules giving the sources access to
+// the destinations. All destinations, except autogroup:self, are combined in
+// one rule, while autogroup:self results in one rule per user in selfUsers.
+func (pol *Policy) compileDestinations(
+	users types.Users,
+	nodes types.Nodes,
+	selfUsers types.Users,
+	isTagged func(*types.Node) bool,
+	srcIPs *netipx.IPSet,
+	protocols []int,
+	dests []AliasWithPorts,
+) ([]tailcfg.FilterRule, error) {
+	var rules []tailcfg.FilterRule
+
+	var destPorts []tailcfg.NetPortRange
+	var selfDests []AliasWithPorts
+	for _, dest := range dests {
+		if isAutoGroupSelf(dest.Alias) {
+			selfDests = append(selfDests, dest)
 			continue
 		}
 
+		ips, err := dest.Alias.Resolve(pol, users, nodes)
+		if err != nil {
+			log.Trace().Err(err).Msgf("resolving destination ips")
+		}
+
+		destPorts = append(destPorts, netPortRanges(ips, dest.Ports)...)
+	}
+
+	if len(destPorts) > 0 {
 		rules = append(rules, tailcfg.FilterRule{
 			SrcIPs:   ipSetToPrefixStringList(srcIPs),
 			DstPorts: destPorts,
@@ -78,9 +201,248 @@ func (pol *Policy) compileFilterRules(
 		})
 	}
 
+	if len(selfDests) == 0 {
+		return rules, nil
+	}
+
+	for _, user := range selfUsers {
+		userSrcIPs, selfIPs, err := selfSources(srcIPs, user, nodes, isTagged)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(userSrcIPs.Prefixes()) == 0 {
+			continue
+		}
+
+		var selfPorts []tailcfg.NetPortRange
+		for _, dest := range selfDests {
+			selfPorts = append(selfPorts, netPortRanges(selfIPs, dest.Ports)...)
+		}
+
+		rules = append(rules, tailcfg.FilterRule{
+			SrcIPs:   ipSetToPrefixStringList(userSrcIPs),
+			DstPorts: selfPorts,
+			IPProto:  protocols,
+		})
+	}
+
+	return rules, nil
+}
+
+// compileCapGrants creates the FilterRules granting the application
+// capabilities to the sources when they access the destinations. Like
+// compileDestinations, autogroup:self results in one rule per user.
+func (pol *Policy) compileCapGrants(
+	users types.Users,
+	nodes types.Nodes,
+	selfUsers types.Users,
+	isTagged func(*types.Node) bool,
+	srcIPs *netipx.IPSet,
+	dests Aliases,
+	capMap tailcfg.PeerCapMap,
+) ([]tailcfg.FilterRule, error) {
+	var rules []tailcfg.FilterRule
+
+	var destIPs netipx.IPSetBuilder
+	var hasSelf bool
+	for _, dest := range dests {
+		if isAutoGroupSelf(dest) {
+			hasSelf = true
+			continue
+		}
+
+		ips, err := dest.Resolve(pol, users, nodes)
+		if err != nil {
+			log.Trace().Err(err).Msgf("resolving destination ips")
+		}
+		destIPs.AddSet(ips)
+	}
+
+	destSet, err := destIPs.IPSet()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(destSet.Prefixes()) > 0 {
+		rules = append(rules, tailcfg.FilterRule{
+			SrcIPs: ipSetToPrefixStringList(srcIPs),
+			CapGrant: []tailcfg.CapGrant{
+				{
+					Dsts:   destSet.Prefixes(),
+					CapMap: capMap,
+				},
+			},
+		})
+	}
+
+	if !hasSelf {
+		return rules, nil
+	}
+
+	for _, user := range selfUsers {
+		userSrcIPs, selfIPs, err := selfSources(srcIPs, user, nodes, isTagged)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(userSrcIPs.Prefixes()) == 0 {
+			continue
+		}
+
+		rules = append(rules, tailcfg.FilterRule{
+			SrcIPs: ipSetToPrefixStringList(userSrcIPs),
+			CapGrant: []tailcfg.CapGrant{
+				{
+					Dsts:   selfIPs.Prefixes(),
+					CapMap: capMap,
+				},
+			},
+		})
+	}
+
 	return rules, nil
 }
 
+// selfSources returns the sources owned by the user, which are the only
+// sources that can access the autogroup:self destinations of the user, and
+// the IPs of the nodes of the user.
+func selfSources(
+	srcIPs *netipx.IPSet,
+	user types.User,
+	nodes types.Nodes,
+	isTagged func(*types.Node) bool,
+) (*netipx.IPSet, *netipx.IPSet, error) {
+	selfIPs, err := resolveSelf(user, nodes, isTagged)
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolving autogroup:self for user %q: %w", user.Username(), err)
+	}
+
+	var userSrcs netipx.IPSetBuilder
+	userSrcs.AddSet(srcIPs)
+	userSrcs.Intersect(selfIPs)
+	userSrcIPs, err := userSrcs.IPSet()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return userSrcIPs, selfIPs, nil
+}
+
+// netPortRanges returns a NetPortRange for every combination of
+// prefix in the IPSet and port range.
+func netPortRanges(ips *netipx.IPSet, ports []tailcfg.PortRange) []tailcfg.NetPortRange {
+	var ret []tailcfg.NetPortRange
+
+	for _, pref := range ips.Prefixes() {
+		for _, port := range ports {
+			ret = append(ret, tailcfg.NetPortRange{
+				IP:    pref.String(),
+				Ports: port,
+			})
+		}
+	}
+
+	return ret
+}
+
+// runTests evaluates the tests of the policy against the filter, it returns
+// an error describing every failing assertion.
+func (pol *Policy) runTests(
+	users types.Users,
+	nodes types.Nodes,
+	filter []tailcfg.FilterRule,
+) error {
+	if pol == nil {
+		return nil
+	}
+
+	var errs []error
+
+	for index, test := range pol.Tests {
+		srcIPs, err := test.Source.Resolve(pol, users, nodes)
+		if err != nil {
+			log.Trace().Err(err).Msgf("resolving test source ips")
+		}
+
+		proto, err := ParseProtocol(test.Protocol)
+		if err != nil {
+			return fmt.Errorf("parsing policy, protocol err: %w ", err)
+		}
+
+		srcAddrs := testAddrs(srcIPs, nodes)
+
+		// A test expecting access passing without any address to check
+		// would hide a typo or a removed node, it fails instead.
+		if len(test.Accept) > 0 && len(srcAddrs) == 0 {
+			errs = append(errs, fmt.Errorf("test %d: source resolves to no addresses", index))
+		}
+
+		check := func(dests []AliasWithPorts, accept bool) {
+			for destIndex, dest := range dests {
+				dstIPs, err := dest.Alias.Resolve(pol, users, nodes)
+				if err != nil {
+					log.Trace().Err(err).Msgf("resolving test destination ips")
+				}
+
+				port := dest.Ports[0].First
+
+				dstAddrs := testAddrs(dstIPs, nodes)
+				if accept && len(dstAddrs) == 0 {
+					errs = append(errs, fmt.Errorf("test %d: accept %d resolves to no addresses", index, destIndex))
+				}
+
+				for _, src := range srcAddrs {
+					for _, dst := range dstAddrs {
+						_, allowed := matcher.FilterAllows(filter, []netip.Addr{src}, []netip.Addr{dst}, port, proto)
+						switch {
+						case accept && !allowed:
+							errs = append(errs, fmt.Errorf("test %d: %s cannot access %s", index, src, netip.AddrPortFrom(dst, port)))
+						case !accept && allowed:
+							errs = append(errs, fmt.Errorf("test %d: %s can access %s", index, src, netip.AddrPortFrom(dst, port)))
+						}
+					}
+				}
+			}
+		}
+
+		check(test.Accept, true)
+		check(test.Deny, false)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrPolicyTestFailed, multierr.New(errs...))
+	}
+
+	return nil
+}
+
+// testAddrs returns the addresses to evaluate a test for. Single addresses
+// are used as is, while larger prefixes are only evaluated for the addresses
+// of the nodes within them.
+func testAddrs(ips *netipx.IPSet, nodes types.Nodes) []netip.Addr {
+	if ips == nil {
+		return nil
+	}
+
+	var ret []netip.Addr
+	for _, pref := range ips.Prefixes() {
+		if pref.IsSingleIP() {
+			ret = append(ret, pref.Addr())
+		}
+	}
+
+	for _, node := range nodes {
+		for _, addr := range node.IPs() {
+			if ips.Contains(addr) && !slices.Contains(ret, addr) {
+				ret = append(ret, addr)
+			}
+		}
+	}
+
+	return ret
+}
+
 func sshAction(accept bool, duration time.Duration) tailcfg.SSHAction {
 	return tailcfg.SSHAction{
 		Reject:                   !accept,
@@ -100,11 +462,22 @@ func (pol *Policy) compileSSHPolicy(
 		return nil, nil
 	}
 
+	isTagged, err := taggedFunc(pol, users, nodes)
+	if err != nil {
+		return nil, err
+	}
+
 	var rules []*tailcfg.SSHRule
 
 	for index, rule := range pol.SSHs {
 		var dest netipx.IPSetBuilder
+		var hasSelf bool
 		for _, src := range rule.Destinations {
+			if isAutoGroupSelf(src) {
+				hasSelf = true
+				continue
+			}
+
 			ips, err := src.Resolve(pol, users, nodes)
 			if err != nil {
 				log.Trace().Err(err).Msgf("resolving destination ips")
@@ -117,8 +490,14 @@ func (pol *Policy) compileSSHPolicy(
 			return nil, err
 		}
 
+		// If the node is only a destination through autogroup:self,
+		// only the sources owned by the same user are allowed.
+		var selfOnly bool
 		if !node.InIPSet(destSet) {
-			continue
+			if !hasSelf || isTagged(node) {
+				continue
+			}
+			selfOnly = true
 		}
 
 		var action tailcfg.SSHAction
@@ -126,7 +505,7 @@ func (pol *Policy) compileSSHPolicy(
 		case "accept":
 			action = sshAction(true, 0)
 		case "check":
-			action = sshAction(true, rule.CheckPeriod)
+			action = sshAction(true, time.Duration(rule.CheckPeriod))
 		default:
 			return nil, fmt.Errorf("parsing SSH policy, unknown action %q, index: %d: %w", rule.Action, index, err)
 		}
@@ -137,6 +516,17 @@ func (pol *Policy) compileSSHPolicy(
 			log.Trace().Err(err).Msgf("resolving source ips")
 		}
 
+		if selfOnly {
+			srcIPs, _, err = selfSources(srcIPs, node.User, nodes, isTagged)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(srcIPs.Prefixes()) == 0 {
+				continue
+			}
+		}
+
 		for addr := range util.IPSetAddrIter(srcIPs) {
 			principals = append(principals, &tailcfg.SSHPrincipal{
 				NodeIP: addr.String(),
@@ -145,6 +535,16 @@ func (pol *Policy) compileSSHPolicy(
 
 		userMap := make(map[string]string, len(rule.Users))
 		for _, user := range rule.Users {
+			// autogroup:nonroot allows any user, except root, unless
+			// root is explicitly listed in the rule.
+			if user.IsNonRoot() {
+				userMap["*"] = "="
+				if _, ok := userMap["root"]; !ok {
+					userMap["root"] = ""
+				}
+				continue
+			}
+
 			userMap[user.String()] = "="
 		}
 		rules = append(rules, &tailcfg.SSHRule{
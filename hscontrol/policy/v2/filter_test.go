@@ -1,10 +1,12 @@
 package v2
 
 import (
+	"net/netip"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
 	"gorm.io/gorm"
 	"tailscale.com/tailcfg"
 )
@@ -376,3 +378,546 @@ func TestParsing(t *testing.T) {
 		})
 	}
 }
+
+func TestAutogroupSelf(t *testing.T) {
+	users := types.Users{
+		{Model: gorm.Model{ID: 1}, Name: "user1"},
+		{Model: gorm.Model{ID: 2}, Name: "user2"},
+		{Model: gorm.Model{ID: 3}, Name: "user3"},
+	}
+
+	nodes := types.Nodes{
+		{ID: 1, IPv4: ap("100.64.0.1"), User: users[0]},
+		{ID: 2, IPv4: ap("100.64.0.2"), User: users[0]},
+		{ID: 3, IPv4: ap("100.64.0.3"), User: users[1]},
+		{ID: 4, IPv4: ap("100.64.0.4"), User: users[1], ForcedTags: []string{"tag:server"}},
+		{ID: 5, IPv4: ap("100.64.0.5"), User: users[2]},
+	}
+
+	user1Self := tailcfg.FilterRule{
+		SrcIPs: []string{"100.64.0.1/32", "100.64.0.2/32"},
+		DstPorts: []tailcfg.NetPortRange{
+			{IP: "100.64.0.1/32", Ports: tailcfg.PortRangeAny},
+			{IP: "100.64.0.2/32", Ports: tailcfg.PortRangeAny},
+		},
+	}
+	user2Self := tailcfg.FilterRule{
+		SrcIPs: []string{"100.64.0.3/32"},
+		DstPorts: []tailcfg.NetPortRange{
+			{IP: "100.64.0.3/32", Ports: tailcfg.PortRangeAny},
+		},
+	}
+	user3Self := tailcfg.FilterRule{
+		SrcIPs: []string{"100.64.0.5/32"},
+		DstPorts: []tailcfg.NetPortRange{
+			{IP: "100.64.0.5/32", Ports: tailcfg.PortRangeAny},
+		},
+	}
+
+	tests := []struct {
+		name string
+		pol  string
+		// node is the node the filter is compiled for, if nil,
+		// the filter for the entire tailnet is compiled.
+		node *types.Node
+		want []tailcfg.FilterRule
+	}{
+		{
+			name: "wildcard-source-tailnet",
+			pol: `
+{
+	"acls": [
+		{"action": "accept", "src": ["*"], "dst": ["autogroup:self:*"]},
+	],
+}`,
+			want: []tailcfg.FilterRule{user1Self, user2Self, user3Self},
+		},
+		{
+			name: "wildcard-source-node",
+			pol: `
+{
+	"acls": [
+		{"action": "accept", "src": ["*"], "dst": ["autogroup:self:*"]},
+	],
+}`,
+			node: nodes[0],
+			want: []tailcfg.FilterRule{user1Self},
+		},
+		{
+			name: "wildcard-source-tagged-node",
+			pol: `
+{
+	"acls": [
+		{"action": "accept", "src": ["*"], "dst": ["autogroup:self:*"]},
+	],
+}`,
+			node: nodes[3],
+			want: nil,
+		},
+		{
+			name: "group-source",
+			pol: `
+{
+	"groups": {
+		"group:admins": ["user1@", "user2@"],
+	},
+	"acls": [
+		{"action": "accept", "src": ["group:admins"], "dst": ["autogroup:self:*"]},
+	],
+}`,
+			want: []tailcfg.FilterRule{user1Self, user2Self},
+		},
+		{
+			name: "source-without-nodes-of-destination-user",
+			pol: `
+{
+	"acls": [
+		{"action": "accept", "src": ["user1@"], "dst": ["autogroup:self:*"]},
+	],
+}`,
+			node: nodes[2],
+			want: nil,
+		},
+		{
+			name: "mixed-with-other-destination",
+			pol: `
+{
+	"tagOwners": {
+		"tag:server": ["user2@"],
+	},
+	"acls": [
+		{"action": "accept", "src": ["user1@"], "dst": ["autogroup:self:22", "tag:server:80"]},
+	],
+}`,
+			want: []tailcfg.FilterRule{
+				{
+					SrcIPs: []string{"100.64.0.1/32", "100.64.0.2/32"},
+					DstPorts: []tailcfg.NetPortRange{
+						{IP: "100.64.0.4/32", Ports: tailcfg.PortRange{First: 80, Last: 80}},
+					},
+				},
+				{
+					SrcIPs: []string{"100.64.0.1/32", "100.64.0.2/32"},
+					DstPorts: []tailcfg.NetPortRange{
+						{IP: "100.64.0.1/32", Ports: tailcfg.PortRange{First: 22, Last: 22}},
+						{IP: "100.64.0.2/32", Ports: tailcfg.PortRange{First: 22, Last: 22}},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol, err := policyFromBytes([]byte(tt.pol))
+			if err != nil {
+				t.Fatalf("parsing policy: %s", err)
+			}
+
+			var rules []tailcfg.FilterRule
+			if tt.node == nil {
+				rules, err = pol.compileFilterRules(users, nodes)
+			} else {
+				rules, err = pol.compileFilterRulesForNode(users, tt.node, nodes)
+			}
+			if err != nil {
+				t.Fatalf("compiling filter rules: %s", err)
+			}
+
+			if diff := cmp.Diff(tt.want, rules); diff != "" {
+				t.Errorf("compileFilterRules() unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// TestAutogroupSelfRequestedTags checks that a node with a requested tag
+// approved by the tagOwners is tagged, and therefore not part of the
+// autogroup:self of its user.
+func TestAutogroupSelfRequestedTags(t *testing.T) {
+	users := types.Users{
+		{Model: gorm.Model{ID: 1}, Name: "user1"},
+	}
+
+	nodes := types.Nodes{
+		{ID: 1, IPv4: ap("100.64.0.1"), User: users[0]},
+		{ID: 2, IPv4: ap("100.64.0.2"), User: users[0], Hostinfo: &tailcfg.Hostinfo{RequestTags: []string{"tag:kiosk"}}},
+	}
+
+	pol, err := policyFromBytes([]byte(`
+{
+	"tagOwners": {
+		"tag:kiosk": ["user1@"],
+	},
+	"acls": [
+		{"action": "accept", "src": ["*"], "dst": ["autogroup:self:*"]},
+	],
+}`))
+	if err != nil {
+		t.Fatalf("parsing policy: %s", err)
+	}
+
+	rules, err := pol.compileFilterRulesForNode(users, nodes[0], nodes)
+	if err != nil {
+		t.Fatalf("compiling filter rules: %s", err)
+	}
+
+	want := []tailcfg.FilterRule{
+		{
+			SrcIPs: []string{"100.64.0.1/32"},
+			DstPorts: []tailcfg.NetPortRange{
+				{IP: "100.64.0.1/32", Ports: tailcfg.PortRangeAny},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, rules); diff != "" {
+		t.Errorf("compileFilterRulesForNode() unexpected result (-want +got):\n%s", diff)
+	}
+
+	rules, err = pol.compileFilterRulesForNode(users, nodes[1], nodes)
+	if err != nil {
+		t.Fatalf("compiling filter rules: %s", err)
+	}
+	if len(rules) != 0 {
+		t.Errorf("compileFilterRulesForNode() for tagged node = %v, want no rules", rules)
+	}
+}
+
+func TestAutogroupSelfSSH(t *testing.T) {
+	users := types.Users{
+		{Model: gorm.Model{ID: 1}, Name: "user1"},
+		{Model: gorm.Model{ID: 2}, Name: "user2"},
+	}
+
+	nodes := types.Nodes{
+		{ID: 1, IPv4: ap("100.64.0.1"), User: users[0]},
+		{ID: 2, IPv4: ap("100.64.0.2"), User: users[0]},
+		{ID: 3, IPv4: ap("100.64.0.3"), User: users[1]},
+		{ID: 4, IPv4: ap("100.64.0.4"), User: users[1], ForcedTags: []string{"tag:server"}},
+	}
+
+	selfOnly := `
+{
+	"ssh": [
+		{"action": "accept", "src": ["user1@", "user2@"], "dst": ["autogroup:self"], "users": ["root"]},
+	],
+}`
+
+	tests := []struct {
+		name string
+		pol  string
+		node *types.Node
+		want []*tailcfg.SSHPrincipal
+	}{
+		{
+			name: "self-only-user1",
+			pol:  selfOnly,
+			node: nodes[0],
+			want: []*tailcfg.SSHPrincipal{{NodeIP: "100.64.0.1"}, {NodeIP: "100.64.0.2"}},
+		},
+		{
+			name: "self-only-user2",
+			pol:  selfOnly,
+			node: nodes[2],
+			want: []*tailcfg.SSHPrincipal{{NodeIP: "100.64.0.3"}},
+		},
+		{
+			name: "self-only-tagged-node",
+			pol:  selfOnly,
+			node: nodes[3],
+			want: nil,
+		},
+		{
+			name: "source-without-nodes-of-destination-user",
+			pol: `
+{
+	"ssh": [
+		{"action": "accept", "src": ["user1@"], "dst": ["autogroup:self"], "users": ["root"]},
+	],
+}`,
+			node: nodes[2],
+			want: nil,
+		},
+		{
+			// The node is a destination of the rule through user2@, so
+			// all the sources are allowed, not only the ones of user2.
+			name: "also-matched-by-other-destination",
+			pol: `
+{
+	"ssh": [
+		{"action": "accept", "src": ["user1@"], "dst": ["autogroup:self", "user2@"], "users": ["root"]},
+	],
+}`,
+			node: nodes[2],
+			want: []*tailcfg.SSHPrincipal{{NodeIP: "100.64.0.1"}, {NodeIP: "100.64.0.2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol, err := policyFromBytes([]byte(tt.pol))
+			if err != nil {
+				t.Fatalf("parsing policy: %s", err)
+			}
+
+			sshPol, err := pol.compileSSHPolicy(users, tt.node, nodes)
+			if err != nil {
+				t.Fatalf("compiling SSH policy: %s", err)
+			}
+
+			var got []*tailcfg.SSHPrincipal
+			for _, rule := range sshPol.Rules {
+				got = append(got, rule.Principals...)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("compileSSHPolicy() unexpected principals (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSSHUsers(t *testing.T) {
+	users := types.Users{
+		{Model: gorm.Model{ID: 1}, Name: "user1"},
+	}
+
+	nodes := types.Nodes{
+		{ID: 1, IPv4: ap("100.64.0.1"), User: users[0]},
+		{ID: 2, IPv4: ap("100.64.0.2"), User: users[0], ForcedTags: []string{"tag:server"}},
+	}
+
+	tests := []struct {
+		name  string
+		users string
+		want  map[string]string
+	}{
+		{
+			name:  "root",
+			users: `["root"]`,
+			want:  map[string]string{"root": "="},
+		},
+		{
+			name:  "nonroot",
+			users: `["autogroup:nonroot"]`,
+			want:  map[string]string{"*": "=", "root": ""},
+		},
+		{
+			name:  "nonroot-and-root",
+			users: `["autogroup:nonroot", "root"]`,
+			want:  map[string]string{"*": "=", "root": "="},
+		},
+		{
+			name:  "root-and-nonroot",
+			users: `["root", "autogroup:nonroot"]`,
+			want:  map[string]string{"*": "=", "root": "="},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol, err := policyFromBytes([]byte(`
+{
+	"tagOwners": {
+		"tag:server": ["user1@"],
+	},
+	"ssh": [
+		{"action": "accept", "src": ["autogroup:member"], "dst": ["autogroup:tagged"], "users": ` + tt.users + `},
+	],
+}`))
+			if err != nil {
+				t.Fatalf("parsing policy: %s", err)
+			}
+
+			sshPol, err := pol.compileSSHPolicy(users, nodes[1], nodes)
+			if err != nil {
+				t.Fatalf("compiling SSH policy: %s", err)
+			}
+
+			if len(sshPol.Rules) != 1 {
+				t.Fatalf("got %d rules, want 1", len(sshPol.Rules))
+			}
+
+			if diff := cmp.Diff([]*tailcfg.SSHPrincipal{{NodeIP: "100.64.0.1"}}, sshPol.Rules[0].Principals); diff != "" {
+				t.Errorf("compileSSHPolicy() unexpected principals (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.want, sshPol.Rules[0].SSHUsers); diff != "" {
+				t.Errorf("compileSSHPolicy() unexpected users (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGrants(t *testing.T) {
+	users := types.Users{
+		{Model: gorm.Model{ID: 1}, Name: "user1"},
+		{Model: gorm.Model{ID: 2}, Name: "user2"},
+	}
+
+	nodes := types.Nodes{
+		{ID: 1, IPv4: ap("100.64.0.1"), User: users[0]},
+		{ID: 2, IPv4: ap("100.64.0.2"), User: users[0]},
+		{ID: 3, IPv4: ap("100.64.0.3"), User: users[1]},
+		{ID: 4, IPv4: ap("100.64.0.4"), User: users[1], ForcedTags: []string{"tag:server"}},
+	}
+
+	capMap := tailcfg.PeerCapMap{
+		"example.com/cap/idp": []tailcfg.RawMessage{`{"users":["*"]}`},
+	}
+
+	tests := []struct {
+		name string
+		pol  string
+		node *types.Node
+		want []tailcfg.FilterRule
+	}{
+		{
+			name: "ip-all",
+			pol: `
+{
+	"grants": [
+		{"src": ["user1@"], "dst": ["tag:server"], "ip": ["*"]},
+	],
+}`,
+			want: []tailcfg.FilterRule{
+				{
+					SrcIPs: []string{"100.64.0.1/32", "100.64.0.2/32"},
+					DstPorts: []tailcfg.NetPortRange{
+						{IP: "100.64.0.4/32", Ports: tailcfg.PortRangeAny},
+					},
+				},
+			},
+		},
+		{
+			name: "ip-protocols",
+			pol: `
+{
+	"grants": [
+		{"src": ["user1@"], "dst": ["tag:server"], "ip": ["tcp:443", "udp:53", "tcp:80", "22"]},
+	],
+}`,
+			want: []tailcfg.FilterRule{
+				{
+					SrcIPs: []string{"100.64.0.1/32", "100.64.0.2/32"},
+					DstPorts: []tailcfg.NetPortRange{
+						{IP: "100.64.0.4/32", Ports: tailcfg.PortRange{First: 443, Last: 443}},
+						{IP: "100.64.0.4/32", Ports: tailcfg.PortRange{First: 80, Last: 80}},
+					},
+					IPProto: []int{protocolTCP},
+				},
+				{
+					SrcIPs: []string{"100.64.0.1/32", "100.64.0.2/32"},
+					DstPorts: []tailcfg.NetPortRange{
+						{IP: "100.64.0.4/32", Ports: tailcfg.PortRange{First: 53, Last: 53}},
+					},
+					IPProto: []int{protocolUDP},
+				},
+				{
+					SrcIPs: []string{"100.64.0.1/32", "100.64.0.2/32"},
+					DstPorts: []tailcfg.NetPortRange{
+						{IP: "100.64.0.4/32", Ports: tailcfg.PortRange{First: 22, Last: 22}},
+					},
+				},
+			},
+		},
+		{
+			name: "app",
+			pol: `
+{
+	"grants": [
+		{"src": ["user2@"], "dst": ["tag:server"], "app": {"example.com/cap/idp": [{"users":["*"]}]}},
+	],
+}`,
+			want: []tailcfg.FilterRule{
+				{
+					SrcIPs: []string{"100.64.0.3/32"},
+					CapGrant: []tailcfg.CapGrant{
+						{
+							Dsts:   []netip.Prefix{mp("100.64.0.4/32")},
+							CapMap: capMap,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "ip-and-app-with-autogroup-self",
+			pol: `
+{
+	"grants": [
+		{"src": ["*"], "dst": ["autogroup:self"], "ip": ["*"], "app": {"example.com/cap/idp": [{"users":["*"]}]}},
+	],
+}`,
+			node: nodes[0],
+			want: []tailcfg.FilterRule{
+				{
+					SrcIPs: []string{"100.64.0.1/32", "100.64.0.2/32"},
+					DstPorts: []tailcfg.NetPortRange{
+						{IP: "100.64.0.1/32", Ports: tailcfg.PortRangeAny},
+						{IP: "100.64.0.2/32", Ports: tailcfg.PortRangeAny},
+					},
+				},
+				{
+					SrcIPs: []string{"100.64.0.1/32", "100.64.0.2/32"},
+					CapGrant: []tailcfg.CapGrant{
+						{
+							Dsts:   []netip.Prefix{mp("100.64.0.1/32"), mp("100.64.0.2/32")},
+							CapMap: capMap,
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "acls-and-grants",
+			pol: `
+{
+	"acls": [
+		{"action": "accept", "src": ["user2@"], "dst": ["user1@:22"]},
+	],
+	"grants": [
+		{"src": ["user1@"], "dst": ["user2@"], "ip": ["22"]},
+	],
+}`,
+			want: []tailcfg.FilterRule{
+				{
+					SrcIPs: []string{"100.64.0.3/32"},
+					DstPorts: []tailcfg.NetPortRange{
+						{IP: "100.64.0.1/32", Ports: tailcfg.PortRange{First: 22, Last: 22}},
+						{IP: "100.64.0.2/32", Ports: tailcfg.PortRange{First: 22, Last: 22}},
+					},
+				},
+				{
+					SrcIPs: []string{"100.64.0.1/32", "100.64.0.2/32"},
+					DstPorts: []tailcfg.NetPortRange{
+						{IP: "100.64.0.3/32", Ports: tailcfg.PortRange{First: 22, Last: 22}},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pol, err := policyFromBytes([]byte(tt.pol))
+			if err != nil {
+				t.Fatalf("parsing policy: %s", err)
+			}
+
+			var rules []tailcfg.FilterRule
+			if tt.node == nil {
+				rules, err = pol.compileFilterRules(users, nodes)
+			} else {
+				rules, err = pol.compileFilterRulesForNode(users, tt.node, nodes)
+			}
+			if err != nil {
+				t.Fatalf("compiling filter rules: %s", err)
+			}
+
+			if diff := cmp.Diff(tt.want, rules, util.Comparers...); diff != "" {
+				t.Errorf("compileFilterRules() unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/netip"
+	"slices"
 	"strings"
 	"sync"
 
@@ -20,8 +21,9 @@ type PolicyManager struct {
 	users []types.User
 	nodes types.Nodes
 
-	filterHash deephash.Sum
-	filter     []tailcfg.FilterRule
+	filterHash    deephash.Sum
+	filter        []tailcfg.FilterRule
+	filterOrigins []types.PolicyRuleOrigin
 
 	tagOwnerMapHash deephash.Sum
 	tagOwnerMap     map[Tag]*netipx.IPSet
@@ -29,12 +31,19 @@ type PolicyManager struct {
 	autoApproveMapHash deephash.Sum
 	autoApproveMap     map[netip.Prefix]*netipx.IPSet
 
+	nodeAttrsHash deephash.Sum
+	nodeAttrs     []nodeAttrSet
+
 	// Lazy map of SSH policies
 	sshPolicyMap map[types.NodeID]*tailcfg.SSHPolicy
+
+	// Lazy map of per node filter rules, as rules using
+	// autogroup:self differ between nodes.
+	filterRulesMap map[types.NodeID][]tailcfg.FilterRule
 }
 
 // NewPolicyManager creates a new PolicyManager from a policy file and a list of users and nodes.
-// It returns an error if the policy file is invalid.
+// It returns an error if the policy file is invalid or any of its tests fail.
 // The policy manager will update the filter rules based on the users and nodes.
 func NewPolicyManager(b []byte, users []types.User, nodes types.Nodes) (*PolicyManager, error) {
 	policy, err := policyFromBytes(b)
@@ -43,10 +52,11 @@ func NewPolicyManager(b []byte, users []types.User, nodes types.Nodes) (*PolicyM
 	}
 
 	pm := PolicyManager{
-		pol:          policy,
-		users:        users,
-		nodes:        nodes,
-		sshPolicyMap: make(map[types.NodeID]*tailcfg.SSHPolicy, len(nodes)),
+		pol:            policy,
+		users:          users,
+		nodes:          nodes,
+		sshPolicyMap:   make(map[types.NodeID]*tailcfg.SSHPolicy, len(nodes)),
+		filterRulesMap: make(map[types.NodeID][]tailcfg.FilterRule, len(nodes)),
 	}
 
 	_, err = pm.updateLocked()
@@ -54,20 +64,26 @@ func NewPolicyManager(b []byte, users []types.User, nodes types.Nodes) (*PolicyM
 		return nil, err
 	}
 
+	err = pm.pol.runTests(pm.users, pm.nodes, pm.filter)
+	if err != nil {
+		return nil, err
+	}
+
 	return &pm, nil
 }
 
 // updateLocked updates the filter rules based on the current policy and nodes.
 // It must be called with the lock held.
 func (pm *PolicyManager) updateLocked() (bool, error) {
-	filter, err := pm.pol.compileFilterRules(pm.users, pm.nodes)
+	filter, origins, err := pm.pol.compileFilterRulesForUsers(pm.users, pm.nodes, pm.users)
 	if err != nil {
 		return false, fmt.Errorf("compiling filter rules: %w", err)
 	}
 
 	filterHash := deephash.Hash(&filter)
-	filterChanged := filterHash == pm.filterHash
+	filterChanged := filterHash != pm.filterHash
 	pm.filter = filter
+	pm.filterOrigins = origins
 	pm.filterHash = filterHash
 
 	// Order matters, tags might be used in autoapprovers, so we need to ensure
@@ -93,8 +109,18 @@ func (pm *PolicyManager) updateLocked() (bool, error) {
 	pm.autoApproveMap = autoMap
 	pm.autoApproveMapHash = autoApproveMapHash
 
+	nodeAttrs, err := resolveNodeAttrs(pm.pol, pm.users, pm.nodes)
+	if err != nil {
+		return false, fmt.Errorf("resolving node attributes: %w", err)
+	}
+
+	nodeAttrsHash := deephash.Hash(&nodeAttrs)
+	nodeAttrsChanged := nodeAttrsHash != pm.nodeAttrsHash
+	pm.nodeAttrs = nodeAttrs
+	pm.nodeAttrsHash = nodeAttrsHash
+
 	// If neither of the calculated values changed, no need to update nodes
-	if !filterChanged && !tagOwnerChanged && !autoApproveChanged {
+	if !filterChanged && !tagOwnerChanged && !autoApproveChanged && !nodeAttrsChanged {
 		return false, nil
 	}
 
@@ -104,6 +130,10 @@ func (pm *PolicyManager) updateLocked() (bool, error) {
 	// that nodes has been added or removed.
 	clear(pm.sshPolicyMap)
 
+	// The per node rules are derived from the same policy, users
+	// and nodes as the filter.
+	clear(pm.filterRulesMap)
+
 	return true, nil
 }
 
@@ -137,6 +167,18 @@ func (pm *PolicyManager) SetPolicy(polB []byte) (bool, error) {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
+	// The tests of the new policy must pass before it replaces the
+	// current policy.
+	filter, err := pol.compileFilterRules(pm.users, pm.nodes)
+	if err != nil {
+		return false, fmt.Errorf("compiling filter rules: %w", err)
+	}
+
+	err = pol.runTests(pm.users, pm.nodes, filter)
+	if err != nil {
+		return false, err
+	}
+
 	pm.pol = pol
 
 	return pm.updateLocked()
@@ -149,6 +191,49 @@ func (pm *PolicyManager) Filter() []tailcfg.FilterRule {
 	return pm.filter
 }
 
+// FilterWithOrigins returns the filter rules with the ACL or grant each rule
+// was compiled from.
+func (pm *PolicyManager) FilterWithOrigins() ([]tailcfg.FilterRule, []types.PolicyRuleOrigin) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	return pm.filter, pm.filterOrigins
+}
+
+// FilterForNode returns the filter rules from the perspective of the given
+// node. It differs from Filter as autogroup:self is only resolved for the
+// user owning the node.
+func (pm *PolicyManager) FilterForNode(node *types.Node) ([]tailcfg.FilterRule, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if rules, ok := pm.filterRulesMap[node.ID]; ok {
+		return rules, nil
+	}
+
+	// The rules are compiled from the node as it is known to the policy
+	// manager, so the cached rules are invalidated together with the
+	// filter. A node not yet known is compiled as is, but not cached.
+	known, cache := node, false
+	for _, n := range pm.nodes {
+		if n.ID == node.ID {
+			known, cache = n, true
+			break
+		}
+	}
+
+	rules, err := pm.pol.compileFilterRulesForNode(pm.users, known, pm.nodes)
+	if err != nil {
+		return nil, fmt.Errorf("compiling filter rules for node: %w", err)
+	}
+
+	if cache {
+		pm.filterRulesMap[node.ID] = rules
+	}
+
+	return rules, nil
+}
+
 // SetUsers updates the users in the policy manager and updates the filter rules.
 func (pm *PolicyManager) SetUsers(users []types.User) (bool, error) {
 	pm.mu.Lock()
@@ -231,6 +316,26 @@ func (pm *PolicyManager) NodeCanApproveRoute(node *types.Node, route netip.Prefi
 	return false
 }
 
+// NodeAttributes returns the node attributes from the policy matching
+// the given node, in the order they appear in the policy.
+func (pm *PolicyManager) NodeAttributes(node *types.Node) []string {
+	if pm == nil {
+		return nil
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	var attrs []string
+	for _, set := range pm.nodeAttrs {
+		if slices.ContainsFunc(node.IPs(), set.ips.Contains) {
+			attrs = append(attrs, set.attrs...)
+		}
+	}
+
+	return attrs
+}
+
 func (pm *PolicyManager) Version() int {
 	return 2
 }
@@ -56,3 +56,338 @@ func TestPolicyManager(t *testing.T) {
 		})
 	}
 }
+
+func TestPolicyManagerFilterForNode(t *testing.T) {
+	users := types.Users{
+		{Model: gorm.Model{ID: 1}, Name: "user1"},
+		{Model: gorm.Model{ID: 2}, Name: "user2"},
+	}
+
+	nodes := types.Nodes{
+		{ID: 1, IPv4: ap("100.64.0.1"), User: users[0]},
+		{ID: 2, IPv4: ap("100.64.0.2"), User: users[0]},
+		{ID: 3, IPv4: ap("100.64.0.3"), User: users[1]},
+	}
+
+	pol := `
+{
+	"acls": [
+		{"action": "accept", "src": ["*"], "dst": ["autogroup:self:*"]},
+	],
+}`
+
+	selfRule := func(ips ...string) []tailcfg.FilterRule {
+		rule := tailcfg.FilterRule{}
+		for _, ip := range ips {
+			rule.SrcIPs = append(rule.SrcIPs, ip+"/32")
+			rule.DstPorts = append(rule.DstPorts, tailcfg.NetPortRange{IP: ip + "/32", Ports: tailcfg.PortRangeAny})
+		}
+
+		return []tailcfg.FilterRule{rule}
+	}
+
+	pm, err := NewPolicyManager([]byte(pol), users, nodes)
+	require.NoError(t, err)
+
+	got, err := pm.FilterForNode(nodes[0])
+	require.NoError(t, err)
+	if diff := cmp.Diff(selfRule("100.64.0.1", "100.64.0.2"), got); diff != "" {
+		t.Errorf("FilterForNode() unexpected result (-want +got):\n%s", diff)
+	}
+	require.Contains(t, pm.filterRulesMap, nodes[0].ID)
+
+	// A node passed in with a state the policy manager has not seen yet
+	// is resolved as it is known to the policy manager.
+	moved := *nodes[0]
+	moved.User = users[1]
+	got, err = pm.FilterForNode(&moved)
+	require.NoError(t, err)
+	if diff := cmp.Diff(selfRule("100.64.0.1", "100.64.0.2"), got); diff != "" {
+		t.Errorf("FilterForNode() unexpected result for stale node (-want +got):\n%s", diff)
+	}
+
+	// Tagging the node changes the filter and invalidates the cached rules.
+	tagged := &types.Node{ID: 1, IPv4: ap("100.64.0.1"), User: users[0], ForcedTags: []string{"tag:server"}}
+	_, err = pm.SetNodes(types.Nodes{tagged, nodes[1], nodes[2]})
+	require.NoError(t, err)
+	require.Empty(t, pm.filterRulesMap)
+
+	got, err = pm.FilterForNode(tagged)
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	got, err = pm.FilterForNode(nodes[1])
+	require.NoError(t, err)
+	if diff := cmp.Diff(selfRule("100.64.0.2"), got); diff != "" {
+		t.Errorf("FilterForNode() unexpected result after tagging (-want +got):\n%s", diff)
+	}
+
+	// Nodes unknown to the policy manager are not cached.
+	unknown := &types.Node{ID: 4, IPv4: ap("100.64.0.4"), User: users[1]}
+	_, err = pm.FilterForNode(unknown)
+	require.NoError(t, err)
+	require.NotContains(t, pm.filterRulesMap, unknown.ID)
+}
+
+func TestPolicyManagerSetNodesChanged(t *testing.T) {
+	users := types.Users{
+		{Model: gorm.Model{ID: 1}, Name: "user1"},
+		{Model: gorm.Model{ID: 2}, Name: "user2"},
+	}
+
+	initial := types.Nodes{
+		{ID: 1, IPv4: ap("100.64.0.1"), User: users[0]},
+	}
+
+	pol := `
+{
+	"acls": [
+		{"action": "accept", "src": ["user1@"], "dst": ["user1@:*"]},
+	],
+}`
+
+	tests := []struct {
+		name        string
+		nodes       types.Nodes
+		wantChanged bool
+	}{
+		{
+			name:        "same-nodes",
+			nodes:       initial,
+			wantChanged: false,
+		},
+		{
+			name: "node-in-filter-added",
+			nodes: types.Nodes{
+				initial[0],
+				{ID: 2, IPv4: ap("100.64.0.2"), User: users[0]},
+			},
+			wantChanged: true,
+		},
+		{
+			name: "node-not-in-filter-added",
+			nodes: types.Nodes{
+				initial[0],
+				{ID: 3, IPv4: ap("100.64.0.3"), User: users[1]},
+			},
+			wantChanged: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, err := NewPolicyManager([]byte(pol), users, initial)
+			require.NoError(t, err)
+
+			changed, err := pm.SetNodes(tt.nodes)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantChanged, changed)
+		})
+	}
+}
+
+func TestPolicyManagerSetPolicyTests(t *testing.T) {
+	users := types.Users{
+		{Model: gorm.Model{ID: 1}, Name: "user1"},
+		{Model: gorm.Model{ID: 2}, Name: "user2"},
+	}
+
+	nodes := types.Nodes{
+		{ID: 1, IPv4: ap("100.64.0.1"), User: users[0]},
+		{ID: 2, IPv4: ap("100.64.0.2"), User: users[1]},
+		{ID: 3, IPv4: ap("100.64.0.3"), User: users[1], ForcedTags: []string{"tag:server"}},
+	}
+
+	initial := `
+{
+	"acls": [
+		{"action": "accept", "src": ["*"], "dst": ["*:*"]},
+	],
+}`
+
+	tests := []struct {
+		name    string
+		pol     string
+		wantErr string
+	}{
+		{
+			name: "passing-tests",
+			pol: `
+{
+	"tagOwners": {
+		"tag:server": ["user2@"],
+	},
+	"acls": [
+		{"action": "accept", "proto": "tcp", "src": ["user1@"], "dst": ["tag:server:22"]},
+	],
+	"tests": [
+		{"src": "user1@", "accept": ["tag:server:22"], "deny": ["tag:server:80", "user2@:22"]},
+		{"src": "100.64.0.1", "proto": "udp", "deny": ["tag:server:22"]},
+	],
+}`,
+		},
+		{
+			name: "failing-accept",
+			pol: `
+{
+	"tagOwners": {
+		"tag:server": ["user2@"],
+	},
+	"acls": [
+		{"action": "accept", "src": ["user1@"], "dst": ["tag:server:22"]},
+	],
+	"tests": [
+		{"src": "user2@", "accept": ["tag:server:22"]},
+	],
+}`,
+			wantErr: "test 0: 100.64.0.2 cannot access 100.64.0.3:22",
+		},
+		{
+			name: "failing-deny",
+			pol: `
+{
+	"acls": [
+		{"action": "accept", "src": ["user1@"], "dst": ["user2@:*"]},
+	],
+	"tests": [
+		{"src": "user1@", "deny": ["user2@:443"]},
+	],
+}`,
+			wantErr: "test 0: 100.64.0.1 can access 100.64.0.2:443",
+		},
+		{
+			name: "accept-source-without-addresses",
+			pol: `
+{
+	"groups": {
+		"group:empty": [],
+	},
+	"acls": [
+		{"action": "accept", "src": ["*"], "dst": ["*:*"]},
+	],
+	"tests": [
+		{"src": "group:empty", "accept": ["user2@:22"]},
+	],
+}`,
+			wantErr: "test 0: source resolves to no addresses",
+		},
+		{
+			name: "accept-destination-without-addresses",
+			pol: `
+{
+	"tagOwners": {
+		"tag:unused": ["user1@"],
+	},
+	"acls": [
+		{"action": "accept", "src": ["*"], "dst": ["*:*"]},
+	],
+	"tests": [
+		{"src": "user1@", "accept": ["user2@:22", "tag:unused:22"]},
+	],
+}`,
+			wantErr: "test 0: accept 1 resolves to no addresses",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, err := NewPolicyManager([]byte(initial), users, nodes)
+			require.NoError(t, err)
+
+			before := pm.Filter()
+
+			_, err = pm.SetPolicy([]byte(tt.pol))
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, ErrPolicyTestFailed)
+			require.ErrorContains(t, err, tt.wantErr)
+
+			// The current policy is kept when the tests fail.
+			if diff := cmp.Diff(before, pm.Filter()); diff != "" {
+				t.Errorf("Filter() changed after failing tests (-want +got):\n%s", diff)
+			}
+
+			// A policy manager cannot be created from a policy with
+			// failing tests.
+			_, err = NewPolicyManager([]byte(tt.pol), users, nodes)
+			require.ErrorIs(t, err, ErrPolicyTestFailed)
+		})
+	}
+}
+
+func TestPolicyManagerNodeAttributes(t *testing.T) {
+	users := types.Users{
+		{Model: gorm.Model{ID: 1}, Name: "user1"},
+		{Model: gorm.Model{ID: 2}, Name: "user2"},
+	}
+
+	nodes := types.Nodes{
+		{ID: 1, IPv4: ap("100.64.0.1"), User: users[0]},
+		{ID: 2, IPv4: ap("100.64.0.2"), User: users[1]},
+		{ID: 3, IPv4: ap("100.64.0.3"), User: users[1], ForcedTags: []string{"tag:kiosk"}},
+	}
+
+	pol := `
+{
+	"tagOwners": {
+		"tag:kiosk": ["user2@"],
+	},
+	"nodeAttrs": [
+		{"target": ["*"], "attr": ["randomize-client-port"]},
+		{"target": ["user1@"], "attr": ["funnel", "drive:share"]},
+		{"target": ["tag:kiosk"], "attr": ["-file-sharing"]},
+	],
+}`
+
+	pm, err := NewPolicyManager([]byte(pol), users, nodes)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		node *types.Node
+		want []string
+	}{
+		{
+			name: "user1",
+			node: nodes[0],
+			want: []string{"randomize-client-port", "funnel", "drive:share"},
+		},
+		{
+			name: "user2",
+			node: nodes[1],
+			want: []string{"randomize-client-port"},
+		},
+		{
+			name: "tagged",
+			node: nodes[2],
+			want: []string{"randomize-client-port", "-file-sharing"},
+		},
+		{
+			// Targets are resolved from the known nodes, only the
+			// wildcard matches a node not yet known.
+			name: "unknown-node",
+			node: &types.Node{ID: 4, IPv4: ap("100.64.0.4"), User: users[0]},
+			want: []string{"randomize-client-port"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, pm.NodeAttributes(tt.node))
+		})
+	}
+
+	changed, err := pm.SetPolicy([]byte(`
+{
+	"nodeAttrs": [
+		{"target": ["user2@"], "attr": ["funnel"]},
+	],
+}`))
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Nil(t, pm.NodeAttributes(nodes[0]))
+	require.Equal(t, []string{"funnel"}, pm.NodeAttributes(nodes[1]))
+}
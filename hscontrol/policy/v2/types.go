@@ -3,6 +3,7 @@ package v2
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/netip"
 	"strings"
@@ -374,9 +375,27 @@ type AutoGroup string
 
 const (
 	AutoGroupInternet = "autogroup:internet"
+
+	// AutoGroupSelf represents all the devices owned by the same user as
+	// the source of a rule. It is only valid as a destination as it is
+	// resolved per source user when the filter is compiled.
+	AutoGroupSelf = "autogroup:self"
+
+	// AutoGroupMember represents all the devices owned by a user,
+	// that is every device that is not tagged.
+	AutoGroupMember = "autogroup:member"
+
+	// AutoGroupTagged represents all the devices with a valid tag.
+	AutoGroupTagged = "autogroup:tagged"
+
+	// AutoGroupNonRoot is not an alias, but can be used in the users of
+	// an SSH rule to allow any user except root.
+	AutoGroupNonRoot = "autogroup:nonroot"
 )
 
-var autogroups = []string{AutoGroupInternet}
+var autogroups = []string{AutoGroupInternet, AutoGroupSelf, AutoGroupMember, AutoGroupTagged}
+
+var ErrAutogroupSelfNotResolvable = errors.New("autogroup:self can only be resolved per user")
 
 func (ag AutoGroup) Validate() error {
 	for _, valid := range autogroups {
@@ -396,15 +415,128 @@ func (ag *AutoGroup) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
-func (ag AutoGroup) Resolve(_ *Policy, _ types.Users, _ types.Nodes) (*netipx.IPSet, error) {
+func (ag AutoGroup) Resolve(p *Policy, users types.Users, nodes types.Nodes) (*netipx.IPSet, error) {
 	switch ag {
 	case AutoGroupInternet:
 		return util.TheInternet(), nil
+	case AutoGroupSelf:
+		// autogroup:self cannot be resolved without knowing the user
+		// of the source, see resolveSelf.
+		return nil, ErrAutogroupSelfNotResolvable
+	case AutoGroupMember:
+		isTagged, err := taggedFunc(p, users, nodes)
+		if err != nil {
+			return nil, err
+		}
+
+		return resolveMembers(nodes, isTagged)
+	case AutoGroupTagged:
+		isTagged, err := taggedFunc(p, users, nodes)
+		if err != nil {
+			return nil, err
+		}
+
+		var ips netipx.IPSetBuilder
+
+		for _, node := range nodes {
+			if isTagged(node) {
+				node.AppendToIPSet(&ips)
+			}
+		}
+
+		return ips.IPSet()
 	}
 
 	return nil, nil
 }
 
+// taggedFunc returns a function reporting whether a node is tagged under
+// the policy, either by a forced tag, a tag from a PreAuthKey or a requested
+// tag approved by the tagOwners of the policy. autogroup:member,
+// autogroup:tagged and autogroup:self all use it, so a node is never both a
+// member and tagged.
+func taggedFunc(p *Policy, users types.Users, nodes types.Nodes) (func(*types.Node) bool, error) {
+	tagMap, err := resolveTagOwners(p, users, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(node *types.Node) bool {
+		if node.IsTagged() {
+			return true
+		}
+
+		if node.Hostinfo == nil {
+			return false
+		}
+
+		for _, tag := range node.Hostinfo.RequestTags {
+			if tagips, ok := tagMap[Tag(tag)]; ok && node.InIPSet(tagips) {
+				return true
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// resolveMembers returns the IPs of all the nodes that are not tagged.
+func resolveMembers(nodes types.Nodes, isTagged func(*types.Node) bool) (*netipx.IPSet, error) {
+	var ips netipx.IPSetBuilder
+
+	for _, node := range nodes {
+		if isTagged(node) {
+			continue
+		}
+
+		node.AppendToIPSet(&ips)
+	}
+
+	return ips.IPSet()
+}
+
+// CanBeTagOwner reports whether the AutoGroup can own tags, only
+// autogroup:member can, allowing any user to tag their own devices.
+func (ag AutoGroup) CanBeTagOwner() bool {
+	return ag.Is(AutoGroupMember)
+}
+
+// CanBeAutoApprover reports whether the AutoGroup can be used as an
+// auto approver.
+func (ag AutoGroup) CanBeAutoApprover() bool {
+	return ag.Is(AutoGroupMember) || ag.Is(AutoGroupTagged)
+}
+
+// Is reports whether the AutoGroup is the given autogroup.
+func (ag AutoGroup) Is(c string) bool {
+	return string(ag) == c
+}
+
+// isAutoGroupSelf reports whether the alias is autogroup:self.
+func isAutoGroupSelf(alias Alias) bool {
+	ag, ok := alias.(*AutoGroup)
+	return ok && ag.Is(AutoGroupSelf)
+}
+
+// resolveSelf resolves autogroup:self from the perspective of the given user,
+// meaning all the devices owned by the user, excluding tagged devices as they
+// are not considered to be owned by a user.
+func resolveSelf(user types.User, nodes types.Nodes, isTagged func(*types.Node) bool) (*netipx.IPSet, error) {
+	var ips netipx.IPSetBuilder
+
+	for _, node := range nodes {
+		if isTagged(node) {
+			continue
+		}
+
+		if node.User.ID == user.ID {
+			node.AppendToIPSet(&ips)
+		}
+	}
+
+	return ips.IPSet()
+}
+
 type Alias interface {
 	Validate() error
 	UnmarshalJSON([]byte) error
@@ -617,12 +749,15 @@ func parseAutoApprover(s string) (AutoApprover, error) {
 		return ptr.To(Group(s)), nil
 	case isTag(s):
 		return ptr.To(Tag(s)), nil
+	case isAutoGroup(s) && AutoGroup(s).CanBeAutoApprover():
+		return ptr.To(AutoGroup(s)), nil
 	}
 
 	return nil, fmt.Errorf(`Invalid AutoApprover %q. An alias must be one of the following types:
 - user (containing an "@")
 - group (starting with "group:")
 - tag (starting with "tag:")
+- autogroup:member or autogroup:tagged
 
 Please check the format and try again.`, s)
 }
@@ -684,11 +819,14 @@ func parseOwner(s string) (Owner, error) {
 		return ptr.To(Username(s)), nil
 	case isGroup(s):
 		return ptr.To(Group(s)), nil
+	case isAutoGroup(s) && AutoGroup(s).CanBeTagOwner():
+		return ptr.To(AutoGroup(s)), nil
 	}
 	return nil, fmt.Errorf(`Invalid Owner %q. An alias must be one of the following types:
 - user (containing an "@")
 - group (starting with "group:")
 - tag (starting with "tag:")
+- autogroup:member
 
 Please check the format and try again.`, s)
 }
@@ -783,6 +921,15 @@ func resolveTagOwners(p *Policy, users types.Users, nodes types.Nodes) (map[Tag]
 				// Should never happen
 				return nil, fmt.Errorf("owner %v is not an Alias", owner)
 			}
+			// Which nodes are members depends on the tagOwners, the
+			// owners are therefore the nodes not tagged by a forced tag
+			// or a tag from a PreAuthKey.
+			if ag, ok := o.(*AutoGroup); ok && ag.Is(AutoGroupMember) {
+				resolved, _ := resolveMembers(nodes, (*types.Node).IsTagged)
+				ips.AddSet(resolved)
+				continue
+			}
+
 			// If it does not resolve, that means the tag is not associated with any IP addresses.
 			resolved, _ := o.Resolve(p, users, nodes)
 			ips.AddSet(resolved)
@@ -804,6 +951,41 @@ type AutoApproverPolicy struct {
 	ExitNode AutoApprovers                  `json:"exitNode"`
 }
 
+// nodeAttrSet holds the attributes of a NodeAttr and the IPs of the
+// nodes it targets.
+type nodeAttrSet struct {
+	ips   *netipx.IPSet
+	attrs []string
+}
+
+// resolveNodeAttrs resolves the targets of the node attributes in the
+// policy, keeping the order of the policy.
+func resolveNodeAttrs(p *Policy, users types.Users, nodes types.Nodes) ([]nodeAttrSet, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	var ret []nodeAttrSet
+
+	for _, attr := range p.NodeAttrs {
+		var ips netipx.IPSetBuilder
+		for _, target := range attr.Targets {
+			// If it does not resolve, that means the target is not associated with any IP addresses.
+			resolved, _ := target.Resolve(p, users, nodes)
+			ips.AddSet(resolved)
+		}
+
+		ipSet, err := ips.IPSet()
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, nodeAttrSet{ips: ipSet, attrs: attr.Attrs})
+	}
+
+	return ret, nil
+}
+
 // resolveAutoApprovers resolves the AutoApprovers to a map of netip.Prefix to netipx.IPSet.
 // The resulting map can be used to quickly look up if a node can self-approve a route.
 // It is intended for internal use in a PolicyManager.
@@ -892,15 +1074,105 @@ type Policy struct {
 	ACLs          []ACL              `json:"acls"`
 	AutoApprovers AutoApproverPolicy `json:"autoApprovers"`
 	SSHs          []SSH              `json:"ssh"`
+	Tests         []ACLTest          `json:"tests"`
+	Grants        []Grant            `json:"grants"`
+	NodeAttrs     []NodeAttr         `json:"nodeAttrs"`
+}
+
+// Grant gives the sources access to the destinations, either on the network
+// level through IP, or on the application level through App, or both.
+type Grant struct {
+	Sources      Aliases            `json:"src"`
+	Destinations Aliases            `json:"dst"`
+	IP           []GrantIP          `json:"ip,omitempty"`
+	App          tailcfg.PeerCapMap `json:"app,omitempty"`
+}
+
+// GrantIP is the network access of a Grant, it is either "*", a port
+// specification like "22" or "8000-8999", or a protocol and a port
+// specification like "tcp:443" or "udp:*".
+type GrantIP struct {
+	Protocol string
+	Ports    []tailcfg.PortRange
+}
+
+func (g *GrantIP) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	portsPart := s
+	if proto, ports, ok := strings.Cut(s, ":"); ok {
+		if _, _, err := parseProtocol(proto); err != nil {
+			return fmt.Errorf("parsing grant ip %q: %w", s, err)
+		}
+		g.Protocol = proto
+		portsPart = ports
+	}
+
+	ports, err := parsePortRange(portsPart)
+	if err != nil {
+		return fmt.Errorf("parsing grant ip %q: %w", s, err)
+	}
+	g.Ports = ports
+
+	return nil
+}
+
+// NodeAttr sets node attributes on the nodes matched by Targets. The
+// attributes are node capabilities, e.g. "funnel" or "randomize-client-port".
+// An attribute prefixed with "-" removes a capability, which allows turning
+// off capabilities given to all nodes by default, e.g. "-file-sharing".
+type NodeAttr struct {
+	Targets Aliases  `json:"target"`
+	Attrs   []string `json:"attr"`
+}
+
+// ACLTest asserts that the source can access all the destinations in
+// Accept, and none of the destinations in Deny. Every destination must
+// have a single port, e.g. "tag:server:22".
+type ACLTest struct {
+	Source   AliasEnc         `json:"src"`
+	Protocol string           `json:"proto,omitempty"`
+	Accept   []AliasWithPorts `json:"accept"`
+	Deny     []AliasWithPorts `json:"deny,omitempty"`
 }
 
 // SSH controls who can ssh into which machines.
 type SSH struct {
-	Action       string        `json:"action"` // TODO(kradalby): add strict type
-	Sources      SSHSrcAliases `json:"src"`
-	Destinations SSHDstAliases `json:"dst"`
-	Users        []SSHUser     `json:"users"`
-	CheckPeriod  time.Duration `json:"checkPeriod,omitempty"`
+	Action       string         `json:"action"` // TODO(kradalby): add strict type
+	Sources      SSHSrcAliases  `json:"src"`
+	Destinations SSHDstAliases  `json:"dst"`
+	Users        []SSHUser      `json:"users"`
+	CheckPeriod  SSHCheckPeriod `json:"checkPeriod,omitempty"`
+}
+
+// SSHCheckPeriod is how long a session of an SSH rule with the "check"
+// action is valid before the user has to authenticate again. It is written
+// as a duration, e.g. "12h".
+type SSHCheckPeriod time.Duration
+
+func (p *SSHCheckPeriod) UnmarshalJSON(b []byte) error {
+	var str string
+	if err := json.Unmarshal(b, &str); err != nil {
+		// The period used to be read as a number of nanoseconds.
+		var nanoseconds int64
+		if err := json.Unmarshal(b, &nanoseconds); err != nil {
+			return fmt.Errorf("checkPeriod must be a duration, e.g. \"12h\": %w", err)
+		}
+		*p = SSHCheckPeriod(nanoseconds)
+
+		return nil
+	}
+
+	period, err := time.ParseDuration(str)
+	if err != nil {
+		return fmt.Errorf("parsing checkPeriod: %w", err)
+	}
+	*p = SSHCheckPeriod(period)
+
+	return nil
 }
 
 // SSHSrcAliases is a list of aliases that can be used as sources in an SSH rule.
@@ -916,8 +1188,15 @@ func (a *SSHSrcAliases) UnmarshalJSON(b []byte) error {
 
 	*a = make([]Alias, len(aliases))
 	for i, alias := range aliases {
-		switch alias.Alias.(type) {
-		case *Username, *Group, *Tag, *AutoGroup:
+		switch ag := alias.Alias.(type) {
+		case *AutoGroup:
+			// autogroup:self is rejected with a more descriptive error
+			// when the policy is validated.
+			if !ag.Is(AutoGroupMember) && !ag.Is(AutoGroupTagged) && !ag.Is(AutoGroupSelf) {
+				return fmt.Errorf("autogroup %q not supported as SSH source", *ag)
+			}
+			(*a)[i] = alias.Alias
+		case *Username, *Group, *Tag:
 			(*a)[i] = alias.Alias
 		default:
 			return fmt.Errorf("type %T not supported", alias.Alias)
@@ -955,12 +1234,16 @@ func (a *SSHDstAliases) UnmarshalJSON(b []byte) error {
 
 	*a = make([]Alias, len(aliases))
 	for i, alias := range aliases {
-		switch alias.Alias.(type) {
-		case *Username, *Tag, *AutoGroup,
+		switch ag := alias.Alias.(type) {
+		case *AutoGroup:
+			if !ag.Is(AutoGroupMember) && !ag.Is(AutoGroupTagged) && !ag.Is(AutoGroupSelf) {
+				return fmt.Errorf("autogroup %q not supported as SSH destination", *ag)
+			}
+			(*a)[i] = alias.Alias
+		case *Username, *Tag,
 			// Asterix and Group is actually not supposed to be supported,
-			// however we do not support autogroups at the moment
-			// so we will leave it in as there is no other option
-			// to dynamically give all access
+			// it is left in to not break existing policies, autogroup:member
+			// and autogroup:tagged should be preferred.
 			// https://tailscale.com/kb/1193/tailscale-ssh#dst
 			Asterix,
 			*Group:
@@ -978,6 +1261,11 @@ func (u SSHUser) String() string {
 	return string(u)
 }
 
+// IsNonRoot reports whether the SSHUser is autogroup:nonroot.
+func (u SSHUser) IsNonRoot() bool {
+	return u == AutoGroupNonRoot
+}
+
 func policyFromBytes(b []byte) (*Policy, error) {
 	if b == nil || len(b) == 0 {
 		return nil, nil
@@ -997,9 +1285,108 @@ func policyFromBytes(b []byte) (*Policy, error) {
 		return nil, fmt.Errorf("parsing policy from bytes: %w", err)
 	}
 
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+
 	return &policy, nil
 }
 
+// validate reports an error if the policy contains entries that are
+// syntactically valid, but cannot be used in the place they appear.
+func (p *Policy) validate() error {
+	var errs []error
+
+	for index, acl := range p.ACLs {
+		for _, src := range acl.Sources {
+			if isAutoGroupSelf(src) {
+				errs = append(errs, fmt.Errorf("acl %d: %q cannot be used as a source", index, AutoGroupSelf))
+			}
+		}
+	}
+
+	for index, ssh := range p.SSHs {
+		for _, src := range ssh.Sources {
+			if isAutoGroupSelf(src) {
+				errs = append(errs, fmt.Errorf("ssh %d: %q cannot be used as a source", index, AutoGroupSelf))
+			}
+		}
+
+		for _, user := range ssh.Users {
+			if isAutoGroup(string(user)) && !user.IsNonRoot() {
+				errs = append(errs, fmt.Errorf("ssh %d: %q cannot be used as a user, only %q is supported", index, user, AutoGroupNonRoot))
+			}
+		}
+	}
+
+	for index, grant := range p.Grants {
+		for _, src := range grant.Sources {
+			if isAutoGroupSelf(src) {
+				errs = append(errs, fmt.Errorf("grant %d: %q cannot be used as a source", index, AutoGroupSelf))
+			}
+		}
+
+		if len(grant.IP) == 0 && len(grant.App) == 0 {
+			errs = append(errs, fmt.Errorf("grant %d: must have at least one of ip or app", index))
+		}
+	}
+
+	for index, attr := range p.NodeAttrs {
+		if len(attr.Targets) == 0 {
+			errs = append(errs, fmt.Errorf("nodeAttr %d: missing target", index))
+		}
+
+		for _, target := range attr.Targets {
+			if isAutoGroupSelf(target) {
+				errs = append(errs, fmt.Errorf("nodeAttr %d: %q cannot be used as a target", index, AutoGroupSelf))
+			}
+		}
+
+		if len(attr.Attrs) == 0 {
+			errs = append(errs, fmt.Errorf("nodeAttr %d: missing attr", index))
+		}
+
+		for _, a := range attr.Attrs {
+			if strings.TrimPrefix(a, "-") == "" {
+				errs = append(errs, fmt.Errorf("nodeAttr %d: empty attr", index))
+			}
+		}
+	}
+
+	for index, test := range p.Tests {
+		if test.Source.Alias == nil {
+			errs = append(errs, fmt.Errorf("test %d: missing source", index))
+		} else if isAutoGroupSelf(test.Source.Alias) {
+			errs = append(errs, fmt.Errorf("test %d: %q cannot be used as a source", index, AutoGroupSelf))
+		}
+
+		if _, _, err := parseProtocol(test.Protocol); err != nil {
+			errs = append(errs, fmt.Errorf("test %d: %w", index, err))
+		}
+
+		errs = append(errs, validateTestDestinations(index, "accept", test.Accept)...)
+		errs = append(errs, validateTestDestinations(index, "deny", test.Deny)...)
+	}
+
+	return multierr.New(errs...)
+}
+
+func validateTestDestinations(index int, field string, dests []AliasWithPorts) []error {
+	var errs []error
+
+	for destIndex, dest := range dests {
+		if isAutoGroupSelf(dest.Alias) {
+			errs = append(errs, fmt.Errorf("test %d: %s %d: %q cannot be used as a destination", index, field, destIndex, AutoGroupSelf))
+		}
+
+		if len(dest.Ports) != 1 || dest.Ports[0].First != dest.Ports[0].Last {
+			errs = append(errs, fmt.Errorf("test %d: %s %d: destination must have a single port", index, field, destIndex))
+		}
+	}
+
+	return errs
+}
+
 const (
 	expectedTokenItems = 2
 )
@@ -359,7 +359,164 @@ func TestUnmarshalPolicy(t *testing.T) {
 	],
 }
 `,
-			wantErr: `AutoGroup is invalid, got: "autogroup:invalid", must be one of [autogroup:internet]`,
+			wantErr: `AutoGroup is invalid, got: "autogroup:invalid", must be one of [autogroup:internet autogroup:self autogroup:member autogroup:tagged]`,
+		},
+		{
+			name: "autogroup-self-as-source",
+			input: `
+{
+	"acls": [
+		{
+			"action": "accept",
+			"src": ["autogroup:self"],
+			"dst": ["*:*"],
+		},
+	],
+}
+`,
+			wantErr: `acl 0: "autogroup:self" cannot be used as a source`,
+		},
+		{
+			name: "autogroup-internet-as-ssh-source",
+			input: `
+{
+	"ssh": [
+		{
+			"action": "accept",
+			"src": ["autogroup:internet"],
+			"dst": ["autogroup:member"],
+			"users": ["root"],
+		},
+	],
+}
+`,
+			wantErr: `autogroup "autogroup:internet" not supported as SSH source`,
+		},
+		{
+			name: "invalid-autogroup-as-ssh-user",
+			input: `
+{
+	"ssh": [
+		{
+			"action": "accept",
+			"src": ["autogroup:member"],
+			"dst": ["autogroup:tagged"],
+			"users": ["autogroup:member"],
+		},
+	],
+}
+`,
+			wantErr: `ssh 0: "autogroup:member" cannot be used as a user, only "autogroup:nonroot" is supported`,
+		},
+		{
+			name: "autogroup-tagged-as-tag-owner",
+			input: `
+{
+	"tagOwners": {
+		"tag:test": ["autogroup:tagged"],
+	},
+}
+`,
+			wantErr: `Invalid Owner "autogroup:tagged"`,
+		},
+		{
+			name: "test-destination-port-range",
+			input: `
+{
+	"tests": [
+		{
+			"src": "user1@",
+			"accept": ["tag:server:22-80"],
+		},
+	],
+}
+`,
+			wantErr: `test 0: accept 0: destination must have a single port`,
+		},
+		{
+			name: "test-autogroup-self-destination",
+			input: `
+{
+	"tests": [
+		{
+			"src": "user1@",
+			"deny": ["autogroup:self:22"],
+		},
+	],
+}
+`,
+			wantErr: `test 0: deny 0: "autogroup:self" cannot be used as a destination`,
+		},
+		{
+			name: "grant-without-ip-or-app",
+			input: `
+{
+	"grants": [
+		{
+			"src": ["*"],
+			"dst": ["*"],
+		},
+	],
+}
+`,
+			wantErr: `grant 0: must have at least one of ip or app`,
+		},
+		{
+			name: "grant-invalid-ip",
+			input: `
+{
+	"grants": [
+		{
+			"src": ["*"],
+			"dst": ["*"],
+			"ip": ["foo:22"],
+		},
+	],
+}
+`,
+			wantErr: `parsing grant ip "foo:22"`,
+		},
+		{
+			name: "grant-autogroup-self-as-source",
+			input: `
+{
+	"grants": [
+		{
+			"src": ["autogroup:self"],
+			"dst": ["*"],
+			"ip": ["*"],
+		},
+	],
+}
+`,
+			wantErr: `grant 0: "autogroup:self" cannot be used as a source`,
+		},
+		{
+			name: "node-attr-autogroup-self-target",
+			input: `
+{
+	"nodeAttrs": [
+		{
+			"target": ["autogroup:self"],
+			"attr": ["funnel"],
+		},
+	],
+}
+`,
+			wantErr: `nodeAttr 0: "autogroup:self" cannot be used as a target`,
+		},
+		{
+			name: "node-attr-missing-attr",
+			input: `
+{
+	"nodeAttrs": [
+		{
+			"target": ["*"],
+		},
+	],
+}
+`,
+			wantErr: `nodeAttr 0: missing attr`,
 		},
 	}
 
@@ -584,6 +741,117 @@ func TestResolvePolicy(t *testing.T) {
 			toResolve: agp("autogroup:internet"),
 			want:      util.TheInternet().Prefixes(),
 		},
+		{
+			name:      "autogroup-member",
+			toResolve: agp("autogroup:member"),
+			nodes: types.Nodes{
+				{
+					User: users["testuser"],
+					IPv4: ap("100.100.101.1"),
+				},
+				{
+					User: users["notme"],
+					IPv4: ap("100.100.101.2"),
+				},
+				// Not matching forced tags
+				{
+					User:       users["testuser"],
+					ForcedTags: []string{"tag:anything"},
+					IPv4:       ap("100.100.101.3"),
+				},
+				// Not matching requested tag approved by tagOwners
+				{
+					User: users["groupuser"],
+					Hostinfo: &tailcfg.Hostinfo{
+						RequestTags: []string{"tag:approved"},
+					},
+					IPv4: ap("100.100.101.4"),
+				},
+				// Requested tag not approved by tagOwners
+				{
+					User: users["notme"],
+					Hostinfo: &tailcfg.Hostinfo{
+						RequestTags: []string{"tag:approved"},
+					},
+					IPv4: ap("100.100.101.5"),
+				},
+			},
+			pol: &Policy{
+				TagOwners: TagOwners{
+					Tag("tag:approved"): Owners{ptr.To(Username("groupuser@"))},
+				},
+			},
+			want: []netip.Prefix{mp("100.100.101.1/32"), mp("100.100.101.2/32"), mp("100.100.101.5/32")},
+		},
+		{
+			name:      "autogroup-member-owning-tags",
+			toResolve: agp("autogroup:member"),
+			nodes: types.Nodes{
+				{
+					User: users["testuser"],
+					IPv4: ap("100.100.101.1"),
+				},
+				// Not matching requested tag approved by autogroup:member
+				{
+					User: users["notme"],
+					Hostinfo: &tailcfg.Hostinfo{
+						RequestTags: []string{"tag:approved"},
+					},
+					IPv4: ap("100.100.101.2"),
+				},
+			},
+			pol: &Policy{
+				TagOwners: TagOwners{
+					Tag("tag:approved"): Owners{agp("autogroup:member")},
+				},
+			},
+			want: []netip.Prefix{mp("100.100.101.1/32")},
+		},
+		{
+			name:      "autogroup-tagged",
+			toResolve: agp("autogroup:tagged"),
+			nodes: types.Nodes{
+				// Not matching untagged
+				{
+					User: users["testuser"],
+					IPv4: ap("100.100.101.1"),
+				},
+				{
+					User:       users["testuser"],
+					ForcedTags: []string{"tag:anything"},
+					IPv4:       ap("100.100.101.2"),
+				},
+				{
+					User: users["testuser"],
+					AuthKey: &types.PreAuthKey{
+						Tags: []string{"tag:alsotagged"},
+					},
+					IPv4: ap("100.100.101.3"),
+				},
+				// Requested tag approved by tagOwners
+				{
+					User: users["groupuser"],
+					Hostinfo: &tailcfg.Hostinfo{
+						RequestTags: []string{"tag:approved"},
+					},
+					IPv4: ap("100.100.101.4"),
+				},
+				// Requested tag not approved by tagOwners
+				{
+					User: users["notme"],
+					Hostinfo: &tailcfg.Hostinfo{
+						RequestTags: []string{"tag:approved"},
+					},
+					IPv4: ap("100.100.101.5"),
+				},
+			},
+			pol: &Policy{
+				TagOwners: TagOwners{
+					Tag("tag:approved"): Owners{ptr.To(Username("groupuser@"))},
+				},
+			},
+			want: []netip.Prefix{mp("100.100.101.2/31"), mp("100.100.101.4/32")},
+		},
 		{
 			name:      "invalid-username",
 			toResolve: ptr.To(Username("invaliduser@")),
@@ -773,6 +1041,23 @@ func TestResolveAutoApprovers(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "autogroup-route-and-exit",
+			policy: &Policy{
+				AutoApprovers: AutoApproverPolicy{
+					ExitNode: AutoApprovers{agp("autogroup:tagged")},
+					Routes: map[netip.Prefix]AutoApprovers{
+						mp("10.0.0.0/24"): {agp("autogroup:member")},
+					},
+				},
+			},
+			want: map[netip.Prefix]*netipx.IPSet{
+				mp("10.0.0.0/24"): mustIPSet("100.64.0.1/32", "100.64.0.2/32", "100.64.0.3/32"),
+				tsaddr.AllIPv4():  mustIPSet("100.64.0.4/32", "100.64.0.5/32"),
+				tsaddr.AllIPv6():  mustIPSet("100.64.0.4/32", "100.64.0.5/32"),
+			},
+			wantErr: false,
+		},
 		{
 			name: "mixed-routes-and-exit-nodes",
 			policy: &Policy{
@@ -1029,6 +1314,18 @@ func TestResolveTagOwners(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "autogroup-member-tag-owner",
+			policy: &Policy{
+				TagOwners: TagOwners{
+					Tag("tag:test"): Owners{agp("autogroup:member")},
+				},
+			},
+			want: map[Tag]*netipx.IPSet{
+				Tag("tag:test"): mustIPSet("100.64.0.1/32", "100.64.0.2/32", "100.64.0.3/32"),
+			},
+			wantErr: false,
+		},
 	}
 
 	cmps := append(util.Comparers, cmp.Comparer(ipSetComparer))
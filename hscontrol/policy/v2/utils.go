@@ -111,6 +111,26 @@ const (
 	ProtocolFC       = 133 // Fibre Channel
 )
 
+// ParseProtocol returns the IANA protocol number of a single protocol, given
+// by name or number, as used by the tests of the policy and CheckAccess. An
+// empty protocol is TCP, and "icmp" is ICMPv4.
+func ParseProtocol(protocol string) (int, error) {
+	protocols, _, err := parseProtocol(protocol)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(protocols) == 0 {
+		return protocolTCP, nil
+	}
+
+	if protocols[0] < 0 || protocols[0] > 255 {
+		return 0, fmt.Errorf("protocol number %d out of range", protocols[0])
+	}
+
+	return protocols[0], nil
+}
+
 // parseProtocol reads the proto field of the ACL and generates a list of
 // protocols that will be allowed, following the IANA IP protocol number
 // https://www.iana.org/assignments/protocol-numbers/protocol-numbers.xhtml
@@ -0,0 +1,280 @@
+package policy
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+
+	"github.com/juanfont/headscale/hscontrol/routes"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"tailscale.com/tailcfg"
+	"tailscale.com/util/set"
+)
+
+// Views keeps track of what every node can see of the tailnet, its peers
+// and its own packet filter and SSH policy, and of the parts of the node
+// its peers see which depend on the policy. It is used to only
+// send updates to the nodes affected by a change instead of sending a full
+// update to all nodes.
+type Views struct {
+	mu sync.Mutex
+
+	views     map[types.NodeID]nodeView
+	primaries map[types.NodeID][]netip.Prefix
+}
+
+type nodeView struct {
+	peers set.Set[types.NodeID]
+
+	// policy is the packet filter and SSH policy of the node, node is
+	// the valid tags and attributes of the node.
+	policy string
+	node   string
+}
+
+// ViewChange describes how the view of a node changed.
+type ViewChange struct {
+	// PeersChanged are the peers the node can see which it could not see
+	// before, or which changed themselves.
+	PeersChanged []types.NodeID
+
+	// PeersRemoved are the peers the node cannot see anymore.
+	PeersRemoved []types.NodeID
+
+	// SelfChanged reports if the node itself, its packet filter or SSH
+	// policy changed.
+	SelfChanged bool
+}
+
+// Empty reports if nothing changed for the node.
+func (c ViewChange) Empty() bool {
+	return len(c.PeersChanged) == 0 && len(c.PeersRemoved) == 0 && !c.SelfChanged
+}
+
+func NewViews() *Views {
+	return &Views{
+		views:     make(map[types.NodeID]nodeView),
+		primaries: make(map[types.NodeID][]netip.Prefix),
+	}
+}
+
+// Update computes the view of every node and returns, by node, how it
+// changed since the previous Update. Only nodes with changes are returned.
+// The nodes in changed, and the nodes which primary routes, valid tags or
+// attributes changed, are reported as changed to every node that can see
+// them and to themselves.
+func (v *Views) Update(
+	pm PolicyManager,
+	primary *routes.PrimaryRoutes,
+	nodes types.Nodes,
+	changed ...types.NodeID,
+) (map[types.NodeID]ViewChange, error) {
+	return v.update(pm, primary, nodes, true, changed)
+}
+
+// UpdateNodes is like Update, but only computes the views of the nodes
+// which changed, were added or removed, or which primary routes changed,
+// and of the nodes which could see them before or can see them now. As
+// nodes see each other mutually, the views of all other nodes are
+// unchanged as long as the policy and the users did not change, Update
+// must be used if they did.
+func (v *Views) UpdateNodes(
+	pm PolicyManager,
+	primary *routes.PrimaryRoutes,
+	nodes types.Nodes,
+	changed ...types.NodeID,
+) (map[types.NodeID]ViewChange, error) {
+	return v.update(pm, primary, nodes, false, changed)
+}
+
+func (v *Views) update(
+	pm PolicyManager,
+	primary *routes.PrimaryRoutes,
+	nodes types.Nodes,
+	all bool,
+	changed []types.NodeID,
+) (map[types.NodeID]ViewChange, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	byID := make(map[types.NodeID]*types.Node, len(nodes))
+	primaries := make(map[types.NodeID][]netip.Prefix)
+	for _, node := range nodes {
+		byID[node.ID] = node
+
+		if prefixes := primary.PrimaryRoutes(node.ID); len(prefixes) > 0 {
+			primaries[node.ID] = prefixes
+		}
+	}
+
+	changedIDs := set.SetOf(changed)
+	for id, prefixes := range primaries {
+		if !slices.Equal(v.primaries[id], prefixes) {
+			changedIDs.Add(id)
+		}
+	}
+	for id := range v.primaries {
+		if _, ok := primaries[id]; !ok {
+			changedIDs.Add(id)
+		}
+	}
+
+	// computed holds the views computed by this update, the views of
+	// the other nodes did not change.
+	computed := make(map[types.NodeID]nodeView)
+	compute := func(id types.NodeID) error {
+		node, ok := byID[id]
+		if !ok {
+			return nil
+		}
+		if _, ok := computed[id]; ok {
+			return nil
+		}
+
+		view, err := computeNodeView(pm, node, nodes)
+		if err != nil {
+			return fmt.Errorf("computing view of node %d: %w", id, err)
+		}
+		computed[id] = view
+
+		return nil
+	}
+
+	if all {
+		for _, node := range nodes {
+			if err := compute(node.ID); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for id := range byID {
+			if _, ok := v.views[id]; !ok {
+				changedIDs.Add(id)
+			}
+		}
+		for id := range v.views {
+			if _, ok := byID[id]; !ok {
+				changedIDs.Add(id)
+			}
+		}
+
+		for id := range changedIDs {
+			if err := compute(id); err != nil {
+				return nil, err
+			}
+		}
+
+		affected := make(set.Set[types.NodeID])
+		for id := range changedIDs {
+			for peer := range v.views[id].peers {
+				affected.Add(peer)
+			}
+			for peer := range computed[id].peers {
+				affected.Add(peer)
+			}
+		}
+		for id := range affected {
+			if err := compute(id); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for id, after := range computed {
+		if before, ok := v.views[id]; ok && before.node != after.node {
+			changedIDs.Add(id)
+		}
+	}
+
+	changes := make(map[types.NodeID]ViewChange)
+	for id, after := range computed {
+		before, existed := v.views[id]
+
+		var change ViewChange
+		for peer := range after.peers {
+			if !before.peers.Contains(peer) || changedIDs.Contains(peer) {
+				change.PeersChanged = append(change.PeersChanged, peer)
+			}
+		}
+		for peer := range before.peers {
+			if !after.peers.Contains(peer) {
+				change.PeersRemoved = append(change.PeersRemoved, peer)
+			}
+		}
+		change.SelfChanged = !existed || changedIDs.Contains(id) || before.policy != after.policy
+
+		if change.Empty() {
+			continue
+		}
+
+		slices.Sort(change.PeersChanged)
+		slices.Sort(change.PeersRemoved)
+		changes[id] = change
+	}
+
+	views := make(map[types.NodeID]nodeView, len(nodes))
+	for id := range byID {
+		if view, ok := computed[id]; ok {
+			views[id] = view
+		} else {
+			views[id] = v.views[id]
+		}
+	}
+
+	v.views = views
+	v.primaries = primaries
+
+	return changes, nil
+}
+
+func computeNodeView(
+	pm PolicyManager,
+	node *types.Node,
+	nodes types.Nodes,
+) (nodeView, error) {
+	peers, err := peersOf(pm, node, nodes)
+	if err != nil {
+		return nodeView{}, err
+	}
+
+	filter, err := pm.FilterForNode(node)
+	if err != nil {
+		return nodeView{}, err
+	}
+
+	sshPolicy, err := pm.SSHPolicy(node)
+	if err != nil {
+		return nodeView{}, err
+	}
+
+	var tags []string
+	for _, tag := range node.RequestTags() {
+		if pm.NodeCanHaveTag(node, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	view := nodeView{
+		peers: make(set.Set[types.NodeID], len(peers)),
+		policy: jsonKey(struct {
+			Filter    []tailcfg.FilterRule
+			SSHPolicy *tailcfg.SSHPolicy
+		}{
+			Filter:    ReduceFilterRules(node, filter),
+			SSHPolicy: sshPolicy,
+		}),
+		node: jsonKey(struct {
+			Tags       []string
+			Attributes []string
+		}{
+			Tags:       tags,
+			Attributes: pm.NodeAttributes(node),
+		}),
+	}
+	for _, peer := range peers {
+		view.peers.Add(peer.ID)
+	}
+
+	return view, nil
+}
@@ -0,0 +1,245 @@
+package policy
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/juanfont/headscale/hscontrol/routes"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"tailscale.com/tailcfg"
+)
+
+func TestViewsUpdate(t *testing.T) {
+	users := types.Users{
+		types.User{Model: gorm.Model{ID: 1}, Name: "user1"},
+		types.User{Model: gorm.Model{ID: 2}, Name: "user2"},
+		types.User{Model: gorm.Model{ID: 3}, Name: "user3"},
+	}
+
+	nodes := types.Nodes{
+		&types.Node{ID: 1, IPv4: ap("100.64.0.1"), User: users[0], UserID: 1},
+		&types.Node{ID: 2, IPv4: ap("100.64.0.2"), User: users[1], UserID: 2},
+		&types.Node{ID: 3, IPv4: ap("100.64.0.3"), User: users[2], UserID: 3},
+	}
+
+	pol := []byte(`
+{
+  "acls": [
+    {"action": "accept", "src": ["user1@"], "dst": ["user2@:22"]}
+  ]
+}
+`)
+
+	newPol := []byte(`
+{
+  "acls": [
+    {"action": "accept", "src": ["user1@"], "dst": ["user3@:22"]}
+  ]
+}
+`)
+
+	for idx, pmf := range PolicyManagerFuncsForTest(pol) {
+		t.Run(fmt.Sprintf("v%d", idx+1), func(t *testing.T) {
+			pm, err := pmf(users, nodes)
+			require.NoError(t, err)
+
+			primary := routes.New()
+			views := NewViews()
+
+			// All nodes are new on the first update.
+			changes, err := views.Update(pm, primary, nodes)
+			require.NoError(t, err)
+			require.Equal(t, map[types.NodeID]ViewChange{
+				1: {PeersChanged: []types.NodeID{2}, SelfChanged: true},
+				2: {PeersChanged: []types.NodeID{1}, SelfChanged: true},
+				3: {SelfChanged: true},
+			}, changes)
+
+			changes, err = views.Update(pm, primary, nodes)
+			require.NoError(t, err)
+			require.Empty(t, changes)
+
+			_, err = pm.SetPolicy(newPol)
+			require.NoError(t, err)
+
+			// Node 1 only has a destination in the policy, so its own
+			// packet filter does not change.
+			changes, err = views.Update(pm, primary, nodes)
+			require.NoError(t, err)
+			require.Equal(t, map[types.NodeID]ViewChange{
+				1: {PeersChanged: []types.NodeID{3}, PeersRemoved: []types.NodeID{2}},
+				2: {PeersRemoved: []types.NodeID{1}, SelfChanged: true},
+				3: {PeersChanged: []types.NodeID{1}, SelfChanged: true},
+			}, changes)
+
+			// Node 2 cannot be seen by any node.
+			changes, err = views.Update(pm, primary, nodes, 2)
+			require.NoError(t, err)
+			require.Equal(t, map[types.NodeID]ViewChange{
+				2: {SelfChanged: true},
+			}, changes)
+
+			// A new primary route changes the node for everyone seeing it.
+			primary.SetRoutes(3, netip.MustParsePrefix("10.0.0.0/24"))
+
+			changes, err = views.Update(pm, primary, nodes)
+			require.NoError(t, err)
+			require.Equal(t, map[types.NodeID]ViewChange{
+				1: {PeersChanged: []types.NodeID{3}},
+				3: {SelfChanged: true},
+			}, changes)
+
+			// Removed nodes are reported as removed peers.
+			changes, err = views.Update(pm, primary, nodes[:2])
+			require.NoError(t, err)
+			require.Equal(t, map[types.NodeID]ViewChange{
+				1: {PeersRemoved: []types.NodeID{3}},
+			}, changes)
+		})
+	}
+}
+
+func TestViewsUpdateTags(t *testing.T) {
+	users := types.Users{
+		types.User{Model: gorm.Model{ID: 1}, Name: "user1"},
+	}
+
+	nodes := types.Nodes{
+		&types.Node{ID: 1, IPv4: ap("100.64.0.1"), User: users[0], UserID: 1},
+		&types.Node{
+			ID:       2,
+			IPv4:     ap("100.64.0.2"),
+			User:     users[0],
+			UserID:   1,
+			Hostinfo: &tailcfg.Hostinfo{RequestTags: []string{"tag:web"}},
+		},
+	}
+
+	pol := []byte(`
+{
+  "acls": [
+    {"action": "accept", "src": ["*"], "dst": ["*:*"]}
+  ]
+}
+`)
+
+	newPol := []byte(`
+{
+  "tagOwners": {
+    "tag:web": ["user1@"]
+  },
+  "acls": [
+    {"action": "accept", "src": ["*"], "dst": ["*:*"]}
+  ]
+}
+`)
+
+	for idx, pmf := range PolicyManagerFuncsForTest(pol) {
+		t.Run(fmt.Sprintf("v%d", idx+1), func(t *testing.T) {
+			pm, err := pmf(users, nodes)
+			require.NoError(t, err)
+
+			views := NewViews()
+			_, err = views.Update(pm, nil, nodes)
+			require.NoError(t, err)
+
+			_, err = pm.SetPolicy(newPol)
+			require.NoError(t, err)
+
+			// The tag of node 2 is now valid, which all its peers see.
+			changes, err := views.Update(pm, nil, nodes)
+			require.NoError(t, err)
+			require.Equal(t, map[types.NodeID]ViewChange{
+				1: {PeersChanged: []types.NodeID{2}},
+				2: {SelfChanged: true},
+			}, changes)
+		})
+	}
+}
+
+// sshCountingPolicyManager records the nodes which views are computed, the
+// SSH policy is read once for each of them.
+type sshCountingPolicyManager struct {
+	PolicyManager
+	computed []types.NodeID
+}
+
+func (pm *sshCountingPolicyManager) SSHPolicy(node *types.Node) (*tailcfg.SSHPolicy, error) {
+	pm.computed = append(pm.computed, node.ID)
+	return pm.PolicyManager.SSHPolicy(node)
+}
+
+func TestViewsUpdateNodes(t *testing.T) {
+	users := types.Users{
+		types.User{Model: gorm.Model{ID: 1}, Name: "user1"},
+		types.User{Model: gorm.Model{ID: 2}, Name: "user2"},
+		types.User{Model: gorm.Model{ID: 3}, Name: "user3"},
+	}
+
+	nodes := types.Nodes{
+		&types.Node{ID: 1, IPv4: ap("100.64.0.1"), User: users[0], UserID: 1},
+		&types.Node{ID: 2, IPv4: ap("100.64.0.2"), User: users[1], UserID: 2},
+		&types.Node{ID: 3, IPv4: ap("100.64.0.3"), User: users[2], UserID: 3},
+		&types.Node{ID: 4, IPv4: ap("100.64.0.4"), User: users[2], UserID: 3},
+	}
+	added := append(slices.Clone(nodes), &types.Node{ID: 5, IPv4: ap("100.64.0.5"), User: users[1], UserID: 2})
+
+	pol := []byte(`
+{
+  "acls": [
+    {"action": "accept", "src": ["user1@"], "dst": ["user2@:22"]}
+  ]
+}
+`)
+
+	for idx, pmf := range PolicyManagerFuncsForTest(pol) {
+		t.Run(fmt.Sprintf("v%d", idx+1), func(t *testing.T) {
+			policyManager, err := pmf(users, nodes)
+			require.NoError(t, err)
+			pm := &sshCountingPolicyManager{PolicyManager: policyManager}
+
+			views := NewViews()
+			_, err = views.Update(pm, nil, nodes)
+			require.NoError(t, err)
+
+			_, err = pm.SetNodes(added)
+			require.NoError(t, err)
+
+			// Only the new node and the node which can see it are computed.
+			pm.computed = nil
+			changes, err := views.UpdateNodes(pm, nil, added)
+			require.NoError(t, err)
+			require.Equal(t, map[types.NodeID]ViewChange{
+				1: {PeersChanged: []types.NodeID{5}},
+				5: {PeersChanged: []types.NodeID{1}, SelfChanged: true},
+			}, changes)
+			require.ElementsMatch(t, []types.NodeID{1, 5}, pm.computed)
+
+			// A changed node is sent to the nodes seeing it.
+			pm.computed = nil
+			changes, err = views.UpdateNodes(pm, nil, added, 2)
+			require.NoError(t, err)
+			require.Equal(t, map[types.NodeID]ViewChange{
+				1: {PeersChanged: []types.NodeID{2}},
+				2: {SelfChanged: true},
+			}, changes)
+			require.ElementsMatch(t, []types.NodeID{1, 2}, pm.computed)
+
+			_, err = pm.SetNodes(nodes)
+			require.NoError(t, err)
+
+			// The nodes which could see a removed node are computed.
+			pm.computed = nil
+			changes, err = views.UpdateNodes(pm, nil, nodes)
+			require.NoError(t, err)
+			require.Equal(t, map[types.NodeID]ViewChange{
+				1: {PeersRemoved: []types.NodeID{5}},
+			}, changes)
+			require.ElementsMatch(t, []types.NodeID{1}, pm.computed)
+		})
+	}
+}
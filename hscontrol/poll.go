@@ -2,6 +2,7 @@ package hscontrol
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand/v2"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"slices"
 	"time"
 
+	"github.com/juanfont/headscale/hscontrol/events"
 	"github.com/juanfont/headscale/hscontrol/mapper"
 	"github.com/juanfont/headscale/hscontrol/policy"
 	"github.com/juanfont/headscale/hscontrol/types"
@@ -23,6 +25,8 @@ const (
 	keepAliveInterval = 50 * time.Second
 )
 
+var errNodeNotInStore = errors.New("node not found in store")
+
 type contextKey string
 
 const nodeNameContextKey = contextKey("nodeName")
@@ -34,6 +38,10 @@ type mapSession struct {
 	capVer tailcfg.CapabilityVersion
 	mapper *mapper.Mapper
 
+	// netmap is the netmap last sent in a streaming session, used to
+	// only send what changed.
+	netmap *mapper.NetmapState
+
 	cancelChMu deadlock.Mutex
 
 	ch           chan types.StateUpdate
@@ -61,7 +69,10 @@ func (h *Headscale) newMapSession(
 	warnf, infof, tracef, errf := logPollFunc(req, node)
 
 	var updateChan chan types.StateUpdate
+	var netmap *mapper.NetmapState
 	if req.Stream {
+		netmap = mapper.NewNetmapState()
+
 		// Use a buffered channel in case a node is not fully ready
 		// to receive a message to make sure we dont block the entire
 		// notifier.
@@ -79,6 +90,7 @@ func (h *Headscale) newMapSession(
 		node:   node,
 		capVer: req.Version,
 		mapper: h.mapper,
+		netmap: netmap,
 
 		ch:           updateChan,
 		cancelCh:     make(chan struct{}),
@@ -200,17 +212,19 @@ func (m *mapSession) serveLongPoll() {
 		// in principal, it will be removed, but the client rapidly
 		// reconnects, the channel might be of another connection.
 		// In that case, it is not closed and the node is still online.
-		if m.h.nodeNotifier.RemoveNode(m.node.ID, m.ch) {
+		// In HA mode, the node may have connected to another instance
+		// already, it is still online.
+		if m.h.nodeNotifier.RemoveNode(m.node.ID, m.ch) &&
+			(m.h.cluster == nil || !m.h.nodeNotifier.IsConnected(m.node.ID)) {
 			// Failover the node's routes if any.
 			m.h.updateNodeOnlineStatus(false, m.node)
 
 			// When a node disconnects, and it causes the primary route map to change,
-			// send a full update to all nodes.
-			// TODO(kradalby): This can likely be made more effective, but likely most
-			// nodes has access to the same routes, so it might not be a big deal.
+			// send the nodes which primary routes changed to the nodes seeing them.
 			if m.h.primaryRoutes.SetRoutes(m.node.ID) {
-				ctx := types.NotifyCtx(context.Background(), "poll-primary-change", m.node.Hostname)
-				m.h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+				if err := m.h.events.Publish(context.Background(), events.PrimaryRoutesChanged{}); err != nil {
+					m.errf(err, "Failed to send primary route changes")
+				}
 			}
 		}
 
@@ -223,8 +237,9 @@ func (m *mapSession) serveLongPoll() {
 	defer m.h.pollNetMapStreamWG.Done()
 
 	if m.h.primaryRoutes.SetRoutes(m.node.ID, m.node.SubnetRoutes()...) {
-		ctx := types.NotifyCtx(context.Background(), "poll-primary-change", m.node.Hostname)
-		m.h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
+		if err := m.h.events.Publish(context.Background(), events.PrimaryRoutesChanged{}); err != nil {
+			m.errf(err, "Failed to send primary route changes")
+		}
 	}
 
 	// Upgrade the writer to a ResponseController
@@ -282,18 +297,19 @@ func (m *mapSession) serveLongPoll() {
 			// Ensure the node object is updated, for example, there
 			// might have been a hostinfo update in a sidechannel
 			// which contains data needed to generate a map response.
-			m.node, err = m.h.db.GetNodeByID(m.node.ID)
-			if err != nil {
-				m.errf(err, "Could not get machine from db")
+			node, ok := m.h.store.Node(m.node.ID)
+			if !ok {
+				m.errf(errNodeNotInStore, "Could not get node from store")
 
 				return
 			}
+			m.node = node
 
 			updateType := "full"
 			switch update.Type {
 			case types.StateFullUpdate:
 				m.tracef("Sending Full MapResponse")
-				data, err = m.mapper.FullMapResponse(m.req, m.node, fmt.Sprintf("from mapSession: %p, stream: %t", m, m.isStreaming()))
+				data, err = m.mapper.FullMapResponse(m.req, m.node, m.netmap, fmt.Sprintf("from mapSession: %p, stream: %t", m, m.isStreaming()))
 			case types.StatePeerChanged:
 				changed := make(map[types.NodeID]bool, len(update.ChangeNodes))
 
@@ -303,12 +319,12 @@ func (m *mapSession) serveLongPoll() {
 
 				lastMessage = update.Message
 				m.tracef(fmt.Sprintf("Sending Changed MapResponse: %v", lastMessage))
-				data, err = m.mapper.PeerChangedResponse(m.req, m.node, changed, update.ChangePatches, lastMessage)
+				data, err = m.mapper.PeerChangedResponse(m.req, m.node, m.netmap, changed, update.ChangePatches, lastMessage)
 				updateType = "change"
 
 			case types.StatePeerChangedPatch:
 				m.tracef(fmt.Sprintf("Sending Changed Patch MapResponse: %v", lastMessage))
-				data, err = m.mapper.PeerChangedPatchResponse(m.req, m.node, update.ChangePatches)
+				data, err = m.mapper.PeerChangedPatchResponse(m.req, m.node, m.netmap, update.ChangePatches)
 				updateType = "patch"
 			case types.StatePeerRemoved:
 				changed := make(map[types.NodeID]bool, len(update.Removed))
@@ -317,18 +333,26 @@ func (m *mapSession) serveLongPoll() {
 					changed[nodeID] = false
 				}
 				m.tracef(fmt.Sprintf("Sending Changed MapResponse: %v", lastMessage))
-				data, err = m.mapper.PeerChangedResponse(m.req, m.node, changed, update.ChangePatches, lastMessage)
+				data, err = m.mapper.PeerChangedResponse(m.req, m.node, m.netmap, changed, update.ChangePatches, lastMessage)
 				updateType = "remove"
 			case types.StateSelfUpdate:
 				lastMessage = update.Message
 				m.tracef(fmt.Sprintf("Sending Changed MapResponse: %v", lastMessage))
 				// create the map so an empty (self) update is sent
-				data, err = m.mapper.PeerChangedResponse(m.req, m.node, make(map[types.NodeID]bool), update.ChangePatches, lastMessage)
+				data, err = m.mapper.PeerChangedResponse(m.req, m.node, m.netmap, make(map[types.NodeID]bool), update.ChangePatches, lastMessage)
 				updateType = "remove"
 			case types.StateDERPUpdated:
 				m.tracef("Sending DERPUpdate MapResponse")
-				data, err = m.mapper.DERPMapResponse(m.req, m.node, m.h.DERPMap)
+				data, err = m.mapper.DERPMapResponse(m.req, m.node, m.netmap, m.h.DERPMap)
 				updateType = "derp"
+			case types.StateDNSUpdated:
+				m.tracef("Sending DNSUpdate MapResponse")
+				data, err = m.mapper.DNSConfigResponse(m.req, m.node, m.netmap)
+				updateType = "dns"
+			case types.StatePingRequest:
+				m.tracef("Sending PingRequest MapResponse")
+				data, err = m.mapper.PingResponse(m.req, m.node, m.netmap, update.PingRequest)
+				updateType = "ping"
 			}
 
 			if err != nil {
@@ -360,6 +384,7 @@ func (m *mapSession) serveLongPoll() {
 					mapResponseLastSentSeconds.WithLabelValues(updateType, m.node.ID.String()).Set(float64(time.Now().Unix()))
 				}
 				mapResponseSent.WithLabelValues("ok", updateType).Inc()
+				mapResponseBytesSent.WithLabelValues(updateType).Add(float64(len(data)))
 				m.tracef("update sent")
 				m.resetKeepAlive()
 			}
@@ -396,21 +421,18 @@ func (m *mapSession) serveLongPoll() {
 // about change in their online/offline status.
 // It takes a StateUpdateType of either StatePeerOnlineChanged or StatePeerOfflineChanged.
 func (h *Headscale) updateNodeOnlineStatus(online bool, node *types.Node) {
-	change := &tailcfg.PeerChange{
-		NodeID: tailcfg.NodeID(node.ID),
-		Online: &online,
-	}
-
+	var ev events.Event = events.NodeConnected{NodeID: node.ID}
 	if !online {
 		now := time.Now()
 
 		// lastSeen is only relevant if the node is disconnected.
 		node.LastSeen = &now
-		change.LastSeen = &now
+		ev = events.NodeDisconnected{NodeID: node.ID, LastSeen: now}
 	}
 
-	ctx := types.NotifyCtx(context.Background(), "poll-nodeupdate-onlinestatus", node.Hostname)
-	h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdatePeerPatch(change), node.ID)
+	if err := h.events.Publish(context.Background(), ev); err != nil {
+		log.Error().Err(err).Uint64("node.id", node.ID.Uint64()).Msg("failed to publish online status")
+	}
 }
 
 func (m *mapSession) handleEndpointUpdate() {
@@ -449,40 +471,18 @@ func (m *mapSession) handleEndpointUpdate() {
 	// Check if the Hostinfo of the node has changed.
 	// If it has changed, check if there has been a change to
 	// the routable IPs of the host and update them in
-	// the database. Then send a Changed update
-	// (containing the whole node object) to peers to inform about
-	// the route change.
+	// the route manager. The nodes affected by the route change
+	// are sent their updates after the node has been saved.
 	// If the hostinfo has changed, but not the routes, just update
 	// hostinfo and let the function continue.
 	if routesChanged {
-		// TODO(kradalby): I am not sure if we need this?
-		nodesChangedHook(m.h.db, m.h.polMan, m.h.nodeNotifier)
-
 		// Approve any route that has been defined in policy as
 		// auto approved. Any change here is not important as any
 		// actual state change will be detected when the route manager
 		// is updated.
 		policy.AutoApproveRoutes(m.h.polMan, m.node)
 
-		// Update the routes of the given node in the route manager to
-		// see if an update needs to be sent.
-		if m.h.primaryRoutes.SetRoutes(m.node.ID, m.node.SubnetRoutes()...) {
-			ctx := types.NotifyCtx(m.ctx, "poll-primary-change", m.node.Hostname)
-			m.h.nodeNotifier.NotifyAll(ctx, types.UpdateFull())
-		} else {
-			ctx := types.NotifyCtx(m.ctx, "cli-approveroutes", m.node.Hostname)
-			m.h.nodeNotifier.NotifyWithIgnore(ctx, types.UpdatePeerChanged(m.node.ID), m.node.ID)
-
-			// TODO(kradalby): I am not sure if we need this?
-			// Send an update to the node itself with to ensure it
-			// has an updated packetfilter allowing the new route
-			// if it is defined in the ACL.
-			ctx = types.NotifyCtx(m.ctx, "poll-nodeupdate-self-hostinfochange", m.node.Hostname)
-			m.h.nodeNotifier.NotifyByNodeID(
-				ctx,
-				types.UpdateSelf(m.node.ID),
-				m.node.ID)
-		}
+		m.h.primaryRoutes.SetRoutes(m.node.ID, m.node.SubnetRoutes()...)
 	}
 
 	// Check if there has been a change to Hostname and update them
@@ -491,6 +491,13 @@ func (m *mapSession) handleEndpointUpdate() {
 	// the hostname change.
 	m.node.ApplyHostnameFromHostInfo(m.req.Hostinfo)
 
+	// The health warnings and the tailnet lock signature are set outside
+	// of the map session, keep the ones set since the session started.
+	if stored, ok := m.h.store.Node(m.node.ID); ok {
+		m.node.HealthWarnings = stored.HealthWarnings
+		m.node.KeySignature = stored.KeySignature
+	}
+
 	if err := m.h.db.DB.Save(m.node).Error; err != nil {
 		m.errf(err, "Failed to persist/update node in the database")
 		http.Error(m.w, "", http.StatusInternalServerError)
@@ -498,13 +505,19 @@ func (m *mapSession) handleEndpointUpdate() {
 
 		return
 	}
+	m.h.store.PutNode(m.node)
 
-	ctx := types.NotifyCtx(context.Background(), "poll-nodeupdate-peers-patch", m.node.Hostname)
-	m.h.nodeNotifier.NotifyWithIgnore(
-		ctx,
-		types.UpdatePeerChanged(m.node.ID),
-		m.node.ID,
-	)
+	// A route change can change the packet filters, which nodes can see
+	// each other and the primary routes, only the nodes affected by it
+	// are sent an update, including the node itself.
+	var ev events.Event = events.NodeChanged{NodeID: m.node.ID}
+	if routesChanged {
+		ev = events.RoutesChanged{NodeID: m.node.ID}
+	}
+
+	if err := m.h.events.Publish(context.Background(), ev); err != nil {
+		m.errf(err, "Failed to send node changes")
+	}
 
 	m.w.WriteHeader(http.StatusOK)
 	mapResponseEndpointUpdates.WithLabelValues("ok").Inc()
@@ -25,6 +25,10 @@ type PrimaryRoutes struct {
 	// primaries is a map of prefixes to the node that is the primary for that prefix.
 	primaries map[netip.Prefix]types.NodeID
 	isPrimary map[types.NodeID]bool
+
+	// lowestID makes the node with the lowest ID the primary of a route,
+	// instead of keeping the current primary while it is available.
+	lowestID bool
 }
 
 func New() *PrimaryRoutes {
@@ -35,6 +39,18 @@ func New() *PrimaryRoutes {
 	}
 }
 
+// NewLowestID returns PrimaryRoutes which always choose the node with the
+// lowest ID as the primary of a route. The primaries then only depend on
+// the available routes and not on the order the nodes connected in, so
+// all instances in HA mode choose the same primaries. A node with a lower
+// ID becomes the primary again once it is available again.
+func NewLowestID() *PrimaryRoutes {
+	pr := New()
+	pr.lowestID = true
+
+	return pr
+}
+
 // updatePrimaryLocked recalculates the primary routes and updates the internal state.
 // It returns true if the primary routes have changed.
 // It is assumed that the caller holds the lock.
@@ -74,13 +90,14 @@ func (pr *PrimaryRoutes) updatePrimaryLocked() bool {
 	// If the current primary is still available, continue.
 	// If the current primary is not available, select a new one.
 	for prefix, nodes := range allPrimaries {
-		if node, ok := pr.primaries[prefix]; ok {
+		node, ok := pr.primaries[prefix]
+		if ok && !pr.lowestID {
 			// If the current primary is still available, continue.
 			if slices.Contains(nodes, node) {
 				continue
 			}
 		}
-		if len(nodes) >= 1 {
+		if len(nodes) >= 1 && (!ok || node != nodes[0]) {
 			pr.primaries[prefix] = nodes[0]
 			changed = true
 		}
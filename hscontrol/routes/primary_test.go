@@ -466,3 +466,44 @@ func TestPrimaryRoutes(t *testing.T) {
 		})
 	}
 }
+
+func TestPrimaryRoutesLowestID(t *testing.T) {
+	route := mp("192.168.1.0/24")
+
+	// Instances seeing the routers connect in different orders choose
+	// the same primary.
+	first := NewLowestID()
+	first.SetRoutes(2, route)
+	first.SetRoutes(1, route)
+	first.SetRoutes(3, route)
+
+	second := NewLowestID()
+	second.SetRoutes(3, route)
+	second.SetRoutes(2, route)
+	second.SetRoutes(1, route)
+
+	for _, pr := range []*PrimaryRoutes{first, second} {
+		if diff := cmp.Diff([]netip.Prefix{route}, pr.PrimaryRoutes(1), util.Comparers...); diff != "" {
+			t.Errorf("primary routes of node 1 mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	if !first.SetRoutes(1) {
+		t.Errorf("removing the routes of the primary did not change the primaries")
+	}
+	if diff := cmp.Diff([]netip.Prefix{route}, first.PrimaryRoutes(2), util.Comparers...); diff != "" {
+		t.Errorf("primary routes of node 2 mismatch (-want +got):\n%s", diff)
+	}
+
+	// The node with the lowest ID becomes the primary again.
+	if !first.SetRoutes(1, route) {
+		t.Errorf("adding the routes of node 1 again did not change the primaries")
+	}
+	if diff := cmp.Diff([]netip.Prefix{route}, first.PrimaryRoutes(1), util.Comparers...); diff != "" {
+		t.Errorf("primary routes of node 1 mismatch (-want +got):\n%s", diff)
+	}
+
+	if first.SetRoutes(3, route) {
+		t.Errorf("setting the same routes of node 3 changed the primaries")
+	}
+}
@@ -0,0 +1,131 @@
+package hscontrol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+// acmeChallengePrefix is the label of the ACME DNS-01 challenge record of
+// a name.
+const acmeChallengePrefix = "_acme-challenge."
+
+// NoiseSetDNSHandler publishes the DNS records nodes request, which
+// `tailscale cert` uses for the ACME DNS-01 challenge of the name of the
+// node.
+func (ns *noiseServer) NoiseSetDNSHandler(
+	writer http.ResponseWriter,
+	req *http.Request,
+) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		httpError(writer, err)
+
+		return
+	}
+
+	var setDNS tailcfg.SetDNSRequest
+	if err := json.Unmarshal(body, &setDNS); err != nil {
+		httpError(writer, NewHTTPError(http.StatusBadRequest, "invalid set-dns request", err))
+
+		return
+	}
+
+	if err := ns.headscale.setDNS(req.Context(), ns.machineKey, setDNS); err != nil {
+		httpError(writer, err)
+
+		return
+	}
+
+	respBody, err := json.Marshal(tailcfg.SetDNSResponse{})
+	if err != nil {
+		httpError(writer, err)
+
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+	writer.Write(respBody)
+}
+
+// setDNS publishes the DNS record requested by the node with the given
+// machine key with the configured DNS provider.
+func (h *Headscale) setDNS(
+	ctx context.Context,
+	machineKey key.MachinePublic,
+	setDNS tailcfg.SetDNSRequest,
+) error {
+	if h.dnsProvider == nil {
+		return NewHTTPError(http.StatusNotImplemented, "certificates are not enabled on this server", nil)
+	}
+
+	node, err := h.db.GetNodeByNodeKey(setDNS.NodeKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return NewHTTPError(http.StatusNotFound, "node not found", nil)
+		}
+
+		return err
+	}
+
+	if node.MachineKey != machineKey {
+		return NewHTTPError(http.StatusNotFound, "node not found", nil)
+	}
+
+	if err := validateSetDNS(node, h.cfg.BaseDomain, setDNS); err != nil {
+		return err
+	}
+
+	name := strings.TrimSuffix(setDNS.Name, ".")
+	if err := h.dnsProvider.SetRecord(ctx, name, setDNS.Type, setDNS.Value); err != nil {
+		return NewHTTPError(http.StatusBadGateway, "publishing DNS record failed", err)
+	}
+
+	log.Info().
+		Caller().
+		Uint64("node.id", node.ID.Uint64()).
+		Str("name", name).
+		Str("type", setDNS.Type).
+		Msg("published DNS record for node")
+
+	return nil
+}
+
+// validateSetDNS checks that the node only sets the ACME DNS-01 challenge
+// of its own name, so no node can get a certificate for the name of
+// another node.
+func validateSetDNS(node *types.Node, baseDomain string, setDNS tailcfg.SetDNSRequest) error {
+	if node.IsExpired() {
+		return NewHTTPError(http.StatusForbidden, "node is expired", nil)
+	}
+
+	fqdn, err := node.GetFQDN(baseDomain)
+	if err != nil {
+		return NewHTTPError(http.StatusForbidden, "node has no valid DNS name", err)
+	}
+
+	if setDNS.Type != "TXT" ||
+		!strings.EqualFold(strings.TrimSuffix(setDNS.Name, "."), acmeChallengePrefix+fqdn) {
+		return NewHTTPError(
+			http.StatusForbidden,
+			"nodes can only set the TXT record "+acmeChallengePrefix+fqdn,
+			nil,
+		)
+	}
+
+	if setDNS.Value == "" {
+		return NewHTTPError(http.StatusBadRequest, "missing record value", nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package hscontrol
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"gopkg.in/check.v1"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+func Test_validateSetDNS(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	node := &types.Node{GivenName: "node1"}
+
+	tests := []struct {
+		name     string
+		node     *types.Node
+		setDNS   tailcfg.SetDNSRequest
+		wantCode int
+	}{
+		{
+			name: "own-challenge",
+			node: node,
+			setDNS: tailcfg.SetDNSRequest{
+				Name:  "_acme-challenge.node1.tailnet.example.com",
+				Type:  "TXT",
+				Value: "challenge",
+			},
+		},
+		{
+			name: "own-challenge-fqdn",
+			node: node,
+			setDNS: tailcfg.SetDNSRequest{
+				Name:  "_acme-challenge.Node1.tailnet.example.com.",
+				Type:  "TXT",
+				Value: "challenge",
+			},
+		},
+		{
+			name: "other-node",
+			node: node,
+			setDNS: tailcfg.SetDNSRequest{
+				Name:  "_acme-challenge.node2.tailnet.example.com",
+				Type:  "TXT",
+				Value: "challenge",
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "not-a-challenge",
+			node: node,
+			setDNS: tailcfg.SetDNSRequest{
+				Name:  "node1.tailnet.example.com",
+				Type:  "TXT",
+				Value: "challenge",
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "other-type",
+			node: node,
+			setDNS: tailcfg.SetDNSRequest{
+				Name:  "_acme-challenge.node1.tailnet.example.com",
+				Type:  "CNAME",
+				Value: "attacker.example.org",
+			},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name: "empty-value",
+			node: node,
+			setDNS: tailcfg.SetDNSRequest{
+				Name: "_acme-challenge.node1.tailnet.example.com",
+				Type: "TXT",
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "expired",
+			node: &types.Node{GivenName: "node1", Expiry: &past},
+			setDNS: tailcfg.SetDNSRequest{
+				Name:  "_acme-challenge.node1.tailnet.example.com",
+				Type:  "TXT",
+				Value: "challenge",
+			},
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSetDNS(tt.node, "tailnet.example.com", tt.setDNS)
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Errorf("validateSetDNS() error = %v, want nil", err)
+				}
+
+				return
+			}
+
+			var httpErr HTTPError
+			if !errors.As(err, &httpErr) || httpErr.Code != tt.wantCode {
+				t.Errorf("validateSetDNS() error = %v, want status %d", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+type fakeDNSProvider struct {
+	records map[string]string
+}
+
+func (p *fakeDNSProvider) SetRecord(ctx context.Context, name, typ, value string) error {
+	p.records[name+" "+typ] = value
+
+	return nil
+}
+
+func (s *Suite) TestSetDNS(c *check.C) {
+	app.cfg.BaseDomain = "tailnet.example.com"
+
+	user, err := app.db.CreateUser(types.User{Name: "test"})
+	c.Assert(err, check.IsNil)
+
+	machineKey := key.NewMachine().Public()
+	nodeKey := key.NewNode().Public()
+	node := types.Node{
+		MachineKey:     machineKey,
+		NodeKey:        nodeKey,
+		Hostname:       "node1",
+		GivenName:      "node1",
+		UserID:         user.ID,
+		RegisterMethod: util.RegisterMethodAuthKey,
+	}
+	c.Assert(app.db.DB.Save(&node).Error, check.IsNil)
+
+	setDNS := tailcfg.SetDNSRequest{
+		NodeKey: nodeKey,
+		Name:    "_acme-challenge.node1.tailnet.example.com",
+		Type:    "TXT",
+		Value:   "challenge",
+	}
+
+	// Without a DNS provider, nodes cannot get certificates.
+	err = app.setDNS(context.Background(), machineKey, setDNS)
+	c.Assert(err, check.NotNil)
+
+	provider := &fakeDNSProvider{records: make(map[string]string)}
+	app.dnsProvider = provider
+
+	err = app.setDNS(context.Background(), machineKey, setDNS)
+	c.Assert(err, check.IsNil)
+	c.Assert(provider.records, check.DeepEquals, map[string]string{
+		"_acme-challenge.node1.tailnet.example.com TXT": "challenge",
+	})
+
+	// Only the node itself can set its challenge.
+	err = app.setDNS(context.Background(), key.NewMachine().Public(), setDNS)
+	c.Assert(err, check.NotNil)
+}
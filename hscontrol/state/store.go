@@ -0,0 +1,144 @@
+package state
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+)
+
+// Store holds the nodes and users of headscale in memory. It is read by
+// the mapper, the poll sessions and the policy manager instead of querying
+// the database for every map response.
+// The database stays the persistent storage, every write to a node or user
+// in the database must be followed by the matching write to the Store.
+type Store struct {
+	mu sync.RWMutex
+
+	nodes map[types.NodeID]*types.Node
+	users map[types.UserID]types.User
+}
+
+// New returns a Store holding the given users and nodes, typically
+// everything loaded from the database at startup.
+func New(users []types.User, nodes types.Nodes) *Store {
+	s := &Store{
+		nodes: make(map[types.NodeID]*types.Node, len(nodes)),
+		users: make(map[types.UserID]types.User, len(users)),
+	}
+
+	for _, user := range users {
+		s.users[types.UserID(user.ID)] = user
+	}
+
+	for _, node := range nodes {
+		s.nodes[node.ID] = node.Clone()
+	}
+
+	return s
+}
+
+// Node returns a copy of the node with the given ID.
+func (s *Store) Node(id types.NodeID) (*types.Node, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	node, ok := s.nodes[id]
+	if !ok {
+		return nil, false
+	}
+
+	return node.Clone(), true
+}
+
+// Nodes returns a copy of all nodes, ordered by ID.
+func (s *Store) Nodes() types.Nodes {
+	return s.nodesExcept(0)
+}
+
+// Peers returns a copy of all nodes except the given node, ordered by
+// ID, regardless of any policy or if the nodes are expired.
+func (s *Store) Peers(id types.NodeID) types.Nodes {
+	return s.nodesExcept(id)
+}
+
+func (s *Store) nodesExcept(id types.NodeID) types.Nodes {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nodes := make(types.Nodes, 0, len(s.nodes))
+	for nodeID, node := range s.nodes {
+		if nodeID == id {
+			continue
+		}
+
+		nodes = append(nodes, node.Clone())
+	}
+
+	slices.SortFunc(nodes, func(a, b *types.Node) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return nodes
+}
+
+// PutNode adds or replaces the node in the store with a copy of node.
+func (s *Store) PutNode(node *types.Node) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nodes[node.ID] = node.Clone()
+}
+
+// DeleteNode removes the node with the given ID from the store.
+func (s *Store) DeleteNode(id types.NodeID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.nodes, id)
+}
+
+// Users returns all users, ordered by ID.
+func (s *Store) Users() []types.User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]types.User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+
+	slices.SortFunc(users, func(a, b types.User) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return users
+}
+
+// PutUser adds or replaces the user in the store. The user of the nodes
+// belonging to it is updated too.
+func (s *Store) PutUser(user types.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[types.UserID(user.ID)] = user
+
+	for _, node := range s.nodes {
+		if node.UserID == user.ID {
+			node.User = user
+		}
+
+		if node.AuthKey != nil && node.AuthKey.UserID == user.ID {
+			node.AuthKey.User = user
+		}
+	}
+}
+
+// DeleteUser removes the user with the given ID from the store.
+func (s *Store) DeleteUser(id types.UserID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.users, id)
+}
@@ -0,0 +1,100 @@
+package state
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"tailscale.com/tailcfg"
+)
+
+func ap(ipStr string) *netip.Addr {
+	ip := netip.MustParseAddr(ipStr)
+	return &ip
+}
+
+func nodeIDs(nodes types.Nodes) []types.NodeID {
+	ids := make([]types.NodeID, len(nodes))
+	for i, node := range nodes {
+		ids[i] = node.ID
+	}
+
+	return ids
+}
+
+func TestStore(t *testing.T) {
+	users := []types.User{
+		{Model: gorm.Model{ID: 2}, Name: "user2"},
+		{Model: gorm.Model{ID: 1}, Name: "user1"},
+	}
+
+	nodes := types.Nodes{
+		{ID: 3, IPv4: ap("100.64.0.3"), UserID: 2, User: users[0]},
+		{ID: 1, IPv4: ap("100.64.0.1"), UserID: 1, User: users[1]},
+		{ID: 2, IPv4: ap("100.64.0.2"), UserID: 1, User: users[1]},
+	}
+
+	s := New(users, nodes)
+
+	assert.Equal(t, []types.NodeID{1, 2, 3}, nodeIDs(s.Nodes()))
+	assert.Equal(t, []types.NodeID{1, 3}, nodeIDs(s.Peers(2)))
+
+	gotUsers := s.Users()
+	require.Len(t, gotUsers, 2)
+	assert.Equal(t, "user1", gotUsers[0].Name)
+	assert.Equal(t, "user2", gotUsers[1].Name)
+
+	node, ok := s.Node(1)
+	require.True(t, ok)
+	assert.Equal(t, "100.64.0.1", node.IPv4.String())
+
+	_, ok = s.Node(4)
+	assert.False(t, ok)
+
+	// Changes to nodes read from, or written to, the store must not
+	// change the store until they are put.
+	node.Hostinfo = &tailcfg.Hostinfo{Hostname: "changed"}
+	nodes[1].Hostname = "changed"
+
+	node, ok = s.Node(1)
+	require.True(t, ok)
+	assert.Nil(t, node.Hostinfo)
+	assert.Empty(t, node.Hostname)
+
+	node.Hostinfo = &tailcfg.Hostinfo{Hostname: "node1"}
+	s.PutNode(node)
+
+	node, ok = s.Node(1)
+	require.True(t, ok)
+	assert.Equal(t, "node1", node.Hostinfo.Hostname)
+
+	s.PutNode(&types.Node{ID: 4, IPv4: ap("100.64.0.4"), UserID: 2, User: users[0]})
+	assert.Equal(t, []types.NodeID{1, 2, 3, 4}, nodeIDs(s.Nodes()))
+
+	s.DeleteNode(2)
+	assert.Equal(t, []types.NodeID{1, 3, 4}, nodeIDs(s.Nodes()))
+
+	// Renaming a user changes the user of its nodes.
+	s.PutUser(types.User{Model: gorm.Model{ID: 2}, Name: "renamed"})
+
+	for _, id := range []types.NodeID{3, 4} {
+		node, ok := s.Node(id)
+		require.True(t, ok)
+		assert.Equal(t, "renamed", node.User.Name)
+	}
+
+	node, ok = s.Node(1)
+	require.True(t, ok)
+	assert.Equal(t, "user1", node.User.Name)
+
+	s.PutUser(types.User{Model: gorm.Model{ID: 3}, Name: "user3"})
+	s.DeleteUser(1)
+
+	gotUsers = s.Users()
+	require.Len(t, gotUsers, 2)
+	assert.Equal(t, "renamed", gotUsers[0].Name)
+	assert.Equal(t, "user3", gotUsers[1].Name)
+}
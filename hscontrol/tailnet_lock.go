@@ -0,0 +1,650 @@
+package hscontrol
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/events"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tka"
+	"tailscale.com/types/key"
+	"tailscale.com/types/tkatype"
+)
+
+var (
+	errTailnetLockNotEnabled = NewHTTPError(
+		http.StatusBadRequest,
+		types.ErrTailnetLockNotEnabled.Error(),
+		nil,
+	)
+	errTailnetLockAlreadyEnabled = NewHTTPError(
+		http.StatusConflict,
+		types.ErrTailnetLockAlreadyEnabled.Error(),
+		nil,
+	)
+)
+
+// noiseJSONHandler returns the handler of a Noise RPC with a JSON request
+// and response, like the tailnet lock RPCs.
+func noiseJSONHandler[Req, Resp any](
+	ns *noiseServer,
+	fn func(ctx context.Context, machineKey key.MachinePublic, req Req) (*Resp, error),
+) http.HandlerFunc {
+	return func(writer http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			httpError(writer, err)
+
+			return
+		}
+
+		var rpcReq Req
+		if err := json.Unmarshal(body, &rpcReq); err != nil {
+			httpError(writer, NewHTTPError(http.StatusBadRequest, "invalid request", err))
+
+			return
+		}
+
+		resp, err := fn(req.Context(), ns.machineKey, rpcReq)
+		if err != nil {
+			httpError(writer, err)
+
+			return
+		}
+
+		writeJSON(writer, resp)
+	}
+}
+
+// tailnetLockNode returns the node sending a tailnet lock RPC.
+func (h *Headscale) tailnetLockNode(machineKey key.MachinePublic, nodeKey key.NodePublic) (*types.Node, error) {
+	node, err := h.db.GetNodeByNodeKey(nodeKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewHTTPError(http.StatusNotFound, "node not found", nil)
+		}
+
+		return nil, err
+	}
+
+	if node.MachineKey != machineKey {
+		return nil, NewHTTPError(http.StatusNotFound, "node not found", nil)
+	}
+
+	return node, nil
+}
+
+// openTailnetLock opens the authority stored in the database, it returns
+// errTailnetLockNotEnabled if tailnet lock is not enabled.
+func openTailnetLock(tx *gorm.DB) (*tka.Authority, *db.TailnetLockStorage, error) {
+	return openTailnetLockState(tx, db.GetTailnetLockState)
+}
+
+// lockTailnetLock is like openTailnetLock, but locks the state of tailnet
+// lock until the end of the write transaction, so changes to the authority
+// made by the headscale instances sharing the database are serialised.
+func lockTailnetLock(tx *gorm.DB) (*tka.Authority, *db.TailnetLockStorage, error) {
+	return openTailnetLockState(tx, db.LockTailnetLockState)
+}
+
+func openTailnetLockState(
+	tx *gorm.DB,
+	getState func(*gorm.DB) (*types.TailnetLockState, error),
+) (*tka.Authority, *db.TailnetLockStorage, error) {
+	state, err := getState(tx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errTailnetLockNotEnabled
+		}
+
+		return nil, nil, err
+	}
+
+	if !state.Enabled {
+		return nil, nil, errTailnetLockNotEnabled
+	}
+
+	storage := db.NewTailnetLockStorage(tx)
+	authority, err := tka.Open(storage)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening tailnet key authority: %w", err)
+	}
+
+	return authority, storage, nil
+}
+
+// tailnetLockInfo returns the state of tailnet lock sent to the nodes,
+// nil if tailnet lock was never initialised.
+func tailnetLockInfo(tx *gorm.DB) (*tailcfg.TKAInfo, error) {
+	state, err := db.GetTailnetLockState(tx)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if !state.Enabled {
+		return &tailcfg.TKAInfo{Disabled: true}, nil
+	}
+
+	authority, _, err := openTailnetLock(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := authority.Head().MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tailcfg.TKAInfo{Head: string(head)}, nil
+}
+
+// publishTailnetLockChanged sends the new state of tailnet lock to the
+// nodes, with the nodes whose signature changed.
+func (h *Headscale) publishTailnetLockChanged(ctx context.Context, signed ...types.NodeID) error {
+	info, err := db.Read(h.db.DB, tailnetLockInfo)
+	if err != nil {
+		return err
+	}
+
+	evs := []events.Event{events.TailnetLockChanged{Info: info}}
+	for _, id := range signed {
+		if err := h.refreshStoreNode(id); err != nil {
+			return err
+		}
+		evs = append(evs, events.NodeSignatureChanged{NodeID: id})
+	}
+
+	return h.events.Publish(ctx, evs...)
+}
+
+func parseAUMs(marshaled []tkatype.MarshaledAUM) ([]tka.AUM, error) {
+	aums := make([]tka.AUM, len(marshaled))
+	for i, data := range marshaled {
+		if err := aums[i].Unserialize(data); err != nil {
+			return nil, NewHTTPError(http.StatusBadRequest, "invalid AUM", err)
+		}
+	}
+
+	return aums, nil
+}
+
+func toSyncOffer(head string, ancestors []string) (tka.SyncOffer, error) {
+	var offer tka.SyncOffer
+	if err := offer.Head.UnmarshalText([]byte(head)); err != nil {
+		return tka.SyncOffer{}, NewHTTPError(http.StatusBadRequest, "invalid head", err)
+	}
+
+	offer.Ancestors = make([]tka.AUMHash, len(ancestors))
+	for i, ancestor := range ancestors {
+		if err := offer.Ancestors[i].UnmarshalText([]byte(ancestor)); err != nil {
+			return tka.SyncOffer{}, NewHTTPError(http.StatusBadRequest, "invalid ancestor", err)
+		}
+	}
+
+	return offer, nil
+}
+
+func fromSyncOffer(offer tka.SyncOffer) (string, []string, error) {
+	head, err := offer.Head.MarshalText()
+	if err != nil {
+		return "", nil, err
+	}
+
+	ancestors := make([]string, len(offer.Ancestors))
+	for i, ancestor := range offer.Ancestors {
+		hash, err := ancestor.MarshalText()
+		if err != nil {
+			return "", nil, err
+		}
+		ancestors[i] = string(hash)
+	}
+
+	return string(head), ancestors, nil
+}
+
+// tailnetLockInitBegin starts the initialisation of tailnet lock with the
+// genesis AUM of the node, and returns the node keys it has to sign.
+func (h *Headscale) tailnetLockInitBegin(
+	ctx context.Context,
+	machineKey key.MachinePublic,
+	req tailcfg.TKAInitBeginRequest,
+) (*tailcfg.TKAInitBeginResponse, error) {
+	node, err := h.tailnetLockNode(machineKey, req.NodeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var genesis tka.AUM
+	if err := genesis.Unserialize(req.GenesisAUM); err != nil {
+		return nil, NewHTTPError(http.StatusBadRequest, "invalid genesis AUM", err)
+	}
+	if _, err := tka.Bootstrap(&tka.Mem{}, genesis); err != nil {
+		return nil, NewHTTPError(http.StatusBadRequest, "invalid genesis AUM", err)
+	}
+
+	pending := types.TailnetLockInit{
+		NodeID:     node.ID,
+		GenesisAUM: req.GenesisAUM,
+	}
+
+	var resp tailcfg.TKAInitBeginResponse
+	for _, n := range h.store.Nodes() {
+		pending.Nodes = append(pending.Nodes, n.ID)
+		resp.NeedSignatures = append(resp.NeedSignatures, tailcfg.TKASignInfo{
+			NodeID:     n.ID.NodeID(),
+			NodePublic: n.NodeKey,
+		})
+	}
+
+	err = h.db.Write(func(tx *gorm.DB) error {
+		// The initialisation is stored first, which waits for one being
+		// finished meanwhile, so tailnet lock is seen enabled below.
+		if err := db.SetTailnetLockInit(tx, pending); err != nil {
+			return err
+		}
+
+		state, err := db.LockTailnetLockState(tx)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if state != nil && state.Enabled {
+			return errTailnetLockAlreadyEnabled
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// tailnetLockInitFinish enables tailnet lock with the genesis AUM from
+// tailnetLockInitBegin, once the node signed the node keys of all nodes.
+func (h *Headscale) tailnetLockInitFinish(
+	ctx context.Context,
+	machineKey key.MachinePublic,
+	req tailcfg.TKAInitFinishRequest,
+) (*tailcfg.TKAInitFinishResponse, error) {
+	node, err := h.tailnetLockNode(machineKey, req.NodeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var signatures map[types.NodeID][]byte
+	err = h.db.Write(func(tx *gorm.DB) error {
+		pending, err := db.LockTailnetLockInit(tx)
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && pending.NodeID != node.ID) {
+			return NewHTTPError(http.StatusBadRequest, "no tailnet lock initialisation in progress", nil)
+		} else if err != nil {
+			return err
+		}
+
+		var genesis tka.AUM
+		if err := genesis.Unserialize(pending.GenesisAUM); err != nil {
+			return NewHTTPError(http.StatusBadRequest, "invalid genesis AUM", err)
+		}
+
+		authority, err := tka.Bootstrap(&tka.Mem{}, genesis)
+		if err != nil {
+			return NewHTTPError(http.StatusBadRequest, "invalid genesis AUM", err)
+		}
+
+		// Nodes which were deleted since do not need a signature anymore.
+		signatures = make(map[types.NodeID][]byte, len(pending.Nodes))
+		for _, id := range pending.Nodes {
+			n, ok := h.store.Node(id)
+			if !ok {
+				continue
+			}
+
+			sig, ok := req.Signatures[id.NodeID()]
+			if !ok {
+				return NewHTTPError(http.StatusBadRequest, fmt.Sprintf("missing signature for node %d", id), nil)
+			}
+
+			if err := authority.NodeKeyAuthorized(n.NodeKey, sig); err != nil {
+				return NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid signature for node %d", id), err)
+			}
+			signatures[id] = sig
+		}
+
+		if _, err := db.LockTailnetLockState(tx); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err := db.InitTailnetLock(tx); err != nil {
+			return err
+		}
+
+		if _, err := tka.Bootstrap(db.NewTailnetLockStorage(tx), genesis); err != nil {
+			return fmt.Errorf("bootstrapping tailnet key authority: %w", err)
+		}
+
+		for id, sig := range signatures {
+			if err := db.NodeSetKeySignature(tx, id, sig); err != nil {
+				return err
+			}
+		}
+
+		return db.DeleteTailnetLockInit(tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Signatures of earlier initialisations were removed.
+	var signed []types.NodeID
+	for _, n := range h.store.Nodes() {
+		if len(n.KeySignature) > 0 || signatures[n.ID] != nil {
+			signed = append(signed, n.ID)
+		}
+	}
+
+	log.Info().
+		Caller().
+		Uint64("node.id", node.ID.Uint64()).
+		Int("signatures", len(signatures)).
+		Msg("tailnet lock enabled")
+
+	if err := h.publishTailnetLockChanged(ctx, signed...); err != nil {
+		return nil, err
+	}
+
+	return &tailcfg.TKAInitFinishResponse{}, nil
+}
+
+// tailnetLockBootstrap returns the genesis AUM when tailnet lock is
+// enabled, and the disablement secret when it was disabled.
+func (h *Headscale) tailnetLockBootstrap(
+	ctx context.Context,
+	machineKey key.MachinePublic,
+	req tailcfg.TKABootstrapRequest,
+) (*tailcfg.TKABootstrapResponse, error) {
+	if _, err := h.tailnetLockNode(machineKey, req.NodeKey); err != nil {
+		return nil, err
+	}
+
+	return db.Read(h.db.DB, func(rx *gorm.DB) (*tailcfg.TKABootstrapResponse, error) {
+		state, err := db.GetTailnetLockState(rx)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &tailcfg.TKABootstrapResponse{}, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if !state.Enabled {
+			return &tailcfg.TKABootstrapResponse{DisablementSecret: state.DisablementSecret}, nil
+		}
+
+		storage := db.NewTailnetLockStorage(rx)
+		ancestor, err := storage.LastActiveAncestor()
+		if err != nil {
+			return nil, err
+		}
+		if ancestor == nil {
+			return nil, errors.New("tailnet key authority has no active ancestor")
+		}
+
+		genesis, err := storage.AUM(*ancestor)
+		if err != nil {
+			return nil, fmt.Errorf("reading genesis AUM: %w", err)
+		}
+
+		return &tailcfg.TKABootstrapResponse{GenesisAUM: genesis.Serialize()}, nil
+	})
+}
+
+// tailnetLockSyncOffer compares the authority of the node with the one
+// of headscale, and returns the AUMs the node is missing.
+func (h *Headscale) tailnetLockSyncOffer(
+	ctx context.Context,
+	machineKey key.MachinePublic,
+	req tailcfg.TKASyncOfferRequest,
+) (*tailcfg.TKASyncOfferResponse, error) {
+	if _, err := h.tailnetLockNode(machineKey, req.NodeKey); err != nil {
+		return nil, err
+	}
+
+	nodeOffer, err := toSyncOffer(req.Head, req.Ancestors)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.Read(h.db.DB, func(rx *gorm.DB) (*tailcfg.TKASyncOfferResponse, error) {
+		authority, storage, err := openTailnetLock(rx)
+		if err != nil {
+			return nil, err
+		}
+
+		offer, err := authority.SyncOffer(storage)
+		if err != nil {
+			return nil, err
+		}
+
+		missing, err := authority.MissingAUMs(storage, nodeOffer)
+		if err != nil {
+			return nil, fmt.Errorf("computing missing AUMs: %w", err)
+		}
+
+		var resp tailcfg.TKASyncOfferResponse
+		resp.Head, resp.Ancestors, err = fromSyncOffer(offer)
+		if err != nil {
+			return nil, err
+		}
+		for _, aum := range missing {
+			resp.MissingAUMs = append(resp.MissingAUMs, aum.Serialize())
+		}
+
+		return &resp, nil
+	})
+}
+
+// tailnetLockSyncSend applies the AUMs headscale is missing, made by the
+// node for example when trusting another key.
+func (h *Headscale) tailnetLockSyncSend(
+	ctx context.Context,
+	machineKey key.MachinePublic,
+	req tailcfg.TKASyncSendRequest,
+) (*tailcfg.TKASyncSendResponse, error) {
+	node, err := h.tailnetLockNode(machineKey, req.NodeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	aums, err := parseAUMs(req.MissingAUMs)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed bool
+	head, err := db.Write(h.db.DB, func(tx *gorm.DB) (tka.AUMHash, error) {
+		authority, storage, err := lockTailnetLock(tx)
+		if err != nil {
+			return tka.AUMHash{}, err
+		}
+
+		if len(aums) == 0 {
+			return authority.Head(), nil
+		}
+
+		before := authority.Head()
+		if err := authority.Inform(storage, aums); err != nil {
+			return tka.AUMHash{}, NewHTTPError(http.StatusBadRequest, "applying AUMs failed", err)
+		}
+		changed = authority.Head() != before
+
+		return authority.Head(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		log.Info().
+			Caller().
+			Uint64("node.id", node.ID.Uint64()).
+			Str("head", head.String()).
+			Msg("tailnet lock updated")
+
+		if err := h.publishTailnetLockChanged(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	headText, err := head.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tailcfg.TKASyncSendResponse{Head: string(headText)}, nil
+}
+
+// tailnetLockDisable disables tailnet lock for all nodes, with the
+// disablement secret generated when it was initialised.
+func (h *Headscale) tailnetLockDisable(
+	ctx context.Context,
+	machineKey key.MachinePublic,
+	req tailcfg.TKADisableRequest,
+) (*tailcfg.TKADisableResponse, error) {
+	node, err := h.tailnetLockNode(machineKey, req.NodeKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.db.Write(func(tx *gorm.DB) error {
+		authority, _, err := lockTailnetLock(tx)
+		if err != nil {
+			return err
+		}
+
+		if !authority.ValidDisablement(req.DisablementSecret) {
+			return NewHTTPError(http.StatusForbidden, "invalid disablement secret", nil)
+		}
+
+		return db.DisableTailnetLock(tx, req.DisablementSecret)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Caller().
+		Uint64("node.id", node.ID.Uint64()).
+		Msg("tailnet lock disabled")
+
+	if err := h.publishTailnetLockChanged(ctx); err != nil {
+		return nil, err
+	}
+
+	return &tailcfg.TKADisableResponse{}, nil
+}
+
+// tailnetLockSign saves the signature of a node key made with a trusted
+// key, for example when a new node is added to a locked tailnet.
+func (h *Headscale) tailnetLockSign(
+	ctx context.Context,
+	machineKey key.MachinePublic,
+	req tailcfg.TKASubmitSignatureRequest,
+) (*tailcfg.TKASubmitSignatureResponse, error) {
+	if _, err := h.tailnetLockNode(machineKey, req.NodeKey); err != nil {
+		return nil, err
+	}
+
+	var sig tka.NodeKeySignature
+	if err := sig.Unserialize(req.Signature); err != nil {
+		return nil, NewHTTPError(http.StatusBadRequest, "invalid signature", err)
+	}
+
+	var nodeKey key.NodePublic
+	if err := nodeKey.UnmarshalBinary(sig.Pubkey); err != nil {
+		return nil, NewHTTPError(http.StatusBadRequest, "signature does not sign a node key", err)
+	}
+
+	signed, err := h.db.GetNodeByNodeKey(nodeKey)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, NewHTTPError(http.StatusNotFound, "signed node not found", nil)
+		}
+
+		return nil, err
+	}
+
+	err = h.db.Write(func(tx *gorm.DB) error {
+		authority, _, err := lockTailnetLock(tx)
+		if err != nil {
+			return err
+		}
+
+		if err := authority.NodeKeyAuthorized(nodeKey, req.Signature); err != nil {
+			return NewHTTPError(http.StatusBadRequest, "signature is not trusted", err)
+		}
+
+		return db.NodeSetKeySignature(tx, signed.ID, req.Signature)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Caller().
+		Uint64("node.id", signed.ID.Uint64()).
+		Msg("node key signed for tailnet lock")
+
+	if err := h.refreshStoreNode(signed.ID); err != nil {
+		return nil, err
+	}
+
+	if err := h.events.Publish(ctx, events.NodeSignatureChanged{NodeID: signed.ID}); err != nil {
+		return nil, err
+	}
+
+	return &tailcfg.TKASubmitSignatureResponse{}, nil
+}
+
+// tailnetLockAffectedSigs returns the signatures made with the given
+// key, which have to be resigned before the key can be removed.
+func (h *Headscale) tailnetLockAffectedSigs(
+	ctx context.Context,
+	machineKey key.MachinePublic,
+	req tailcfg.TKASignaturesUsingKeyRequest,
+) (*tailcfg.TKASignaturesUsingKeyResponse, error) {
+	if _, err := h.tailnetLockNode(machineKey, req.NodeKey); err != nil {
+		return nil, err
+	}
+
+	var resp tailcfg.TKASignaturesUsingKeyResponse
+	for _, n := range h.store.Nodes() {
+		if len(n.KeySignature) == 0 {
+			continue
+		}
+
+		var sig tka.NodeKeySignature
+		if err := sig.Unserialize(n.KeySignature); err != nil {
+			continue
+		}
+
+		keyID, err := sig.UnverifiedAuthorizingKeyID()
+		if err != nil {
+			continue
+		}
+
+		if bytes.Equal(keyID, req.KeyID) {
+			resp.Signatures = append(resp.Signatures, n.KeySignature)
+		}
+	}
+
+	return &resp, nil
+}
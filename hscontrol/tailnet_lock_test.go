@@ -0,0 +1,286 @@
+package hscontrol
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/juanfont/headscale/hscontrol/db"
+	"github.com/juanfont/headscale/hscontrol/types"
+	"github.com/juanfont/headscale/hscontrol/util"
+	"gopkg.in/check.v1"
+	"gorm.io/gorm"
+	"tailscale.com/tailcfg"
+	"tailscale.com/tka"
+	"tailscale.com/types/key"
+	"tailscale.com/types/tkatype"
+)
+
+func TestSyncOfferRoundTrip(t *testing.T) {
+	nlPriv := key.NewNLPrivate()
+	storage := &tka.Mem{}
+	authority, _, err := tka.Create(storage, tka.State{
+		Keys: []tka.Key{{Kind: tka.Key25519, Public: nlPriv.Public().Verifier(), Votes: 1}},
+		DisablementSecrets: [][]byte{
+			tka.DisablementKDF(bytes.Repeat([]byte{1}, 32)),
+		},
+	}, nlPriv)
+	if err != nil {
+		t.Fatalf("creating authority: %s", err)
+	}
+
+	offer, err := authority.SyncOffer(storage)
+	if err != nil {
+		t.Fatalf("SyncOffer() error = %s", err)
+	}
+
+	head, ancestors, err := fromSyncOffer(offer)
+	if err != nil {
+		t.Fatalf("fromSyncOffer() error = %s", err)
+	}
+
+	got, err := toSyncOffer(head, ancestors)
+	if err != nil {
+		t.Fatalf("toSyncOffer() error = %s", err)
+	}
+
+	if got.Head != offer.Head || len(got.Ancestors) != len(offer.Ancestors) {
+		t.Errorf("toSyncOffer() = %v, want %v", got, offer)
+	}
+
+	if _, err := toSyncOffer("invalid", nil); err == nil {
+		t.Error("toSyncOffer() of an invalid head did not fail")
+	}
+}
+
+// tailnetLockTestNode is a node of the tailnet lock tests, as registered
+// by the client.
+type tailnetLockTestNode struct {
+	machineKey key.MachinePublic
+	nodeKey    key.NodePublic
+	node       *types.Node
+}
+
+func createTailnetLockTestNode(c *check.C, user *types.User, hostname string) tailnetLockTestNode {
+	n := tailnetLockTestNode{
+		machineKey: key.NewMachine().Public(),
+		nodeKey:    key.NewNode().Public(),
+	}
+	n.node = &types.Node{
+		MachineKey:     n.machineKey,
+		NodeKey:        n.nodeKey,
+		Hostname:       hostname,
+		GivenName:      hostname,
+		UserID:         user.ID,
+		RegisterMethod: util.RegisterMethodAuthKey,
+	}
+	c.Assert(app.db.DB.Save(n.node).Error, check.IsNil)
+	c.Assert(app.refreshStoreNode(n.node.ID), check.IsNil)
+
+	return n
+}
+
+// signNodeKey signs the node key the way the clients do.
+func signNodeKey(c *check.C, nodeKey key.NodePublic, signer key.NLPrivate) tkatype.MarshaledSignature {
+	pubkey, err := nodeKey.MarshalBinary()
+	c.Assert(err, check.IsNil)
+
+	sig := tka.NodeKeySignature{
+		SigKind: tka.SigDirect,
+		KeyID:   signer.KeyID(),
+		Pubkey:  pubkey,
+	}
+	sig.Signature, err = signer.SignNKS(sig.SigHash())
+	c.Assert(err, check.IsNil)
+
+	return sig.Serialize()
+}
+
+func (s *Suite) TestTailnetLock(c *check.C) {
+	ctx := context.Background()
+
+	user, err := app.db.CreateUser(types.User{Name: "test"})
+	c.Assert(err, check.IsNil)
+
+	laptop := createTailnetLockTestNode(c, user, "laptop")
+	server := createTailnetLockTestNode(c, user, "server")
+
+	info, err := db.Read(app.db.DB, tailnetLockInfo)
+	c.Assert(err, check.IsNil)
+	c.Assert(info, check.IsNil)
+
+	// The laptop initialises tailnet lock with its key as the trusted key.
+	nlPriv := key.NewNLPrivate()
+	secret := bytes.Repeat([]byte{1}, 32)
+	clientStorage := &tka.Mem{}
+	clientAuthority, genesis, err := tka.Create(clientStorage, tka.State{
+		Keys:               []tka.Key{{Kind: tka.Key25519, Public: nlPriv.Public().Verifier(), Votes: 1}},
+		DisablementSecrets: [][]byte{tka.DisablementKDF(secret)},
+	}, nlPriv)
+	c.Assert(err, check.IsNil)
+
+	begin, err := app.tailnetLockInitBegin(ctx, laptop.machineKey, tailcfg.TKAInitBeginRequest{
+		NodeKey:    laptop.nodeKey,
+		GenesisAUM: genesis.Serialize(),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(begin.NeedSignatures, check.DeepEquals, []tailcfg.TKASignInfo{
+		{NodeID: laptop.node.ID.NodeID(), NodePublic: laptop.nodeKey},
+		{NodeID: server.node.ID.NodeID(), NodePublic: server.nodeKey},
+	})
+
+	// The initialisation is stored, so it can be finished through any
+	// instance sharing the database.
+	var pending types.TailnetLockInit
+	c.Assert(app.db.DB.First(&pending).Error, check.IsNil)
+	c.Assert(pending.NodeID, check.Equals, laptop.node.ID)
+	c.Assert(pending.Nodes, check.DeepEquals, []types.NodeID{laptop.node.ID, server.node.ID})
+
+	// All nodes must be signed.
+	_, err = app.tailnetLockInitFinish(ctx, laptop.machineKey, tailcfg.TKAInitFinishRequest{
+		NodeKey: laptop.nodeKey,
+		Signatures: map[tailcfg.NodeID]tkatype.MarshaledSignature{
+			laptop.node.ID.NodeID(): signNodeKey(c, laptop.nodeKey, nlPriv),
+		},
+	})
+	c.Assert(err, check.NotNil)
+
+	// Signatures must be made with a trusted key.
+	_, err = app.tailnetLockInitFinish(ctx, laptop.machineKey, tailcfg.TKAInitFinishRequest{
+		NodeKey: laptop.nodeKey,
+		Signatures: map[tailcfg.NodeID]tkatype.MarshaledSignature{
+			laptop.node.ID.NodeID(): signNodeKey(c, laptop.nodeKey, nlPriv),
+			server.node.ID.NodeID(): signNodeKey(c, server.nodeKey, key.NewNLPrivate()),
+		},
+	})
+	c.Assert(err, check.NotNil)
+
+	_, err = app.tailnetLockInitFinish(ctx, laptop.machineKey, tailcfg.TKAInitFinishRequest{
+		NodeKey: laptop.nodeKey,
+		Signatures: map[tailcfg.NodeID]tkatype.MarshaledSignature{
+			laptop.node.ID.NodeID(): signNodeKey(c, laptop.nodeKey, nlPriv),
+			server.node.ID.NodeID(): signNodeKey(c, server.nodeKey, nlPriv),
+		},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(app.db.DB.First(&types.TailnetLockInit{}).Error, check.Equals, gorm.ErrRecordNotFound)
+
+	stored, ok := app.store.Node(server.node.ID)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(stored.KeySignature, check.NotNil)
+
+	head, err := clientAuthority.Head().MarshalText()
+	c.Assert(err, check.IsNil)
+
+	info, err = db.Read(app.db.DB, tailnetLockInfo)
+	c.Assert(err, check.IsNil)
+	c.Assert(info, check.DeepEquals, &tailcfg.TKAInfo{Head: string(head)})
+
+	_, err = app.tailnetLockInitBegin(ctx, laptop.machineKey, tailcfg.TKAInitBeginRequest{
+		NodeKey:    laptop.nodeKey,
+		GenesisAUM: genesis.Serialize(),
+	})
+	c.Assert(err, check.NotNil)
+
+	// The server joins tailnet lock with the genesis AUM.
+	bootstrap, err := app.tailnetLockBootstrap(ctx, server.machineKey, tailcfg.TKABootstrapRequest{
+		NodeKey: server.nodeKey,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(bootstrap.GenesisAUM, check.DeepEquals, genesis.Serialize())
+
+	// The laptop trusts another key, and sends the update to headscale.
+	updater := clientAuthority.NewUpdater(nlPriv)
+	c.Assert(updater.AddKey(tka.Key{Kind: tka.Key25519, Public: key.NewNLPrivate().Public().Verifier(), Votes: 1}), check.IsNil)
+	updates, err := updater.Finalize(clientStorage)
+	c.Assert(err, check.IsNil)
+	c.Assert(clientAuthority.Inform(clientStorage, updates), check.IsNil)
+
+	var marshaled []tkatype.MarshaledAUM
+	for _, aum := range updates {
+		marshaled = append(marshaled, aum.Serialize())
+	}
+
+	sent, err := app.tailnetLockSyncSend(ctx, laptop.machineKey, tailcfg.TKASyncSendRequest{
+		NodeKey:     laptop.nodeKey,
+		MissingAUMs: marshaled,
+	})
+	c.Assert(err, check.IsNil)
+
+	head, err = clientAuthority.Head().MarshalText()
+	c.Assert(err, check.IsNil)
+	c.Assert(sent.Head, check.Equals, string(head))
+
+	// The server only has the genesis AUM and gets the update.
+	serverStorage := &tka.Mem{}
+	_, err = tka.Bootstrap(serverStorage, genesis)
+	c.Assert(err, check.IsNil)
+
+	genesisHead, err := genesis.Hash().MarshalText()
+	c.Assert(err, check.IsNil)
+
+	offer, err := app.tailnetLockSyncOffer(ctx, server.machineKey, tailcfg.TKASyncOfferRequest{
+		NodeKey: server.nodeKey,
+		Head:    string(genesisHead),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(offer.Head, check.Equals, string(head))
+	c.Assert(offer.MissingAUMs, check.DeepEquals, marshaled)
+
+	// A node added later is signed by the laptop.
+	phone := createTailnetLockTestNode(c, user, "phone")
+
+	_, err = app.tailnetLockSign(ctx, laptop.machineKey, tailcfg.TKASubmitSignatureRequest{
+		NodeKey:   laptop.nodeKey,
+		Signature: signNodeKey(c, phone.nodeKey, key.NewNLPrivate()),
+	})
+	c.Assert(err, check.NotNil)
+
+	phoneSig := signNodeKey(c, phone.nodeKey, nlPriv)
+	_, err = app.tailnetLockSign(ctx, laptop.machineKey, tailcfg.TKASubmitSignatureRequest{
+		NodeKey:   laptop.nodeKey,
+		Signature: phoneSig,
+	})
+	c.Assert(err, check.IsNil)
+
+	phoneNode, err := app.db.GetNodeByID(phone.node.ID)
+	c.Assert(err, check.IsNil)
+	c.Assert([]byte(phoneNode.KeySignature), check.DeepEquals, []byte(phoneSig))
+
+	affected, err := app.tailnetLockAffectedSigs(ctx, laptop.machineKey, tailcfg.TKASignaturesUsingKeyRequest{
+		NodeKey: laptop.nodeKey,
+		KeyID:   nlPriv.KeyID(),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(affected.Signatures, check.HasLen, 3)
+
+	// Tailnet lock can only be disabled with the disablement secret.
+	_, err = app.tailnetLockDisable(ctx, laptop.machineKey, tailcfg.TKADisableRequest{
+		NodeKey:           laptop.nodeKey,
+		DisablementSecret: bytes.Repeat([]byte{2}, 32),
+	})
+	c.Assert(err, check.NotNil)
+
+	_, err = app.tailnetLockDisable(ctx, laptop.machineKey, tailcfg.TKADisableRequest{
+		NodeKey:           laptop.nodeKey,
+		DisablementSecret: secret,
+	})
+	c.Assert(err, check.IsNil)
+
+	info, err = db.Read(app.db.DB, tailnetLockInfo)
+	c.Assert(err, check.IsNil)
+	c.Assert(info, check.DeepEquals, &tailcfg.TKAInfo{Disabled: true})
+
+	// Nodes which were offline learn the secret to disable it locally.
+	bootstrap, err = app.tailnetLockBootstrap(ctx, server.machineKey, tailcfg.TKABootstrapRequest{
+		NodeKey: server.nodeKey,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(bootstrap.DisablementSecret, check.DeepEquals, secret)
+
+	// Only a node can use its node key.
+	_, err = app.tailnetLockBootstrap(ctx, key.NewMachine().Public(), tailcfg.TKABootstrapRequest{
+		NodeKey: server.nodeKey,
+	})
+	c.Assert(err, check.NotNil)
+}
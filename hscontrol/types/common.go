@@ -35,6 +35,10 @@ func (su StateUpdateType) String() string {
 		return "StateSelfUpdate"
 	case StateDERPUpdated:
 		return "StateDERPUpdated"
+	case StatePingRequest:
+		return "StatePingRequest"
+	case StateDNSUpdated:
+		return "StateDNSUpdated"
 	}
 
 	return "unknown state update type"
@@ -56,6 +60,12 @@ const (
 	// which should have a length of one.
 	StateSelfUpdate
 	StateDERPUpdated
+	// StatePingRequest is used to ask the node to answer
+	// the ping in the PingRequest field.
+	StatePingRequest
+	// StateDNSUpdated is used when the DNS configuration, e.g. the
+	// extra records, changed and has to be sent to the nodes.
+	StateDNSUpdated
 )
 
 // StateUpdate is an internal message containing information about
@@ -83,6 +93,9 @@ type StateUpdate struct {
 	// contain the new DERP Map.
 	DERPMap *tailcfg.DERPMap
 
+	// PingRequest must be set when Type is StatePingRequest.
+	PingRequest *tailcfg.PingRequest
+
 	// Additional message for tracking origin or what being
 	// updated, useful for ambiguous updates like StatePeerChanged.
 	Message string
@@ -136,6 +149,13 @@ func UpdatePeerRemoved(nodeIDs ...NodeID) StateUpdate {
 	}
 }
 
+func UpdatePing(ping *tailcfg.PingRequest) StateUpdate {
+	return StateUpdate{
+		Type:        StatePingRequest,
+		PingRequest: ping,
+	}
+}
+
 func UpdateExpire(nodeID NodeID, expiry time.Time) StateUpdate {
 	return StateUpdate{
 		Type: StatePeerChangedPatch,
@@ -43,6 +43,16 @@ const (
 	IPAllocationStrategyRandom     IPAllocationStrategy = "random"
 )
 
+// DNSCertProvider is the provider publishing the ACME DNS-01 challenge
+// records nodes request to get certificates with `tailscale cert`.
+type DNSCertProvider string
+
+const (
+	DNSCertProviderNone    DNSCertProvider = ""
+	DNSCertProviderRFC2136 DNSCertProvider = "rfc2136"
+	DNSCertProviderExec    DNSCertProvider = "exec"
+)
+
 type PolicyMode string
 
 const (
@@ -89,6 +99,12 @@ type Config struct {
 
 	OIDC OIDCConfig
 
+	IDToken IDTokenConfig
+
+	TailnetLock TailnetLockConfig
+
+	HA HAConfig
+
 	LogTail             LogTailConfig
 	RandomizeClientPort bool
 
@@ -106,6 +122,38 @@ type DNSConfig struct {
 	SearchDomains    []string            `mapstructure:"search_domains"`
 	ExtraRecords     []tailcfg.DNSRecord `mapstructure:"extra_records"`
 	ExtraRecordsPath string              `mapstructure:"extra_records_path"`
+	Certs            DNSCertsConfig      `mapstructure:"certs"`
+}
+
+// DNSCertsConfig configures how the DNS records nodes request for
+// `tailscale cert` are published.
+type DNSCertsConfig struct {
+	Provider DNSCertProvider
+	RFC2136  RFC2136Config
+	Exec     ExecDNSConfig
+}
+
+// Enabled reports if nodes can get certificates for their name.
+func (c DNSCertsConfig) Enabled() bool {
+	return c.Provider != DNSCertProviderNone
+}
+
+// RFC2136Config configures publishing DNS records with RFC 2136 dynamic
+// updates to an authoritative DNS server.
+type RFC2136Config struct {
+	Server        string
+	Zone          string
+	TSIGKey       string
+	TSIGSecret    string
+	TSIGAlgorithm string
+	TTL           time.Duration
+	Timeout       time.Duration
+}
+
+// ExecDNSConfig configures publishing DNS records by running a command.
+type ExecDNSConfig struct {
+	Command string
+	Timeout time.Duration
 }
 
 type Nameservers struct {
@@ -202,6 +250,35 @@ type DERPConfig struct {
 	IPv6                               string
 }
 
+// IDTokenConfig configures the OIDC ID tokens headscale issues to nodes
+// for workload identity.
+type IDTokenConfig struct {
+	PrivateKeyPath string
+	Expiry         time.Duration
+}
+
+// Enabled reports if nodes can request ID tokens.
+func (c IDTokenConfig) Enabled() bool {
+	return c.PrivateKeyPath != ""
+}
+
+// TailnetLockConfig configures tailnet lock, with which the nodes only
+// accept peers signed by trusted keys.
+type TailnetLockConfig struct {
+	Enabled bool
+}
+
+// HAConfig configures high-availability mode, in which several headscale
+// instances share one postgres database.
+type HAConfig struct {
+	Enabled bool
+
+	// HeartbeatInterval is how often the instances tell each other that
+	// they are alive, and try to become the leader. An instance which was
+	// not heard from for three intervals is considered gone.
+	HeartbeatInterval time.Duration
+}
+
 type LogTailConfig struct {
 	Enabled bool
 }
@@ -228,9 +305,9 @@ type LogConfig struct {
 }
 
 type Tuning struct {
-	NotifierSendTimeout            time.Duration
 	BatchChangeDelay               time.Duration
 	NodeMapSessionBufferedChanSize int
+	NodeUpdateQueueSize            int
 }
 
 func validatePKCEMethod(method string) error {
@@ -290,6 +367,11 @@ func LoadConfig(path string, isFile bool) error {
 	viper.SetDefault("dns.nameservers.global", []string{})
 	viper.SetDefault("dns.nameservers.split", map[string]string{})
 	viper.SetDefault("dns.search_domains", []string{})
+	viper.SetDefault("dns.certs.provider", "")
+	viper.SetDefault("dns.certs.rfc2136.tsig_algorithm", "hmac-sha256")
+	viper.SetDefault("dns.certs.rfc2136.ttl", "60s")
+	viper.SetDefault("dns.certs.rfc2136.timeout", "10s")
+	viper.SetDefault("dns.certs.exec.timeout", "30s")
 
 	viper.SetDefault("derp.server.enabled", false)
 	viper.SetDefault("derp.server.stun.enabled", true)
@@ -319,14 +401,21 @@ func LoadConfig(path string, isFile bool) error {
 	viper.SetDefault("oidc.pkce.enabled", false)
 	viper.SetDefault("oidc.pkce.method", "S256")
 
+	viper.SetDefault("id_token.expiry", "5m")
+
+	viper.SetDefault("tailnet_lock.enabled", false)
+
+	viper.SetDefault("ha.enabled", false)
+	viper.SetDefault("ha.heartbeat_interval", "5s")
+
 	viper.SetDefault("logtail.enabled", false)
 	viper.SetDefault("randomize_client_port", false)
 
 	viper.SetDefault("ephemeral_node_inactivity_timeout", "120s")
 
-	viper.SetDefault("tuning.notifier_send_timeout", "800ms")
 	viper.SetDefault("tuning.batch_change_delay", "800ms")
 	viper.SetDefault("tuning.node_mapsession_buffered_chan_size", 30)
+	viper.SetDefault("tuning.node_update_queue_size", 30)
 
 	viper.SetDefault("prefixes.allocation", string(IPAllocationStrategySequential))
 
@@ -377,6 +466,10 @@ func validateServerConfig() error {
 		log.Fatal().Msg("Fatal config error: dns.extra_records and dns.extra_records_path are mutually exclusive. Please remove one of them from your config file")
 	}
 
+	if err := validateDNSCertsConfig(); err != nil {
+		return err
+	}
+
 	// Collect any validation errors and return them all at once
 	var errorText string
 	if (viper.GetString("tls_letsencrypt_hostname") != "") &&
@@ -417,6 +510,16 @@ func validateServerConfig() error {
 		)
 	}
 
+	if viper.GetBool("ha.enabled") {
+		if viper.GetString("database.type") != DatabasePostgres {
+			errorText += "Fatal config error: ha.enabled requires database.type to be postgres\n"
+		}
+
+		if viper.GetDuration("ha.heartbeat_interval") <= 0 {
+			errorText += "Fatal config error: ha.heartbeat_interval must be positive\n"
+		}
+	}
+
 	if errorText != "" {
 		// nolint
 		return errors.New(strings.TrimSuffix(errorText, "\n"))
@@ -620,6 +723,7 @@ func dns() (DNSConfig, error) {
 	dns.Nameservers.Split = viper.GetStringMapStringSlice("dns.nameservers.split")
 	dns.SearchDomains = viper.GetStringSlice("dns.search_domains")
 	dns.ExtraRecordsPath = viper.GetString("dns.extra_records_path")
+	dns.Certs = dnsCerts()
 
 	if viper.IsSet("dns.extra_records") {
 		var extraRecords []tailcfg.DNSRecord
@@ -634,6 +738,63 @@ func dns() (DNSConfig, error) {
 	return dns, nil
 }
 
+func dnsCerts() DNSCertsConfig {
+	provider := DNSCertProvider(viper.GetString("dns.certs.provider"))
+	if provider == DNSCertProviderNone {
+		return DNSCertsConfig{}
+	}
+
+	return DNSCertsConfig{
+		Provider: provider,
+		RFC2136: RFC2136Config{
+			Server:        viper.GetString("dns.certs.rfc2136.server"),
+			Zone:          viper.GetString("dns.certs.rfc2136.zone"),
+			TSIGKey:       viper.GetString("dns.certs.rfc2136.tsig_key"),
+			TSIGSecret:    viper.GetString("dns.certs.rfc2136.tsig_secret"),
+			TSIGAlgorithm: viper.GetString("dns.certs.rfc2136.tsig_algorithm"),
+			TTL:           viper.GetDuration("dns.certs.rfc2136.ttl"),
+			Timeout:       viper.GetDuration("dns.certs.rfc2136.timeout"),
+		},
+		Exec: ExecDNSConfig{
+			Command: viper.GetString("dns.certs.exec.command"),
+			Timeout: viper.GetDuration("dns.certs.exec.timeout"),
+		},
+	}
+}
+
+func validateDNSCertsConfig() error {
+	certs := dnsCerts()
+
+	switch certs.Provider {
+	case DNSCertProviderNone:
+		return nil
+	case DNSCertProviderRFC2136:
+		if certs.RFC2136.Server == "" {
+			return errors.New("dns.certs.rfc2136.server must be set to use the rfc2136 provider")
+		}
+		if (certs.RFC2136.TSIGKey == "") != (certs.RFC2136.TSIGSecret == "") {
+			return errors.New("dns.certs.rfc2136.tsig_key and dns.certs.rfc2136.tsig_secret must be set together")
+		}
+	case DNSCertProviderExec:
+		if certs.Exec.Command == "" {
+			return errors.New("dns.certs.exec.command must be set to use the exec provider")
+		}
+	default:
+		return fmt.Errorf(
+			"dns.certs.provider is set to %q, which is not a valid provider, allowed options: %s, %s",
+			certs.Provider,
+			DNSCertProviderRFC2136,
+			DNSCertProviderExec,
+		)
+	}
+
+	if viper.GetString("dns.base_domain") == "" {
+		return errors.New("dns.base_domain must be set to use dns.certs, the certificates are issued for names in it")
+	}
+
+	return nil
+}
+
 // globalResolvers returns the global DNS resolvers
 // defined in the config file.
 // If a nameserver is a valid IP, it will be used as a regular resolver.
@@ -801,6 +962,17 @@ func LoadCLIConfig() (*Config, error) {
 	}, nil
 }
 
+// LoadDatabaseConfig reads the configuration file at path and returns its
+// database configuration, for commands using the databases of several
+// configurations. It replaces the configuration loaded before.
+func LoadDatabaseConfig(path string) (DatabaseConfig, error) {
+	if err := LoadConfig(path, true); err != nil {
+		return DatabaseConfig{}, err
+	}
+
+	return databaseConfig(), nil
+}
+
 // LoadServerConfig returns the full Headscale configuration to
 // host a Headscale server. This is called as part of `headscale serve`.
 func LoadServerConfig() (*Config, error) {
@@ -948,6 +1120,22 @@ func LoadServerConfig() (*Config, error) {
 			},
 		},
 
+		IDToken: IDTokenConfig{
+			PrivateKeyPath: util.AbsolutePathFromConfigPath(
+				viper.GetString("id_token.private_key_path"),
+			),
+			Expiry: viper.GetDuration("id_token.expiry"),
+		},
+
+		TailnetLock: TailnetLockConfig{
+			Enabled: viper.GetBool("tailnet_lock.enabled"),
+		},
+
+		HA: HAConfig{
+			Enabled:           viper.GetBool("ha.enabled"),
+			HeartbeatInterval: viper.GetDuration("ha.heartbeat_interval"),
+		},
+
 		LogTail:             logTailConfig,
 		RandomizeClientPort: randomizeClientPort,
 
@@ -964,11 +1152,11 @@ func LoadServerConfig() (*Config, error) {
 
 		// TODO(kradalby): Document these settings when more stable
 		Tuning: Tuning{
-			NotifierSendTimeout: viper.GetDuration("tuning.notifier_send_timeout"),
-			BatchChangeDelay:    viper.GetDuration("tuning.batch_change_delay"),
+			BatchChangeDelay: viper.GetDuration("tuning.batch_change_delay"),
 			NodeMapSessionBufferedChanSize: viper.GetInt(
 				"tuning.node_mapsession_buffered_chan_size",
 			),
+			NodeUpdateQueueSize: viper.GetInt("tuning.node_update_queue_size"),
 		},
 	}, nil
 }
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/spf13/viper"
@@ -181,6 +182,32 @@ func TestReadConfig(t *testing.T) {
 			},
 			wantErr: "",
 		},
+		{
+			name:       "dns-certs",
+			configPath: "testdata/dns-certs.yaml",
+			setup: func(t *testing.T) (any, error) {
+				cfg, err := LoadServerConfig()
+				if err != nil {
+					return nil, err
+				}
+
+				return cfg.DNSConfig.Certs, nil
+			},
+			want: DNSCertsConfig{
+				Provider: DNSCertProviderRFC2136,
+				RFC2136: RFC2136Config{
+					Server:        "ns1.derp.no",
+					TSIGKey:       "headscale",
+					TSIGSecret:    "aGVhZHNjYWxl",
+					TSIGAlgorithm: "hmac-sha256",
+					TTL:           time.Minute,
+					Timeout:       10 * time.Second,
+				},
+				Exec: ExecDNSConfig{
+					Timeout: 30 * time.Second,
+				},
+			},
+		},
 		{
 			name:       "policy-path-is-loaded",
 			configPath: "testdata/policy-path-is-loaded.yaml",
@@ -308,6 +335,48 @@ func TestReadConfigFromEnv(t *testing.T) {
 	}
 }
 
+func TestLoadDatabaseConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	sqlitePath := filepath.Join(dir, "sqlite.yaml")
+	err := os.WriteFile(sqlitePath, []byte(`---
+database:
+  type: sqlite
+  sqlite:
+    path: headscale.db
+`), 0o600)
+	require.NoError(t, err)
+
+	postgresPath := filepath.Join(dir, "postgres.yaml")
+	err = os.WriteFile(postgresPath, []byte(`---
+database:
+  type: postgres
+  postgres:
+    host: db.example.com
+    name: headscale
+    user: headscale
+`), 0o600)
+	require.NoError(t, err)
+
+	viper.Reset()
+
+	sqlite, err := LoadDatabaseConfig(sqlitePath)
+	require.NoError(t, err)
+	assert.Equal(t, DatabaseSqlite, sqlite.Type)
+	assert.Equal(t, filepath.Join(dir, "headscale.db"), sqlite.Sqlite.Path)
+
+	// The second configuration replaces the first one.
+	postgres, err := LoadDatabaseConfig(postgresPath)
+	require.NoError(t, err)
+	assert.Equal(t, DatabasePostgres, postgres.Type)
+	assert.Equal(t, "db.example.com", postgres.Postgres.Host)
+	assert.Equal(t, 10, postgres.Postgres.MaxOpenConnections)
+	assert.Empty(t, postgres.Sqlite.Path)
+
+	_, err = LoadDatabaseConfig(filepath.Join(dir, "missing.yaml"))
+	require.Error(t, err)
+}
+
 func TestTLSConfigValidation(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "headscale")
 	if err != nil {
@@ -366,6 +435,58 @@ tls_letsencrypt_challenge_type: TLS-ALPN-01
 	require.NoError(t, err)
 }
 
+func TestHAConfigValidation(t *testing.T) {
+	viper.Reset()
+	tmpDir := t.TempDir()
+	configFilePath := filepath.Join(tmpDir, "config.yaml")
+
+	configYaml := []byte(`---
+noise:
+  private_key_path: noise_private.key
+server_url: http://127.0.0.1:8080
+database:
+  type: sqlite
+ha:
+  enabled: true
+  heartbeat_interval: 0s
+`)
+	err := os.WriteFile(configFilePath, configYaml, 0o600)
+	require.NoError(t, err)
+
+	err = LoadConfig(configFilePath, true)
+	require.NoError(t, err)
+
+	err = validateServerConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Fatal config error: ha.enabled requires database.type to be postgres")
+	assert.Contains(t, err.Error(), "Fatal config error: ha.heartbeat_interval must be positive")
+
+	configYaml = []byte(`---
+noise:
+  private_key_path: noise_private.key
+server_url: http://127.0.0.1:8080
+prefixes:
+  v4: 100.64.0.0/10
+dns:
+  magic_dns: false
+database:
+  type: postgres
+ha:
+  enabled: true
+`)
+	err = os.WriteFile(configFilePath, configYaml, 0o600)
+	require.NoError(t, err)
+
+	err = LoadConfig(configFilePath, true)
+	require.NoError(t, err)
+	require.NoError(t, validateServerConfig())
+
+	cfg, err := LoadServerConfig()
+	require.NoError(t, err)
+	assert.True(t, cfg.HA.Enabled)
+	assert.Equal(t, 5*time.Second, cfg.HA.HeartbeatInterval)
+}
+
 // OK
 // server_url: headscale.com, base: clients.headscale.com
 // server_url: headscale.com, base: headscale.net
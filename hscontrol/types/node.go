@@ -3,6 +3,7 @@ package types
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"net/netip"
 	"slices"
 	"strconv"
@@ -26,6 +27,19 @@ var (
 	ErrNodeUserHasNoName    = errors.New("node user has no name")
 )
 
+// NAT types of a node, as reported in the NetInfo of its Hostinfo.
+const (
+	// NATTypeEasy is a NAT which maps the node to the same public
+	// endpoint for all destinations, direct connections work easily.
+	NATTypeEasy = "easy"
+	// NATTypeHard is a NAT which maps the node to a different public
+	// endpoint per destination, direct connections often need DERP.
+	NATTypeHard = "hard"
+	// NATTypeNoUDP is used when the node cannot use UDP at all, and can
+	// only reach its peers through DERP.
+	NATTypeNoUDP = "no-udp"
+)
+
 type NodeID uint64
 type NodeIDs []NodeID
 
@@ -105,6 +119,16 @@ type Node struct {
 	// See [Node.Hostinfo]
 	ApprovedRoutes []netip.Prefix `gorm:"column:approved_routes;serializer:json"`
 
+	// HealthWarnings are the health problems reported by the node, by
+	// health subsystem. A subsystem is removed when the node reports it
+	// healthy again.
+	HealthWarnings map[string]string `gorm:"column:health_warnings;serializer:json"`
+
+	// KeySignature is the tailnet lock signature of the node key, a
+	// serialized tka.NodeKeySignature. The nodes verify it themselves,
+	// so headscale cannot add nodes to a locked tailnet.
+	KeySignature []byte `gorm:"column:key_signature"`
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt *time.Time
@@ -114,6 +138,48 @@ type Node struct {
 
 type Nodes []*Node
 
+// Clone returns a deep copy of the node, which can be modified without
+// affecting the original.
+func (node *Node) Clone() *Node {
+	if node == nil {
+		return nil
+	}
+
+	n := *node
+	n.Endpoints = slices.Clone(node.Endpoints)
+	n.Hostinfo = node.Hostinfo.Clone()
+	n.IPv4 = clonePtr(node.IPv4)
+	n.IPv6 = clonePtr(node.IPv6)
+	n.ForcedTags = slices.Clone(node.ForcedTags)
+	n.AuthKeyID = clonePtr(node.AuthKeyID)
+	if node.AuthKey != nil {
+		authKey := *node.AuthKey
+		authKey.Tags = slices.Clone(node.AuthKey.Tags)
+		authKey.CreatedAt = clonePtr(node.AuthKey.CreatedAt)
+		authKey.Expiration = clonePtr(node.AuthKey.Expiration)
+		n.AuthKey = &authKey
+	}
+	n.Expiry = clonePtr(node.Expiry)
+	n.LastSeen = clonePtr(node.LastSeen)
+	n.ApprovedRoutes = slices.Clone(node.ApprovedRoutes)
+	n.HealthWarnings = maps.Clone(node.HealthWarnings)
+	n.KeySignature = slices.Clone(node.KeySignature)
+	n.DeletedAt = clonePtr(node.DeletedAt)
+	n.IsOnline = clonePtr(node.IsOnline)
+
+	return &n
+}
+
+func clonePtr[T any](v *T) *T {
+	if v == nil {
+		return nil
+	}
+
+	c := *v
+
+	return &c
+}
+
 // GivenNameHasBeenChanged returns whether the `givenName` can be automatically changed based on the `Hostname` of the node.
 func (node *Node) GivenNameHasBeenChanged() bool {
 	return node.GivenName == util.ConvertWithFQDNRules(node.Hostname)
@@ -337,9 +403,19 @@ func (node *Node) Proto() *v1.Node {
 
 		RegisterMethod: node.RegisterMethodToV1Enum(),
 
+		PreferredDerp: int32(node.PreferredDERP()),
+		NatType:       node.NATType(),
+
 		CreatedAt: timestamppb.New(node.CreatedAt),
 	}
 
+	for _, subsystem := range slices.Sorted(maps.Keys(node.HealthWarnings)) {
+		nodeProto.HealthWarnings = append(nodeProto.HealthWarnings, &v1.HealthWarning{
+			Subsystem: subsystem,
+			Message:   node.HealthWarnings[subsystem],
+		})
+	}
+
 	if node.AuthKey != nil {
 		nodeProto.PreAuthKey = node.AuthKey.Proto()
 	}
@@ -404,6 +480,62 @@ func (node *Node) SubnetRoutes() []netip.Prefix {
 	return routes
 }
 
+// SetHealthWarning records the health of a subsystem of the node. An
+// empty message marks the subsystem healthy and removes its warning.
+// It reports if the health of the node changed.
+func (node *Node) SetHealthWarning(subsystem, message string) bool {
+	current, ok := node.HealthWarnings[subsystem]
+	if message == "" {
+		delete(node.HealthWarnings, subsystem)
+
+		return ok
+	}
+
+	if ok && current == message {
+		return false
+	}
+
+	if node.HealthWarnings == nil {
+		node.HealthWarnings = make(map[string]string)
+	}
+	node.HealthWarnings[subsystem] = message
+
+	return true
+}
+
+// PreferredDERP returns the DERP region the node prefers, or 0 if it has
+// not reported one.
+func (node *Node) PreferredDERP() int {
+	if node.Hostinfo == nil || node.Hostinfo.NetInfo == nil {
+		return 0
+	}
+
+	return node.Hostinfo.NetInfo.PreferredDERP
+}
+
+// NATType returns the type of NAT the node is behind, one of the NATType
+// constants, or an empty string if the node has not reported it.
+func (node *Node) NATType() string {
+	if node.Hostinfo == nil || node.Hostinfo.NetInfo == nil {
+		return ""
+	}
+
+	netInfo := node.Hostinfo.NetInfo
+	if netInfo.WorkingUDP.EqualBool(false) {
+		return NATTypeNoUDP
+	}
+
+	mappingVaries, ok := netInfo.MappingVariesByDestIP.Get()
+	switch {
+	case !ok:
+		return ""
+	case mappingVaries:
+		return NATTypeHard
+	default:
+		return NATTypeEasy
+	}
+}
+
 func (node *Node) String() string {
 	return node.Hostname
 }
@@ -5,6 +5,7 @@ import (
 	"net/netip"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -553,3 +554,193 @@ func TestNodeRegisterMethodToV1Enum(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeClone(t *testing.T) {
+	ipv4 := netip.MustParseAddr("100.64.0.1")
+	expiry := time.Now()
+	node := &Node{
+		ID:             1,
+		Endpoints:      []netip.AddrPort{netip.MustParseAddrPort("192.168.0.1:41641")},
+		Hostinfo:       &tailcfg.Hostinfo{Hostname: "node", RoutableIPs: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")}},
+		IPv4:           &ipv4,
+		ForcedTags:     []string{"tag:server"},
+		AuthKey:        &PreAuthKey{ID: 1, Tags: []string{"tag:server"}},
+		Expiry:         &expiry,
+		ApprovedRoutes: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/24")},
+		HealthWarnings: map[string]string{"dns": "failing"},
+		KeySignature:   []byte{1, 2, 3},
+		User:           User{Name: "user1"},
+	}
+
+	clone := node.Clone()
+	if diff := cmp.Diff(node, clone, util.Comparers...); diff != "" {
+		t.Fatalf("Clone() unexpected result (-want +got):\n%s", diff)
+	}
+
+	clone.Endpoints[0] = netip.MustParseAddrPort("192.168.0.2:41641")
+	clone.Hostinfo.Hostname = "changed"
+	*clone.IPv4 = netip.MustParseAddr("100.64.0.2")
+	clone.ForcedTags[0] = "tag:changed"
+	clone.AuthKey.Tags[0] = "tag:changed"
+	*clone.Expiry = expiry.Add(time.Hour)
+	clone.ApprovedRoutes[0] = netip.MustParsePrefix("10.1.0.0/24")
+	clone.HealthWarnings["dns"] = "changed"
+	clone.KeySignature[0] = 9
+	clone.User.Name = "changed"
+
+	if node.Endpoints[0].String() != "192.168.0.1:41641" ||
+		node.Hostinfo.Hostname != "node" ||
+		node.IPv4.String() != "100.64.0.1" ||
+		node.ForcedTags[0] != "tag:server" ||
+		node.AuthKey.Tags[0] != "tag:server" ||
+		!node.Expiry.Equal(expiry) ||
+		node.ApprovedRoutes[0].String() != "10.0.0.0/24" ||
+		node.HealthWarnings["dns"] != "failing" ||
+		node.KeySignature[0] != 1 ||
+		node.User.Name != "user1" {
+		t.Errorf("modifying the clone changed the original node: %+v", node)
+	}
+
+	if (*Node)(nil).Clone() != nil {
+		t.Errorf("Clone() of nil node should be nil")
+	}
+}
+
+func TestNodeSetHealthWarning(t *testing.T) {
+	node := &Node{}
+
+	steps := []struct {
+		subsystem   string
+		message     string
+		wantChanged bool
+		want        map[string]string
+	}{
+		{
+			subsystem:   "dns",
+			message:     "failing",
+			wantChanged: true,
+			want:        map[string]string{"dns": "failing"},
+		},
+		{
+			subsystem:   "dns",
+			message:     "failing",
+			wantChanged: false,
+			want:        map[string]string{"dns": "failing"},
+		},
+		{
+			subsystem:   "derp",
+			message:     "no home region",
+			wantChanged: true,
+			want:        map[string]string{"dns": "failing", "derp": "no home region"},
+		},
+		{
+			subsystem:   "dns",
+			message:     "still failing",
+			wantChanged: true,
+			want:        map[string]string{"dns": "still failing", "derp": "no home region"},
+		},
+		{
+			subsystem:   "dns",
+			wantChanged: true,
+			want:        map[string]string{"derp": "no home region"},
+		},
+		{
+			subsystem:   "dns",
+			wantChanged: false,
+			want:        map[string]string{"derp": "no home region"},
+		},
+	}
+
+	for i, step := range steps {
+		if got := node.SetHealthWarning(step.subsystem, step.message); got != step.wantChanged {
+			t.Errorf("step %d: SetHealthWarning() = %t, want %t", i, got, step.wantChanged)
+		}
+
+		if diff := cmp.Diff(step.want, node.HealthWarnings); diff != "" {
+			t.Errorf("step %d: unexpected health warnings (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestNodeNATType(t *testing.T) {
+	tests := []struct {
+		name    string
+		netInfo *tailcfg.NetInfo
+		want    string
+	}{
+		{
+			name: "no-netinfo",
+			want: "",
+		},
+		{
+			name:    "not-reported",
+			netInfo: &tailcfg.NetInfo{PreferredDERP: 1},
+			want:    "",
+		},
+		{
+			name: "easy",
+			netInfo: &tailcfg.NetInfo{
+				WorkingUDP:            "true",
+				MappingVariesByDestIP: "false",
+			},
+			want: NATTypeEasy,
+		},
+		{
+			name: "hard",
+			netInfo: &tailcfg.NetInfo{
+				WorkingUDP:            "true",
+				MappingVariesByDestIP: "true",
+			},
+			want: NATTypeHard,
+		},
+		{
+			name: "no-udp",
+			netInfo: &tailcfg.NetInfo{
+				WorkingUDP: "false",
+			},
+			want: NATTypeNoUDP,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &Node{Hostinfo: &tailcfg.Hostinfo{NetInfo: tt.netInfo}}
+			if got := node.NATType(); got != tt.want {
+				t.Errorf("NATType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeProtoHealth(t *testing.T) {
+	node := &Node{
+		Hostinfo: &tailcfg.Hostinfo{
+			NetInfo: &tailcfg.NetInfo{
+				PreferredDERP:         2,
+				WorkingUDP:            "true",
+				MappingVariesByDestIP: "true",
+			},
+		},
+		HealthWarnings: map[string]string{
+			"dns":  "failing",
+			"derp": "no home region",
+		},
+	}
+
+	got := node.Proto()
+	if got.GetPreferredDerp() != 2 {
+		t.Errorf("Proto() preferred DERP = %d, want 2", got.GetPreferredDerp())
+	}
+
+	if got.GetNatType() != NATTypeHard {
+		t.Errorf("Proto() NAT type = %q, want %q", got.GetNatType(), NATTypeHard)
+	}
+
+	want := []*v1.HealthWarning{
+		{Subsystem: "derp", Message: "no home region"},
+		{Subsystem: "dns", Message: "failing"},
+	}
+	if diff := cmp.Diff(want, got.GetHealthWarnings(), cmpopts.IgnoreUnexported(v1.HealthWarning{})); diff != "" {
+		t.Errorf("Proto() unexpected health warnings (-want +got):\n%s", diff)
+	}
+}
@@ -3,18 +3,60 @@ package types
 import (
 	"errors"
 
+	v1 "github.com/juanfont/headscale/gen/go/headscale/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"gorm.io/gorm"
 )
 
 var (
 	ErrPolicyNotFound         = errors.New("acl policy not found")
 	ErrPolicyUpdateIsDisabled = errors.New("update is disabled for modes other than 'database'")
+	ErrPolicyHistoryDisabled  = errors.New("history is only kept in 'database' mode")
+	ErrPolicyChanged          = errors.New("policy was changed")
 )
 
+// PolicyAuthorCLI is recorded as the author of a policy revision when it
+// was not made with an API key, e.g. through the local unix socket.
+const PolicyAuthorCLI = "cli"
+
 // Policy represents a policy in the database.
 type Policy struct {
 	gorm.Model
 
 	// Data contains the policy in HuJSON format.
 	Data string
+
+	// Author is the prefix of the API key used to set the policy,
+	// or PolicyAuthorCLI.
+	Author string
+
+	// Message is an optional description of the change.
+	Message string
+
+	// ParentID is the revision the policy replaced, 0 for the first one.
+	// It is unique, so of two updates based on the same revision only
+	// one can be stored.
+	ParentID uint `gorm:"uniqueIndex"`
+}
+
+func (p *Policy) Proto() *v1.PolicyRevision {
+	return &v1.PolicyRevision{
+		Revision:  uint64(p.ID),
+		Author:    p.Author,
+		Message:   p.Message,
+		CreatedAt: timestamppb.New(p.CreatedAt),
+		Policy:    p.Data,
+	}
+}
+
+const (
+	PolicySectionACLs   = "acls"
+	PolicySectionGrants = "grants"
+)
+
+// PolicyRuleOrigin is the entry of the policy a filter rule was compiled
+// from, e.g. the third ACL is {Section: "acls", Index: 2}.
+type PolicyRuleOrigin struct {
+	Section string
+	Index   int
 }
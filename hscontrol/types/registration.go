@@ -0,0 +1,22 @@
+package types
+
+import "time"
+
+// Registration is an interactive registration waiting for the user to
+// log in. In HA mode it is stored in the database, so the registration
+// can be completed, and the node can wait for it, on any instance.
+type Registration struct {
+	ID        RegistrationID `gorm:"primaryKey"`
+	Node      Node           `gorm:"serializer:json"`
+	ExpiresAt time.Time      `gorm:"index"`
+}
+
+// OIDCRegistration is the interactive registration an OIDC login was
+// started for, by the state of the login. In HA mode it is stored in the
+// database, so the login can end on any instance.
+type OIDCRegistration struct {
+	State          string `gorm:"primaryKey"`
+	RegistrationID RegistrationID
+	Verifier       *string
+	ExpiresAt      time.Time `gorm:"index"`
+}
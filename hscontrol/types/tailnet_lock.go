@@ -0,0 +1,63 @@
+package types
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrTailnetLockNotEnabled     = errors.New("tailnet lock is not enabled")
+	ErrTailnetLockAlreadyEnabled = errors.New("tailnet lock is already enabled")
+)
+
+// TailnetLockAUM is an update message (AUM) of the tailnet key authority
+// (TKA), the state of tailnet lock, as serialized by the nodes.
+type TailnetLockAUM struct {
+	// Hash is the tka.AUMHash of the AUM in text form.
+	Hash string `gorm:"primaryKey"`
+
+	// PrevHash is the hash of the parent AUM, empty for the genesis AUM.
+	PrevHash string `gorm:"index"`
+
+	Data      []byte
+	CreatedAt time.Time
+}
+
+// TailnetLockState is the state of tailnet lock of the tailnet. There is
+// at most one, it does not exist until tailnet lock was first initialised.
+type TailnetLockState struct {
+	ID uint `gorm:"primaryKey"`
+
+	// Enabled is false once tailnet lock was disabled, the AUMs are kept
+	// until it is initialised again.
+	Enabled bool
+
+	// LastActiveAncestor is the oldest AUM of the active chain, where
+	// the nodes start computing the state of the authority.
+	LastActiveAncestor string
+
+	// DisablementSecret is the secret tailnet lock was disabled with,
+	// which the nodes verify before disabling it themselves.
+	DisablementSecret []byte
+
+	UpdatedAt time.Time
+}
+
+// TailnetLockInit is an initialisation of tailnet lock started by a node,
+// waiting for it to sign the node keys of all nodes. There is at most one,
+// it is stored so the node can finish it on any headscale instance in HA
+// mode.
+type TailnetLockInit struct {
+	ID uint `gorm:"primaryKey"`
+
+	// NodeID is the node initialising tailnet lock.
+	NodeID NodeID
+
+	// GenesisAUM is the serialized genesis AUM of the new authority.
+	GenesisAUM []byte
+
+	// Nodes are the nodes which node keys have to be signed.
+	Nodes []NodeID `gorm:"serializer:json"`
+
+	CreatedAt time.Time
+}